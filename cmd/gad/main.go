@@ -3,13 +3,18 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bugmaschine/gad/internal/downloaders"
@@ -17,10 +22,17 @@ import (
 	"github.com/bugmaschine/gad/pkg/chrome"
 	"github.com/bugmaschine/gad/pkg/cli"
 	"github.com/bugmaschine/gad/pkg/dirs"
+	"github.com/bugmaschine/gad/pkg/doctor"
 	"github.com/bugmaschine/gad/pkg/download"
+	"github.com/bugmaschine/gad/pkg/events"
 	"github.com/bugmaschine/gad/pkg/ffmpeg"
+	"github.com/bugmaschine/gad/pkg/httpclient"
 	"github.com/bugmaschine/gad/pkg/logger"
+	"github.com/bugmaschine/gad/pkg/selector"
+	"github.com/bugmaschine/gad/pkg/selfupdate"
 	"github.com/bugmaschine/gad/pkg/utils"
+	"github.com/bugmaschine/gad/pkg/version"
+	"golang.org/x/sync/errgroup"
 )
 
 func main() {
@@ -32,11 +44,44 @@ func main() {
 		os.Exit(1)
 	}
 
+	// help, --version and completions were already handled by cobra
+	if args.Command == "" {
+		os.Exit(0)
+	}
+
+	if args.Command == cli.CommandVersion {
+		printVersion()
+		os.Exit(0)
+	}
+
+	if args.Command == cli.CommandListSites {
+		printSupportedSites()
+		os.Exit(0)
+	}
+
+	if args.Command == cli.CommandSupports {
+		os.Exit(runSupports(args.Url))
+	}
+
 	// Set up logger
-	logger.InitDefaultLogger(args.Debug, args.LogFile)
+	logLevel, err := args.GetLogLevel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	logger.InitDefaultLogger(logLevel, args.LogFile, args.LogTimeFormat, args.LogUTC)
 
 	slog.Info("gad started")
 
+	// an update on Windows leaves the old executable behind, it can only be deleted once it isn't running anymore
+	if exePath, err := selfupdate.Executable(); err == nil {
+		selfupdate.RemoveOld(exePath)
+	}
+
+	if args.Command == cli.CommandUpdate {
+		os.Exit(runSelfUpdate(args))
+	}
+
 	// Create data dir
 	dataDir, err := dirs.GetDataDir()
 	if err != nil {
@@ -44,6 +89,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	if args.Command == cli.CommandRemux {
+		os.Exit(runRemux(args, dataDir))
+	}
+
+	if args.Command == cli.CommandClean {
+		os.Exit(runCleanCache(args, dataDir))
+	}
+
+	if args.Command == cli.CommandProbe {
+		os.Exit(runProbe(args, dataDir))
+	}
+
+	if args.Command == cli.CommandSpeedTest {
+		os.Exit(runSpeedTest(args, dataDir))
+	}
+
 	// Get save directory
 	saveDir, err := dirs.GetSaveDirectory(args.OutputFolder)
 	if err != nil {
@@ -51,8 +112,136 @@ func main() {
 		os.Exit(1)
 	}
 
+	if args.Command == cli.CommandDoctor {
+		os.Exit(runDoctor(args, dataDir, saveDir))
+	}
+
+	tempDir := args.TempDir
+	if tempDir == "" {
+		tempDir = filepath.Join(dataDir, "tmp")
+	}
+
+	if args.Command == cli.CommandConfig {
+		os.Exit(printConfig(args, dataDir, saveDir, tempDir))
+	}
+
+	// fail before scraping for minutes, the first download would run into it anyway
+	for _, dir := range []struct{ name, path string }{{"save", saveDir}, {"data", dataDir}, {"temp", tempDir}} {
+		// stdout isn't a directory
+		if dir.name == "save" && args.ToStdout() {
+			continue
+		}
+		if err := dirs.CheckWritable(dir.path); err != nil {
+			slog.Error("Directory is not writable", "directory", dir.name, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// stdout has no leftovers to search
+	if !args.ToStdout() {
+		cleanLeftovers(saveDir, tempDir, args.Clean)
+	}
+
+	skipMode, err := args.GetSkipMode()
+	if err != nil {
+		slog.Error("Failed to parse skip mode", "error", err)
+		os.Exit(1)
+	}
+
+	quality, err := args.GetQuality()
+	if err != nil {
+		slog.Error("Failed to parse quality", "error", err)
+		os.Exit(1)
+	}
+
+	if args.Watch && (args.QueueFile != "" || args.Extractor != "" || args.Url == "") {
+		slog.Error("--watch needs the URL of a series and can't be used with --queue-file or -u")
+		os.Exit(1)
+	}
+	if args.RetryFile != "" && (args.QueueFile != "" || args.Url != "" || args.Watch) {
+		slog.Error("--retry-file takes the series from the file and can't be used with a URL, --queue-file or --watch")
+		os.Exit(1)
+	}
+	if args.ListEpisodes && (args.Watch || args.Extractor != "" || args.Interactive) {
+		slog.Error("--list-episodes can't be used with --watch, -u or --interactive")
+		os.Exit(1)
+	}
+	if args.Watch && args.Interval <= 0 {
+		slog.Error("--interval has to be positive")
+		os.Exit(1)
+	}
+
+	if args.NoFallback && args.Hoster == "" {
+		slog.Error("--no-fallback needs --hoster")
+		os.Exit(1)
+	}
+	if _, err := args.GetHosterFilter(); err != nil {
+		slog.Error("Failed to parse the hoster filter", "error", err)
+		os.Exit(1)
+	}
+
+	if args.ProgressLogInterval < 0 {
+		slog.Error("--progress-log-interval can't be negative")
+		os.Exit(1)
+	}
+
+	if args.MaxFailures < 0 {
+		slog.Error("--max-failures can't be negative")
+		os.Exit(1)
+	}
+
+	if _, err := args.GetFolderMatch(); err != nil {
+		slog.Error("Failed to parse folder match", "error", err)
+		os.Exit(1)
+	}
+
+	if _, err := args.GetNaming(); err != nil {
+		slog.Error("Failed to parse naming", "error", err)
+		os.Exit(1)
+	}
+
+	if _, err := args.GetAudioFormat(); err != nil {
+		slog.Error("Failed to parse audio format", "error", err)
+		os.Exit(1)
+	}
+	subLangs, subMode, err := args.GetSubtitles()
+	if err != nil {
+		slog.Error("Failed to parse subtitle options", "error", err)
+		os.Exit(1)
+	}
+	if args.NoFfmpeg && subMode == download.SubtitleEmbed && subLangs.Enabled() {
+		slog.Error("--sub-mode embed needs FFmpeg, use --sub-mode external with --no-ffmpeg")
+		os.Exit(1)
+	}
+	if args.NoFfmpeg && (args.AudioOnly || args.FfmpegArgs != "" || args.Verify) {
+		slog.Error("--no-ffmpeg can't be used together with --audio-only, --ffmpeg-args or --verify")
+		os.Exit(1)
+	}
+	if args.ToStdout() && (args.Extractor == "" || args.QueueFile != "" || args.AudioOnly) {
+		slog.Error("-o - only works for a single download with -u and without --audio-only")
+		os.Exit(1)
+	}
+
+	maxSize, err := args.GetMaxSize()
+	if err != nil {
+		slog.Error("Failed to parse maximum size", "error", err)
+		os.Exit(1)
+	}
+
+	maxTotalSize, err := args.GetMaxTotalSize()
+	if err != nil {
+		slog.Error("Failed to parse maximum total size", "error", err)
+		os.Exit(1)
+	}
+
+	ffmpegArgs, err := ffmpeg.ParseArgs(args.FfmpegArgs)
+	if err != nil {
+		slog.Error("Failed to parse FFmpeg arguments", "error", err)
+		os.Exit(1)
+	}
+
 	// Context with signal handling
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, stop := interruptContext()
 	defer stop()
 
 	// Rate limit parsing
@@ -62,31 +251,199 @@ func main() {
 		os.Exit(1)
 	}
 
+	var rateSchedule *download.RateSchedule
+	if args.RateSchedule != "" {
+		if rateLimit > 0 {
+			slog.Error("--rate and --rate-schedule can't be used together")
+			os.Exit(1)
+		}
+		rateSchedule, err = cli.ParseRateSchedule(args.RateSchedule)
+		if err != nil {
+			slog.Error("Failed to parse rate schedule", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	dataCap, capped, err := args.GetDataCap()
+	if err != nil {
+		slog.Error("Failed to parse --cap-after", "error", err)
+		os.Exit(1)
+	}
+	if capped && (rateLimit > 0 || rateSchedule != nil) {
+		slog.Error("--cap-after can't be used together with --rate or --rate-schedule")
+		os.Exit(1)
+	}
+
+	scrapeProxy, downloadProxy, err := args.GetProxies()
+	if err != nil {
+		slog.Error("Failed to parse proxy", "error", err)
+		os.Exit(1)
+	}
+	chromeFlags, err := args.GetChromeFlags()
+	if err != nil {
+		slog.Error("Failed to parse --chrome-flag", "error", err)
+		os.Exit(1)
+	}
+	locale, timezone, err := args.GetLocale()
+	if err != nil {
+		slog.Error("Failed to parse --locale or --timezone", "error", err)
+		os.Exit(1)
+	}
+
+	// one client for everything, so connections get reused between extractors and downloads
+	httpConfig := args.GetHTTPConfig()
+	if args.Simulate != "" {
+		httpConfig.Simulation, err = cli.ParseSimulation(args.Simulate)
+		if err != nil {
+			slog.Error("Failed to parse --simulate", "error", err)
+			os.Exit(1)
+		}
+		slog.Warn("Simulating a bad network, requests are slowed down and fail on purpose", "simulation", args.Simulate)
+	}
+	httpConfig.Proxy = scrapeProxy
+	httpclient.SetDefault(httpclient.New(httpConfig))
+
 	// Downloader for assets (FFmpeg, uBlock)
-	assetDownloader := download.NewDownloader("gad/1.0", args.Debug, rateLimit)
+	assetDownloader := download.NewDownloader(args.UserAgent, args.Debug, rateLimit)
+	// with a proxy for either side the downloads get their own client
+	if scrapeProxy != nil || downloadProxy != nil {
+		downloadConfig := httpConfig
+		downloadConfig.Proxy = downloadProxy
+		assetDownloader.SetHTTPClient(httpclient.New(downloadConfig))
+	}
+	if args.ToStdout() {
+		// stdout only gets the video
+		assetDownloader.SetProgressOutput(os.Stderr)
+	}
+	assetDownloader.SetQuality(quality)
+	assetDownloader.SetMaxDuration(args.MaxDuration)
+	assetDownloader.SetMaxSize(maxSize)
+	assetDownloader.SetTempDir(tempDir)
+	assetDownloader.SetKeepSegments(args.KeepSegments)
+	assetDownloader.SetSegmentRetries(args.SegmentRetries)
+	assetDownloader.SetProgressLogInterval(args.ProgressLogInterval)
+	assetDownloader.SetFfmpegArgs(ffmpegArgs)
+	assetDownloader.SetFfmpegConcurrency(args.FfmpegConcurrency, args.FfmpegHwConcurrency)
+	assetDownloader.SetFaststart(args.Faststart)
+	assetDownloader.SetNoSeekOutput(args.NoSeekOutput)
+	assetDownloader.SetSubtitles(subLangs, subMode)
+	if args.Dedupe {
+		// the whole save directory, so identical episodes are found across series
+		assetDownloader.SetDeduplicator(download.NewDeduplicator(saveDir))
+	}
+	assetDownloader.HandlePauseSignals(ctx)
+	if rateSchedule != nil {
+		assetDownloader.SetRateSchedule(ctx, rateSchedule)
+	}
+	if capped {
+		assetDownloader.SetDataCap(ctx, dataCap)
+	}
 
 	// Create FFmpeg manager
 	ff := ffmpeg.New(dataDir)
 
-	// Auto-download FFmpeg
-	slog.Info("Checking for FFmpeg...")
-	ffmpegPath, err := ff.AutoDownload(ctx, assetDownloader)
-	if err != nil {
-		slog.Error("Failed to manage FFmpeg", "error", err)
+	// Chrome management
+	chromeMgr := chrome.NewManager(dataDir, assetDownloader).
+		SetUserAgent(args.UserAgent).
+		SetRequireUblock(args.RequireUblock).
+		SetProxy(scrapeProxy).
+		SetFlags(chromeFlags).
+		SetLocale(locale, timezone)
+	if path := args.GetTracePath(dataDir); path != "" {
+		slog.Info("Recording the browser traffic", "path", path, "secrets", args.TraceHTTPSecrets)
+		chromeMgr.SetHarRecorder(chrome.NewHarRecorder(path, args.TraceHTTPSecrets))
+	}
+
+	// FFmpeg and the browser are independent downloads, so they get prepared at the same time.
+	// Both go through assetDownloader, which keeps them within the rate limit together.
+	prepare, prepareCtx := errgroup.WithContext(ctx)
+	var ffmpegPath, ffprobePath string
+	// listing the episodes doesn't need FFmpeg
+	prepare.Go(func() error {
+		if args.ListEpisodes || args.NoFfmpeg {
+			return nil
+		}
+		slog.Info("Checking for FFmpeg...")
+		path, err := ff.AutoDownload(prepareCtx, assetDownloader)
+		if err != nil && prepareCtx.Err() != nil {
+			return err
+		}
+		// direct files don't need FFmpeg, the downloads that do fail on their own
+		if err != nil {
+			slog.Warn("FFmpeg is not available, continuing without it. Direct files download as usual, HLS streams are kept as .ts and downloads that have to be muxed fail", "error", err)
+		}
+		ffmpegPath = path
+		if path != "" && args.Verify {
+			if ffprobePath, err = ff.AutoDownloadFfprobe(prepareCtx, assetDownloader); err != nil {
+				if prepareCtx.Err() != nil {
+					return err
+				}
+				slog.Warn("ffprobe is not available, the muxed episodes aren't verified", "error", err)
+			}
+		}
+		return nil
+	})
+	// single downloads with -u don't need the browser
+	if args.Extractor == "" {
+		prepare.Go(func() error {
+			return chromeMgr.Prepare(prepareCtx)
+		})
+	}
+	if err := prepare.Wait(); err != nil {
+		slog.Error("Failed to prepare dependencies", "error", err)
 		os.Exit(1)
 	}
-	slog.Info("Using FFmpeg at", "path", ffmpegPath)
-	assetDownloader.SetFfmpegPath(ffmpegPath)
+	switch {
+	case args.NoFfmpeg:
+		slog.Info("FFmpeg is disabled, keeping the raw streams")
+		assetDownloader.DisableFfmpeg()
+	case ffmpegPath != "":
+		slog.Info("Using FFmpeg at", "path", ffmpegPath)
+		assetDownloader.SetFfmpegPath(ffmpegPath)
+		assetDownloader.SetVerify(ffprobePath)
+	}
 
-	// Chrome management
-	chromeMgr := chrome.NewManager(dataDir, assetDownloader)
+	// runs after all other deferred calls, so the event socket is removed before exiting
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	shared := session{failures: download.NewFailurePolicy(args.ContinueOnError, args.MaxFailures), partial: &atomic.Int32{}}
+	// set if a series failed to load, failed episodes only count with --strict-exit
+	fatal := false
+	defer func() {
+		gaveUp := !finishFailures(args, shared.failures)
+		failed := len(shared.failures.Failed()) + int(shared.partial.Load())
+		exitCode = args.ExitCode(fatal || gaveUp, failed)
+		if exitCode == cli.ExitFailures {
+			slog.Warn("Some episodes failed or were left out, exiting with status 2 because of --strict-exit", "failed", failed)
+		}
+	}()
+	// created after FFmpeg and the browser are prepared, only the episodes count towards --max-total-size
+	if maxTotalSize > 0 {
+		shared.budget = download.NewSizeBudget(assetDownloader, maxTotalSize)
+	}
+	if args.EventSocket != "" {
+		eventServer, err := events.Listen(args.EventSocket)
+		if err != nil {
+			slog.Error("Failed to create event socket", "error", err)
+			os.Exit(1)
+		}
+		defer eventServer.Close()
+		shared.events = eventServer
+		slog.Info("Publishing events", "socket", args.EventSocket)
+	}
 
 	if args.QueueFile != "" {
 		slog.Debug("Queue file specified", "file", args.QueueFile)
 		queueFile, err := os.Open(args.QueueFile)
 		if err != nil {
 			slog.Error("Failed to open queue file", "error", err)
-			os.Exit(1)
+			fatal = true
+			return
 		}
 		defer queueFile.Close()
 
@@ -111,23 +468,59 @@ func main() {
 			}
 
 			// as queue is meant for keeping a library up to date, skip existing is forced to be on.
-			args.SkipExisting = true
+			if !skipMode.Skips() {
+				args.SkipExisting = downloaders.SkipModeByName.String()
+			}
 			// For simplicity, we just set the URL and call the handler for each line.
 			args.Url = line
 			slog.Info("Processing URL from queue", "url", args.Url)
 			// I know that this could be better, but realistically people are only going to use queue with a whole series.
 			// and the download bar might not show all downloads, but who cares? i mean, i'll just have a cron job run it
-			if err := handleSeriesDownload(ctx, args, assetDownloader, chromeMgr, saveDir); err != nil {
+			if err := handleSeriesDownload(ctx, args, assetDownloader, chromeMgr, shared, saveDir); err != nil && ctx.Err() == nil {
 				slog.Error("Failed to handle series download from queue", "error", err, "url", args.Url)
+				fatal = true
+			}
+			if shared.failures.GaveUp() || ctx.Err() != nil {
+				break
 			}
 		}
 		if err := scanner.Err(); err != nil {
 			slog.Error("Error reading queue file", "error", err)
-			os.Exit(1)
+			fatal = true
 		}
 
 		slog.Info("Finished processing queue file")
-		os.Exit(0)
+		// return instead of os.Exit, the event socket has to be removed
+		return
+	}
+
+	if args.RetryFile != "" {
+		failed, err := download.ReadFailSummary(args.RetryFile)
+		if err != nil {
+			slog.Error("Failed to read the retry file", "error", err)
+			fatal = true
+			return
+		}
+		groups := download.GroupFailures(failed)
+		slog.Info("Retrying the failed episodes", "file", args.RetryFile, "episodes", len(failed), "series", len(groups))
+		for _, group := range groups {
+			retry := shared
+			retry.episodes = group.Includes
+			// files of older versions don't know the save directory of the series
+			dir := group.Dir
+			if dir == "" {
+				dir = saveDir
+			}
+			slog.Info("Retrying series", "url", group.Url, "language", group.Language, "episodes", len(group.Episodes), "directory", dir)
+			if err := handleSeriesDownload(ctx, args.RetryArgs(group), assetDownloader, chromeMgr, retry, dir); err != nil && ctx.Err() == nil {
+				slog.Error("Failed to retry series", "error", err, "url", group.Url)
+				fatal = true
+			}
+			if shared.failures.GaveUp() || ctx.Err() != nil {
+				break
+			}
+		}
+		return
 	}
 
 	// Main work
@@ -136,159 +529,1065 @@ func main() {
 			slog.Debug("Single download", "url", args.Url, "extractor", args.Extractor)
 			if err := handleSingleDownload(ctx, args, assetDownloader, chromeMgr, saveDir); err != nil {
 				slog.Error("Failed to handle single download", "error", err)
-				os.Exit(1)
+				fatal = true
 			}
-			os.Exit(0)
+		} else if args.Watch {
+			watchSeries(ctx, args, assetDownloader, chromeMgr, shared, saveDir)
 		} else {
 			slog.Debug("Series download", "url", args.Url)
-			if err := handleSeriesDownload(ctx, args, assetDownloader, chromeMgr, saveDir); err != nil {
+			if err := handleSeriesDownload(ctx, args, assetDownloader, chromeMgr, shared, saveDir); err != nil && ctx.Err() == nil {
 				slog.Error("Failed to handle series download", "error", err)
+				fatal = true
 			}
 		}
 	} else {
 		slog.Error("Please specify a URL")
-		os.Exit(1)
+		fatal = true
 	}
 }
 
-func handleSeriesDownload(ctx context.Context, args *cli.Args, d *download.Downloader, cm *chrome.ChromeManager, saveDir string) (err error) {
-	dl, err := downloaders.GetDownloader(args.Url)
+// interruptContext is canceled by the first Ctrl+C, so the running downloads stop, clean up and the summary gets printed.
+// A second Ctrl+C exits immediately, e.g. if closing the browser hangs.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		slog.Warn("Stopping, press Ctrl+C again to exit immediately")
+		cancel()
+		<-signals
+		os.Exit(130)
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// cleanLeftovers reports the leftovers of crashed runs in the save and temp directory and deletes them with --clean.
+func cleanLeftovers(saveDir, tempDir string, clean bool) {
+	leftovers, err := download.FindLeftovers(saveDir)
 	if err != nil {
-		slog.Error("Failed to get downloader", "error", err)
-		return err
+		slog.Warn("Failed to search for leftovers of interrupted downloads", "error", err)
+		return
+	}
+	tempLeftovers, err := download.FindTempLeftovers(tempDir)
+	if err != nil {
+		slog.Warn("Failed to search for leftovers of interrupted downloads", "error", err)
+		return
 	}
-	if dl == nil {
-		slog.Error("No downloader supports this URL. Maybe use -e to specify an extractor for a single file?")
-		return fmt.Errorf("no downloader supports this URL")
+	leftovers = append(leftovers, tempLeftovers...)
+	if len(leftovers) == 0 {
+		return
 	}
 
-	// Browser session for scraping
-	scrapeCtx, cancel, err := cm.Get(ctx, !args.Browser, args.Debug)
-	if err != nil {
-		slog.Error("Failed to start browser", "error", err)
-		return err
+	var size int64
+	for _, l := range leftovers {
+		slog.Debug("Found leftover", "path", l.Path, "size", l.Size)
+		size += l.Size
+	}
+	if !clean {
+		slog.Warn("Found leftovers of interrupted downloads, use --clean to delete them", "count", len(leftovers), "size", download.FormatSize(size))
+		return
 	}
-	defer cancel()
 
-	slog.Info("Fetching series info...")
-	info, err := dl.GetSeriesInfo(scrapeCtx)
+	freed, err := download.RemoveLeftovers(leftovers)
 	if err != nil {
-		slog.Error("Failed to get series info", "error", err)
-		return err
+		slog.Warn("Failed to delete leftovers", "error", err)
 	}
-	slog.Info("Series", "title", info.Title)
+	slog.Info("Deleted leftovers of interrupted downloads", "count", len(leftovers), "reclaimed", download.FormatSize(freed))
+}
 
-	// maybe make this an option, idk.
-	if args.QueueFile != "" {
-		slog.Debug("Queue file there, doing special stuff")
-		folderName := utils.CleanFolderName(info.Title)
-		saveDir = filepath.Join(saveDir, folderName)
-		slog.Info("Saving to", "directory", saveDir)
+// runDoctor prints the environment checks and returns the exit code, 1 if any check failed.
+func runDoctor(args *cli.Args, dataDir, saveDir string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-		if err := os.MkdirAll(saveDir, 0755); err != nil {
-			slog.Error("Failed to create save directory", "error", err, "path", saveDir)
-			return err
-		}
+	assetDownloader := download.NewDownloader(args.UserAgent, args.Debug, 0)
+	report := doctor.Run(ctx, doctor.Options{
+		DataDir:    dataDir,
+		SaveDir:    saveDir,
+		Downloader: assetDownloader,
+		Chrome:     chrome.NewManager(dataDir, assetDownloader).SetUserAgent(args.UserAgent),
+		Headless:   !args.Browser,
+	})
 
+	fmt.Println()
+	report.Print(os.Stdout)
+	if !report.Passed() {
+		return 1
 	}
+	return 0
+}
 
-	manager := download.NewDownloadManager(d, args.ConcurrentDownloads, saveDir, *info, args.SkipExisting)
-	taskChan := make(chan *downloaders.DownloadTaskWrapper, 50)
-
-	// Start manager in background
-	var wg sync.WaitGroup
-	wg.Add(1)
-	var managerErr error
-
-	go func() {
-		defer wg.Done()
-		managerErr = manager.ProgressDownloads(ctx)
-	}()
+// runCleanCache deletes the caches picked by the flags of clean-cache and returns the exit code, 1 if any of them
+// couldn't be deleted. Only files gad downloaded into the data directory and browser profiles are touched.
+func runCleanCache(args *cli.Args, dataDir string) int {
+	chromeMgr := chrome.NewManager(dataDir, nil)
+	caches := []struct {
+		name    string
+		enabled bool
+		root    string
+		paths   func() ([]string, error)
+	}{
+		{"uBlock Origin", args.CleanUblock, dataDir, func() ([]string, error) { return chromeMgr.UblockCache(), nil }},
+		{"FFmpeg", args.CleanFfmpeg, dataDir, func() ([]string, error) { return ffmpeg.New(dataDir).Cache(), nil }},
+		{"Chromium", args.CleanChromium, dataDir, func() ([]string, error) { return chromeMgr.ChromiumCache(), nil }},
+		{"browser profiles", args.CleanProfile, os.TempDir(), chrome.ProfileCache},
+	}
 
-	// Feed tasks from downloader to manager
-	go func() {
-		for tw := range taskChan {
-			manager.Submit(download.ManagerTask{
-				DownloadUrl: tw.Url,
-				Referer:     tw.Referer,
-				VideoType:   tw.Lang,
-				EpisodeInfo: tw.Episode,
-			})
+	exitCode := 0
+	var total int64
+	for _, cache := range caches {
+		if !cache.enabled {
+			continue
 		}
-		manager.Close()
-	}()
-
-	defer func() {
-		close(taskChan)
-		wg.Wait()
-	}()
+		paths, err := cache.paths()
+		var reclaimed int64
+		if err == nil {
+			reclaimed, err = dirs.RemoveCache(cache.root, paths)
+		}
+		total += reclaimed
+		if err != nil {
+			slog.Error("Failed to clean "+cache.name, "error", err)
+			exitCode = 1
+			continue
+		}
+		slog.Info("Cleaned "+cache.name, "reclaimed", download.FormatSize(reclaimed))
+	}
+	slog.Info("Done, the caches are downloaded again on the next run", "reclaimed", download.FormatSize(total))
+	return exitCode
+}
 
-	seriesNameForCache := download.PrepareSeriesNameForFile(info.Title)
-	cache, _ := download.NewDirectoryCache(saveDir)
+// runRemux remuxes every .ts file of the given paths and returns the exit code, 1 if any file failed.
+func runRemux(args *cli.Args, dataDir string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	settings := downloaders.DownloadSettings{
-		SkipExisting: args.SkipExisting,
-		CheckIfExists: func(season, episode, maxEpisodes uint32, videoType *downloaders.VideoType) bool {
-			if !args.SkipExisting || cache == nil {
-				return false
-			}
+	ffmpegArgs, err := ffmpeg.ParseArgs(args.FfmpegArgs)
+	if err != nil {
+		slog.Error("Failed to parse FFmpeg arguments", "error", err)
+		return 1
+	}
 
-			// If videoType is nil, check by prefix using a dummy videoType and trimming it
-			if videoType == nil {
-				epInfo := downloaders.EpisodeInfo{Season: season, Episode: episode, MaxEpisodes: maxEpisodes}
-				// We build the name with no videoType and no title for a clean prefix
-				prefix := download.GetEpisodeName(seriesNameForCache, nil, &epInfo, false)
-				return cache.HasPrefix(prefix)
-			}
+	var sources []string
+	for _, path := range args.RemuxPaths {
+		found, err := ffmpeg.FindRemuxSources(path)
+		if err != nil {
+			slog.Error("Failed to find files to remux", "path", path, "error", err)
+			return 1
+		}
+		sources = append(sources, found...)
+	}
+	if len(sources) == 0 {
+		slog.Info("No .ts files found")
+		return 0
+	}
 
-			epInfo := downloaders.EpisodeInfo{Season: season, Episode: episode, MaxEpisodes: maxEpisodes}
-			outputName := download.GetEpisodeName(seriesNameForCache, videoType, &epInfo, false)
-			return cache.CheckIfEpisodeExists(outputName)
-		},
+	// only downloads FFmpeg if it isn't there yet
+	ffmpegPath, err := ffmpeg.New(dataDir).AutoDownload(ctx, download.NewDownloader(httpclient.DefaultUserAgent, args.Debug, 0))
+	if err != nil {
+		slog.Error("Failed to manage FFmpeg", "error", err)
+		return 1
+	}
+
+	failed := 0
+	for _, src := range sources {
+		dst, err := ffmpeg.Remux(ctx, ffmpegPath, src, ffmpeg.RemuxOptions{
+			Format:       args.RemuxFormat,
+			DeleteSource: args.DeleteSource,
+			Faststart:    args.Faststart,
+			NoSeek:       args.NoSeekOutput,
+			ExtraArgs:    ffmpegArgs,
+		})
+		switch {
+		case errors.Is(err, ffmpeg.ErrTargetExists):
+			slog.Info("Skipping, already remuxed", "file", src, "target", dst)
+		case err != nil:
+			slog.Error("Failed to remux", "file", src, "error", err)
+			failed++
+		default:
+			slog.Info("Remuxed", "file", src, "target", dst)
+		}
+		if ctx.Err() != nil {
+			return 1
+		}
+	}
+
+	slog.Info("Remux finished", "files", len(sources), "failed", failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printSupportedSites() {
+	fmt.Println("Sites (series, seasons and episodes):")
+	for _, site := range downloaders.SupportedSites() {
+		fmt.Printf("  %s: %s (%s)\n", site.Name, strings.Join(site.Domains, ", "), strings.Join(site.Capabilities(), ", "))
+		for _, example := range site.Examples {
+			fmt.Printf("    %s\n", example)
+		}
+	}
+	fmt.Println("Hosters (single videos with -u, --extractor picks one by name):")
+	for _, e := range extractors.GetExtractors() {
+		fmt.Printf("  %s\n", strings.Join(e.Names(), ", "))
+	}
+}
+
+// runSelfUpdate replaces the running executable with the latest release, or only reports it with --check-only.
+func runSelfUpdate(args *cli.Args) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	current := version.Get().Version
+	release, err := selfupdate.Latest(ctx, selfupdate.GithubAPIURL)
+	if err != nil {
+		slog.Error("Failed to check for updates", "error", err)
+		return 1
+	}
+	newer := selfupdate.IsNewer(release.Version, current)
+
+	if args.CheckOnly {
+		switch {
+		case newer:
+			fmt.Printf("gad %s is available, this is %s. Run \"gad self-update\" to install it.\n", release.Version, current)
+		case current == "dev":
+			fmt.Printf("This is a development build, the latest release is %s.\n", release.Version)
+		default:
+			fmt.Printf("gad %s is up to date.\n", current)
+		}
+		return 0
+	}
+
+	if !newer && !args.ForceUpdate {
+		if current == "dev" {
+			slog.Error("This is a development build, use --force to replace it with the latest release", "latest", release.Version)
+			return 1
+		}
+		slog.Info("gad is up to date", "version", current)
+		return 0
+	}
+
+	exePath, err := selfupdate.Executable()
+	if err != nil {
+		slog.Error("Failed to find the executable", "error", err)
+		return 1
+	}
+	// e.g. installed by a package manager into a system directory, it should be updated the same way
+	if err := dirs.CheckWritable(filepath.Dir(exePath)); err != nil {
+		slog.Error("Can't replace the executable, update gad the way it was installed", "path", exePath, "error", err)
+		return 1
+	}
+
+	slog.Info("Updating gad", "from", current, "to", release.Version, "path", exePath)
+	if err := selfupdate.Install(ctx, download.NewDownloader(httpclient.DefaultUserAgent, args.Debug, 0), release, exePath); err != nil {
+		slog.Error("Failed to update gad", "error", err)
+		return 1
+	}
+	slog.Info("Updated gad", "version", release.Version)
+	return 0
+}
+
+// runSupports prints whether url is a series of a supported site or a hoster page for -u, it fails otherwise.
+func runSupports(url string) int {
+	_, ok, reason := downloaders.Match(url)
+	if ok {
+		fmt.Printf("Supported: %s\n", reason)
+		return 0
+	}
+	if name := hosterOf(url); name != "" {
+		fmt.Printf("Supported with -u: a video of the hoster %s\n", name)
+		return 0
+	}
+	fmt.Printf("Not supported: %s\n", reason)
+	return 1
+}
+
+// hosterOf returns the name of the extractor supporting url, or an empty string.
+func hosterOf(url string) string {
+	for _, e := range extractors.GetExtractors() {
+		if e.SupportsUrl(url) {
+			return e.Names()[0]
+		}
+	}
+	return ""
+}
+
+// configEnvironment are the variables that change how gad behaves, they are printed by --print-config if set.
+var configEnvironment = []string{"GITHUB_TOKEN", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "ALL_PROXY", "http_proxy", "https_proxy", "no_proxy", "all_proxy"}
+
+type printedConfig struct {
+	Version     string                 `json:"version"`
+	Url         string                 `json:"url,omitempty"`
+	Paths       printedPaths           `json:"paths"`
+	Environment map[string]string      `json:"environment,omitempty"`
+	Flags       map[string]cli.Setting `json:"flags"`
+}
+
+type printedPaths struct {
+	DataDir  string `json:"data_dir"`
+	SaveDir  string `json:"save_dir"`
+	TempDir  string `json:"temp_dir"`
+	LogFile  string `json:"log_file,omitempty"`
+	Ffmpeg   string `json:"ffmpeg"`
+	Chromium string `json:"chromium"`
+}
+
+// printConfig writes the effective settings with the resolved paths as JSON to stdout, without downloading anything.
+func printConfig(args *cli.Args, dataDir, saveDir, tempDir string) int {
+	// relative paths depend on where gad was started, which a bug report doesn't show
+	if abs, err := filepath.Abs(saveDir); err == nil {
+		saveDir = abs
+	}
+	if abs, err := filepath.Abs(tempDir); err == nil {
+		tempDir = abs
+	}
+
+	config := printedConfig{
+		Version: version.Get().Version,
+		Url:     cli.Redact("url", args.Url),
+		Paths: printedPaths{
+			DataDir:  dataDir,
+			SaveDir:  saveDir,
+			TempDir:  tempDir,
+			LogFile:  args.LogFile,
+			Ffmpeg:   "not installed, will be downloaded on first run",
+			Chromium: "not installed, will be downloaded on first run",
+		},
+		Environment: make(map[string]string),
+		Flags:       args.Settings,
+	}
+	if path, err := ffmpeg.New(dataDir).GetFfmpegPath(); err == nil {
+		config.Paths.Ffmpeg = path
+	}
+	if path := chrome.NewManager(dataDir, nil).InstalledChromiumPath(); path != "" {
+		config.Paths.Chromium = path
+	}
+	for _, name := range configEnvironment {
+		if value, ok := os.LookupEnv(name); ok {
+			config.Environment[name] = cli.Redact(name, value)
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(config); err != nil {
+		slog.Error("Failed to print the configuration", "error", err)
+		return 1
+	}
+	return 0
+}
+
+func printVersion() {
+	info := version.Get()
+	fmt.Println(info)
+
+	ffmpegVersion := "not installed, will be downloaded on first run"
+	uBlockVersion := "not installed, will be downloaded on first run"
+	if dataDir, err := dirs.GetDataDir(); err == nil {
+		if path, err := ffmpeg.New(dataDir).GetFfmpegPath(); err == nil {
+			if v, err := ffmpeg.Version(path); err == nil {
+				ffmpegVersion = fmt.Sprintf("%s (%s)", v, path)
+			} else {
+				ffmpegVersion = fmt.Sprintf("unknown (%s)", path)
+			}
+		}
+		if v := chrome.NewManager(dataDir, nil).InstalledUblockVersion(); v != "" {
+			uBlockVersion = v
+		}
+	}
+
+	fmt.Printf("FFmpeg:   %s\n", ffmpegVersion)
+	fmt.Printf("          source: %s\n", ffmpeg.DownloadSource())
+	fmt.Printf("uBlock:   %s\n", uBlockVersion)
+	fmt.Printf("          fallback: %s\n", chrome.UblockFallbackVersion)
+}
+
+// watchSeries downloads the episodes of args.Url that are missing every --interval until the context is canceled.
+// A failed check is logged and retried with the next one.
+func watchSeries(ctx context.Context, args *cli.Args, d *download.Downloader, cm *chrome.ChromeManager, shared session, saveDir string) {
+	// only new episodes, the finished ones are found through the series state and the save directory
+	if skipMode, _ := args.GetSkipMode(); !skipMode.Skips() {
+		args.SkipExisting = downloaders.SkipModeByName.String()
+	}
+	grabbed := &grabLogger{next: shared.events}
+	shared.events = grabbed
+
+	for {
+		slog.Info("Checking for new episodes", "url", args.Url)
+		grabbed.count.Store(0)
+		if err := handleSeriesDownload(ctx, args, d, cm, shared, saveDir); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to check for new episodes", "error", err)
+		}
+		if shared.failures.GaveUp() {
+			slog.Info("Stopped watching")
+			return
+		}
+		if grabbed.count.Load() == 0 && ctx.Err() == nil {
+			slog.Info("No new episodes")
+		}
+
+		next := time.NewTimer(args.Interval)
+		slog.Info("Waiting for the next check", "at", time.Now().Add(args.Interval).Format(time.DateTime))
+		select {
+		case <-ctx.Done():
+			next.Stop()
+			slog.Info("Stopped watching")
+			return
+		case <-next.C:
+		}
+	}
+}
+
+// grabLogger logs every episode a watch run downloaded and passes all events on.
+type grabLogger struct {
+	next  events.Publisher
+	count atomic.Int32
+}
+
+func (g *grabLogger) Publish(e events.Event) {
+	if e.Type == events.TypeTaskCompleted {
+		g.count.Add(1)
+		slog.Info("Grabbed new episode", "file", e.Task.File)
+	}
+	if g.next != nil {
+		g.next.Publish(e)
+	}
+}
+
+// session holds what every series of a run shares.
+type session struct {
+	budget *download.SizeBudget
+	// events is nil without --event-socket
+	events events.Publisher
+	// failures counts the failed downloads of the whole run
+	failures *download.FailurePolicy
+	// partial counts the scrapes that left out seasons or episodes
+	partial *atomic.Int32
+	// episodes limits a series to the failed episodes of --retry-file, nil keeps all
+	episodes func(season, episode uint32) bool
+}
+
+func handleSeriesDownload(ctx context.Context, args *cli.Args, d *download.Downloader, cm *chrome.ChromeManager, shared session, saveDir string) (err error) {
+	dl, err := downloaders.GetDownloader(args.Url)
+	if errors.Is(err, downloaders.ErrUnsupportedSite) {
+		if name := hosterOf(args.Url); name != "" {
+			slog.Error("This is a video of a hoster, not a series. Use -u to download it", "hoster", name)
+		} else {
+			slog.Error("No downloader supports this URL, gad list-extractors shows the supported sites", "error", err)
+		}
+		return err
+	}
+	if err != nil {
+		slog.Error("Failed to get downloader", "error", err)
+		return err
+	}
+
+	// Browser session for scraping
+	scrapeCtx, cancel, err := cm.Get(ctx, !args.Browser, args.Debug)
+	if err != nil {
+		slog.Error("Failed to start browser", "error", err)
+		return err
+	}
+	defer cancel()
+
+	slog.Info("Fetching series info...")
+	info, err := downloaders.GetSeriesInfoWithRetry(scrapeCtx, dl, args.InfoRetries)
+	if err != nil {
+		slog.Error("Failed to get series info", "error", err)
+		return err
+	}
+	slog.Info("Series", "title", info.Title)
+
+	// maybe make this an option, idk.
+	if args.QueueFile != "" {
+		slog.Debug("Queue file there, doing special stuff")
+		folderName := utils.CleanFolderName(info.Title)
+		folderMatch, err := args.GetFolderMatch()
+		if err != nil {
+			return err
+		}
+		// reuse the folder of earlier runs, even if the site changed the title a bit since
+		if existing, score, err := folderMatch.FindSeriesFolder(saveDir, info.Title); err != nil {
+			slog.Warn("Failed to look for an existing series folder", "error", err)
+		} else if existing != "" && existing != folderName {
+			slog.Info("Using existing series folder", "folder", existing, "strategy", folderMatch.Strategy, "score", fmt.Sprintf("%.2f", score))
+			folderName = existing
+		}
+		saveDir = filepath.Join(saveDir, folderName)
+		slog.Info("Saving to", "directory", saveDir)
+
+		if err := os.MkdirAll(saveDir, 0755); err != nil {
+			slog.Error("Failed to create save directory", "error", err, "path", saveDir)
+			return err
+		}
+
+	}
+
+	skipMode, err := args.GetSkipMode()
+	if err != nil {
+		return err
+	}
+	quality, err := args.GetQuality()
+	if err != nil {
+		return err
+	}
+	languages, multiLanguage, err := args.GetLanguages()
+	if err != nil {
+		return err
+	}
+	audioFormat, err := args.GetAudioFormat()
+	if err != nil {
+		return err
+	}
+	if multiLanguage && audioFormat != "" {
+		return fmt.Errorf("--audio-only can't be used with multiple languages")
+	}
+	if multiLanguage && args.NoFfmpeg {
+		return fmt.Errorf("--no-ffmpeg can't be used with multiple languages, they have to be muxed")
+	}
+	naming, err := args.GetNaming()
+	if err != nil {
+		return err
+	}
+	folderTemplate := naming.FolderTemplate(args.FolderTemplate)
+	if args.IncludeSpecials && folderTemplate == "" {
+		folderTemplate = download.SpecialsTemplate
+	}
+
+	state, err := download.LoadSeriesState(saveDir)
+	if err != nil {
+		slog.Error("Failed to read series state", "error", err)
+		return err
+	}
+	state.Series = info.Title
+
+	seriesNameForCache := download.PrepareSeriesNameForFile(info.Title)
+	cache, _ := download.NewDirectoryCache(saveDir, skipMode)
+	if cache != nil {
+		cache.SetState(state)
+	}
+
+	episodeExists := func(cache *download.DirectoryCache, epInfo downloaders.EpisodeInfo, videoType *downloaders.VideoType) bool {
+		if cache == nil {
+			return false
+		}
+
+		episodeDir := download.GetEpisodeDirectory(folderTemplate, info.Title, &epInfo)
+
+		// If videoType is nil, check by prefix using a dummy videoType and trimming it.
+		// The media server presets have no language in the name and the title isn't known yet, they always check by prefix.
+		if videoType == nil || !naming.HasLanguage() {
+			// We build the name with no videoType and no title for a clean prefix
+			prefix := naming.Prefix(seriesNameForCache, &epInfo)
+			return cache.HasPrefix(filepath.Join(episodeDir, prefix))
+		}
+
+		outputName := naming.EpisodeName(seriesNameForCache, videoType, &epInfo)
+		return cache.CheckIfEpisodeExists(filepath.Join(episodeDir, outputName))
+	}
+
+	settings := downloaders.DownloadSettings{
+		SkipExisting:       skipMode,
+		UserAgent:          args.UserAgent,
+		Quality:            quality,
+		ExtractAttempts:    args.ExtractAttempts,
+		BrowserFallback:    args.BrowserFallback,
+		Strict:             args.Strict,
+		IncludeSpecials:    args.IncludeSpecials,
+		NavRetries:         args.NavRetries,
+		ResolveConcurrency: args.ResolveConcurrency,
+		CheckIfExists: func(season, episode, maxEpisodes uint32, videoType *downloaders.VideoType) bool {
+			// the state still finds finished episodes after the folder template changed
+			if skipMode.Skips() && videoType != nil && state.IsComplete(saveDir, season, episode, videoType.String()) {
+				return true
+			}
+			epInfo := downloaders.EpisodeInfo{Season: season, Episode: episode, MaxEpisodes: maxEpisodes}
+			return episodeExists(cache, epInfo, videoType)
+		},
+		PreferredHoster: state.PreferredHoster,
+		Hoster:          args.Hoster,
+		NoFallback:      args.NoFallback,
+		// checked by GetHosterFilter at the start
+		Hosters: downloaders.HosterFilter{Only: args.OnlyHosters, Exclude: args.ExcludeHosters},
 	}
 
 	req := downloaders.DownloadRequest{
 		Url:           args.Url,
+		Language:      args.GetVideoType(),
+		Episodes:      args.GetEpisodesRequest(),
 		SaveDirectory: saveDir,
 		SeriesTitle:   info.Title,
-		// Other fields like language selection could be added to CLI args
+		MultiLanguage: multiLanguage,
+		Languages:     languages,
+	}
+
+	// --continue has to look at the save directory even if --skip-existing is off
+	continueCache := cache
+	if args.Continue && !skipMode.Skips() {
+		continueCache, _ = download.NewDirectoryCache(saveDir, downloaders.SkipModeByName)
+	}
+
+	if err := applyEpisodeFilters(scrapeCtx, args, dl, req, &settings, func(epInfo downloaders.EpisodeInfo) bool {
+		return state.IsComplete(saveDir, epInfo.Season, epInfo.Episode, "") || episodeExists(continueCache, epInfo, nil)
+	}); err != nil {
+		return err
 	}
+	if shared.episodes != nil {
+		filter := settings.EpisodeFilter
+		settings.EpisodeFilter = func(season, episode uint32) bool {
+			return shared.episodes(season, episode) && (filter == nil || filter(season, episode))
+		}
+	}
+
+	if args.ListEpisodes {
+		return printEpisodes(scrapeCtx, dl, info, req, settings)
+	}
+
+	if args.Interactive {
+		if selector.IsInteractive() {
+			if err := selectInteractively(scrapeCtx, dl, &req, &settings); err != nil {
+				return err
+			}
+		} else {
+			slog.Warn("Interactive selection needs a terminal, downloading without it")
+		}
+	}
+
+	manager := download.NewDownloadManager(d, args.ConcurrentDownloads, saveDir, *info, skipMode).
+		SetFolderTemplate(folderTemplate).
+		SetNaming(naming).
+		SetAdaptiveConcurrency(args.AdaptiveConcurrency).
+		SetParallelParts(args.ParallelParts).
+		SetAudioFormat(audioFormat).
+		SetState(state).
+		SetCache(cache).
+		SetWriteThumbnails(args.WriteThumbnails).
+		SetChecksums(args.Checksums, args.VerifyChecksums).
+		SetSizeBudget(shared.budget).
+		SetEvents(shared.events).
+		SetFailurePolicy(shared.failures, args.Url)
+	taskChan := make(chan *downloaders.DownloadTaskWrapper, 50)
+
+	// Start manager in background
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// the failed episodes are counted by the failure policy, they don't fail the series
+		manager.ProgressDownloads(ctx)
+		if args.AdaptiveConcurrency {
+			stats := manager.ConcurrencyStats()
+			slog.Info("Adaptive concurrency finished", "concurrent", stats.Limit, "max", stats.Max)
+		}
+		if skipped := manager.Skipped(); len(skipped) > 0 {
+			episodes := make([]string, len(skipped))
+			for i, ep := range skipped {
+				episodes[i] = download.GetEpisodeName("", nil, &ep, false)
+			}
+			slog.Warn("Reached --max-total-size, run again with --continue to download the rest",
+				"downloaded", download.FormatSize(shared.budget.Used()), "remaining", strings.Join(episodes, ", "))
+		}
+	}()
+
+	// Feed tasks from downloader to manager
+	go func() {
+		for tw := range taskChan {
+			manager.Submit(download.ManagerTask{
+				DownloadUrl: tw.Url,
+				Referer:     tw.Referer,
+				VideoType:   tw.Lang,
+				EpisodeInfo: tw.Episode,
+				Hoster:      tw.Hoster,
+				Resolution:  tw.Resolution,
+				Refresh:     tw.Refresh,
+				Tracks:      tw.Tracks,
+				Part:        tw.Part,
+			})
+		}
+		manager.Close()
+	}()
+
+	// the early returns have to wait for the manager as well
+	closeTasks := sync.OnceFunc(func() {
+		close(taskChan)
+		wg.Wait()
+	})
+	defer closeTasks()
+
+	// no need to look for more episodes once the failure policy gave up
+	scrapeCtx, stopScrape := context.WithCancel(scrapeCtx)
+	defer stopScrape()
+	go func() {
+		select {
+		case <-shared.failures.Aborted():
+			stopScrape()
+		case <-scrapeCtx.Done():
+		}
+	}()
 
 	slog.Info("Starting scrape...")
-	if err := dl.Download(scrapeCtx, req, settings, taskChan); err != nil {
-		slog.Error("Scrape failed", "error", err)
+	// after Ctrl+C or once the failure policy gave up the scrape fails, the summary tells what happened
+	if err := dl.Download(scrapeCtx, req, settings, taskChan); err != nil && !shared.failures.GaveUp() && ctx.Err() == nil {
+		if !logGaps(err) {
+			slog.Error("Scrape failed", "error", err)
+			return err
+		}
+		shared.partial.Add(1)
+	}
+
+	closeTasks()
+	summary := manager.Summary()
+	if ctx.Err() != nil {
+		slog.Warn("Interrupted, the downloads were stopped", "completed", summary.Completed, "failed", summary.Failed,
+			"skipped", summary.Skipped, "canceled", summary.Canceled, "data used", download.FormatSize(summary.DataUsed),
+			"wasted", download.FormatSize(summary.DataWasted))
+	} else {
+		slog.Log(ctx, logger.LevelSummary, "Done!", "completed", summary.Completed, "failed", summary.Failed, "skipped", summary.Skipped,
+			"canceled", summary.Canceled, "data used", download.FormatSize(summary.DataUsed), "wasted", download.FormatSize(summary.DataWasted))
+	}
+
+	return nil
+}
+
+// logGaps reports the seasons and episodes a partial scrape left out. It returns false if err is a real failure.
+func logGaps(err error) bool {
+	var partial *downloaders.PartialError
+	if !errors.As(err, &partial) {
+		return false
+	}
+	gaps := make([]string, len(partial.Gaps))
+	for i, g := range partial.Gaps {
+		if g.Episode == 0 {
+			gaps[i] = fmt.Sprintf("season %d", g.Season)
+		} else {
+			gaps[i] = fmt.Sprintf("S%02dE%02d", g.Season, g.Episode)
+		}
+	}
+	slog.Warn("Some pages failed to load and were left out, run again to retry them or use --strict to stop on the first failure",
+		"missing", strings.Join(gaps, ", "))
+	return true
+}
+
+// finishFailures writes the --fail-summary file. It returns false if the failure policy stopped the run.
+func finishFailures(args *cli.Args, failures *download.FailurePolicy) bool {
+	failed := failures.Failed()
+	if args.FailSummary != "" {
+		if err := download.WriteFailSummary(args.FailSummary, failed); err != nil {
+			slog.Error("Failed to write fail summary", "error", err)
+		} else if len(failed) > 0 {
+			slog.Info("Wrote the failed episodes", "file", args.FailSummary, "count", len(failed))
+		}
+	}
+	if failures.GaveUp() {
+		slog.Error("Stopped the run because of failed downloads, see --continue-on-error and --max-failures", "failed", len(failed))
+		return false
+	}
+	return true
+}
+
+// applyEpisodeFilters narrows the requested episodes with --from-episode, --to-episode and --continue.
+// The ranges of -e/-s pick the candidates first, --from-episode/--to-episode cut them down and --continue
+// moves the start to the first episode inside that window which isn't in the save directory yet.
+// --skip-existing is still applied by the scraper afterwards, so finished episodes behind the start get skipped too.
+func applyEpisodeFilters(ctx context.Context, args *cli.Args, dl downloaders.Downloader, req downloaders.DownloadRequest, settings *downloaders.DownloadSettings, exists func(epInfo downloaders.EpisodeInfo) bool) error {
+	if args.FromEpisode > 0 && args.ToEpisode > 0 && args.FromEpisode > args.ToEpisode {
+		return fmt.Errorf("--from-episode (%d) is greater than --to-episode (%d)", args.FromEpisode, args.ToEpisode)
+	}
+
+	inWindow := func(episode uint32) bool {
+		return episode >= args.FromEpisode && (args.ToEpisode == 0 || episode <= args.ToEpisode)
+	}
+	if args.FromEpisode > 0 || args.ToEpisode > 0 {
+		settings.EpisodeFilter = func(season, episode uint32) bool {
+			return inWindow(episode)
+		}
+	}
+
+	if !args.Continue {
+		return nil
+	}
+
+	lister, ok := dl.(downloaders.EpisodeLister)
+	if !ok {
+		slog.Warn("This site doesn't support listing episodes, --continue is ignored")
+		return nil
+	}
+
+	slog.Info("Looking for the first missing episode...")
+	episodes, err := lister.ListEpisodes(ctx, req, *settings)
+	if err != nil && !logGaps(err) {
+		return fmt.Errorf("failed to list episodes: %w", err)
+	}
+
+	var start *downloaders.EpisodeInfo
+	for i, ep := range episodes {
+		if inWindow(ep.Episode) && !exists(ep) {
+			start = &episodes[i]
+			break
+		}
+	}
+
+	if start == nil {
+		slog.Info("All episodes are already downloaded")
+		settings.EpisodeFilter = func(season, episode uint32) bool {
+			return false
+		}
+		return nil
+	}
+
+	slog.Info("Continuing", "season", start.Season, "episode", start.Episode)
+	settings.EpisodeFilter = func(season, episode uint32) bool {
+		if !inWindow(episode) {
+			return false
+		}
+		return season > start.Season || (season == start.Season && episode >= start.Episode)
+	}
+	return nil
+}
+
+// episodeList is the output of --list-episodes.
+type episodeList struct {
+	Url         string          `json:"url"`
+	Title       string          `json:"title"`
+	Description string          `json:"description,omitempty"`
+	CoverUrl    string          `json:"cover_url,omitempty"`
+	Episodes    []listedEpisode `json:"episodes"`
+	// Missing are the seasons and episodes whose pages failed to load
+	Missing []listedGap `json:"missing,omitempty"`
+}
+
+type listedEpisode struct {
+	Season       uint32           `json:"season"`
+	Episode      uint32           `json:"episode"`
+	Title        string           `json:"title,omitempty"`
+	AirDate      string           `json:"air_date,omitempty"`
+	ThumbnailUrl string           `json:"thumbnail_url,omitempty"`
+	Languages    []listedLanguage `json:"languages"`
+}
+
+type listedLanguage struct {
+	Language string   `json:"language"`
+	Hosters  []string `json:"hosters"`
+}
+
+type listedGap struct {
+	Season  uint32 `json:"season"`
+	Episode uint32 `json:"episode,omitempty"`
+	Error   string `json:"error"`
+}
+
+// printEpisodes writes the episodes of the request with their languages and hosters as JSON to stdout. Nothing gets
+// extracted or downloaded, pages that fail to load are listed as missing.
+func printEpisodes(ctx context.Context, dl downloaders.Downloader, info *downloaders.SeriesInfo, req downloaders.DownloadRequest, settings downloaders.DownloadSettings) error {
+	inspector, ok := dl.(downloaders.EpisodeInspector)
+	if !ok {
+		return fmt.Errorf("this site doesn't support listing episodes")
+	}
+
+	slog.Info("Listing episodes...")
+	episodes, err := inspector.InspectEpisodes(ctx, req, settings)
+	var partial *downloaders.PartialError
+	if err != nil && !errors.As(err, &partial) {
+		return fmt.Errorf("failed to list episodes: %w", err)
+	}
+
+	list := episodeList{
+		Url:         req.Url,
+		Title:       info.Title,
+		Description: info.Description,
+		CoverUrl:    info.CoverUrl,
+		Episodes:    make([]listedEpisode, len(episodes)),
+	}
+	for i, ep := range episodes {
+		listed := listedEpisode{
+			Season:       ep.Season,
+			Episode:      ep.Episode,
+			Title:        ep.Title,
+			AirDate:      ep.AirDate,
+			ThumbnailUrl: ep.ThumbnailUrl,
+			Languages:    make([]listedLanguage, len(ep.Languages)),
+		}
+		for j, language := range ep.Languages {
+			listed.Languages[j] = listedLanguage{Language: language.Language.String(), Hosters: language.Hosters}
+		}
+		list.Episodes[i] = listed
+	}
+	if partial != nil {
+		for _, gap := range partial.Gaps {
+			list.Missing = append(list.Missing, listedGap{Season: gap.Season, Episode: gap.Episode, Error: gap.Err.Error()})
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(list)
+}
+
+// selectInteractively lets the user pick the language and episodes before anything gets downloaded.
+func selectInteractively(ctx context.Context, dl downloaders.Downloader, req *downloaders.DownloadRequest, settings *downloaders.DownloadSettings) error {
+	lister, ok := dl.(downloaders.EpisodeLister)
+	if !ok {
+		slog.Warn("This site doesn't support listing episodes, downloading without interactive selection")
+		return nil
+	}
+
+	languageOptions := []string{"Automatic"}
+	for _, vt := range downloaders.LanguagePreference {
+		languageOptions = append(languageOptions, vt.String())
+	}
+	initial := 0
+	for i, vt := range downloaders.LanguagePreference {
+		if vt == req.Language {
+			initial = i + 1
+		}
+	}
+
+	choice, err := selector.SingleSelect("Language:", languageOptions, initial)
+	if err != nil {
+		return err
+	}
+	if choice > 0 {
+		req.Language = downloaders.LanguagePreference[choice-1]
+	}
+
+	slog.Info("Listing episodes...")
+	episodes, err := lister.ListEpisodes(ctx, *req, *settings)
+	if err != nil && !logGaps(err) {
+		return fmt.Errorf("failed to list episodes: %w", err)
+	}
+	// only offer what --from-episode, --to-episode and --continue left over
+	if settings.EpisodeFilter != nil {
+		episodes = slices.DeleteFunc(episodes, func(ep downloaders.EpisodeInfo) bool {
+			return !settings.EpisodeFilter(ep.Season, ep.Episode)
+		})
+	}
+	if len(episodes) == 0 {
+		return fmt.Errorf("no episodes found")
+	}
+
+	labels := make([]string, len(episodes))
+	for i, ep := range episodes {
+		labels[i] = download.GetEpisodeName("", nil, &ep, true)
+	}
+
+	selected, err := selector.MultiSelect("Episodes:", labels, true)
+	if err != nil {
 		return err
 	}
 
-	slog.Info("Done!")
+	type episodeKey struct{ season, episode uint32 }
+	wanted := make(map[episodeKey]bool, len(selected))
+	for _, i := range selected {
+		wanted[episodeKey{episodes[i].Season, episodes[i].Episode}] = true
+	}
+	slog.Info("Selected episodes", "count", len(wanted))
 
-	return managerErr
+	settings.EpisodeFilter = func(season, episode uint32) bool {
+		return wanted[episodeKey{season, episode}]
+	}
+	return nil
 }
 
 func handleSingleDownload(ctx context.Context, args *cli.Args, d *download.Downloader, cm *chrome.ChromeManager, saveDir string) error {
+	quality, err := args.GetQuality()
+	if err != nil {
+		return err
+	}
+
 	slog.Info("Extracting video URL...", "url", args.Url)
 
-	// If it needs chrome (complex extractors), we would handle that here.
-	// For simple extractors like Vidoza:
-	ext, err := extractors.ExtractVideoUrl(ctx, args.Url, "", "")
+	ext, extractorName, err := extractVideo(ctx, args, quality)
+	if errors.Is(err, extractors.ErrUnsupported) {
+		slog.Error("No extractor supported this URL")
+		return err
+	}
 	if err != nil {
 		slog.Error("Failed to extract video URL", "error", err)
 		return err
 	}
-	if ext == nil {
-		slog.Error("No extractor supported this URL")
-		return fmt.Errorf("no extractor supported this URL")
+
+	title := extractors.ExtractTitle(ctx, args.Url, extractorName, args.UserAgent, "")
+	if title != "" {
+		slog.Debug("Found video title", "title", title)
+	}
+	outputName := download.GetSingleFileName(args.OutputTemplate, title, time.Now())
+	outputPath := filepath.Join(saveDir, outputName)
+
+	skipMode, err := args.GetSkipMode()
+	if err != nil {
+		return err
+	}
+	audioFormat, err := args.GetAudioFormat()
+	if err != nil {
+		return err
 	}
 
-	timestamp := time.Now().Format("2006-01-02_15-04-05.000")
-	outputPath := filepath.Join(saveDir, timestamp)
+	// same as in the series download, send the embed page like a browser would
+	referer := ext.Referer
+	if referer == "" {
+		referer = args.Url
+	}
+	hoster := extractorName
+	if hoster == "" {
+		hoster = hosterOf(args.Url)
+	}
 
 	task := download.NewDownloadTask(outputPath, ext.Url).
-		SetSkipExisting(args.SkipExisting).
-		SetReferer(ext.Referer)
+		SetSkipExisting(skipMode.Skips()).
+		SetOverwriteFile(skipMode == downloaders.SkipModeOverwrite).
+		SetReferer(referer).
+		SetHoster(hoster).
+		SetParallelParts(args.ParallelParts).
+		SetAudioFormat(audioFormat).
+		SetRefresh(func(ctx context.Context) (string, string, error) {
+			ext, _, err := extractVideo(ctx, args, quality)
+			if err != nil {
+				return "", "", err
+			}
+			if ext.Referer == "" {
+				return ext.Url, args.Url, nil
+			}
+			return ext.Url, ext.Referer, nil
+		})
 
 	slog.Info("Starting download...", "url", ext.Url)
-	if err := d.DownloadToFile(ctx, task); err != nil {
+	run := d.DownloadToFile
+	if args.ToStdout() {
+		task.SetCustomMessage(outputName)
+		run = func(ctx context.Context, task *download.DownloadTask) error {
+			return d.DownloadToWriter(ctx, task, os.Stdout)
+		}
+	}
+	if err := run(ctx, task); err != nil {
+		var statusErr *download.ErrHTTPStatus
+		if errors.As(err, &statusErr) && (statusErr.Code == http.StatusForbidden || statusErr.Code == http.StatusNotFound) {
+			slog.Error("Download failed, the video link probably expired", "status", statusErr.Code)
+			return err
+		}
+		if errors.Is(err, download.ErrLiveStream) {
+			slog.Error("The stream has no end, set --max-duration to record it anyway")
+			return err
+		}
+		if errors.Is(err, download.ErrNotStreamable) {
+			slog.Error("This download can't be written to stdout, save it to a file instead", "error", err)
+			return err
+		}
+		if errors.Is(err, download.ErrFFmpegDisabled) {
+			slog.Error("This download needs FFmpeg, run it without --no-ffmpeg", "error", err)
+			return err
+		}
+		if errors.Is(err, download.ErrFFmpegRequired) {
+			slog.Error("This download needs FFmpeg, which couldn't be set up. Install it or run gad again once it can be downloaded", "error", err)
+			return err
+		}
+		var limitErr *download.ErrLimitExceeded
+		if errors.As(err, &limitErr) {
+			slog.Error("Download stopped early, the file is incomplete", "reason", limitErr)
+			return err
+		}
 		slog.Error("Download failed", "error", err)
 		return err
 	}
@@ -296,3 +1595,213 @@ func handleSingleDownload(ctx context.Context, args *cli.Args, d *download.Downl
 	d.Wait()
 	return nil
 }
+
+// extractVideo resolves args.Url with the extractor picked by -u, or the first one supporting the URL.
+// The name of the picked extractor is returned too, it's empty without -u.
+func extractVideo(ctx context.Context, args *cli.Args, quality extractors.QualityCap) (*extractors.ExtractedVideo, string, error) {
+	extractorName := ""
+	if extractors.ExistsExtractorWithName(args.Extractor) {
+		extractorName = args.Extractor
+	}
+
+	// If it needs chrome (complex extractors), we would handle that here.
+	// For simple extractors like Vidoza:
+	var ext *extractors.ExtractedVideo
+	var err error
+	if extractorName != "" {
+		ext, err = extractors.ExtractVideoUrlWithExtractor(ctx, args.Url, extractorName, args.UserAgent, "", quality)
+	} else {
+		ext, err = extractors.ExtractVideoUrl(ctx, args.Url, args.UserAgent, "", quality)
+	}
+	return ext, extractorName, err
+}
+
+// runProbe resolves the stream of args.Url like a download would and prints what ffprobe finds. Nothing is written to the save directory.
+func runProbe(args *cli.Args, dataDir string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	quality, err := args.GetQuality()
+	if err != nil {
+		slog.Error("Failed to parse quality", "error", err)
+		return 1
+	}
+
+	d := download.NewDownloader(args.UserAgent, args.Debug, 0)
+	d.SetQuality(quality)
+
+	streamUrl, referer, err := resolveStream(ctx, args, d, dataDir, quality)
+	if err != nil {
+		slog.Error("Failed to resolve the stream", "error", err)
+		return 1
+	}
+	slog.Debug("Probing stream", "url", streamUrl, "referer", referer)
+
+	ffprobePath, err := ffmpeg.New(dataDir).AutoDownloadFfprobe(ctx, d)
+	if err != nil {
+		slog.Error("Failed to manage ffprobe", "error", err)
+		return 1
+	}
+
+	variants, err := d.ListVariants(ctx, streamUrl, referer)
+	if err != nil {
+		slog.Error("Failed to read the stream", "error", err)
+		return 1
+	}
+	// ffprobe would only look at the first variant of a master playlist, probe the one a download picks instead
+	probeUrl := streamUrl
+	for _, v := range variants {
+		if v.Selected {
+			probeUrl = v.Url
+		}
+	}
+
+	result, err := ffmpeg.Probe(ctx, ffprobePath, probeUrl, referer, args.UserAgent)
+	if err != nil {
+		slog.Error("Failed to probe the stream", "error", err)
+		return 1
+	}
+	result.Url = streamUrl
+	result.Variants = variants
+
+	if args.ProbeJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			slog.Error("Failed to write result", "error", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Println()
+	result.Print(os.Stdout)
+	return 0
+}
+
+// runSpeedTest measures the throughput of the stream of args.Url with more and more connections and suggests settings.
+func runSpeedTest(args *cli.Args, dataDir string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	quality, err := args.GetQuality()
+	if err != nil {
+		slog.Error("Failed to parse quality", "error", err)
+		return 1
+	}
+
+	d := download.NewDownloader(args.UserAgent, args.Debug, 0)
+	d.SetQuality(quality)
+
+	streamUrl, referer, err := resolveStream(ctx, args, d, dataDir, quality)
+	if err != nil {
+		slog.Error("Failed to resolve the stream", "error", err)
+		return 1
+	}
+
+	slog.Info("Measuring download speed...", "url", streamUrl, "duration", args.SpeedTestDuration)
+	samples, err := d.SpeedTest(ctx, streamUrl, referer, args.SpeedTestDuration, args.SpeedTestConnections)
+	if err != nil {
+		slog.Error("Speed test failed", "error", err)
+		return 1
+	}
+
+	fmt.Println()
+	fmt.Println("Connections  Speed")
+	for _, s := range samples {
+		fmt.Printf("%11d  %s/s\n", s.Connections, download.FormatSize(int64(s.BytesPerSecond)))
+	}
+
+	recommended := download.RecommendConcurrency(samples)
+	fmt.Println()
+	fmt.Printf("--concurrent %d gets %s/s, more connections add less than 10%%.\n", recommended.Connections, download.FormatSize(int64(recommended.BytesPerSecond)))
+	// FormatSize with the space removed is understood by --rate
+	rate := strings.ReplaceAll(download.FormatSize(int64(recommended.BytesPerSecond*0.8)), " ", "")
+	fmt.Printf("--rate %s leaves about a fifth of it for other devices.\n", rate)
+	return 0
+}
+
+// resolveStream returns the stream URL and referer of args.Url. Series get scraped with the browser until the first
+// selected episode is found, hoster pages go through the extractors and anything else is assumed to be a stream already.
+func resolveStream(ctx context.Context, args *cli.Args, d *download.Downloader, dataDir string, quality extractors.QualityCap) (string, string, error) {
+	if args.Extractor == "" {
+		dl, err := downloaders.GetDownloader(args.Url)
+		if err == nil {
+			return resolveEpisode(ctx, args, dl, chrome.NewManager(dataDir, d).SetUserAgent(args.UserAgent), quality)
+		}
+		if !errors.Is(err, downloaders.ErrUnsupportedSite) {
+			return "", "", err
+		}
+	}
+
+	ext, _, err := extractVideo(ctx, args, quality)
+	if errors.Is(err, extractors.ErrUnsupported) && args.Extractor == "" {
+		slog.Debug("No extractor supports the URL, probing it directly")
+		return args.Url, "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	referer := ext.Referer
+	if referer == "" {
+		referer = args.Url
+	}
+	return ext.Url, referer, nil
+}
+
+// resolveEpisode scrapes the series until the first episode selected with -s/-e was extracted.
+func resolveEpisode(ctx context.Context, args *cli.Args, dl downloaders.Downloader, cm *chrome.ChromeManager, quality extractors.QualityCap) (string, string, error) {
+	if err := cm.Prepare(ctx); err != nil {
+		return "", "", err
+	}
+	scrapeCtx, cancel, err := cm.Get(ctx, !args.Browser, args.Debug)
+	if err != nil {
+		return "", "", err
+	}
+	defer cancel()
+
+	slog.Info("Fetching series info...")
+	info, err := downloaders.GetSeriesInfoWithRetry(scrapeCtx, dl, downloaders.DefaultInfoRetries)
+	if err != nil {
+		return "", "", err
+	}
+
+	req := downloaders.DownloadRequest{
+		Url:         args.Url,
+		Language:    args.GetVideoType(),
+		Episodes:    args.GetEpisodesRequest(),
+		SeriesTitle: info.Title,
+	}
+	settings := downloaders.DownloadSettings{
+		UserAgent:          args.UserAgent,
+		Quality:            quality,
+		ExtractAttempts:    1,
+		NavRetries:         downloaders.DefaultNavRetries,
+		ResolveConcurrency: 1,
+	}
+
+	// the scrape is stopped as soon as the first episode arrives
+	downloadCtx, stopScrape := context.WithCancel(scrapeCtx)
+	defer stopScrape()
+	taskChan := make(chan *downloaders.DownloadTaskWrapper, 1)
+	scrapeErr := make(chan error, 1)
+	go func() {
+		scrapeErr <- dl.Download(downloadCtx, req, settings, taskChan)
+		close(taskChan)
+	}()
+
+	slog.Info("Resolving episode...")
+	tw, ok := <-taskChan
+	stopScrape()
+	for range taskChan {
+	}
+	if !ok {
+		if err := <-scrapeErr; err != nil {
+			return "", "", err
+		}
+		return "", "", errors.New("no episode found, check -s, -e and the language")
+	}
+
+	slog.Info("Probing episode", "episode", download.GetEpisodeName(info.Title, &tw.Lang, &tw.Episode, false), "hoster", tw.Hoster)
+	return tw.Url, tw.Referer, nil
+}
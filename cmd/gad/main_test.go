@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+	"github.com/bugmaschine/gad/pkg/cli"
+)
+
+// fakeLister lists two seasons of four episodes.
+type fakeLister struct{}
+
+func (fakeLister) GetSeriesInfo(ctx context.Context) (*downloaders.SeriesInfo, error) {
+	return &downloaders.SeriesInfo{}, nil
+}
+
+func (fakeLister) Download(ctx context.Context, request downloaders.DownloadRequest, settings downloaders.DownloadSettings, sender chan<- *downloaders.DownloadTaskWrapper) error {
+	return nil
+}
+
+func (fakeLister) ListEpisodes(ctx context.Context, request downloaders.DownloadRequest, settings downloaders.DownloadSettings) ([]downloaders.EpisodeInfo, error) {
+	var episodes []downloaders.EpisodeInfo
+	for season := uint32(1); season <= 2; season++ {
+		for episode := uint32(1); episode <= 4; episode++ {
+			episodes = append(episodes, downloaders.EpisodeInfo{Season: season, Episode: episode})
+		}
+	}
+	return episodes, nil
+}
+
+func TestApplyEpisodeFilters(t *testing.T) {
+	type episode struct{ season, episode uint32 }
+	all := []episode{{1, 1}, {1, 2}, {1, 3}, {1, 4}, {2, 1}, {2, 2}, {2, 3}, {2, 4}}
+
+	tests := []struct {
+		name     string
+		from, to uint32
+		resume   bool
+		// downloaded are the episodes that already exist
+		downloaded []episode
+		expected   []episode
+	}{
+		{"no filter", 0, 0, false, nil, all},
+		{"open end", 3, 0, false, nil, []episode{{1, 3}, {1, 4}, {2, 3}, {2, 4}}},
+		{"open start", 0, 2, false, nil, []episode{{1, 1}, {1, 2}, {2, 1}, {2, 2}}},
+		{"range in every season", 2, 3, false, nil, []episode{{1, 2}, {1, 3}, {2, 2}, {2, 3}}},
+		{"continue without state", 0, 0, true, nil, all},
+		{"continue across seasons", 0, 0, true, []episode{{1, 1}, {1, 2}}, []episode{{1, 3}, {1, 4}, {2, 1}, {2, 2}, {2, 3}, {2, 4}}},
+		{"continue in range", 2, 3, true, []episode{{1, 2}, {1, 3}}, []episode{{2, 2}, {2, 3}}},
+		{"continue when done", 0, 0, true, all, nil},
+	}
+
+	for _, tt := range tests {
+		args := &cli.Args{FromEpisode: tt.from, ToEpisode: tt.to, Continue: tt.resume}
+		exists := func(ep downloaders.EpisodeInfo) bool {
+			for _, d := range tt.downloaded {
+				if d.season == ep.Season && d.episode == ep.Episode {
+					return true
+				}
+			}
+			return false
+		}
+		var settings downloaders.DownloadSettings
+		if err := applyEpisodeFilters(context.Background(), args, fakeLister{}, downloaders.DownloadRequest{}, &settings, exists); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var got []episode
+		for _, ep := range all {
+			if settings.EpisodeFilter == nil || settings.EpisodeFilter(ep.season, ep.episode) {
+				got = append(got, ep)
+			}
+		}
+		if !slices.Equal(got, tt.expected) {
+			t.Errorf("%s\nExpected: %v\nGot:      %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestApplyEpisodeFiltersInvalidRange(t *testing.T) {
+	args := &cli.Args{FromEpisode: 5, ToEpisode: 2}
+	var settings downloaders.DownloadSettings
+	if err := applyEpisodeFilters(context.Background(), args, fakeLister{}, downloaders.DownloadRequest{}, &settings, nil); err == nil {
+		t.Error("\nExpected: an error for --from-episode after --to-episode\nGot:      nil")
+	}
+}
@@ -2,14 +2,16 @@ package downloaders
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/bugmaschine/gad/internal/extractors"
 	"github.com/chromedp/cdproto/cdp"
@@ -36,15 +38,9 @@ func (a *AniWorldSerienStream) GetSeriesInfo(ctx context.Context) (*SeriesInfo,
 	slog.Info("Navigating to series page", "url", url)
 
 	// Navigate with long timeout for ddos-guard
-	navCtx, cancel := context.WithTimeout(ctx, 45*time.Second)
-	defer cancel()
-
-	err := chromedp.Run(navCtx,
-		chromedp.Navigate(url),
-		chromedp.WaitVisible(`body`, chromedp.ByQuery),
-	)
-	if err != nil {
-		slog.Warn("Initial navigation failed or timed out", "error", err)
+	navErr := navigate(ctx, url, `body`)
+	if navErr != nil {
+		slog.Warn("Initial navigation failed or timed out", "error", navErr)
 	}
 
 	// Wait for actual content using visible selectors (case-corrected)
@@ -64,16 +60,49 @@ func (a *AniWorldSerienStream) GetSeriesInfo(ctx context.Context) (*SeriesInfo,
 	}
 
 	if title == "" {
+		if err := checkWall(ctx); err != nil {
+			return nil, err
+		}
+		// the page didn't load, GetSeriesInfoWithRetry tries again
+		if navErr != nil {
+			return nil, fmt.Errorf("failed to load the series page: %w", navErr)
+		}
 		// Final fallback: use the slug
 		title = strings.Title(strings.ReplaceAll(a.ParsedUrl.Name, "-", " "))
 	}
 
+	// the cover is lazy loaded, so the real url is in data-src
+	var cover string
+	_ = chromedp.Run(ctx, chromedp.Evaluate(`(() => {
+		const img = document.querySelector(".seriesCoverBox img");
+		return img ? (img.getAttribute("data-src") || img.getAttribute("src") || "") : "";
+	})()`, &cover))
+
 	return &SeriesInfo{
 		Title:       strings.TrimSpace(title),
 		Description: strings.TrimSpace(description),
+		CoverUrl:    resolveUrl(url, cover),
 	}, nil
 }
 
+func (a *AniWorldSerienStream) ListEpisodes(ctx context.Context, request DownloadRequest, settings DownloadSettings) ([]EpisodeInfo, error) {
+	scraper := &Scraper{
+		ParsedUrl: a.ParsedUrl,
+		Request:   request,
+		Settings:  settings,
+	}
+	return scraper.List(ctx)
+}
+
+func (a *AniWorldSerienStream) InspectEpisodes(ctx context.Context, request DownloadRequest, settings DownloadSettings) ([]EpisodeDetails, error) {
+	scraper := &Scraper{
+		ParsedUrl: a.ParsedUrl,
+		Request:   request,
+		Settings:  settings,
+	}
+	return scraper.Inspect(ctx)
+}
+
 func (a *AniWorldSerienStream) Download(ctx context.Context, request DownloadRequest, settings DownloadSettings, sender chan<- *DownloadTaskWrapper) error {
 	scraper := &Scraper{
 		ParsedUrl: a.ParsedUrl,
@@ -181,44 +210,152 @@ type Scraper struct {
 	Request   DownloadRequest
 	Settings  DownloadSettings
 	Sender    chan<- *DownloadTaskWrapper
+
+	// resolving the hoster links runs in the background, so the browser can already scrape the next episode.
+	resolveSem chan struct{}
+	resolveWg  sync.WaitGroup
+
+	// gaps are added by the browser loop and the resolvers, stopped is the gap a resolver stopped the scrape with
+	// in strict mode
+	mu      sync.Mutex
+	gaps    []Gap
+	stopped error
+}
+
+// skip records a season or episode that couldn't be scraped. In strict mode the error is returned instead, which stops the scrape.
+func (s *Scraper) skip(ctx context.Context, season, episode uint32, err error) error {
+	// a cancel isn't a gap, nothing else could be scraped either
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	gap := Gap{Season: season, Episode: episode, Err: err}
+	if s.Settings.Strict {
+		return gap
+	}
+	slog.Error("Failed to scrape, skipping", "error", gap)
+	s.mu.Lock()
+	s.gaps = append(s.gaps, gap)
+	s.mu.Unlock()
+	return nil
+}
+
+// skipResolved records an episode whose streams couldn't be resolved, like skip. Resolvers run in the background,
+// so in strict mode the gap stops the browser loop at the next episode it sends, see stopError.
+func (s *Scraper) skipResolved(ctx context.Context, season, episode uint32, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	gap := Gap{Season: season, Episode: episode, Err: err}
+	slog.Error("Failed to resolve episode, skipping", "error", gap)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.Settings.Strict {
+		s.gaps = append(s.gaps, gap)
+	} else if s.stopped == nil {
+		s.stopped = gap
+	}
+}
+
+// stopError returns the gap a resolver stopped the scrape with in strict mode, nil if none did.
+func (s *Scraper) stopError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// partialError returns the gaps as a PartialError, nil if there are none.
+func (s *Scraper) partialError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.gaps) == 0 {
+		return nil
+	}
+	return &PartialError{Gaps: slices.Clone(s.gaps)}
 }
 
 func (s *Scraper) Scrape(ctx context.Context) error {
+	concurrency := s.Settings.ResolveConcurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	s.resolveSem = make(chan struct{}, concurrency)
+
+	err := s.scrape(ctx)
+	// the resolvers may still add gaps
+	s.resolveWg.Wait()
+	if err == nil {
+		err = s.stopError()
+	}
+	if err != nil {
+		return err
+	}
+	return s.partialError()
+}
+
+func (s *Scraper) scrape(ctx context.Context) error {
+	if AdblockMissing(ctx) {
+		closePopups(ctx)
+	}
+
+	var err error
 	switch s.Request.Episodes.Kind {
 	case EpisodesRequestUnspecified:
 		if s.ParsedUrl.Season != nil {
 			if s.ParsedUrl.Season.HasEpisode {
 				return s.scrapeEpisode(ctx, s.ParsedUrl.Season.Season, s.ParsedUrl.Season.Episode, s.ParsedUrl.Season.Episode) // Max is itself for single episode
 			}
-			return s.scrapeSeason(ctx, s.ParsedUrl.Season.Season, AllOrSpecific{All: true})
+			err = s.scrapeSeason(ctx, s.ParsedUrl.Season.Season, AllOrSpecific{All: true})
+		} else {
+			err = s.scrapeSeasons(ctx, AllOrSpecific{All: true})
 		}
-		return s.scrapeSeasons(ctx, AllOrSpecific{All: true})
 	case EpisodesRequestEpisodes:
 		season := uint32(1)
 		if s.ParsedUrl.Season != nil {
 			season = s.ParsedUrl.Season.Season
 		}
-		return s.scrapeSeason(ctx, season, s.Request.Episodes.Payload)
+		err = s.scrapeSeason(ctx, season, s.Request.Episodes.Payload)
 	case EpisodesRequestSeasons:
-		return s.scrapeSeasons(ctx, s.Request.Episodes.Payload)
+		err = s.scrapeSeasons(ctx, s.Request.Episodes.Payload)
 	}
-	return nil
+	return err
 }
 
 func (s *Scraper) scrapeSeasons(ctx context.Context, payload AllOrSpecific) error {
+	seasons, err := s.listSeasons(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, season := range s.dropSpecials(seasons, payload) {
+		if s.shouldDownloadSeason(season, payload) {
+			slog.Debug("Queueing season for scraping", "season", season)
+			if err := s.scrapeSeason(ctx, season, AllOrSpecific{All: true}); err != nil {
+				return err
+			}
+		} else {
+			slog.Debug("Skipping season due to filter", "season", season)
+		}
+	}
+	return nil
+}
+
+// listSeasons returns the sorted season numbers of the series, movies are season 0.
+func (s *Scraper) listSeasons(ctx context.Context) ([]uint32, error) {
+	if err := navigateWithRetry(ctx, s.ParsedUrl.GetEpisodeUrl(1, 1), `.hosterSiteDirectNav`, s.Settings.NavRetries); err != nil {
+		return nil, err
+	}
+
 	var nodes []*cdp.Node
 	err := chromedp.Run(ctx,
-		chromedp.Navigate(s.ParsedUrl.GetEpisodeUrl(1, 1)),
-		chromedp.WaitVisible(`.hosterSiteDirectNav`, chromedp.ByQuery),
 		chromedp.Nodes(`#stream > ul:first-of-type > li`, &nodes),
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var seasons []uint32
 	if len(nodes) == 0 {
-		return fmt.Errorf("no seasons found")
+		return nil, fmt.Errorf("no seasons found")
 	}
 
 	var seasonTexts []string
@@ -226,33 +363,52 @@ func (s *Scraper) scrapeSeasons(ctx context.Context, payload AllOrSpecific) erro
 		chromedp.Evaluate(`Array.from(document.querySelectorAll("#stream > ul:first-of-type > li")).map(li => li.innerText.trim())`, &seasonTexts),
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for _, t := range seasonTexts {
-		if strings.EqualFold(t, "Filme") {
-			seasons = append(seasons, 0)
+		season, ok := classifySeason(t)
+		if !ok {
+			slog.Debug("Ignoring unknown season entry", "text", t)
 			continue
 		}
-		num, err := strconv.ParseUint(t, 10, 32)
-		if err == nil {
-			seasons = append(seasons, uint32(num))
+		if !slices.Contains(seasons, season) {
+			seasons = append(seasons, season)
 		}
 	}
 	slog.Debug("Found seasons", "raw", seasonTexts, "parsed", seasons)
 	sort.Slice(seasons, func(i, j int) bool { return seasons[i] < seasons[j] })
 
-	for _, season := range seasons {
-		if s.shouldDownloadSeason(season, payload) {
-			slog.Debug("Queueing season for scraping", "season", season)
-			if err := s.scrapeSeason(ctx, season, AllOrSpecific{All: true}); err != nil {
-				slog.Error("Failed to scrape season", "season", season, "error", err)
-			}
-		} else {
-			slog.Debug("Skipping season due to filter", "season", season)
-		}
+	return seasons, nil
+}
+
+// specialLabels are the entries of the season list that aren't a numbered season. They all end up in season 0.
+var specialLabels = []string{"filme", "film", "movies", "movie", "specials", "special", "ova", "ovas", "extras", "trailer"}
+
+// classifySeason returns the season number of an entry of the season list, 0 for movies and specials. Entries that
+// are neither are not ok.
+func classifySeason(text string) (uint32, bool) {
+	text = strings.TrimSpace(text)
+	if slices.Contains(specialLabels, strings.ToLower(text)) {
+		return 0, true
 	}
-	return nil
+	num, err := strconv.ParseUint(text, 10, 32)
+	if err != nil || num == 0 {
+		return 0, false
+	}
+	return uint32(num), true
+}
+
+// dropSpecials removes season 0 from seasons unless IncludeSpecials is set or payload asks for it.
+func (s *Scraper) dropSpecials(seasons []uint32, payload AllOrSpecific) []uint32 {
+	if s.Settings.IncludeSpecials || !slices.Contains(seasons, 0) {
+		return seasons
+	}
+	if !payload.All && s.shouldDownloadSeason(0, payload) {
+		return seasons
+	}
+	slog.Info("Skipping movies and specials, use --include-specials to download them")
+	return slices.DeleteFunc(slices.Clone(seasons), func(season uint32) bool { return season == 0 })
 }
 
 func (s *Scraper) shouldDownloadSeason(season uint32, payload AllOrSpecific) bool {
@@ -267,21 +423,56 @@ func (s *Scraper) shouldDownloadSeason(season uint32, payload AllOrSpecific) boo
 	return false
 }
 
+// scrapeSeason only returns an error in strict mode, otherwise failures are recorded as gaps.
 func (s *Scraper) scrapeSeason(ctx context.Context, season uint32, payload AllOrSpecific) error {
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(s.ParsedUrl.GetSeasonUrl(season)),
-		chromedp.WaitVisible(`.hosterSiteDirectNav`, chromedp.ByQuery),
-	)
+	episodes, err := s.listEpisodes(ctx, season)
 	if err != nil {
+		return s.skip(ctx, season, 0, fmt.Errorf("failed to list episodes: %w", err))
+	}
+	if err := s.checkNumbering(season, episodes, payload); err != nil {
 		return err
 	}
 
+	// Find max episode for padding
+	var maxEpisodes uint32
+	for _, ep := range episodes {
+		if ep > maxEpisodes {
+			maxEpisodes = ep
+		}
+	}
+
+	for _, episode := range episodes {
+		if s.Settings.CheckIfExists != nil && s.Settings.CheckIfExists(season, episode, maxEpisodes, nil) {
+			slog.Info("Skipping episode because it already exists", "season", season, "episode", episode)
+			continue
+		}
+
+		if s.shouldDownloadEpisode(episode, payload) && (s.Settings.EpisodeFilter == nil || s.Settings.EpisodeFilter(season, episode)) {
+			slog.Debug("Queueing episode for scraping", "season", season, "episode", episode)
+			if err := s.scrapeEpisode(ctx, season, episode, maxEpisodes); err != nil {
+				if err := s.skip(ctx, season, episode, err); err != nil {
+					return err
+				}
+			}
+		} else {
+			slog.Debug("Skipping episode due to filter", "season", season, "episode", episode)
+		}
+	}
+	return nil
+}
+
+// listEpisodes returns the sorted episode numbers of a season.
+func (s *Scraper) listEpisodes(ctx context.Context, season uint32) ([]uint32, error) {
+	if err := navigateWithRetry(ctx, s.ParsedUrl.GetSeasonUrl(season), `.hosterSiteDirectNav`, s.Settings.NavRetries); err != nil {
+		return nil, err
+	}
+
 	var episodeTexts []string
-	err = chromedp.Run(ctx,
+	err := chromedp.Run(ctx,
 		chromedp.Evaluate(`Array.from(document.querySelectorAll("li > a[data-episode-id]")).map(a => a.innerText.trim())`, &episodeTexts),
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var episodes []uint32
@@ -293,29 +484,124 @@ func (s *Scraper) scrapeSeason(ctx context.Context, season uint32, payload AllOr
 	}
 	sort.Slice(episodes, func(i, j int) bool { return episodes[i] < episodes[j] })
 
-	// Find max episode for padding
-	var maxEpisodes uint32
-	for _, ep := range episodes {
-		if ep > maxEpisodes {
-			maxEpisodes = ep
+	return episodes, nil
+}
+
+// List enumerates the episodes matching the request without resolving any streams.
+func (s *Scraper) List(ctx context.Context) ([]EpisodeInfo, error) {
+	var seasons []uint32
+	episodePayload := AllOrSpecific{All: true}
+
+	switch s.Request.Episodes.Kind {
+	case EpisodesRequestEpisodes:
+		season := uint32(1)
+		if s.ParsedUrl.Season != nil {
+			season = s.ParsedUrl.Season.Season
+		}
+		seasons = []uint32{season}
+		episodePayload = s.Request.Episodes.Payload
+	case EpisodesRequestSeasons:
+		all, err := s.listSeasons(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, season := range s.dropSpecials(all, s.Request.Episodes.Payload) {
+			if s.shouldDownloadSeason(season, s.Request.Episodes.Payload) {
+				seasons = append(seasons, season)
+			}
+		}
+	default:
+		if s.ParsedUrl.Season != nil {
+			if s.ParsedUrl.Season.HasEpisode {
+				episode := s.ParsedUrl.Season.Episode
+				return []EpisodeInfo{{Season: s.ParsedUrl.Season.Season, Episode: episode, MaxEpisodes: episode}}, nil
+			}
+			seasons = []uint32{s.ParsedUrl.Season.Season}
+		} else {
+			all, err := s.listSeasons(ctx)
+			if err != nil {
+				return nil, err
+			}
+			seasons = s.dropSpecials(all, AllOrSpecific{All: true})
 		}
 	}
 
-	for _, episode := range episodes {
-		if s.Settings.CheckIfExists != nil && s.Settings.CheckIfExists(season, episode, maxEpisodes, nil) {
-			slog.Info("Skipping episode because it already exists", "season", season, "episode", episode)
+	var result []EpisodeInfo
+	for _, season := range seasons {
+		episodes, err := s.listEpisodes(ctx, season)
+		if err != nil {
+			if err := s.skip(ctx, season, 0, fmt.Errorf("failed to list episodes: %w", err)); err != nil {
+				return nil, err
+			}
 			continue
 		}
+		if err := s.checkNumbering(season, episodes, episodePayload); err != nil {
+			return nil, err
+		}
 
-		if s.shouldDownloadEpisode(episode, payload) {
-			slog.Debug("Queueing episode for scraping", "season", season, "episode", episode)
-			if err := s.scrapeEpisode(ctx, season, episode, maxEpisodes); err != nil {
-				slog.Error("Failed to scrape episode", "season", season, "episode", episode, "error", err)
+		var maxEpisodes uint32
+		for _, ep := range episodes {
+			maxEpisodes = max(maxEpisodes, ep)
+		}
+
+		for _, episode := range episodes {
+			if s.shouldDownloadEpisode(episode, episodePayload) {
+				result = append(result, EpisodeInfo{Season: season, Episode: episode, MaxEpisodes: maxEpisodes})
+			}
+		}
+	}
+
+	return result, s.partialError()
+}
+
+// missingEpisodes returns the numbers the sorted episode list of a season skips between its first and last episode.
+// Seasons may continue the numbering of the one before, so the list doesn't have to start at 1. A list that skips
+// more numbers than it has is taken for a numbering with jumps, e.g. by year, and nothing is returned.
+func missingEpisodes(episodes []uint32) []uint32 {
+	var missing []uint32
+	for i := 1; i < len(episodes); i++ {
+		for ep := episodes[i-1] + 1; ep < episodes[i]; ep++ {
+			missing = append(missing, ep)
+			if len(missing) > len(episodes) {
+				return nil
 			}
-		} else {
-			slog.Debug("Skipping episode due to filter", "season", season, "episode", episode)
 		}
 	}
+	return missing
+}
+
+// checkNumbering warns about an empty episode list and the numbers the list of a season skips, a missing episode is
+// more often a scraping problem than a real gap. Only the episodes of payload count. In strict mode the scrape stops instead.
+func (s *Scraper) checkNumbering(season uint32, episodes []uint32, payload AllOrSpecific) error {
+	// movies and specials are numbered freely
+	if season == 0 {
+		return nil
+	}
+	if len(episodes) == 0 {
+		if s.Settings.Strict {
+			return Gap{Season: season, Err: fmt.Errorf("%w: the season has no episodes", ErrMissingEpisodes)}
+		}
+		slog.Warn("The season lists no episodes, this is often a scraping problem. --strict stops instead", "season", season)
+		return nil
+	}
+	var missing []string
+	first := uint32(0)
+	for _, ep := range missingEpisodes(episodes) {
+		if s.shouldDownloadEpisode(ep, payload) {
+			if first == 0 {
+				first = ep
+			}
+			missing = append(missing, strconv.FormatUint(uint64(ep), 10))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if s.Settings.Strict {
+		return Gap{Season: season, Episode: first, Err: fmt.Errorf("%w: %s missing", ErrMissingEpisodes, strings.Join(missing, ", "))}
+	}
+	slog.Warn("The episode list skips numbers, this is often a scraping problem. --strict stops instead",
+		"season", season, "missing", strings.Join(missing, ", "))
 	return nil
 }
 
@@ -335,57 +621,191 @@ func (s *Scraper) scrapeEpisode(ctx context.Context, season, episode, maxEpisode
 	url := s.ParsedUrl.GetEpisodeUrl(season, episode)
 	slog.Info("Navigating to episode page", "url", url)
 
-	// Long timeout for potential challenges
-	eCtx, cancel := context.WithTimeout(ctx, 45*time.Second)
-	defer cancel()
+	if err := navigateWithRetry(ctx, url, `.changeLanguageBox`, s.Settings.NavRetries); err != nil {
+		return fmt.Errorf("failed to load episode page: %w", err)
+	}
 
-	err := chromedp.Run(eCtx,
-		chromedp.Navigate(url),
-		chromedp.WaitVisible(`.changeLanguageBox`, chromedp.ByQuery),
-	)
+	available, keys, err := s.episodeLanguages(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to load episode page: %w", err)
+		return err
 	}
 
-	var langInfo struct {
-		Key  string `json:"key"`
-		Type string `json:"type"`
+	if s.Request.MultiLanguage {
+		return s.scrapeEpisodeLanguages(ctx, season, episode, maxEpisodes, available, keys)
 	}
 
-	err = chromedp.Run(ctx,
+	index, ok := SelectVideoType(available, s.Request.Language)
+	if !ok {
+		return fmt.Errorf("requested language %q is not available, available are %v", s.Request.Language, available)
+	}
+	videoType := available[index]
+
+	if s.Settings.CheckIfExists != nil && s.Settings.CheckIfExists(season, episode, maxEpisodes, &videoType) {
+		slog.Info("Skipping episode because it already exists", "season", season, "episode", episode)
+		return nil
+	}
+	episodeInfo := EpisodeInfo{Season: season, Episode: episode, MaxEpisodes: maxEpisodes}
+	s.scrapeEpisodeMetadata(ctx, &episodeInfo)
+
+	hosters, err := s.hostersFor(ctx, videoType, keys[index])
+	if err != nil {
+		return err
+	}
+	return s.sendStreamToDownloader(ctx, episodeInfo, []languageHosters{hosters})
+}
+
+// episodeLanguages returns the languages of the current episode page with the keys of their hosters.
+func (s *Scraper) episodeLanguages(ctx context.Context) ([]VideoType, []string, error) {
+	var languages []struct {
+		Key   string `json:"key"`
+		Title string `json:"title"`
+	}
+
+	err := chromedp.Run(ctx,
 		chromedp.Evaluate(`
-			(() => {
-				const imgs = Array.from(document.querySelectorAll('div.changeLanguageBox img'));
-				// Priority: Dub (German without "Untertitel"), then Sub (German with "Untertitel")
-				const sub = imgs.find(img => (img.title || img.alt || "").includes("Untertitel"));
-				const dub = imgs.find(img => (img.title || img.alt || "").includes("Deutsch") && !(img.title || img.alt || "").includes("Untertitel"));
-				
-				if (dub) return {key: dub.getAttribute("data-lang-key"), type: "dub"};
-				if (sub) return {key: sub.getAttribute("data-lang-key"), type: "sub"};
-				return null;
-			})()
-		`, &langInfo),
+			Array.from(document.querySelectorAll('div.changeLanguageBox img')).map(img => ({
+				key: img.getAttribute("data-lang-key"),
+				title: img.title || img.alt || ""
+			}))
+		`, &languages),
 	)
-	if err != nil || langInfo.Key == "" {
-		return fmt.Errorf("failed to find language info")
+	if err != nil || len(languages) == 0 {
+		return nil, nil, fmt.Errorf("failed to find language info")
 	}
-	slog.Debug("Found language info", "key", langInfo.Key, "type", langInfo.Type)
 
-	var videoType VideoType
-	if langInfo.Type == "dub" {
-		videoType = VideoType{Type: VideoTypeDub, Language: LanguageGerman}
-	} else {
-		videoType = VideoType{Type: VideoTypeSub, Language: LanguageGerman}
+	var available []VideoType
+	var keys []string
+	for _, l := range languages {
+		if vt, ok := videoTypeFromLanguageTitle(l.Title); ok && l.Key != "" {
+			available = append(available, vt)
+			keys = append(keys, l.Key)
+		}
 	}
+	slog.Debug("Found language info", "languages", languages, "parsed", available)
+	return available, keys, nil
+}
 
-	if s.Settings.CheckIfExists != nil && s.Settings.CheckIfExists(season, episode, maxEpisodes, &videoType) {
+// Inspect opens the episodes of List and reads their metadata, languages and hosters, nothing gets extracted.
+// Episodes that can't be opened are gaps like in Scrape.
+func (s *Scraper) Inspect(ctx context.Context) ([]EpisodeDetails, error) {
+	// the gaps of the listing stay in s.gaps
+	episodes, err := s.List(ctx)
+	var partial *PartialError
+	if err != nil && !errors.As(err, &partial) {
+		return nil, err
+	}
+
+	var result []EpisodeDetails
+	for _, ep := range episodes {
+		if s.Settings.EpisodeFilter != nil && !s.Settings.EpisodeFilter(ep.Season, ep.Episode) {
+			continue
+		}
+		details, err := s.inspectEpisode(ctx, ep)
+		if err != nil {
+			if err := s.skip(ctx, ep.Season, ep.Episode, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		result = append(result, details)
+	}
+	return result, s.partialError()
+}
+
+func (s *Scraper) inspectEpisode(ctx context.Context, episodeInfo EpisodeInfo) (EpisodeDetails, error) {
+	url := s.ParsedUrl.GetEpisodeUrl(episodeInfo.Season, episodeInfo.Episode)
+	slog.Info("Navigating to episode page", "url", url)
+	if err := navigateWithRetry(ctx, url, `.changeLanguageBox`, s.Settings.NavRetries); err != nil {
+		return EpisodeDetails{}, fmt.Errorf("failed to load episode page: %w", err)
+	}
+
+	available, keys, err := s.episodeLanguages(ctx)
+	if err != nil {
+		return EpisodeDetails{}, err
+	}
+	s.scrapeEpisodeMetadata(ctx, &episodeInfo)
+
+	details := EpisodeDetails{EpisodeInfo: episodeInfo}
+	for i, vt := range available {
+		hosters, err := s.hostersFor(ctx, vt, keys[i])
+		if err != nil {
+			return EpisodeDetails{}, err
+		}
+		language := LanguageDetails{Language: vt, Hosters: []string{}}
+		for _, h := range hosters.Hosters {
+			language.Hosters = append(language.Hosters, h.Name)
+		}
+		details.Languages = append(details.Languages, language)
+	}
+	return details, nil
+}
+
+// scrapeEpisodeMetadata fills in the title, thumbnail and air date of the episode page, they are left empty if missing.
+// The German title is preferred, many episodes only have the English one.
+func (s *Scraper) scrapeEpisodeMetadata(ctx context.Context, episodeInfo *EpisodeInfo) {
+	var metadata struct {
+		Title     string `json:"title"`
+		Thumbnail string `json:"thumbnail"`
+		AirDate   string `json:"airDate"`
+	}
+	err := chromedp.Run(ctx, chromedp.Evaluate(`(() => {
+		const text = selector => {
+			const element = document.querySelector(selector);
+			return element ? element.innerText.trim() : "";
+		};
+		const image = document.querySelector('meta[property="og:image"]');
+		const date = document.querySelector('[itemprop="datePublished"]');
+		return {
+			title: text(".hosterSiteTitle .episodeGermanTitle") || text(".hosterSiteTitle .episodeEnglishTitle"),
+			thumbnail: image ? image.getAttribute("content") || "" : "",
+			airDate: date ? (date.getAttribute("content") || date.innerText || "").trim() : ""
+		};
+	})()`, &metadata))
+	if err != nil {
+		slog.Debug("Failed to read episode metadata", "season", episodeInfo.Season, "episode", episodeInfo.Episode, "error", err)
+		return
+	}
+
+	episodeInfo.ThumbnailUrl = resolveUrl(s.ParsedUrl.GetEpisodeUrl(episodeInfo.Season, episodeInfo.Episode), metadata.Thumbnail)
+	episodeInfo.AirDate = metadata.AirDate
+	episodeInfo.Title = metadata.Title
+}
+
+// scrapeEpisodeLanguages collects the hosters of every requested language, they get downloaded as tracks of one file.
+func (s *Scraper) scrapeEpisodeLanguages(ctx context.Context, season, episode, maxEpisodes uint32, available []VideoType, keys []string) error {
+	indices := SelectVideoTypes(available, s.Request.Languages)
+	if len(indices) == 0 {
+		return fmt.Errorf("none of the requested languages %v is available, available are %v", s.Request.Languages, available)
+	}
+
+	// the muxed file carries no language in its name, so any file of the episode counts
+	if s.Settings.CheckIfExists != nil && s.Settings.CheckIfExists(season, episode, maxEpisodes, nil) {
 		slog.Info("Skipping episode because it already exists", "season", season, "episode", episode)
 		return nil
 	}
-	return s.sendStreamToDownloader(ctx, season, episode, maxEpisodes, langInfo.Key, videoType)
+	episodeInfo := EpisodeInfo{Season: season, Episode: episode, MaxEpisodes: maxEpisodes}
+	s.scrapeEpisodeMetadata(ctx, &episodeInfo)
+
+	var languages []languageHosters
+	for _, i := range indices {
+		hosters, err := s.hostersFor(ctx, available[i], keys[i])
+		if err != nil {
+			return err
+		}
+		languages = append(languages, hosters)
+	}
+	return s.sendStreamToDownloader(ctx, episodeInfo, languages)
 }
 
-func (s *Scraper) sendStreamToDownloader(ctx context.Context, season, episode, maxEpisodes uint32, langKey string, videoType VideoType) error {
+// languageHosters are the hosters offering an episode in one language, referer is the episode page.
+type languageHosters struct {
+	Lang    VideoType
+	Hosters []hoster
+	Referer string
+}
+
+// hostersFor lists the hosters of the language with the given key on the current episode page.
+func (s *Scraper) hostersFor(ctx context.Context, videoType VideoType, langKey string) (languageHosters, error) {
 	var streams []struct {
 		Name string `json:"name"`
 		Href string `json:"href"`
@@ -400,47 +820,292 @@ func (s *Scraper) sendStreamToDownloader(ctx context.Context, season, episode, m
 		`, langKey), &streams),
 	)
 	if err != nil {
-		return err
+		return languageHosters{}, err
 	}
 
 	var currentUrl string
 	err = chromedp.Run(ctx, chromedp.Location(&currentUrl))
 	if err != nil {
-		return err
+		return languageHosters{}, err
 	}
 	base, _ := url.Parse(currentUrl)
 
+	result := languageHosters{Lang: videoType, Referer: currentUrl}
 	for _, stream := range streams {
 		rel, err := url.Parse(stream.Href)
 		if err != nil {
 			continue
 		}
-		absoluteUrl := base.ResolveReference(rel).String()
+		result.Hosters = append(result.Hosters, hoster{Name: stream.Name, Url: base.ResolveReference(rel).String()})
+	}
+	return result, nil
+}
+
+// sendStreamToDownloader resolves the streams in the background and sends them to the downloader as one task.
+// With more than one language a language that can't be resolved is left out instead of failing the episode.
+func (s *Scraper) sendStreamToDownloader(ctx context.Context, episodeInfo EpisodeInfo, languages []languageHosters) error {
+	if err := s.stopError(); err != nil {
+		return err
+	}
+	// wait for a free slot, this keeps the browser from running too far ahead of the resolvers.
+	select {
+	case s.resolveSem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.resolveWg.Add(1)
+	go func() {
+		defer s.resolveWg.Done()
+		defer func() { <-s.resolveSem }()
+
+		var tracks []Track
+		var errs []error
+		for _, l := range languages {
+			hosters, excluded := filterHosters(l.Hosters, s.Settings.Hosters)
+			if len(hosters) == 0 && len(excluded) > 0 {
+				slog.Warn("All hosters of this episode are excluded by --only-hoster or --exclude-hoster", "season", episodeInfo.Season,
+					"episode", episodeInfo.Episode, "language", l.Lang, "excluded", strings.Join(excluded, ", "))
+				errs = append(errs, fmt.Errorf("%w: all hosters are excluded (%s)", ErrNoHoster, strings.Join(excluded, ", ")))
+				continue
+			}
+			if s.Settings.PreferredHoster != nil {
+				hosters = preferHoster(hosters, s.Settings.PreferredHoster(episodeInfo.Season, episodeInfo.Episode))
+			}
+			if s.Settings.Hoster != "" {
+				picked, ok := pickHoster(hosters, s.Settings.Hoster, s.Settings.NoFallback)
+				if !ok {
+					slog.Warn("The selected hoster isn't available for this episode", "hoster", s.Settings.Hoster,
+						"season", episodeInfo.Season, "episode", episodeInfo.Episode, "language", l.Lang, "available", strings.Join(hosterNames(hosters), ", "))
+				}
+				hosters = picked
+			}
+			track, err := s.resolveStream(ctx, l.Lang, hosters, l.Referer)
+			if err != nil {
+				if len(languages) > 1 {
+					slog.Warn("Failed to resolve language, leaving it out", "season", episodeInfo.Season, "episode", episodeInfo.Episode, "language", l.Lang, "error", err)
+				}
+				errs = append(errs, err)
+				continue
+			}
+			tracks = append(tracks, track)
+		}
+		if len(tracks) == 0 {
+			s.skipResolved(ctx, episodeInfo.Season, episodeInfo.Episode, errors.Join(errs...))
+			return
+		}
+
+		task := &DownloadTaskWrapper{
+			Episode:    episodeInfo,
+			Lang:       tracks[0].Lang,
+			Url:        tracks[0].Url,
+			Referer:    tracks[0].Referer,
+			Hoster:     tracks[0].Hoster,
+			Resolution: tracks[0].Resolution,
+			Refresh:    tracks[0].Refresh,
+		}
+		if len(tracks) > 1 {
+			task.Tracks = tracks
+		}
+		s.Sender <- task
+	}()
+
+	return nil
+}
+
+// videoTypeFromLanguageTitle maps the title of the flag icons ("Deutsch", "mit Untertitel Englisch", ...) to a video type.
+// A language without "Untertitel" is the dub.
+func videoTypeFromLanguageTitle(title string) (VideoType, bool) {
+	vt, _ := ParseVideoType(title)
+	if vt.Language == LanguageUnspecified {
+		return VideoType{}, false
+	}
+	if vt.Type == VideoTypeUnspecified {
+		vt.Type = VideoTypeDub
+	}
+	return vt, true
+}
+
+type hoster struct {
+	Name string
+	Url  string
+}
+
+// resolveUrl makes a link of a page absolute, empty links stay empty.
+func resolveUrl(page, link string) string {
+	if link == "" {
+		return ""
+	}
+	base, err := url.Parse(page)
+	if err != nil {
+		return link
+	}
+	rel, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(rel).String()
+}
+
+// preferHoster moves the hoster with the given name to the front, the order of the others stays the same.
+func preferHoster(hosters []hoster, name string) []hoster {
+	i := slices.IndexFunc(hosters, func(h hoster) bool {
+		return name != "" && strings.EqualFold(h.Name, name)
+	})
+	if i <= 0 {
+		return hosters
+	}
+	sorted := append([]hoster{hosters[i]}, hosters[:i]...)
+	return append(sorted, hosters[i+1:]...)
+}
+
+// pickHoster moves the hoster with the given name to the front, with noFallback it is the only one left.
+// It reports whether the hoster was found at all.
+func pickHoster(hosters []hoster, name string, noFallback bool) ([]hoster, bool) {
+	i := slices.IndexFunc(hosters, func(h hoster) bool {
+		return strings.EqualFold(h.Name, name)
+	})
+	if i < 0 && noFallback {
+		return nil, false
+	}
+	if i < 0 {
+		return hosters, false
+	}
+	if noFallback {
+		return hosters[i : i+1], true
+	}
+	return preferHoster(hosters, name), true
+}
+
+// filterHosters drops the hosters filter doesn't allow and returns the names of the dropped ones.
+func filterHosters(hosters []hoster, filter HosterFilter) ([]hoster, []string) {
+	var kept []hoster
+	var excluded []string
+	for _, h := range hosters {
+		if filter.Allows(h.Name) {
+			kept = append(kept, h)
+		} else {
+			excluded = append(excluded, h.Name)
+		}
+	}
+	return kept, excluded
+}
+
+func hosterNames(hosters []hoster) []string {
+	names := make([]string, len(hosters))
+	for i, h := range hosters {
+		names[i] = h.Name
+	}
+	return names
+}
 
-		slog.Debug("Found stream hoster", "name", stream.Name, "url", absoluteUrl)
-		slog.Info("Trying hoster", "name", stream.Name, "url", absoluteUrl)
+// resolveStream tries the hosters in order and returns the first stream that could be extracted.
+func (s *Scraper) resolveStream(ctx context.Context, videoType VideoType, hosters []hoster, referer string) (Track, error) {
+	var errs []error
+	for _, h := range hosters {
+		slog.Debug("Found stream hoster", "name", h.Name, "url", h.Url)
+		slog.Info("Trying hoster", "name", h.Name, "url", h.Url)
 
-		// Try to extract
-		extracted, err := extractors.ExtractVideoUrlWithExtractor(ctx, absoluteUrl, stream.Name, "", currentUrl)
+		extracted, err := s.extract(ctx, h, referer)
 		if err == nil && extracted != nil {
-			s.Sender <- &DownloadTaskWrapper{
-				Episode: EpisodeInfo{Season: season, Episode: episode, MaxEpisodes: maxEpisodes},
-				Lang:    videoType,
-				Url:     extracted.Url,
-				Referer: extracted.Referer,
+			// a browser playing the video would send the embed page as referer, some CDNs check it together with the user agent.
+			downloadReferer := extracted.Referer
+			if downloadReferer == "" {
+				downloadReferer = h.Url
 			}
-			return nil
+			return Track{
+				Lang:       videoType,
+				Url:        extracted.Url,
+				Referer:    downloadReferer,
+				Hoster:     h.Name,
+				Resolution: extracted.Resolution,
+				// only the hoster that worked, another one would be a different file
+				Refresh: func(ctx context.Context) (string, string, error) {
+					track, err := s.resolveStream(ctx, videoType, []hoster{h}, referer)
+					return track.Url, track.Referer, err
+				},
+			}, nil
+		}
+		if err != nil {
+			slog.Debug("Hoster failed", "name", h.Name, "error", err)
+			errs = append(errs, err)
 		}
 	}
 
-	return fmt.Errorf("no valid hoster found")
+	if len(errs) == 0 {
+		return Track{}, ErrNoHoster
+	}
+	return Track{}, fmt.Errorf("%w: %w", ErrNoHoster, errors.Join(errs...))
 }
 
-func init() {
-	Register(func(u string) (Downloader, error) {
-		if urlRegex.MatchString(u) {
-			return NewAniWorldSerienStream(u)
+// sniffVideo opens a hoster page in the browser and picks the video from its traffic, see NetworkSniffer. Tests
+// replace it.
+var sniffVideo = func(ctx context.Context, url, referer string) (*extractors.ExtractedVideo, error) {
+	return (&NetworkSniffer{}).Sniff(ctx, url, referer)
+}
+
+// extract runs the HTTP extractor of the hoster up to ExtractAttempts times.
+// If it keeps failing and BrowserFallback is set, the hoster page gets opened in the browser instead.
+func (s *Scraper) extract(ctx context.Context, h hoster, referer string) (*extractors.ExtractedVideo, error) {
+	attempts := max(s.Settings.ExtractAttempts, 1)
+
+	var err error
+	for attempt := uint32(1); attempt <= attempts; attempt++ {
+		var extracted *extractors.ExtractedVideo
+		extracted, err = extractors.ExtractVideoUrlWithExtractor(ctx, h.Url, h.Name, s.Settings.UserAgent, referer, s.Settings.Quality)
+		if err == nil && extracted != nil {
+			if looksLikeVideoUrl(extracted.Url) {
+				return extracted, nil
+			}
+			err = fmt.Errorf("%s returned an invalid url %q: %w", h.Name, extracted.Url, extractors.ErrNoSources)
 		}
-		return nil, nil
-	})
+		if ctx.Err() != nil || errors.Is(err, extractors.ErrUnsupported) {
+			break
+		}
+		slog.Debug("Extraction failed", "name", h.Name, "attempt", attempt, "attempts", attempts, "error", err)
+	}
+
+	if !s.Settings.BrowserFallback || ctx.Err() != nil {
+		return nil, err
+	}
+
+	slog.Info("Falling back to browser extraction", "name", h.Name, "error", err)
+	extracted, sniffErr := sniffVideo(ctx, h.Url, referer)
+	if sniffErr != nil {
+		return nil, errors.Join(err, fmt.Errorf("browser extraction: %w", sniffErr))
+	}
+	return extracted, nil
+}
+
+// aniWorldProvider handles AniWorld and SerienStream, both run on the same page layout.
+type aniWorldProvider struct{}
+
+func (aniWorldProvider) Name() string {
+	return "AniWorld/SerienStream"
+}
+
+func (aniWorldProvider) SupportsUrl(url string) bool {
+	return urlRegex.MatchString(url)
+}
+
+func (aniWorldProvider) New(url string) (Downloader, error) {
+	return NewAniWorldSerienStream(url)
+}
+
+func (aniWorldProvider) Info() SiteInfo {
+	return SiteInfo{
+		Name:    "AniWorld/SerienStream",
+		Domains: []string{"aniworld.to", "s.to"},
+		Examples: []string{
+			"https://aniworld.to/anime/stream/<series>[/staffel-<n>[/episode-<n>]]",
+			"https://s.to/serie/stream/<series>[/filme[/film-<n>]]",
+		},
+		Movies:    true,
+		Subtitles: true,
+		Quality:   true,
+	}
+}
+
+func init() {
+	Register(aniWorldProvider{})
 }
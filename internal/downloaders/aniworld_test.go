@@ -0,0 +1,307 @@
+package downloaders
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bugmaschine/gad/internal/extractors"
+)
+
+func TestPickHoster(t *testing.T) {
+	hosters := []hoster{{Name: "VOE"}, {Name: "Filemoon"}, {Name: "Vidoza"}}
+
+	tests := []struct {
+		name       string
+		noFallback bool
+		expected   []string
+		found      bool
+	}{
+		{"filemoon", false, []string{"Filemoon", "VOE", "Vidoza"}, true},
+		{"filemoon", true, []string{"Filemoon"}, true},
+		{"VOE", false, []string{"VOE", "Filemoon", "Vidoza"}, true},
+		{"streamtape", false, []string{"VOE", "Filemoon", "Vidoza"}, false},
+		{"streamtape", true, []string{}, false},
+	}
+
+	for _, tt := range tests {
+		picked, found := pickHoster(hosters, tt.name, tt.noFallback)
+		if names := hosterNames(picked); !slices.Equal(names, tt.expected) || found != tt.found {
+			t.Errorf("%s (no fallback %v)\nExpected: %v %v\nGot:      %v %v", tt.name, tt.noFallback, tt.expected, tt.found, names, found)
+		}
+	}
+}
+
+func TestFilterHosters(t *testing.T) {
+	hosters := []hoster{{Name: "VOE"}, {Name: "Filemoon"}, {Name: "Vidoza"}}
+
+	tests := []struct {
+		filter   HosterFilter
+		expected []string
+		excluded []string
+	}{
+		{HosterFilter{}, []string{"VOE", "Filemoon", "Vidoza"}, nil},
+		{HosterFilter{Exclude: []string{"filemoon"}}, []string{"VOE", "Vidoza"}, []string{"Filemoon"}},
+		{HosterFilter{Only: []string{"vidoza", "voe"}}, []string{"VOE", "Vidoza"}, []string{"Filemoon"}},
+		// an alias of the extractor
+		{HosterFilter{Exclude: []string{"MoonF"}}, []string{"VOE", "Vidoza"}, []string{"Filemoon"}},
+		{HosterFilter{Only: []string{"VOE"}, Exclude: []string{"voe"}}, []string{}, []string{"VOE", "Filemoon", "Vidoza"}},
+		{HosterFilter{Only: []string{"Streamtape"}}, []string{}, []string{"VOE", "Filemoon", "Vidoza"}},
+	}
+
+	for _, tt := range tests {
+		kept, excluded := filterHosters(hosters, tt.filter)
+		if names := hosterNames(kept); !slices.Equal(names, tt.expected) || !slices.Equal(excluded, tt.excluded) {
+			t.Errorf("%+v\nExpected: %v, excluded %v\nGot:      %v, excluded %v", tt.filter, tt.expected, tt.excluded, names, excluded)
+		}
+	}
+}
+
+func TestClassifySeason(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected uint32
+		ok       bool
+	}{
+		{"1", 1, true},
+		{" 12 ", 12, true},
+		{"Filme", 0, true},
+		{"OVAs", 0, true},
+		{"Specials", 0, true},
+		{"0", 0, false},
+		{"Alle Folgen", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := classifySeason(tt.text)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("%q\nExpected: %d %v\nGot:      %d %v", tt.text, tt.expected, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestDropSpecials(t *testing.T) {
+	seasons := []uint32{0, 1, 2}
+	tests := []struct {
+		name     string
+		include  bool
+		payload  AllOrSpecific
+		expected []uint32
+	}{
+		{"all seasons", false, AllOrSpecific{All: true}, []uint32{1, 2}},
+		{"included", true, AllOrSpecific{All: true}, []uint32{0, 1, 2}},
+		{"asked for", false, AllOrSpecific{Specific: []Range{{Begin: 0, End: 1}}}, []uint32{0, 1, 2}},
+		{"other seasons", false, AllOrSpecific{Specific: []Range{{Begin: 1, End: 2}}}, []uint32{1, 2}},
+	}
+
+	for _, tt := range tests {
+		s := &Scraper{Settings: DownloadSettings{IncludeSpecials: tt.include}}
+		if got := s.dropSpecials(seasons, tt.payload); !slices.Equal(got, tt.expected) {
+			t.Errorf("%s\nExpected: %v\nGot:      %v", tt.name, tt.expected, got)
+		}
+	}
+	if !slices.Equal(seasons, []uint32{0, 1, 2}) {
+		t.Errorf("\nExpected: the seasons to stay untouched\nGot:      %v", seasons)
+	}
+}
+
+func TestMissingEpisodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		episodes []uint32
+		expected []uint32
+	}{
+		{"contiguous", []uint32{1, 2, 3}, nil},
+		{"gap", []uint32{1, 2, 4, 5}, []uint32{3}},
+		{"continued numbering", []uint32{13, 14, 16}, []uint32{15}},
+		{"numbered by year", []uint32{2015, 2019, 2023}, nil},
+		{"single", []uint32{7}, nil},
+		{"empty", nil, nil},
+	}
+
+	for _, tt := range tests {
+		if got := missingEpisodes(tt.episodes); !slices.Equal(got, tt.expected) {
+			t.Errorf("%s\nExpected: %v\nGot:      %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestCheckNumbering(t *testing.T) {
+	tests := []struct {
+		name     string
+		season   uint32
+		episodes []uint32
+		payload  AllOrSpecific
+		expected uint32
+	}{
+		{"gap", 1, []uint32{1, 2, 4, 5}, AllOrSpecific{All: true}, 3},
+		{"second gap asked for", 1, []uint32{1, 3, 4, 6}, AllOrSpecific{Specific: []Range{{Begin: 5, End: 6}}}, 5},
+		{"gap not asked for", 1, []uint32{1, 2, 4, 5}, AllOrSpecific{Specific: []Range{{Begin: 4, End: 5}}}, 0},
+		{"specials", 0, []uint32{1, 4}, AllOrSpecific{All: true}, 0},
+		{"no episodes", 2, nil, AllOrSpecific{All: true}, 0},
+	}
+
+	for _, tt := range tests {
+		s := &Scraper{Settings: DownloadSettings{Strict: true}}
+		err := s.checkNumbering(tt.season, tt.episodes, tt.payload)
+		failed := tt.expected != 0 || (tt.season != 0 && len(tt.episodes) == 0)
+
+		var gap Gap
+		if !failed {
+			if err != nil {
+				t.Errorf("%s\nExpected: no error\nGot:      %v", tt.name, err)
+			}
+			continue
+		}
+		if !errors.As(err, &gap) || !errors.Is(err, ErrMissingEpisodes) || gap.Season != tt.season || gap.Episode != tt.expected {
+			t.Errorf("%s\nExpected: a gap at S%dE%d\nGot:      %v", tt.name, tt.season, tt.expected, err)
+		}
+
+		// without --strict the scrape goes on
+		s.Settings.Strict = false
+		if err := s.checkNumbering(tt.season, tt.episodes, tt.payload); err != nil {
+			t.Errorf("%s\nExpected: only a warning\nGot:      %v", tt.name, err)
+		}
+	}
+}
+
+func TestResolverPool(t *testing.T) {
+	const limit, episodes = 2, 6
+
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`sourcesCode: [{src: "https://cdn.example/video.mp4", res: "720"}]`))
+	}))
+	defer server.Close()
+
+	// unbuffered like the channel of the manager, the resolvers block on it until the tasks are read
+	sender := make(chan *DownloadTaskWrapper)
+	s := &Scraper{Sender: sender, resolveSem: make(chan struct{}, limit)}
+
+	var received atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range sender {
+			received.Add(1)
+		}
+	}()
+
+	ctx := context.Background()
+	for i := range episodes {
+		languages := []languageHosters{{Hosters: []hoster{{Name: "Vidoza", Url: server.URL + "/e/" + strconv.Itoa(i)}}}}
+		if err := s.sendStreamToDownloader(ctx, EpisodeInfo{Season: 1, Episode: uint32(i + 1)}, languages); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(s.resolveSem); n > limit {
+			t.Errorf("\nExpected: at most %d resolvers\nGot:      %d", limit, n)
+		}
+	}
+
+	// Scrape waits for the resolvers before the caller closes the channel, a late send would panic
+	s.resolveWg.Wait()
+	close(sender)
+	<-done
+
+	if got := maxInFlight.Load(); got > limit {
+		t.Errorf("\nExpected: at most %d resolvers at once\nGot:      %d", limit, got)
+	}
+	if got := received.Load(); got != episodes {
+		t.Errorf("\nExpected: %d tasks\nGot:      %d", episodes, got)
+	}
+	if err := s.partialError(); err != nil {
+		t.Errorf("\nExpected: no gaps\nGot:      %v", err)
+	}
+}
+
+// flakyExtractor fails the first fails calls, cancel is called on the first one if set.
+type flakyExtractor struct {
+	fails  int
+	calls  int
+	cancel context.CancelFunc
+}
+
+func (e *flakyExtractor) Names() []string                         { return []string{"FlakyTest"} }
+func (e *flakyExtractor) SupportedFrom() extractors.SupportedFrom { return extractors.SupportedFromUrl }
+func (e *flakyExtractor) SupportsUrl(url string) bool             { return false }
+
+func (e *flakyExtractor) ExtractVideoUrl(ctx context.Context, from extractors.ExtractFrom) (*extractors.ExtractedVideo, error) {
+	e.calls++
+	if e.cancel != nil {
+		e.cancel()
+	}
+	if e.calls <= e.fails {
+		return nil, extractors.ErrNoSources
+	}
+	return &extractors.ExtractedVideo{Url: "https://cdn.example/extracted.mp4"}, nil
+}
+
+func TestScraperExtract(t *testing.T) {
+	flaky := &flakyExtractor{}
+	extractors.Register(flaky)
+	sniff := sniffVideo
+	defer func() { sniffVideo = sniff }()
+	sniffed := 0
+	sniffVideo = func(ctx context.Context, url, referer string) (*extractors.ExtractedVideo, error) {
+		sniffed++
+		return &extractors.ExtractedVideo{Url: "https://cdn.example/sniffed.mp4"}, nil
+	}
+
+	tests := []struct {
+		name     string
+		fails    int
+		attempts uint32
+		fallback bool
+		calls    int
+		sniffed  int
+		// url is the one of the result, empty for an error
+		url string
+	}{
+		{"first attempt", 0, 3, true, 1, 0, "https://cdn.example/extracted.mp4"},
+		{"later attempt", 2, 3, true, 3, 0, "https://cdn.example/extracted.mp4"},
+		{"attempts below 1 mean once", 1, 0, false, 1, 0, ""},
+		{"all attempts fail", 3, 3, false, 3, 0, ""},
+		{"browser fallback", 3, 3, true, 3, 1, "https://cdn.example/sniffed.mp4"},
+	}
+
+	for _, tt := range tests {
+		*flaky = flakyExtractor{fails: tt.fails}
+		sniffed = 0
+		s := &Scraper{Settings: DownloadSettings{ExtractAttempts: tt.attempts, BrowserFallback: tt.fallback}}
+		extracted, err := s.extract(context.Background(), hoster{Name: "FlakyTest", Url: "https://flaky.example/e/1"}, "")
+
+		if flaky.calls != tt.calls || sniffed != tt.sniffed {
+			t.Errorf("%s\nExpected: %d attempts, %d browser fallbacks\nGot:      %d, %d", tt.name, tt.calls, tt.sniffed, flaky.calls, sniffed)
+		}
+		switch {
+		case tt.url == "" && !errors.Is(err, extractors.ErrNoSources):
+			t.Errorf("%s\nExpected: %v\nGot:      %v", tt.name, extractors.ErrNoSources, err)
+		case tt.url != "" && (err != nil || extracted.Url != tt.url):
+			t.Errorf("%s\nExpected: %s\nGot:      %+v (%v)", tt.name, tt.url, extracted, err)
+		}
+	}
+
+	// a Ctrl+C during the first attempt stops the attempts and skips the browser
+	ctx, cancel := context.WithCancel(context.Background())
+	*flaky = flakyExtractor{fails: 3, cancel: cancel}
+	sniffed = 0
+	s := &Scraper{Settings: DownloadSettings{ExtractAttempts: 3, BrowserFallback: true}}
+	if _, err := s.extract(ctx, hoster{Name: "FlakyTest", Url: "https://flaky.example/e/1"}, ""); err == nil || flaky.calls != 1 || sniffed != 0 {
+		t.Errorf("canceled\nExpected: 1 attempt, no browser fallback\nGot:      %d, %d (%v)", flaky.calls, sniffed, err)
+	}
+}
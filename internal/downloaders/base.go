@@ -1,19 +1,123 @@
 package downloaders
 
-var downloaders []DownloaderFactory
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
 
-type DownloaderFactory func(url string) (Downloader, error)
+// Provider adds support for a streaming site. To add a site, implement Downloader for it and
+// call Register with its Provider from an init function, GetDownloader picks it up from there.
+type Provider interface {
+	// Name is shown to the user and has to be unique
+	Name() string
+	// SupportsUrl reports whether the url points to a series, season or episode of the site
+	SupportsUrl(url string) bool
+	// New creates the downloader for a supported url
+	New(url string) (Downloader, error)
+	// Info describes the site for list-extractors and the error messages of unsupported urls
+	Info() SiteInfo
+}
 
-func Register(f DownloaderFactory) {
-	downloaders = append(downloaders, f)
+// SiteInfo describes a supported site.
+type SiteInfo struct {
+	Name string
+	// Domains are the hosts of the site, with or without "www."
+	Domains []string
+	// Examples show the supported url forms
+	Examples []string
+	// Movies, Subtitles and Quality tell whether the site has movies besides seasons, subbed languages and
+	// hosters with more than one quality to pick from
+	Movies    bool
+	Subtitles bool
+	Quality   bool
 }
 
-func GetDownloader(url string) (Downloader, error) {
-	for _, f := range downloaders {
-		d, err := f(url)
-		if err == nil && d != nil {
-			return d, nil
+// Capabilities lists what the site supports in words, for the user.
+func (s SiteInfo) Capabilities() []string {
+	capabilities := []string{"series"}
+	if s.Movies {
+		capabilities = append(capabilities, "movies")
+	}
+	if s.Subtitles {
+		capabilities = append(capabilities, "subtitles")
+	}
+	if s.Quality {
+		capabilities = append(capabilities, "quality")
+	}
+	return capabilities
+}
+
+// hasDomain reports whether the lowercase host belongs to the site.
+func (s SiteInfo) hasDomain(host string) bool {
+	host = strings.TrimPrefix(host, "www.")
+	for _, domain := range s.Domains {
+		if host == domain {
+			return true
 		}
 	}
-	return nil, nil
+	return false
+}
+
+var providers []Provider
+
+// Register adds a provider. It panics if one with the same name is registered already, as that is a programming error.
+func Register(p Provider) {
+	for _, existing := range providers {
+		if strings.EqualFold(existing.Name(), p.Name()) {
+			panic(fmt.Sprintf("downloaders: provider %q registered twice", p.Name()))
+		}
+	}
+	providers = append(providers, p)
+}
+
+// GetProviders returns the registered providers in registration order.
+func GetProviders() []Provider {
+	return providers
+}
+
+// SupportedSites describes the sites of the registered providers in registration order.
+func SupportedSites() []SiteInfo {
+	sites := make([]SiteInfo, len(providers))
+	for i, p := range providers {
+		sites[i] = p.Info()
+	}
+	return sites
+}
+
+// Match returns the downloader of the first provider supporting the url. reason explains the result for the user,
+// e.g. that the site is known but the url isn't a series page.
+func Match(rawUrl string) (Downloader, bool, string) {
+	for _, p := range providers {
+		if p.SupportsUrl(rawUrl) {
+			d, err := p.New(rawUrl)
+			if err != nil {
+				return nil, false, fmt.Sprintf("%s can't handle the url: %v", p.Name(), err)
+			}
+			return d, true, fmt.Sprintf("supported by %s", p.Name())
+		}
+	}
+
+	parsed, err := url.Parse(strings.TrimSpace(rawUrl))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, false, "not an http or https url"
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, p := range providers {
+		if info := p.Info(); info.hasDomain(host) {
+			return nil, false, fmt.Sprintf("%s belongs to %s, but the url isn't a series, season, episode or movie page, e.g. %s",
+				host, info.Name, strings.Join(info.Examples, " or "))
+		}
+	}
+	return nil, false, fmt.Sprintf("no downloader for %s", host)
+}
+
+// GetDownloader returns the downloader of the first provider supporting the url.
+// If there is none, the error wraps ErrUnsupportedSite and tells why, see Match.
+func GetDownloader(url string) (Downloader, error) {
+	d, ok, reason := Match(url)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedSite, reason)
+	}
+	return d, nil
 }
@@ -0,0 +1,74 @@
+package downloaders
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGetDownloader(t *testing.T) {
+	tests := []struct {
+		url         string
+		unsupported bool
+	}{
+		{"https://aniworld.to/anime/stream/yuruyuri-happy-go-lily", false},
+		{"https://s.to/serie/stream/die-simpsons/staffel-1/episode-1", false},
+		{"https://example.com/anime/stream/yuruyuri-happy-go-lily", true},
+	}
+
+	for _, tt := range tests {
+		d, err := GetDownloader(tt.url)
+		if tt.unsupported {
+			if !errors.Is(err, ErrUnsupportedSite) {
+				t.Errorf("%s\nExpected: %v\nGot:      %v", tt.url, ErrUnsupportedSite, err)
+			}
+			continue
+		}
+		if err != nil || d == nil {
+			t.Errorf("%s\nExpected: downloader\nGot:      %v", tt.url, err)
+		}
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for a duplicate provider")
+		}
+	}()
+	Register(aniWorldProvider{})
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		url    string
+		ok     bool
+		reason string
+	}{
+		{"https://aniworld.to/anime/stream/yuruyuri-happy-go-lily/staffel-1", true, "supported by AniWorld/SerienStream"},
+		{"https://www.aniworld.to/anime/stream/yuruyuri-happy-go-lily", true, "supported by AniWorld/SerienStream"},
+		{"https://aniworld.to/animes", false, "aniworld.to belongs to AniWorld/SerienStream"},
+		{"https://S.to/serien", false, "s.to belongs to AniWorld/SerienStream"},
+		{"https://example.com/anime/stream/yuruyuri-happy-go-lily", false, "no downloader for example.com"},
+		{"aniworld.to/anime/stream/yuruyuri-happy-go-lily", false, "not an http or https url"},
+	}
+
+	for _, tt := range tests {
+		d, ok, reason := Match(tt.url)
+		if ok != tt.ok || (d != nil) != tt.ok || !strings.HasPrefix(reason, tt.reason) {
+			t.Errorf("%s\nExpected: %v %q\nGot:      %v %q", tt.url, tt.ok, tt.reason, ok, reason)
+		}
+	}
+}
+
+func TestSupportedSites(t *testing.T) {
+	sites := SupportedSites()
+	if len(sites) != len(GetProviders()) {
+		t.Fatalf("\nExpected: %d sites\nGot:      %d", len(GetProviders()), len(sites))
+	}
+	for _, site := range sites {
+		if site.Name == "" || len(site.Domains) == 0 || len(site.Examples) == 0 {
+			t.Errorf("\nExpected: name, domains and examples\nGot:      %+v", site)
+		}
+	}
+}
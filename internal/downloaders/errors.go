@@ -0,0 +1,112 @@
+package downloaders
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoHoster is returned if none of the hosters of an episode could be extracted.
+// The errors of the single extractors are wrapped as well, see extractors.ErrHosterDown and friends.
+var ErrNoHoster = errors.New("no valid hoster found")
+
+// ErrUnsupportedSite is returned by GetDownloader if no registered provider supports the url.
+var ErrUnsupportedSite = errors.New("no downloader supports this url")
+
+// ErrMissingEpisodes is wrapped by the Gap a strict scrape stops with if the episode list of a season skips numbers.
+var ErrMissingEpisodes = errors.New("the episode list skips numbers")
+
+// ErrWall is wrapped by WallError, to check for walls without the details.
+var ErrWall = errors.New("the page asks to log in or to confirm the age")
+
+type WallKind int
+
+const (
+	WallLogin WallKind = iota + 1
+	WallAge
+)
+
+// WallError is returned if a page shows a login or an age confirmation instead of the series, see WithWallDetector.
+type WallError struct {
+	// Url is the page the wall was found on, sites often redirect to their login page
+	Url  string
+	Kind WallKind
+}
+
+func (e *WallError) Error() string {
+	action := "log in"
+	if e.Kind == WallAge {
+		action = "confirm your age"
+	}
+	return fmt.Sprintf("%s asks to %s, run gad with --browser and %s in the browser window while the page is retried", e.Url, action, action)
+}
+
+func (e *WallError) Unwrap() error {
+	return ErrWall
+}
+
+// ErrPageLoad is wrapped by PageLoadError, to check for pages that didn't load without the details.
+var ErrPageLoad = errors.New("the page didn't load")
+
+// PageLoadError is returned if the browser ended up on a blank or error page instead of the one requested, e.g.
+// because the site redirected or blocked the request.
+type PageLoadError struct {
+	Url string
+	// FinalUrl is where the browser ended up after redirects
+	FinalUrl string
+	// Status of the document response, 0 if none was received
+	Status int
+	Reason string
+	// Err is the error of the navigation itself, usually a timeout waiting for the page content
+	Err error
+}
+
+func (e *PageLoadError) Error() string {
+	msg := fmt.Sprintf("%s didn't load: %s", e.Url, e.Reason)
+	if e.FinalUrl != "" && e.FinalUrl != e.Url {
+		msg += ", ended up at " + e.FinalUrl
+	}
+	if e.Status != 0 {
+		msg += fmt.Sprintf(" with status %d", e.Status)
+	}
+	return msg
+}
+
+func (e *PageLoadError) Unwrap() []error {
+	return []error{ErrPageLoad, e.Err}
+}
+
+// Gap is a season or episode that couldn't be scraped, Episode is 0 if the episodes of the whole season are missing.
+type Gap struct {
+	Season  uint32
+	Episode uint32
+	Err     error
+}
+
+func (g Gap) Error() string {
+	if g.Episode == 0 {
+		return fmt.Sprintf("season %d: %v", g.Season, g.Err)
+	}
+	return fmt.Sprintf("season %d episode %d: %v", g.Season, g.Episode, g.Err)
+}
+
+func (g Gap) Unwrap() error {
+	return g.Err
+}
+
+// PartialError is returned by Download, ListEpisodes and InspectEpisodes if some seasons or episodes failed while the rest went through.
+// It is only returned without DownloadSettings.Strict, everything that was found has been sent or listed already.
+type PartialError struct {
+	Gaps []Gap
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("%d seasons or episodes could not be scraped", len(e.Gaps))
+}
+
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, len(e.Gaps))
+	for i, g := range e.Gaps {
+		errs[i] = g
+	}
+	return errs
+}
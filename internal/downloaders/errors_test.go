@@ -0,0 +1,73 @@
+package downloaders
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestScraperSkip(t *testing.T) {
+	errPage := errors.New("page broke")
+	ctx := context.Background()
+
+	s := &Scraper{}
+	if err := s.skip(ctx, 2, 0, errPage); err != nil {
+		t.Fatalf("\nExpected: gap is recorded\nGot:      %v", err)
+	}
+	s.skip(ctx, 3, 5, errPage)
+
+	var partial *PartialError
+	if err := s.partialError(); !errors.As(err, &partial) || len(partial.Gaps) != 2 || !errors.Is(err, errPage) {
+		t.Errorf("\nExpected: 2 gaps wrapping %v\nGot:      %v", errPage, err)
+	}
+	if expected := "season 3 episode 5: page broke"; partial.Gaps[1].Error() != expected {
+		t.Errorf("\nExpected: %s\nGot:      %s", expected, partial.Gaps[1].Error())
+	}
+
+	strict := &Scraper{Settings: DownloadSettings{Strict: true}}
+	if err := strict.skip(ctx, 1, 0, errPage); !errors.Is(err, errPage) {
+		t.Errorf("\nExpected: %v\nGot:      %v", errPage, err)
+	}
+	if err := strict.partialError(); err != nil {
+		t.Errorf("\nExpected: no gaps in strict mode\nGot:      %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := (&Scraper{}).skip(canceled, 1, 1, errPage); !errors.Is(err, context.Canceled) {
+		t.Errorf("\nExpected: %v\nGot:      %v", context.Canceled, err)
+	}
+}
+
+func TestScraperSkipResolved(t *testing.T) {
+	errHosters := errors.New("no hoster resolved")
+	ctx := context.Background()
+
+	s := &Scraper{}
+	s.skipResolved(ctx, 1, 4, errHosters)
+	if err := s.stopError(); err != nil {
+		t.Errorf("\nExpected: no stop error\nGot:      %v", err)
+	}
+	var partial *PartialError
+	if err := s.partialError(); !errors.As(err, &partial) || len(partial.Gaps) != 1 || !errors.Is(err, errHosters) {
+		t.Errorf("\nExpected: 1 gap wrapping %v\nGot:      %v", errHosters, err)
+	}
+
+	strict := &Scraper{Settings: DownloadSettings{Strict: true}}
+	strict.skipResolved(ctx, 1, 4, errHosters)
+	strict.skipResolved(ctx, 1, 5, errors.New("later"))
+	if err := strict.stopError(); !errors.Is(err, errHosters) {
+		t.Errorf("\nExpected: %v\nGot:      %v", errHosters, err)
+	}
+	if err := strict.partialError(); err != nil {
+		t.Errorf("\nExpected: no gaps in strict mode\nGot:      %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	s = &Scraper{}
+	s.skipResolved(canceled, 1, 1, errHosters)
+	if err := s.partialError(); err != nil {
+		t.Errorf("\nExpected: no gap after cancel\nGot:      %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package downloaders
+
+import (
+	"strings"
+	"unicode"
+)
+
+// LanguageAliases maps the lowercase spellings of languages on the sites and on the command line to a language.
+// Add an entry to support another spelling, ParseVideoType picks it up everywhere.
+var LanguageAliases = map[string]Language{
+	"en":         LanguageEnglish,
+	"eng":        LanguageEnglish,
+	"english":    LanguageEnglish,
+	"englisch":   LanguageEnglish,
+	"englischem": LanguageEnglish,
+	"de":         LanguageGerman,
+	"ger":        LanguageGerman,
+	"deu":        LanguageGerman,
+	"german":     LanguageGerman,
+	"deutsch":    LanguageGerman,
+	"deutschem":  LanguageGerman,
+}
+
+// VideoTypeAliases maps the lowercase words for dubs, subs and raws to their kind, like LanguageAliases.
+var VideoTypeAliases = map[string]VideoTypeKind{
+	"dub":        VideoTypeDub,
+	"dubbed":     VideoTypeDub,
+	"synchro":    VideoTypeDub,
+	"sub":        VideoTypeSub,
+	"subs":       VideoTypeSub,
+	"subbed":     VideoTypeSub,
+	"subtitles":  VideoTypeSub,
+	"untertitel": VideoTypeSub,
+	"raw":        VideoTypeRaw,
+}
+
+// ParseLanguage looks up a single word like "de" or "Deutsch" in LanguageAliases.
+func ParseLanguage(s string) Language {
+	return LanguageAliases[strings.ToLower(strings.TrimSpace(s))]
+}
+
+// ParseVideoType normalizes a label like "Deutsch", "German Dub", "GerSub", "Ger/Sub", "german-dub" or
+// "mit Untertitel Englisch" to a video type. Words that are neither a language nor a type are ignored,
+// the parts that weren't found stay unspecified. ok is false if nothing was found at all.
+func ParseVideoType(label string) (VideoType, bool) {
+	var vt VideoType
+	found := false
+	words := strings.FieldsFunc(strings.ToLower(label), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		for _, part := range splitTypeSuffix(word) {
+			if lang, ok := LanguageAliases[part]; ok {
+				vt.Language = lang
+				found = true
+			} else if kind, ok := VideoTypeAliases[part]; ok {
+				vt.Type = kind
+				found = true
+			}
+		}
+	}
+	return vt, found
+}
+
+// splitTypeSuffix splits words like "gerdub" into the language and the type, other words are returned as they are.
+func splitTypeSuffix(word string) []string {
+	if _, ok := LanguageAliases[word]; ok {
+		return []string{word}
+	}
+	for kind := range VideoTypeAliases {
+		if lang, ok := strings.CutSuffix(word, kind); ok {
+			if _, ok := LanguageAliases[lang]; ok {
+				return []string{lang, kind}
+			}
+		}
+	}
+	return []string{word}
+}
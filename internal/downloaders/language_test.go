@@ -0,0 +1,51 @@
+package downloaders
+
+import "testing"
+
+func TestParseVideoType(t *testing.T) {
+	tests := []struct {
+		label    string
+		expected VideoType
+		ok       bool
+	}{
+		{"Deutsch", VideoType{Language: LanguageGerman}, true},
+		{"German Dub", VideoType{Type: VideoTypeDub, Language: LanguageGerman}, true},
+		{"GerSub", VideoType{Type: VideoTypeSub, Language: LanguageGerman}, true},
+		{"Ger/Sub", VideoType{Type: VideoTypeSub, Language: LanguageGerman}, true},
+		{"german-dub", VideoType{Type: VideoTypeDub, Language: LanguageGerman}, true},
+		{"endub", VideoType{Type: VideoTypeDub, Language: LanguageEnglish}, true},
+		{"mit Untertitel Englisch", VideoType{Type: VideoTypeSub, Language: LanguageEnglish}, true},
+		{"mit deutschem Untertitel", VideoType{Type: VideoTypeSub, Language: LanguageGerman}, true},
+		{"sub", VideoType{Type: VideoTypeSub}, true},
+		{"raw", VideoType{Type: VideoTypeRaw}, true},
+		{"klingon", VideoType{}, false},
+		{"", VideoType{}, false},
+	}
+
+	for _, tt := range tests {
+		vt, ok := ParseVideoType(tt.label)
+		if vt != tt.expected || ok != tt.ok {
+			t.Errorf("%q\nExpected: %+v %v\nGot:      %+v %v", tt.label, tt.expected, tt.ok, vt, ok)
+		}
+	}
+}
+
+func TestVideoTypeFromLanguageTitle(t *testing.T) {
+	tests := []struct {
+		title    string
+		expected VideoType
+		ok       bool
+	}{
+		{"Deutsch", VideoType{Type: VideoTypeDub, Language: LanguageGerman}, true},
+		{"mit Untertitel Deutsch", VideoType{Type: VideoTypeSub, Language: LanguageGerman}, true},
+		{"mit Untertitel Englisch", VideoType{Type: VideoTypeSub, Language: LanguageEnglish}, true},
+		{"Japanisch", VideoType{}, false},
+	}
+
+	for _, tt := range tests {
+		vt, ok := videoTypeFromLanguageTitle(tt.title)
+		if vt != tt.expected || ok != tt.ok {
+			t.Errorf("%q\nExpected: %+v %v\nGot:      %+v %v", tt.title, tt.expected, tt.ok, vt, ok)
+		}
+	}
+}
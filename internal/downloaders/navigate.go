@@ -0,0 +1,257 @@
+package downloaders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+// navigationTimeout is the time a single navigation attempt may take, long enough for ddos-guard challenges.
+const navigationTimeout = 45 * time.Second
+
+// DefaultNavRetries is the default of --nav-retries.
+const DefaultNavRetries = 2
+
+// navRetryDelay is the pause before a page gets reloaded, so a site that is briefly overloaded gets a moment.
+var navRetryDelay = time.Second
+
+// navigatePage loads a page, see navigate. Tests replace it.
+var navigatePage = navigate
+
+// navigateWithRetry navigates to url and waits until waitSelector is visible.
+// If that fails, the page gets reloaded up to retries times before giving up.
+func navigateWithRetry(ctx context.Context, url, waitSelector string, retries uint32) error {
+	var err error
+	for attempt := uint32(0); attempt <= retries; attempt++ {
+		if attempt > 0 {
+			slog.Warn("Navigation failed, reloading page", "url", url, "attempt", attempt, "retries", retries, "error", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(navRetryDelay):
+			}
+		}
+
+		err = navigatePage(ctx, url, waitSelector)
+		if err == nil {
+			return nil
+		}
+		// reloading doesn't get past a login, unless the user does it in the window
+		if wallErr := checkWall(ctx); wallErr != nil {
+			return wallErr
+		}
+
+		// no point in retrying if the whole run got cancelled
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// DefaultInfoRetries is the amount of retries of GetSeriesInfo used when the caller didn't configure any.
+const DefaultInfoRetries = 2
+
+// infoRetryDelay is the wait before the first retry of GetSeriesInfo, it doubles with every further one up to
+// maxInfoRetryDelay.
+var infoRetryDelay = 2 * time.Second
+
+const maxInfoRetryDelay = 30 * time.Second
+
+// GetSeriesInfoWithRetry calls dl.GetSeriesInfo and retries it up to retries times with a growing wait in between.
+// It is the first page of a run, so a hiccup of the site or the network shows up there most. Unlike the reloads of
+// --nav-retries every attempt extracts the info again. Walls and a canceled ctx are not retried.
+func GetSeriesInfoWithRetry(ctx context.Context, dl Downloader, retries uint32) (*SeriesInfo, error) {
+	var err error
+	delay := infoRetryDelay
+	for attempt := uint32(0); attempt <= retries; attempt++ {
+		if attempt > 0 {
+			slog.Warn("Failed to get series info, retrying", "attempt", attempt, "retries", retries, "delay", delay, "error", err)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxInfoRetryDelay)
+		}
+
+		var info *SeriesInfo
+		info, err = dl.GetSeriesInfo(ctx)
+		if err == nil {
+			return info, nil
+		}
+		if errors.Is(err, ErrWall) {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, fmt.Errorf("no series info after %d attempts: %w", retries+1, err)
+}
+
+// pageCheckTimeout limits looking at a page that didn't load, the browser may hang on it as well.
+const pageCheckTimeout = 5 * time.Second
+
+func navigate(ctx context.Context, url, waitSelector string) error {
+	navCtx, cancel := context.WithTimeout(ctx, navigationTimeout)
+	defer cancel()
+
+	// the status of the page itself, the network domain is enabled for every tab
+	var mu sync.Mutex
+	var status int
+	chromedp.ListenTarget(navCtx, func(ev any) {
+		if e, ok := ev.(*network.EventResponseReceived); ok && e.Type == network.ResourceTypeDocument {
+			mu.Lock()
+			status = int(e.Response.Status)
+			mu.Unlock()
+		}
+	})
+
+	err := chromedp.Run(navCtx,
+		chromedp.Navigate(url),
+		chromedp.WaitVisible(waitSelector, chromedp.ByQuery),
+	)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	mu.Lock()
+	page := loadedPage{Status: status}
+	mu.Unlock()
+	checkCtx, cancelCheck := context.WithTimeout(ctx, pageCheckTimeout)
+	defer cancelCheck()
+	if checkErr := chromedp.Run(checkCtx,
+		chromedp.Location(&page.Url),
+		chromedp.Evaluate(`document.body ? document.body.innerText.trim().length : 0`, &page.TextLength),
+	); checkErr != nil {
+		slog.Debug("Failed to inspect the page that didn't load", "url", url, "error", checkErr)
+		return err
+	}
+	if loadErr := page.check(url); loadErr != nil {
+		loadErr.Err = err
+		return loadErr
+	}
+	return err
+}
+
+// loadedPage is what the browser shows after a navigation that didn't find the expected content.
+type loadedPage struct {
+	Url        string
+	Status     int
+	TextLength int
+}
+
+// check returns a PageLoadError if the page is blank or an error page, nil if it looks like a real page that just
+// misses the expected content.
+func (p loadedPage) check(requested string) *PageLoadError {
+	var reason string
+	switch {
+	case p.Url == "" || p.Url == "about:blank":
+		reason = "the browser stayed on a blank page"
+	case strings.HasPrefix(p.Url, "chrome-error://"):
+		reason = "the browser showed its error page, the site may be down or blocked"
+	case p.Status >= 400:
+		reason = "the site answered with an error"
+	case p.TextLength == 0:
+		reason = "the page is empty"
+	default:
+		return nil
+	}
+	return &PageLoadError{Url: requested, FinalUrl: p.Url, Status: p.Status, Reason: reason}
+}
+
+type adblockKey struct{}
+
+// WithoutAdblock marks a browser context that runs without an ad blocker, see AdblockMissing.
+func WithoutAdblock(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adblockKey{}, true)
+}
+
+// AdblockMissing reports whether the browser of ctx runs without an ad blocker, so popups have to be expected.
+func AdblockMissing(ctx context.Context) bool {
+	missing, _ := ctx.Value(adblockKey{}).(bool)
+	return missing
+}
+
+type visibleKey struct{}
+
+// WithVisibleBrowser marks a browser context whose window is shown, so the user can interact with the page.
+func WithVisibleBrowser(ctx context.Context) context.Context {
+	return context.WithValue(ctx, visibleKey{}, true)
+}
+
+// BrowserVisible reports whether the browser window of ctx is shown.
+func BrowserVisible(ctx context.Context) bool {
+	visible, _ := ctx.Value(visibleKey{}).(bool)
+	return visible
+}
+
+type tabListenerKey struct{}
+
+// WithTabListener attaches a function to a browser context that is called with every tab scrapers open in it, e.g.
+// to record the network traffic of the scrape.
+func WithTabListener(ctx context.Context, listen func(tabCtx context.Context)) context.Context {
+	return context.WithValue(ctx, tabListenerKey{}, listen)
+}
+
+// listenTab passes a new tab to the listener of ctx, before anything runs in it.
+func listenTab(ctx context.Context) {
+	if listen, _ := ctx.Value(tabListenerKey{}).(func(context.Context)); listen != nil {
+		listen(ctx)
+	}
+}
+
+type wallKey struct{}
+
+// WithWallDetector attaches a check for login and age walls to a browser context. detect inspects the current page
+// and returns a *WallError if it found one, otherwise nil. Pages that don't load run it to explain why.
+func WithWallDetector(ctx context.Context, detect func(ctx context.Context) error) context.Context {
+	return context.WithValue(ctx, wallKey{}, detect)
+}
+
+// checkWall runs the wall detector of ctx. In a visible browser the wall is only logged, the user can pass it in the
+// window while the page is retried.
+func checkWall(ctx context.Context) error {
+	detect, _ := ctx.Value(wallKey{}).(func(ctx context.Context) error)
+	if detect == nil {
+		return nil
+	}
+	err := detect(ctx)
+	if err != nil && BrowserVisible(ctx) {
+		slog.Warn("Log in or confirm your age in the browser window, the page is loaded again", "error", err)
+		return nil
+	}
+	return err
+}
+
+// closePopups closes every tab the page opens for as long as ctx lives. Without an ad blocker the first click
+// on a page often opens an ad, which would otherwise pile up tabs.
+func closePopups(ctx context.Context) {
+	c := chromedp.FromContext(ctx)
+	if c == nil || c.Browser == nil {
+		return
+	}
+	chromedp.ListenTarget(ctx, func(ev any) {
+		created, ok := ev.(*target.EventTargetCreated)
+		if !ok || created.TargetInfo.Type != "page" || created.TargetInfo.OpenerID == "" {
+			return
+		}
+		// listeners must not block, the command needs the event loop
+		go func() {
+			slog.Debug("Closing popup", "url", created.TargetInfo.URL)
+			if err := target.CloseTarget(created.TargetInfo.TargetID).Do(cdp.WithExecutor(ctx, c.Browser)); err != nil && ctx.Err() == nil {
+				slog.Debug("Failed to close popup", "error", err)
+			}
+		}()
+	})
+}
@@ -0,0 +1,186 @@
+package downloaders
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdblockMissing(t *testing.T) {
+	ctx := context.Background()
+	if AdblockMissing(ctx) {
+		t.Error("a plain context must not be marked")
+	}
+	if !AdblockMissing(WithoutAdblock(ctx)) {
+		t.Error("expected the context to be marked")
+	}
+}
+
+func TestCheckWall(t *testing.T) {
+	wall := &WallError{Url: "https://aniworld.to/login", Kind: WallLogin}
+	detect := func(ctx context.Context) error { return wall }
+
+	if err := checkWall(context.Background()); err != nil {
+		t.Errorf("\nExpected: no detector, no error\nGot:      %v", err)
+	}
+	if err := checkWall(WithWallDetector(context.Background(), detect)); !errors.Is(err, ErrWall) {
+		t.Errorf("\nExpected: %v\nGot:      %v", ErrWall, err)
+	}
+	// the user can log in in a visible window, so the page is retried instead
+	if err := checkWall(WithVisibleBrowser(WithWallDetector(context.Background(), detect))); err != nil {
+		t.Errorf("\nExpected: no error in a visible browser\nGot:      %v", err)
+	}
+}
+
+func TestLoadedPageCheck(t *testing.T) {
+	const url = "https://aniworld.to/anime/stream/test"
+	tests := []struct {
+		page   loadedPage
+		failed bool
+	}{
+		{loadedPage{Url: url, Status: 200, TextLength: 1200}, false},
+		{loadedPage{Url: "about:blank"}, true},
+		{loadedPage{Url: ""}, true},
+		{loadedPage{Url: "chrome-error://chromewebdata/", TextLength: 300}, true},
+		{loadedPage{Url: url, Status: 403, TextLength: 500}, true},
+		{loadedPage{Url: url, Status: 200}, true},
+		// no response seen, e.g. served from the cache
+		{loadedPage{Url: url, TextLength: 1200}, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.page.check(url)
+		if (err != nil) != tt.failed {
+			t.Errorf("%+v\nExpected: failed %v\nGot:      %v", tt.page, tt.failed, err)
+		}
+	}
+
+	err := error(loadedPage{Url: "https://aniworld.to/", Status: 404}.check(url))
+	if !errors.Is(err, ErrPageLoad) {
+		t.Errorf("\nExpected: %v\nGot:      %v", ErrPageLoad, err)
+	}
+	var loadErr *PageLoadError
+	if !errors.As(err, &loadErr) || loadErr.FinalUrl != "https://aniworld.to/" || loadErr.Status != 404 {
+		t.Errorf("\nExpected: final url and status\nGot:      %v", err)
+	}
+}
+
+// flakyInfo fails GetSeriesInfo with the errors in order, then succeeds.
+type flakyInfo struct {
+	Downloader
+	errs  []error
+	calls int
+}
+
+func (f *flakyInfo) GetSeriesInfo(ctx context.Context) (*SeriesInfo, error) {
+	f.calls++
+	if f.calls <= len(f.errs) {
+		return nil, f.errs[f.calls-1]
+	}
+	return &SeriesInfo{Title: "Yuru Yuri"}, nil
+}
+
+func TestGetSeriesInfoWithRetry(t *testing.T) {
+	infoRetryDelay = time.Millisecond
+	defer func() { infoRetryDelay = 2 * time.Second }()
+
+	timeout := errors.New("navigation timed out")
+	wall := &WallError{Url: "https://aniworld.to/login", Kind: WallLogin}
+
+	tests := []struct {
+		name    string
+		errs    []error
+		retries uint32
+		calls   int
+		valid   bool
+	}{
+		{"first attempt", nil, 2, 1, true},
+		{"transient", []error{timeout, timeout}, 2, 3, true},
+		{"all attempts fail", []error{timeout, timeout, timeout}, 2, 3, false},
+		{"no retries", []error{timeout}, 0, 1, false},
+		{"wall", []error{wall}, 2, 1, false},
+	}
+
+	for _, tt := range tests {
+		dl := &flakyInfo{errs: tt.errs}
+		info, err := GetSeriesInfoWithRetry(context.Background(), dl, tt.retries)
+		if (err == nil) != tt.valid || dl.calls != tt.calls {
+			t.Errorf("%s\nExpected: %d calls (valid=%v)\nGot:      %d (%v)", tt.name, tt.calls, tt.valid, dl.calls, err)
+		}
+		if tt.valid && info.Title != "Yuru Yuri" {
+			t.Errorf("%s\nExpected: %q\nGot:      %q", tt.name, "Yuru Yuri", info.Title)
+		}
+		// the last error is kept, so callers can still tell what went wrong
+		if !tt.valid && len(tt.errs) > 0 && !errors.Is(err, tt.errs[len(tt.errs)-1]) {
+			t.Errorf("%s\nExpected: %v\nGot:      %v", tt.name, tt.errs[len(tt.errs)-1], err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GetSeriesInfoWithRetry(ctx, &flakyInfo{errs: []error{timeout}}, 2); !errors.Is(err, context.Canceled) {
+		t.Errorf("\nExpected: %v\nGot:      %v", context.Canceled, err)
+	}
+}
+
+func TestNavigateWithRetry(t *testing.T) {
+	navRetryDelay = time.Millisecond
+	defer func() {
+		navRetryDelay = time.Second
+		navigatePage = navigate
+	}()
+
+	timeout := errors.New("navigation timed out")
+	wall := &WallError{Url: "https://aniworld.to/login", Kind: WallLogin}
+
+	tests := []struct {
+		name    string
+		errs    []error
+		wall    bool
+		retries uint32
+		calls   int
+		valid   bool
+	}{
+		{"first attempt", nil, false, 2, 1, true},
+		{"retries then succeeds", []error{timeout, timeout}, false, 2, 3, true},
+		{"all attempts fail", []error{timeout, timeout, timeout}, false, 2, 3, false},
+		{"no retries", []error{timeout}, false, 0, 1, false},
+		{"wall stops retrying", []error{timeout}, true, 2, 1, false},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		navigatePage = func(ctx context.Context, url, waitSelector string) error {
+			calls++
+			if calls <= len(tt.errs) {
+				return tt.errs[calls-1]
+			}
+			return nil
+		}
+		ctx := context.Background()
+		if tt.wall {
+			ctx = WithWallDetector(ctx, func(ctx context.Context) error { return wall })
+		}
+
+		err := navigateWithRetry(ctx, "https://aniworld.to/anime/stream/yuruyuri-happy-go-lily", "h1", tt.retries)
+		if (err == nil) != tt.valid || calls != tt.calls {
+			t.Errorf("%s\nExpected: %d calls (valid=%v)\nGot:      %d (%v)", tt.name, tt.calls, tt.valid, calls, err)
+		}
+		if tt.wall && !errors.Is(err, ErrWall) {
+			t.Errorf("%s\nExpected: %v\nGot:      %v", tt.name, ErrWall, err)
+		}
+	}
+
+	// the stub cancels like a Ctrl+C during the first attempt
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	navigatePage = func(ctx context.Context, url, waitSelector string) error {
+		calls++
+		cancel()
+		return timeout
+	}
+	if err := navigateWithRetry(ctx, "https://aniworld.to", "h1", 2); !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("cancelled ctx stops\nExpected: 1 call (%v)\nGot:      %d (%v)", context.Canceled, calls, err)
+	}
+}
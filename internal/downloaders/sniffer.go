@@ -0,0 +1,94 @@
+package downloaders
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bugmaschine/gad/internal/extractors"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// DefaultSniffTimeout is how long the sniffer waits for the player to request a stream.
+const DefaultSniffTimeout = 30 * time.Second
+
+// NetworkSniffer opens a hoster page in a new browser tab and captures the first request for a video stream.
+// It is the slow but robust path for hosters whose player can't be replicated with plain HTTP requests.
+type NetworkSniffer struct {
+	Timeout time.Duration
+}
+
+// Sniff needs a chromedp context, the page is opened in a new tab of that browser.
+func (n *NetworkSniffer) Sniff(ctx context.Context, pageUrl, referer string) (*extractors.ExtractedVideo, error) {
+	timeout := n.Timeout
+	if timeout == 0 {
+		timeout = DefaultSniffTimeout
+	}
+
+	tabCtx, cancelTab := chromedp.NewContext(ctx)
+	defer cancelTab()
+	listenTab(tabCtx)
+	tabCtx, cancel := context.WithTimeout(tabCtx, timeout)
+	defer cancel()
+
+	found := make(chan string, 1)
+	chromedp.ListenTarget(tabCtx, func(ev interface{}) {
+		if e, ok := ev.(*network.EventRequestWillBeSent); ok && isStreamUrl(e.Request.URL) {
+			select {
+			case found <- e.Request.URL:
+			default:
+			}
+		}
+	})
+
+	actions := []chromedp.Action{network.Enable()}
+	if referer != "" {
+		actions = append(actions, network.SetExtraHTTPHeaders(network.Headers{"Referer": referer}))
+	}
+	actions = append(actions, chromedp.Navigate(pageUrl))
+	if err := chromedp.Run(tabCtx, actions...); err != nil {
+		return nil, fmt.Errorf("failed to open hoster page: %w", err)
+	}
+
+	// most players only load the stream once playback starts
+	var ignored interface{}
+	if err := chromedp.Run(tabCtx, chromedp.Evaluate(`document.querySelector("video")?.play()?.catch(() => {}); true`, &ignored)); err != nil {
+		slog.Debug("Failed to start playback", "error", err)
+	}
+
+	select {
+	case streamUrl := <-found:
+		var location string
+		_ = chromedp.Run(tabCtx, chromedp.Location(&location))
+		if location == "" {
+			location = pageUrl
+		}
+		return &extractors.ExtractedVideo{
+			Url:     streamUrl,
+			Referer: location,
+			IsM3U8:  strings.Contains(strings.ToLower(streamUrl), ".m3u8"),
+		}, nil
+	case <-tabCtx.Done():
+		return nil, fmt.Errorf("no stream requested within %s: %w", timeout, extractors.ErrNoSources)
+	}
+}
+
+// isStreamUrl reports whether a request loads a playlist or a video file.
+func isStreamUrl(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	path := strings.ToLower(u.Path)
+	return strings.HasSuffix(path, ".m3u8") || strings.HasSuffix(path, ".mpd") || strings.HasSuffix(path, ".mp4")
+}
+
+// looksLikeVideoUrl catches the obviously wrong results of an extractor, like relative paths or decoded garbage.
+func looksLikeVideoUrl(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
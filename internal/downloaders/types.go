@@ -3,6 +3,10 @@ package downloaders
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bugmaschine/gad/internal/extractors"
 )
 
 type Language int
@@ -35,6 +39,18 @@ func (l Language) GetNameLong() string {
 	}
 }
 
+// Code returns the ISO 639-2 code of the language, "und" if it is unspecified.
+func (l Language) Code() string {
+	switch l {
+	case LanguageEnglish:
+		return "eng"
+	case LanguageGerman:
+		return "ger"
+	default:
+		return "und"
+	}
+}
+
 type VideoType struct {
 	Type     VideoTypeKind
 	Language Language
@@ -68,6 +84,114 @@ func (vt VideoType) String() string {
 	}
 }
 
+// AudioLanguage returns the ISO 639-2 code of the audio track. Subs and raws carry the original audio,
+// which the sites don't name, so it is "und".
+func (vt VideoType) AudioLanguage() string {
+	if vt.Type != VideoTypeDub {
+		return "und"
+	}
+	return vt.Language.Code()
+}
+
+// SubtitleLanguage returns the ISO 639-2 code of the subtitles burned into the video, "und" if there are none.
+func (vt VideoType) SubtitleLanguage() string {
+	if vt.Type != VideoTypeSub {
+		return "und"
+	}
+	return vt.Language.Code()
+}
+
+// SkipMode decides what happens with episodes that already exist in the save directory.
+type SkipMode int
+
+const (
+	// SkipModeOff downloads everything, but never touches existing files.
+	SkipModeOff SkipMode = iota
+	// SkipModeByName skips an episode if a file with its name exists.
+	SkipModeByName
+	// SkipModeByNameAndSize additionally requires the size to match the one recorded in the series state.
+	SkipModeByNameAndSize
+	// SkipModeOverwrite downloads everything again and replaces existing files.
+	SkipModeOverwrite
+)
+
+func (m SkipMode) String() string {
+	switch m {
+	case SkipModeByName:
+		return "by-name"
+	case SkipModeByNameAndSize:
+		return "by-name-and-size"
+	case SkipModeOverwrite:
+		return "overwrite"
+	default:
+		return "off"
+	}
+}
+
+// Skips reports whether existing episodes are looked up at all.
+func (m SkipMode) Skips() bool {
+	return m == SkipModeByName || m == SkipModeByNameAndSize
+}
+
+// Matches reports whether vt satisfies the requested video type, unspecified parts match everything.
+func (vt VideoType) Matches(requested VideoType) bool {
+	if requested.Type != VideoTypeUnspecified && requested.Type != vt.Type {
+		return false
+	}
+	if requested.Language != LanguageUnspecified && requested.Language != vt.Language {
+		return false
+	}
+	return true
+}
+
+// LanguagePreference is the order in which video types are picked if the user didn't ask for a specific one.
+var LanguagePreference = []VideoType{
+	{Type: VideoTypeDub, Language: LanguageGerman},
+	{Type: VideoTypeSub, Language: LanguageGerman},
+	{Type: VideoTypeSub, Language: LanguageEnglish},
+	{Type: VideoTypeDub, Language: LanguageEnglish},
+}
+
+// SelectVideoType returns the index of the best available video type matching the request.
+func SelectVideoType(available []VideoType, requested VideoType) (int, bool) {
+	for _, preferred := range LanguagePreference {
+		if !preferred.Matches(requested) {
+			continue
+		}
+		for i, vt := range available {
+			if vt == preferred {
+				return i, true
+			}
+		}
+	}
+
+	// everything else that isn't part of the preference list, e.g. raw
+	for i, vt := range available {
+		if vt.Matches(requested) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// SelectVideoTypes returns the indices of every available video type matching one of the requested ones, in the
+// order they were requested. Without requested types everything is returned in the order of LanguagePreference.
+func SelectVideoTypes(available []VideoType, requested []VideoType) []int {
+	if len(requested) == 0 {
+		requested = append(slices.Clone(LanguagePreference), VideoType{})
+	}
+
+	var indices []int
+	for _, r := range requested {
+		for i, vt := range available {
+			if vt.Matches(r) && !slices.Contains(indices, i) {
+				indices = append(indices, i)
+			}
+		}
+	}
+	return indices
+}
+
 type EpisodesRequest struct {
 	Kind    EpisodesRequestKind
 	Payload AllOrSpecific
@@ -99,6 +223,8 @@ type ExtractorMatch struct {
 type SeriesInfo struct {
 	Title       string
 	Description string
+	// CoverUrl is the poster of the series, empty if the site has none
+	CoverUrl string
 }
 
 type EpisodeInfo struct {
@@ -106,13 +232,41 @@ type EpisodeInfo struct {
 	Episode     uint32
 	Title       string
 	MaxEpisodes uint32
+	// ThumbnailUrl and AirDate are optional, not every site has them
+	ThumbnailUrl string
+	AirDate      string
 }
 
 type DownloadSettings struct {
-	DdosWaitEpisodes uint32
-	DdosWaitMs       uint32
-	SkipExisting     bool
-	CheckIfExists    func(season, episode, maxEpisodes uint32, videoType *VideoType) bool
+	DdosWaitEpisodes   uint32
+	DdosWaitMs         uint32
+	NavRetries         uint32
+	ResolveConcurrency uint32
+	SkipExisting       SkipMode
+	// UserAgent is passed to the extractors, it should match the one of the browser and the downloads.
+	UserAgent string
+	// ExtractAttempts is how often a hoster's HTTP extractor is tried, values below 1 mean once.
+	ExtractAttempts uint32
+	// BrowserFallback opens the hoster page in the browser if the HTTP extractor keeps failing.
+	BrowserFallback bool
+	// Quality limits the variant picked from the ones a hoster offers, the zero value picks the best one.
+	Quality       extractors.QualityCap
+	CheckIfExists func(season, episode, maxEpisodes uint32, videoType *VideoType) bool
+	// EpisodeFilter can drop episodes before they are scraped, nil keeps everything.
+	EpisodeFilter func(season, episode uint32) bool
+	// PreferredHoster returns the name of a hoster to try first for an episode, e.g. the one that worked last time.
+	PreferredHoster func(season, episode uint32) string
+	// Hoster is tried first for every episode, before PreferredHoster. With NoFallback the other hosters aren't tried at all.
+	Hoster     string
+	NoFallback bool
+	// Hosters drops the hosters that must not be tried before any other setting picks one.
+	Hosters HosterFilter
+	// IncludeSpecials keeps season 0, the movies, specials and OVAs of a series, when all of its seasons are
+	// scraped. They are always scraped if they were asked for directly.
+	IncludeSpecials bool
+	// Strict stops at the first season or episode that can't be scraped. Otherwise they are skipped and
+	// reported together in a PartialError once everything else is done.
+	Strict bool
 }
 
 type DownloadRequest struct {
@@ -122,16 +276,105 @@ type DownloadRequest struct {
 	SaveDirectory       string
 	SeriesTitle         string
 	ExtractorPriorities []ExtractorMatch
+	// MultiLanguage downloads every video type of Languages that an episode has and muxes them into one file.
+	// Without Languages every available one is used. Language is ignored then.
+	MultiLanguage bool
+	Languages     []VideoType
 }
 
+// Downloader scrapes a series from one site, it is created by the Provider the url belongs to.
 type Downloader interface {
+	// GetSeriesInfo returns the title of the series, it is used for the folder and file names.
 	GetSeriesInfo(ctx context.Context) (*SeriesInfo, error)
+	// Download finds the requested episodes and sends a task for each stream that could be extracted.
+	// settings.CheckIfExists and settings.EpisodeFilter have to be honored before doing any work for an episode.
+	// It returns once all tasks are sent, the sender is closed by the caller.
 	Download(ctx context.Context, request DownloadRequest, settings DownloadSettings, sender chan<- *DownloadTaskWrapper) error
 }
 
+// EpisodeLister is implemented by downloaders that can enumerate the episodes of a request without downloading them.
+type EpisodeLister interface {
+	ListEpisodes(ctx context.Context, request DownloadRequest, settings DownloadSettings) ([]EpisodeInfo, error)
+}
+
+// EpisodeInspector is implemented by downloaders that can read the languages and hosters of the episodes of a request
+// without extracting any stream. settings.EpisodeFilter has to be honored before opening an episode.
+type EpisodeInspector interface {
+	InspectEpisodes(ctx context.Context, request DownloadRequest, settings DownloadSettings) ([]EpisodeDetails, error)
+}
+
+// EpisodeDetails is an episode with everything its page offers.
+type EpisodeDetails struct {
+	EpisodeInfo
+	Languages []LanguageDetails
+}
+
+// LanguageDetails lists the names of the hosters offering an episode in one language.
+type LanguageDetails struct {
+	Language VideoType
+	Hosters  []string
+}
+
 type DownloadTaskWrapper struct {
 	Episode EpisodeInfo
 	Lang    VideoType
 	Url     string
 	Referer string
+	// Hoster is the name of the hoster the stream was extracted from
+	Hoster string
+	// Resolution is the height of the variant the extractor picked, 0 if unknown
+	Resolution int
+	// Refresh resolves Url again, nil if that's not possible
+	Refresh RefreshFunc
+	// Tracks holds every language of a multi language download, the fields above are the ones of the first.
+	Tracks []Track
+	// Part is set if the episode is split into several files, each of them is a task of its own
+	Part Part
+}
+
+// Part marks one file of an episode that a hoster split into several. The parts of a Group are downloaded and
+// joined into one file in Index order, from 1 to Count. The zero value is a complete episode.
+type Part struct {
+	Group string
+	Index int
+	Count int
+}
+
+// Track is the stream of one language of an episode.
+type Track struct {
+	Lang       VideoType
+	Url        string
+	Referer    string
+	Hoster     string
+	Resolution int
+	// Refresh extracts the stream from the same hoster again, nil if that's not possible
+	Refresh RefreshFunc
+}
+
+// RefreshFunc resolves a stream again, e.g. because the signed URL of a hoster expired during the download.
+type RefreshFunc func(ctx context.Context) (url, referer string, err error)
+
+// HosterFilter is the value of --only-hoster and --exclude-hoster. The names are compared like the names of the
+// extractors, so an alias matches the hoster as well.
+type HosterFilter struct {
+	// Only keeps just these hosters, empty keeps all of them
+	Only    []string
+	Exclude []string
+}
+
+// Allows reports whether the hoster with the name may be tried.
+func (f HosterFilter) Allows(name string) bool {
+	matches := func(n string) bool { return sameHoster(n, name) }
+	if len(f.Only) > 0 && !slices.ContainsFunc(f.Only, matches) {
+		return false
+	}
+	return !slices.ContainsFunc(f.Exclude, matches)
+}
+
+func sameHoster(a, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	ea, eb := extractors.GetExtractorByName(a), extractors.GetExtractorByName(b)
+	return ea != nil && eb != nil && ea.Names()[0] == eb.Names()[0]
 }
@@ -2,6 +2,8 @@ package extractors
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -18,6 +20,9 @@ type ExtractedVideo struct {
 	UserAgent string
 	IsM3U8    bool
 	Filename  string
+	// Resolution and Bandwidth are of the variant the extractor picked, 0 if the hoster doesn't tell
+	Resolution int
+	Bandwidth  int
 }
 
 type Extractor interface {
@@ -32,6 +37,8 @@ type ExtractFrom struct {
 	UserAgent string
 	Referer   string
 	Source    string
+	// Quality limits the variant picked by a VariantExtractor, the zero value picks the best one.
+	Quality QualityCap
 }
 
 var registry []Extractor
@@ -59,22 +66,31 @@ func ExistsExtractorWithName(name string) bool {
 	return GetExtractorByName(name) != nil
 }
 
-func ExtractVideoUrl(ctx context.Context, url string, userAgent, referer string) (*ExtractedVideo, error) {
+// ExtractVideoUrl tries every extractor that supports the url. If none does, the error wraps ErrUnsupported,
+// otherwise the errors of the extractors that failed get joined.
+func ExtractVideoUrl(ctx context.Context, url string, userAgent, referer string, quality QualityCap) (*ExtractedVideo, error) {
+	var errs []error
 	for _, e := range registry {
 		if (e.SupportedFrom()&SupportedFromUrl) != 0 && e.SupportsUrl(url) {
-			res, err := e.ExtractVideoUrl(ctx, ExtractFrom{Url: url, UserAgent: userAgent, Referer: referer})
+			res, err := e.ExtractVideoUrl(ctx, ExtractFrom{Url: url, UserAgent: userAgent, Referer: referer, Quality: quality})
 			if err == nil && res != nil {
 				return res, nil
 			}
+			if err != nil {
+				errs = append(errs, err)
+			}
 		}
 	}
-	return nil, nil
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no extractor for %s: %w", url, ErrUnsupported)
+	}
+	return nil, errors.Join(errs...)
 }
 
-func ExtractVideoUrlWithExtractor(ctx context.Context, url string, name string, userAgent, referer string) (*ExtractedVideo, error) {
+func ExtractVideoUrlWithExtractor(ctx context.Context, url string, name string, userAgent, referer string, quality QualityCap) (*ExtractedVideo, error) {
 	e := GetExtractorByName(name)
 	if e == nil {
-		return nil, nil
+		return nil, fmt.Errorf("no extractor named %s: %w", name, ErrUnsupported)
 	}
-	return e.ExtractVideoUrl(ctx, ExtractFrom{Url: url, UserAgent: userAgent, Referer: referer})
+	return e.ExtractVideoUrl(ctx, ExtractFrom{Url: url, UserAgent: userAgent, Referer: referer, Quality: quality})
 }
@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"regexp"
 	"time"
+
+	"github.com/bugmaschine/gad/pkg/httpclient"
 )
 
 type Doodstream struct{}
@@ -38,10 +40,9 @@ func (d *Doodstream) SupportsUrl(url string) bool {
 
 func (d *Doodstream) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*ExtractedVideo, error) {
 	if from.Url == "" {
-		return nil, fmt.Errorf("Doodstream: from source is unsupported")
+		return nil, fmt.Errorf("Doodstream: extracting from source is %w", ErrUnsupported)
 	}
 
-	client := &http.Client{}
 	req, err := http.NewRequestWithContext(ctx, "GET", from.Url, nil)
 	if err != nil {
 		return nil, err
@@ -53,9 +54,9 @@ func (d *Doodstream) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*Ex
 		req.Header.Set("Referer", from.Referer)
 	}
 
-	resp, err := client.Do(req)
+	resp, err := httpclient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("Doodstream: failed to retrieve sources: %w", err)
+		return nil, fmt.Errorf("Doodstream: %w: %w", ErrHosterDown, err)
 	}
 	defer resp.Body.Close()
 
@@ -68,7 +69,7 @@ func (d *Doodstream) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*Ex
 	fetchRe := regexp.MustCompile(`(?s)\$\.get\(\s*['"](/pass_md5/[\w-]+/([\w-]+))['"]\s*,\s*function\(\s*data\s*\)`)
 	matches := fetchRe.FindStringSubmatch(source)
 	if len(matches) < 3 {
-		return nil, fmt.Errorf("Doodstream: failed to retrieve sources (no match)")
+		return nil, fmt.Errorf("Doodstream: %w (no match)", ErrNoSources)
 	}
 
 	relativeFetchUrl := matches[1]
@@ -88,7 +89,7 @@ func (d *Doodstream) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*Ex
 		req2.Header.Set("User-Agent", from.UserAgent)
 	}
 
-	resp2, err := client.Do(req2)
+	resp2, err := httpclient.Do(req2)
 	if err != nil {
 		return nil, err
 	}
@@ -127,6 +128,10 @@ func ioReadAll(r io.Reader) ([]byte, error) {
 	return io.ReadAll(r)
 }
 
+func (d *Doodstream) ExtractTitle(ctx context.Context, from ExtractFrom) (string, error) {
+	return pageTitle(ctx, from)
+}
+
 // Ensure init registers it
 func init() {
 	Register(&Doodstream{})
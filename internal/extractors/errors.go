@@ -0,0 +1,13 @@
+package extractors
+
+import "errors"
+
+// Errors wrapped by the extractors, so callers can tell the failures apart with errors.Is.
+var (
+	// ErrUnsupported means that no extractor (or not the chosen one) can handle the input.
+	ErrUnsupported = errors.New("unsupported")
+	// ErrHosterDown means the hoster didn't deliver the page, e.g. because the video was removed or access was denied.
+	ErrHosterDown = errors.New("hoster is down")
+	// ErrNoSources means the page could be loaded, but no video was found in it.
+	ErrNoSources = errors.New("failed to retrieve sources")
+)
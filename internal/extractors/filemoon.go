@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+
+	"github.com/bugmaschine/gad/pkg/httpclient"
 )
 
 type Filemoon struct{}
@@ -52,7 +54,7 @@ func (f *Filemoon) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*Extr
 		}
 		req.Header.Set("sec-fetch-dest", "iframe")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := httpclient.Do(req)
 		if err != nil {
 			return nil, err
 		}
@@ -81,7 +83,7 @@ func (f *Filemoon) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*Extr
 		}
 	}
 
-	return nil, fmt.Errorf("Filemoon: failed to retrieve sources")
+	return nil, fmt.Errorf("Filemoon: %w", ErrNoSources)
 }
 
 func init() {
@@ -0,0 +1,31 @@
+package extractors
+
+import "net/http"
+
+// hosterHeaders are the request headers the CDNs of some hosters need to serve the stream and its segments, they
+// answer with 403 otherwise. Keyed by the first name of the extractor.
+var hosterHeaders = map[string]map[string]string{
+	"Vidmoly":    {"Origin": "https://vidmoly.to", "Referer": "https://vidmoly.to/"},
+	"Filemoon":   {"Origin": "https://filemoon.sx", "Referer": "https://filemoon.sx/"},
+	"Voe":        {"Origin": "https://voe.sx"},
+	"Streamtape": {"Referer": "https://streamtape.com/"},
+	"Vidoza":     {"Referer": "https://vidoza.net/"},
+}
+
+// HosterHeaders returns the headers the CDN of the named hoster needs, nil for hosters without any. Aliases and
+// other casing of the name work as well, e.g. "VOE" or "MoonF".
+func HosterHeaders(name string) http.Header {
+	e := GetExtractorByName(name)
+	if e == nil {
+		return nil
+	}
+	preset, ok := hosterHeaders[e.Names()[0]]
+	if !ok {
+		return nil
+	}
+	headers := make(http.Header, len(preset))
+	for key, value := range preset {
+		headers.Set(key, value)
+	}
+	return headers
+}
@@ -0,0 +1,43 @@
+package extractors
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHosterHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected http.Header
+	}{
+		{"Vidmoly", http.Header{"Origin": {"https://vidmoly.to"}, "Referer": {"https://vidmoly.to/"}}},
+		{"VOE", http.Header{"Origin": {"https://voe.sx"}}},
+		{"MoonF", http.Header{"Origin": {"https://filemoon.sx"}, "Referer": {"https://filemoon.sx/"}}},
+		{"Speedfiles", nil},
+		{"unknown", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		got := HosterHeaders(tt.name)
+		if len(got) != len(tt.expected) {
+			t.Errorf("%s\nExpected: %v\nGot:      %v", tt.name, tt.expected, got)
+			continue
+		}
+		for key := range tt.expected {
+			if got.Get(key) != tt.expected.Get(key) {
+				t.Errorf("%s\nExpected: %v\nGot:      %v", tt.name, tt.expected, got)
+			}
+		}
+	}
+}
+
+// TestHosterHeadersNames catches presets that no extractor uses, e.g. after renaming one.
+func TestHosterHeadersNames(t *testing.T) {
+	for name := range hosterHeaders {
+		e := GetExtractorByName(name)
+		if e == nil || e.Names()[0] != name {
+			t.Errorf("\nExpected: an extractor named %s\nGot:      %v", name, e)
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+
+	"github.com/bugmaschine/gad/pkg/httpclient"
 )
 
 type LoadX struct{}
@@ -49,7 +51,7 @@ func (l *LoadX) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*Extract
 	}
 
 	if id == "" {
-		return nil, fmt.Errorf("LoadX: failed to retrieve id")
+		return nil, fmt.Errorf("LoadX: %w (no id)", ErrNoSources)
 	}
 
 	// POST request to get video source
@@ -72,12 +74,16 @@ func (l *LoadX) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*Extract
 	req.Header.Set("X-Requested-With", "XMLHttpRequest")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpclient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("LoadX: %w: status %d", ErrHosterDown, resp.StatusCode)
+	}
+
 	respBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -94,7 +100,7 @@ func (l *LoadX) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*Extract
 		}, nil
 	}
 
-	return nil, fmt.Errorf("LoadX: failed to retrieve sources from API response")
+	return nil, fmt.Errorf("LoadX: %w (API response has no source)", ErrNoSources)
 }
 
 func init() {
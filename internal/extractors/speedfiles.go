@@ -40,7 +40,7 @@ func (s *Speedfiles) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*Ex
 		}
 	}
 
-	return nil, fmt.Errorf("Speedfiles: failed to retrieve sources")
+	return nil, fmt.Errorf("Speedfiles: %w", ErrNoSources)
 }
 
 func (s *Speedfiles) decodeUrl(input string) (string, bool) {
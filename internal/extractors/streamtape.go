@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"strings"
 )
 
 type Streamtape struct{}
@@ -43,13 +44,13 @@ func (s *Streamtape) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*Ex
 
 	robotMatches := robotLinkRe.FindStringSubmatch(source)
 	if len(robotMatches) < 2 {
-		return nil, fmt.Errorf("Streamtape: failed to find robotlink")
+		return nil, fmt.Errorf("Streamtape: %w (no robotlink)", ErrNoSources)
 	}
-	robotUrl := robotMatches[1]
+	robotUrl := unescapeUrl(strings.TrimSpace(robotMatches[1]))
 
 	tokenMatches := tokenRe.FindAllStringSubmatch(source, -1)
 	if len(tokenMatches) == 0 {
-		return nil, fmt.Errorf("Streamtape: failed to find token")
+		return nil, fmt.Errorf("Streamtape: %w (no token)", ErrNoSources)
 	}
 	// Use the last token as per Rust implementation
 	token := tokenMatches[len(tokenMatches)-1][1]
@@ -59,16 +60,18 @@ func (s *Streamtape) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*Ex
 		return nil, err
 	}
 
-	q := finalUrl.Query()
-	q.Set("token", token)
-	q.Set("stream", "1")
-	finalUrl.RawQuery = q.Encode()
+	finalUrl.RawQuery = setRawQueryParam(setRawQueryParam(finalUrl.RawQuery, "token", token), "stream", "1")
 
 	return &ExtractedVideo{
-		Url: finalUrl.String(),
+		Url:     finalUrl.String(),
+		Referer: from.Url,
 	}, nil
 }
 
+func (s *Streamtape) ExtractTitle(ctx context.Context, from ExtractFrom) (string, error) {
+	return pageTitle(ctx, from)
+}
+
 func init() {
 	Register(&Streamtape{})
 }
@@ -0,0 +1,74 @@
+package extractors
+
+import (
+	"context"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// TitleExtractor is implemented by extractors that can suggest a title for the video, it's used to name single downloads.
+type TitleExtractor interface {
+	ExtractTitle(ctx context.Context, from ExtractFrom) (string, error)
+}
+
+// ExtractTitle asks the extractor for a title, an empty string means there is none.
+// If name is empty, the first extractor supporting the url is used.
+func ExtractTitle(ctx context.Context, url, name string, userAgent, referer string) string {
+	var e Extractor
+	if name != "" {
+		e = GetExtractorByName(name)
+	} else {
+		for _, candidate := range registry {
+			if (candidate.SupportedFrom()&SupportedFromUrl) != 0 && candidate.SupportsUrl(url) {
+				e = candidate
+				break
+			}
+		}
+	}
+
+	te, ok := e.(TitleExtractor)
+	if !ok {
+		return ""
+	}
+	title, err := te.ExtractTitle(ctx, ExtractFrom{Url: url, UserAgent: userAgent, Referer: referer})
+	if err != nil {
+		return ""
+	}
+	return title
+}
+
+var (
+	ogTitleRe   = regexp.MustCompile(`(?is)<meta[^>]+(?:property|name)=["']og:title["'][^>]+content=["']([^"']+)["']`)
+	htmlTitleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	// hosters put their own name behind the file name, like "Watch foo.mp4 - VOE | Content Delivery Network"
+	titleSuffixRe = regexp.MustCompile(`(?i)\s+[-|]\s+[^-|]*(?:voe|vidoza|streamtape|dood\w*|content delivery|video cloud)[^-|]*.*$`)
+)
+
+// PageTitle suggests a title from the og:title or <title> of a hoster page, without "Watch", hoster names and file extension.
+func PageTitle(source string) string {
+	var title string
+	if m := ogTitleRe.FindStringSubmatch(source); len(m) > 1 {
+		title = m[1]
+	} else if m := htmlTitleRe.FindStringSubmatch(source); len(m) > 1 {
+		title = m[1]
+	}
+
+	title = strings.TrimSpace(html.UnescapeString(title))
+	title = strings.TrimPrefix(title, "Watch ")
+	title = titleSuffixRe.ReplaceAllString(title, "")
+	if ext := path.Ext(title); len(ext) > 1 && len(ext) <= 5 && !strings.Contains(ext, " ") {
+		title = strings.TrimSuffix(title, ext)
+	}
+	return strings.TrimSpace(title)
+}
+
+// pageTitle implements ExtractTitle for extractors whose pages carry the file name in the title.
+func pageTitle(ctx context.Context, from ExtractFrom) (string, error) {
+	source, err := GetSource(ctx, from)
+	if err != nil {
+		return "", err
+	}
+	return PageTitle(source), nil
+}
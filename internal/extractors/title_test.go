@@ -0,0 +1,22 @@
+package extractors
+
+import "testing"
+
+func TestPageTitle(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{`<html><head><title>Watch Frieren.S01E01.GerSub.mp4 - VOE | Content Delivery Network (CDN) &amp; Video Cloud</title>`, "Frieren.S01E01.GerSub"},
+		{`<meta name="og:title" content="Spy x Family 03.mp4"><title>Streamtape.com</title>`, "Spy x Family 03"},
+		{`<title>One Piece 1100 - DoodStream</title>`, "One Piece 1100"},
+		{`<title>Dr. Stone - Episode 5</title>`, "Dr. Stone - Episode 5"},
+		{`<html>no title</html>`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := PageTitle(tt.source); got != tt.expected {
+			t.Errorf("\nSource:   %s\nExpected: %q\nGot:      %q", tt.source, tt.expected, got)
+		}
+	}
+}
@@ -3,12 +3,15 @@ package extractors
 import (
 	"context"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/bugmaschine/gad/pkg/httpclient"
 )
 
 func IsUrlHostAndHasPath(rawUrl string, expectedHost string, mustHavePath bool, ignoreCase bool) bool {
@@ -51,14 +54,14 @@ func GetSource(ctx context.Context, from ExtractFrom) (string, error) {
 		req.Header.Set("Referer", from.Referer)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpclient.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch source: status %d", resp.StatusCode)
+		return "", fmt.Errorf("%w: status %d", ErrHosterDown, resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -121,3 +124,36 @@ func EncodeBaseN(num int, base int) string {
 	}
 	return string(res)
 }
+
+// unescapeUrl undoes the escaping of URLs embedded in HTML and JavaScript, e.g. "&amp;" and "\/". Signed URLs break
+// if their query isn't passed on exactly.
+func unescapeUrl(s string) string {
+	s = strings.NewReplacer(`\/`, "/", `\u0026`, "&", `\u003d`, "=").Replace(s)
+	return html.UnescapeString(s)
+}
+
+// setRawQueryParam sets key in an encoded query without touching the order or encoding of the other parameters,
+// unlike url.Values.Encode. Some hosters sign the query as it is.
+func setRawQueryParam(rawQuery, key, value string) string {
+	param := url.QueryEscape(key) + "=" + url.QueryEscape(value)
+	var params []string
+	found := false
+	for p := range strings.SplitSeq(rawQuery, "&") {
+		if p == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(p, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil && unescaped == key {
+			if !found {
+				params = append(params, param)
+				found = true
+			}
+			continue
+		}
+		params = append(params, p)
+	}
+	if !found {
+		params = append(params, param)
+	}
+	return strings.Join(params, "&")
+}
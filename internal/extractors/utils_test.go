@@ -0,0 +1,40 @@
+package extractors
+
+import "testing"
+
+func TestUnescapeUrl(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"https://a/v.mp4?token=x&amp;expires=1", "https://a/v.mp4?token=x&expires=1"},
+		{`https:\/\/a\/v.mp4?token=x&expires=1`, "https://a/v.mp4?token=x&expires=1"},
+		{"https://a/v.mp4?token=a%2Fb", "https://a/v.mp4?token=a%2Fb"},
+	}
+
+	for _, tt := range tests {
+		if got := unescapeUrl(tt.input); got != tt.expected {
+			t.Errorf("%s\nExpected: %s\nGot:      %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSetRawQueryParam(t *testing.T) {
+	tests := []struct {
+		query    string
+		key      string
+		value    string
+		expected string
+	}{
+		{"id=1&expires=2&ip=x%2Fy", "token", "abc", "id=1&expires=2&ip=x%2Fy&token=abc"},
+		{"id=1&token=old&expires=2", "token", "new", "id=1&token=new&expires=2"},
+		{"token=a&id=1&token=b", "token", "c", "token=c&id=1"},
+		{"", "stream", "1", "stream=1"},
+	}
+
+	for _, tt := range tests {
+		if got := setRawQueryParam(tt.query, tt.key, tt.value); got != tt.expected {
+			t.Errorf("%s\nExpected: %s\nGot:      %s", tt.query, tt.expected, got)
+		}
+	}
+}
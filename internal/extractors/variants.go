@@ -0,0 +1,127 @@
+package extractors
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// StreamVariant is one quality or format of a video found by an extractor.
+type StreamVariant struct {
+	Url     string
+	Referer string
+	// Resolution is the height in pixels, 0 if the hoster doesn't tell.
+	Resolution int
+	// Bandwidth in bits per second, 0 if unknown.
+	Bandwidth int
+	Codec     string
+	IsHLS     bool
+}
+
+// VariantExtractor is implemented by extractors that report every variant of a video instead of a single URL.
+// Their ExtractVideoUrl should just return the best variant, see extractBest.
+type VariantExtractor interface {
+	Extractor
+	ExtractVariants(ctx context.Context, from ExtractFrom) ([]StreamVariant, error)
+}
+
+// QualityCap limits the variant picked from the ones a hoster or playlist offers, see --quality, --max-height and
+// --max-bitrate. Zero fields mean no limit.
+type QualityCap struct {
+	// MaxHeight is the highest video height in pixels
+	MaxHeight int
+	// MaxBitrate is the highest bandwidth in bits per second
+	MaxBitrate int
+}
+
+// Allows reports whether a variant fits. Variants that don't tell their height or bandwidth fit as far as unknown.
+func (c QualityCap) Allows(height, bandwidth int) bool {
+	if c.MaxHeight > 0 && height > c.MaxHeight {
+		return false
+	}
+	return c.MaxBitrate <= 0 || bandwidth <= c.MaxBitrate
+}
+
+// String is recorded as the quality of an episode in the series state, e.g. "720p" or "best".
+func (c QualityCap) String() string {
+	var parts []string
+	if c.MaxHeight > 0 {
+		parts = append(parts, fmt.Sprintf("%dp", c.MaxHeight))
+	}
+	if c.MaxBitrate > 0 {
+		parts = append(parts, fmt.Sprintf("%d kbit/s", c.MaxBitrate/1000))
+	}
+	if len(parts) == 0 {
+		return "best"
+	}
+	return strings.Join(parts, " ")
+}
+
+// SelectVariant picks the best variant within the cap. If none fits, the smallest one is used.
+func SelectVariant(variants []StreamVariant, quality QualityCap) (StreamVariant, bool) {
+	if len(variants) == 0 {
+		return StreamVariant{}, false
+	}
+
+	better := func(a, b StreamVariant) bool {
+		if a.Resolution != b.Resolution {
+			return a.Resolution > b.Resolution
+		}
+		return a.Bandwidth > b.Bandwidth
+	}
+
+	var best, smallest *StreamVariant
+	for i := range variants {
+		v := &variants[i]
+		if smallest == nil || better(*smallest, *v) {
+			smallest = v
+		}
+		if !quality.Allows(v.Resolution, v.Bandwidth) {
+			continue
+		}
+		if best == nil || better(*v, *best) {
+			best = v
+		}
+	}
+
+	if best == nil {
+		slog.Warn("No variant fits the quality cap, using the smallest one", "cap", quality, "resolution", smallest.Resolution)
+		return *smallest, true
+	}
+	return *best, true
+}
+
+// ParseResolution reads resolutions like "720", "720p" or "1280x720" and returns the height.
+func ParseResolution(s string) (int, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if _, height, ok := strings.Cut(s, "x"); ok {
+		s = height
+	}
+	height, err := strconv.Atoi(strings.TrimSuffix(s, "p"))
+	if err != nil || height < 0 {
+		return 0, false
+	}
+	return height, true
+}
+
+// extractBest implements ExtractVideoUrl for a VariantExtractor.
+func extractBest(ctx context.Context, e VariantExtractor, from ExtractFrom) (*ExtractedVideo, error) {
+	variants, err := e.ExtractVariants(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := SelectVariant(variants, from.Quality)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", e.Names()[0], ErrNoSources)
+	}
+	return &ExtractedVideo{
+		Url:        v.Url,
+		Referer:    v.Referer,
+		IsM3U8:     v.IsHLS,
+		Resolution: v.Resolution,
+		Bandwidth:  v.Bandwidth,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package extractors
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSelectVariant(t *testing.T) {
+	variants := []StreamVariant{
+		{Url: "480", Resolution: 480, Bandwidth: 1200000},
+		{Url: "1080", Resolution: 1080, Bandwidth: 6000000},
+		{Url: "720-low", Resolution: 720, Bandwidth: 2500000},
+		{Url: "720-high", Resolution: 720, Bandwidth: 4000000},
+		{Url: "900", Resolution: 900},
+	}
+
+	tests := []struct {
+		quality  QualityCap
+		expected string
+	}{
+		{QualityCap{}, "1080"},
+		{QualityCap{MaxHeight: 1080}, "1080"},
+		{QualityCap{MaxHeight: 1000}, "900"},
+		{QualityCap{MaxHeight: 720}, "720-high"},
+		{QualityCap{MaxHeight: 600}, "480"},
+		{QualityCap{MaxHeight: 360}, "480"},
+		{QualityCap{MaxBitrate: 3000000}, "900"},
+		{QualityCap{MaxHeight: 720, MaxBitrate: 3000000}, "720-low"},
+		{QualityCap{MaxHeight: 720, MaxBitrate: 1000000}, "480"},
+	}
+
+	for _, tt := range tests {
+		got, ok := SelectVariant(variants, tt.quality)
+		if !ok || got.Url != tt.expected {
+			t.Errorf("\nCap:      %v\nExpected: %s\nGot:      %s", tt.quality, tt.expected, got.Url)
+		}
+	}
+
+	if _, ok := SelectVariant(nil, QualityCap{}); ok {
+		t.Errorf("expected no variant for an empty list")
+	}
+}
+
+func TestExtractVariants(t *testing.T) {
+	tests := []struct {
+		name      string
+		extractor VariantExtractor
+		source    string
+		expected  []StreamVariant
+	}{
+		{
+			"vidoza",
+			&Vidoza{},
+			`var player = videojs("player"); player.src({ sourcesCode: [{ src: "https://str1.vidoza.net/abc/v.mp4", type: "video/mp4", label:"SD", res:"720"}], });`,
+			[]StreamVariant{{Url: "https://str1.vidoza.net/abc/v.mp4", Resolution: 720, Codec: "video/mp4"}},
+		},
+		{
+			"vidoza multiple",
+			&Vidoza{},
+			`sourcesCode: [{ src: "https://a/360.mp4", type: "video/mp4", res:"360"}, { src: "https://a/1080.mp4", type: "video/mp4", res:"1080"}]`,
+			[]StreamVariant{
+				{Url: "https://a/360.mp4", Resolution: 360, Codec: "video/mp4"},
+				{Url: "https://a/1080.mp4", Resolution: 1080, Codec: "video/mp4"},
+			},
+		},
+		{
+			"vidoza with token",
+			&Vidoza{},
+			`sourcesCode: [{ src: "https://str1.vidoza.net/abc/v.mp4?token=a%2Fb&amp;expires=1", type: "video/mp4", res:"720"}]`,
+			[]StreamVariant{{Url: "https://str1.vidoza.net/abc/v.mp4?token=a%2Fb&expires=1", Resolution: 720, Codec: "video/mp4"}},
+		},
+		{
+			"vidmoly",
+			&Vidmoly{},
+			`player.setup({ sources: [{file:"https://box.vidmoly.to/hls/xyz/master.m3u8"}], image: "x.jpg" });`,
+			[]StreamVariant{{Url: "https://box.vidmoly.to/hls/xyz/master.m3u8", Referer: "https://vidmoly.to/", IsHLS: true}},
+		},
+		{
+			"vidmoly with labels",
+			&Vidmoly{},
+			`sources: [{file:"https://a/720.m3u8", label:"720p"},{file:"https://a/480.m3u8", label:"480p"}]`,
+			[]StreamVariant{
+				{Url: "https://a/720.m3u8", Referer: "https://vidmoly.to/", Resolution: 720, IsHLS: true},
+				{Url: "https://a/480.m3u8", Referer: "https://vidmoly.to/", Resolution: 480, IsHLS: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.extractor.ExtractVariants(context.Background(), ExtractFrom{Source: tt.source})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("\nExpected: %+v\nGot:      %+v", tt.expected, got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("\nExpected: %+v\nGot:      %+v", tt.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExtractBest(t *testing.T) {
+	source := `sources: [{file:"https://a/720.m3u8", label:"720p"},{file:"https://a/480.m3u8", label:"480p"}]`
+	got, err := extractBest(context.Background(), &Vidmoly{}, ExtractFrom{Source: source, Quality: QualityCap{MaxHeight: 600}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the picked quality is passed on for the logs
+	expected := ExtractedVideo{Url: "https://a/480.m3u8", Referer: "https://vidmoly.to/", IsM3U8: true, Resolution: 480}
+	if *got != expected {
+		t.Errorf("\nExpected: %+v\nGot:      %+v", expected, *got)
+	}
+}
@@ -21,21 +21,42 @@ func (v *Vidmoly) SupportsUrl(urlStr string) bool {
 }
 
 func (v *Vidmoly) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*ExtractedVideo, error) {
+	return extractBest(ctx, v, from)
+}
+
+var (
+	vidmolyFileRe  = regexp.MustCompile(`(?s)\{[^{}]*?file:\s*"([^"]+\.m3u8[^"]*)"[^{}]*?\}`)
+	vidmolyLabelRe = regexp.MustCompile(`label:\s*"([^"]+)"`)
+	// some pages set the file directly without a sources list
+	vidmolyPlainFileRe = regexp.MustCompile(`(?s)file:\s*"([^"]+\.m3u8[^"]*)"`)
+)
+
+func (v *Vidmoly) ExtractVariants(ctx context.Context, from ExtractFrom) ([]StreamVariant, error) {
 	source, err := GetSource(ctx, from)
 	if err != nil {
 		return nil, err
 	}
 
-	videoUrlRe := regexp.MustCompile(`(?s)file:\s*"([^"]+\.m3u8[^"]*)"`)
-	matches := videoUrlRe.FindStringSubmatch(source)
-	if len(matches) < 2 {
-		return nil, fmt.Errorf("Vidmoly: failed to retrieve sources")
+	var variants []StreamVariant
+	for _, match := range vidmolyFileRe.FindAllStringSubmatch(source, -1) {
+		variant := StreamVariant{
+			Url:     match[1],
+			Referer: "https://vidmoly.to/",
+			IsHLS:   true,
+		}
+		if label := vidmolyLabelRe.FindStringSubmatch(match[0]); len(label) > 1 {
+			variant.Resolution, _ = ParseResolution(label[1])
+		}
+		variants = append(variants, variant)
 	}
 
-	return &ExtractedVideo{
-		Url:     matches[1],
-		Referer: "https://vidmoly.to/",
-	}, nil
+	if len(variants) == 0 {
+		if match := vidmolyPlainFileRe.FindStringSubmatch(source); len(match) > 1 {
+			return []StreamVariant{{Url: match[1], Referer: "https://vidmoly.to/", IsHLS: true}}, nil
+		}
+		return nil, fmt.Errorf("Vidmoly: %w", ErrNoSources)
+	}
+	return variants, nil
 }
 
 func init() {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strings"
 )
 
 type Vidoza struct{}
@@ -30,20 +31,57 @@ func (v *Vidoza) SupportsUrl(urlStr string) bool {
 }
 
 func (v *Vidoza) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*ExtractedVideo, error) {
+	return extractBest(ctx, v, from)
+}
+
+var (
+	vidozaSourcesRe = regexp.MustCompile(`(?s)sourcesCode:\s*\[(.*?)\]`)
+	vidozaEntryRe   = regexp.MustCompile(`(?s)\{(.*?)\}`)
+	vidozaSrcRe     = regexp.MustCompile(`src:\s*"([^"]+)"`)
+	vidozaResRe     = regexp.MustCompile(`res:\s*"?(\d+)`)
+	vidozaTypeRe    = regexp.MustCompile(`type:\s*"([^"]+)"`)
+)
+
+func (v *Vidoza) ExtractVariants(ctx context.Context, from ExtractFrom) ([]StreamVariant, error) {
 	source, err := GetSource(ctx, from)
 	if err != nil {
 		return nil, err
 	}
 
-	videoUrlRe := regexp.MustCompile(`(?s)sourcesCode:\s\[\{\ssrc:\s"(.+)", type`)
-	matches := videoUrlRe.FindStringSubmatch(source)
-	if len(matches) < 2 {
-		return nil, fmt.Errorf("Vidoza: failed to retrieve sources")
+	sources := vidozaSourcesRe.FindStringSubmatch(source)
+	if len(sources) < 2 {
+		return nil, fmt.Errorf("Vidoza: %w", ErrNoSources)
 	}
 
-	return &ExtractedVideo{
-		Url: matches[1],
-	}, nil
+	var variants []StreamVariant
+	for _, entry := range vidozaEntryRe.FindAllStringSubmatch(sources[1], -1) {
+		src := vidozaSrcRe.FindStringSubmatch(entry[1])
+		if len(src) < 2 {
+			continue
+		}
+
+		// the mp4 is signed for the embed page, it checks the referer
+		variant := StreamVariant{Url: unescapeUrl(src[1]), Referer: from.Url}
+		if res := vidozaResRe.FindStringSubmatch(entry[1]); len(res) > 1 {
+			variant.Resolution, _ = ParseResolution(res[1])
+		}
+		if typ := vidozaTypeRe.FindStringSubmatch(entry[1]); len(typ) > 1 {
+			variant.IsHLS = strings.Contains(strings.ToLower(typ[1]), "mpegurl")
+			if !variant.IsHLS {
+				variant.Codec = typ[1]
+			}
+		}
+		variants = append(variants, variant)
+	}
+
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("Vidoza: %w", ErrNoSources)
+	}
+	return variants, nil
+}
+
+func (v *Vidoza) ExtractTitle(ctx context.Context, from ExtractFrom) (string, error) {
+	return pageTitle(ctx, from)
 }
 
 func init() {
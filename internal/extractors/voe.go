@@ -55,7 +55,7 @@ func (v *Voe) ExtractVideoUrl(ctx context.Context, from ExtractFrom) (*Extracted
 		return ev, nil
 	}
 
-	return nil, fmt.Errorf("Voe: failed to retrieve sources")
+	return nil, fmt.Errorf("Voe: %w", ErrNoSources)
 }
 
 func (v *Voe) extract1(source string) (*ExtractedVideo, error) {
@@ -196,6 +196,10 @@ func (v *Voe) shiftChars(input string, shift int) (string, bool) {
 	return string(utf16.Decode(res)), true
 }
 
+func (v *Voe) ExtractTitle(ctx context.Context, from ExtractFrom) (string, error) {
+	return pageTitle(ctx, from)
+}
+
 func init() {
 	Register(&Voe{})
 }
@@ -0,0 +1,31 @@
+package chrome
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// UblockCache returns the files of uBlock Origin in the data directory. Without them Prepare installs it again.
+func (m *ChromeManager) UblockCache() []string {
+	return []string{
+		m.ublockDir(),
+		filepath.Join(m.dataDir, "uBlock.zip"),
+		filepath.Join(m.dataDir, "current_ublock_version"),
+		filepath.Join(m.dataDir, releaseCacheFile),
+	}
+}
+
+// ChromiumCache returns the Chromium snapshot in the data directory. A Chromium of the system is never part of it.
+func (m *ChromeManager) ChromiumCache() []string {
+	return []string{
+		filepath.Join(m.dataDir, "chromium_bin"),
+		filepath.Join(m.dataDir, "chrome_temp.zip"),
+		filepath.Join(m.dataDir, "current_chromium_version"),
+	}
+}
+
+// ProfileCache returns the browser profiles in the temporary directory. Every run starts with a new one and removes
+// it at the end, the ones left over are from runs that crashed or were killed.
+func ProfileCache() ([]string, error) {
+	return filepath.Glob(filepath.Join(os.TempDir(), "chromedp-runner*"))
+}
@@ -3,25 +3,30 @@ package chrome
 import (
 	"archive/zip"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
-	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 
+	"github.com/bugmaschine/gad/internal/downloaders"
 	"github.com/bugmaschine/gad/pkg/download"
+	"github.com/bugmaschine/gad/pkg/httpclient"
+	"github.com/chromedp/cdproto/emulation"
 	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
 )
 
 const (
 	UblockGithubAPIURL        = "https://api.github.com/repos/uBlockOrigin/uBOL-home/releases/latest"
-	UblockFallbackDownloadURL = "https://github.com/uBlockOrigin/uBOL-home/releases/download/2026.215.1801/uBOLite_2026.215.1801.chromium.zip"
+	UblockFallbackVersion     = "2026.215.1801"
+	UblockFallbackDownloadURL = "https://github.com/uBlockOrigin/uBOL-home/releases/download/" + UblockFallbackVersion + "/uBOLite_" + UblockFallbackVersion + ".chromium.zip"
 )
 
 const (
@@ -42,27 +47,117 @@ type Downloader interface {
 type ChromeManager struct {
 	dataDir    string
 	downloader Downloader
+	userAgent  string
+	// execPath is set by Prepare
+	execPath string
+	// requireUblock makes Prepare and Get fail instead of running the browser without uBlock
+	requireUblock bool
+	// proxy is used by the browser, nil connects directly
+	proxy *url.URL
+	// flags are added after the defaults, so they can override them
+	flags []Flag
+	// locale and timezone are emulated by the pages, empty keeps the ones of the system
+	locale   string
+	timezone string
+	// har records the traffic of every browser session, nil records nothing
+	har *HarRecorder
 }
 
+// ErrUblockMissing is returned by Prepare and Get if uBlock Origin is required but couldn't be set up.
+var ErrUblockMissing = errors.New("uBlock Origin is required but not available")
+
 func NewManager(dataDir string, downloader Downloader) *ChromeManager {
 	return &ChromeManager{
 		dataDir:    dataDir,
 		downloader: downloader,
+		userAgent:  httpclient.DefaultUserAgent,
 	}
 }
 
-// Get initializes a chromedp context with uBlock Origin and anti-automation patches.
-func (m *ChromeManager) Get(ctx context.Context, headless, debug bool) (context.Context, context.CancelFunc, error) {
-	chromeExecPath, err := m.prepareChromium()
+// SetUserAgent overrides the user agent of the browser, it should be the same one the downloads use.
+func (m *ChromeManager) SetUserAgent(userAgent string) *ChromeManager {
+	if userAgent != "" {
+		m.userAgent = userAgent
+	}
+	return m
+}
+
+// SetRequireUblock makes the browser fail to start without uBlock Origin. Otherwise it starts without it and the
+// context returned by Get is marked with downloaders.WithoutAdblock, so scrapers can deal with popups themselves.
+func (m *ChromeManager) SetRequireUblock(require bool) *ChromeManager {
+	m.requireUblock = require
+	return m
+}
+
+// SetProxy routes the browser through proxy. Chromium can't log in to a proxy, so it must not have credentials.
+func (m *ChromeManager) SetProxy(proxy *url.URL) *ChromeManager {
+	m.proxy = proxy
+	return m
+}
+
+// SetFlags adds extra switches to the browser, after the ones gad sets.
+func (m *ChromeManager) SetFlags(flags []Flag) *ChromeManager {
+	m.flags = flags
+	return m
+}
+
+// SetLocale makes the pages see locale, like "de-DE", as the language and timezone, like "Europe/Berlin", as the
+// time zone. Empty keeps the setting of the system.
+func (m *ChromeManager) SetLocale(locale, timezone string) *ChromeManager {
+	m.locale, m.timezone = locale, timezone
+	return m
+}
+
+// SetHarRecorder records the network traffic of the browser sessions. The file is saved whenever a session ends.
+func (m *ChromeManager) SetHarRecorder(har *HarRecorder) *ChromeManager {
+	m.har = har
+	return m
+}
+
+// proxyServer returns the proxy in the format of --proxy-server. Chromium resolves host names on SOCKS5 proxies
+// anyway and doesn't know socks5h.
+func (m *ChromeManager) proxyServer() string {
+	u := *m.proxy
+	if u.Scheme == "socks5h" {
+		u.Scheme = "socks5"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// Prepare installs or updates Chromium and uBlock Origin. Get calls it if it didn't run yet,
+// calling it early allows doing it next to other startup work.
+func (m *ChromeManager) Prepare(ctx context.Context) error {
+	chromeExecPath, err := m.prepareChromium(ctx)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to prepare chromium: %w", err)
+		return fmt.Errorf("failed to prepare chromium: %w", err)
 	}
 
-	ublockDir := filepath.Join(m.dataDir, "uBlock")
-	if err := m.prepareUblock(ctx, ublockDir); err != nil {
+	if err := m.prepareUblock(ctx, m.ublockDir()); err != nil {
+		if m.requireUblock {
+			return fmt.Errorf("%w: %w", ErrUblockMissing, err)
+		}
 		slog.Warn("Failed to prepare uBlock Origin, proceeding without it", "error", err)
 	}
 
+	m.execPath = chromeExecPath
+	return nil
+}
+
+func (m *ChromeManager) ublockDir() string {
+	return filepath.Join(m.dataDir, "uBlock")
+}
+
+// Get initializes a chromedp context with uBlock Origin and anti-automation patches. The context carries DetectWall,
+// so scrapers can explain pages that ask to log in.
+func (m *ChromeManager) Get(ctx context.Context, headless, debug bool) (context.Context, context.CancelFunc, error) {
+	if m.execPath == "" {
+		if err := m.Prepare(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	chromeExecPath := m.execPath
+	ublockDir := m.ublockDir()
+
 	opts := []chromedp.ExecAllocatorOption{
 		chromedp.ExecPath(chromeExecPath),
 		chromedp.NoDefaultBrowserCheck,
@@ -79,19 +174,35 @@ func (m *ChromeManager) Get(ctx context.Context, headless, debug bool) (context.
 		//chromedp.Flag("no-sandbox", true), // this is absolutely dangerous. i think sdl did this for performance reasons.
 		chromedp.Flag("disable-dev-shm-usage", true),
 		chromedp.Flag("disable-blink-features", "AutomationControlled"),
-		chromedp.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"),
+		chromedp.UserAgent(m.userAgent),
 		chromedp.WindowSize(1920, 1080),
 		chromedp.Flag("disable-infobars", true),
 		chromedp.Flag("exclude-switches", "enable-automation,enable-logging"),
 	)
+	if m.proxy != nil {
+		opts = append(opts, chromedp.ProxyServer(m.proxyServer()))
+	}
+	if m.locale != "" {
+		opts = append(opts, chromedp.Flag("lang", m.locale), chromedp.Flag("accept-lang", m.locale))
+	}
 
 	effectiveUblockDir, err := m.getUblockDirectory(ublockDir)
-	if err == nil {
+	ublockLoaded := err == nil
+	if ublockLoaded {
 		opts = append(opts, chromedp.Flag("load-extension", effectiveUblockDir))
+	} else if m.requireUblock {
+		return nil, nil, fmt.Errorf("%w: %w", ErrUblockMissing, err)
 	} else {
-		slog.Warn("Failed to add uBlock Origin extension", "error", err)
+		slog.Warn("Failed to add uBlock Origin extension, ads and popups may get in the way. Use --require-ublock to stop instead", "error", err)
 	}
 
+	for _, flag := range m.flags {
+		opts = append(opts, chromedp.Flag(flag.Name, flag.Value))
+	}
+	opts = append(opts, chromedp.ModifyCmdFunc(func(cmd *exec.Cmd) {
+		slog.Debug("Starting browser", "args", cmd.Args[1:])
+	}))
+
 	allocCtx, allocCancel := chromedp.NewExecAllocator(ctx, opts...)
 
 	var contextOpts []chromedp.ContextOption
@@ -103,11 +214,17 @@ func (m *ChromeManager) Get(ctx context.Context, headless, debug bool) (context.
 
 	// Create context
 	taskCtx, taskCancel := chromedp.NewContext(allocCtx, contextOpts...)
+	if m.har != nil {
+		m.har.Listen(taskCtx)
+	}
 
 	// Combine cancels
 	combinedCancel := func() {
 		taskCancel()
 		allocCancel()
+		if m.har != nil {
+			m.saveHar()
+		}
 	}
 
 	// Apply anti-automation patches
@@ -129,23 +246,62 @@ func (m *ChromeManager) Get(ctx context.Context, headless, debug bool) (context.
 			_, err := page.AddScriptToEvaluateOnNewDocument(script).Do(ctx)
 			return err
 		}),
+		chromedp.ActionFunc(m.emulateLocale),
 	)
 	if err != nil {
 		combinedCancel()
 		return nil, nil, fmt.Errorf("browser failed to start or patches failed: %w", err)
 	}
 
+	if !ublockLoaded {
+		taskCtx = downloaders.WithoutAdblock(taskCtx)
+	}
+	if !headless || debug {
+		taskCtx = downloaders.WithVisibleBrowser(taskCtx)
+	}
+	taskCtx = downloaders.WithWallDetector(taskCtx, DetectWall)
+	if m.har != nil {
+		taskCtx = downloaders.WithTabListener(taskCtx, m.har.Listen)
+	}
 	return taskCtx, combinedCancel, nil
 }
 
-func (m *ChromeManager) prepareChromium() (string, error) {
-	// check if chromium is installed locally
-	for _, bin := range []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable"} {
-		if path, err := exec.LookPath(bin); err == nil {
-			slog.Debug("Using system chromium", "path", path)
-			return path, nil
+// saveHar writes the traffic recorded so far, a failure only costs the trace.
+func (m *ChromeManager) saveHar() {
+	requests, err := m.har.Save()
+	if err != nil {
+		slog.Warn("Failed to save the browser traffic", "path", m.har.Path(), "error", err)
+		return
+	}
+	slog.Info("Saved the browser traffic", "path", m.har.Path(), "requests", requests)
+}
+
+// emulateLocale overrides the Accept-Language header, navigator.language, the Intl locale and the time zone of the
+// page, the command line switches don't reach all of them.
+func (m *ChromeManager) emulateLocale(ctx context.Context) error {
+	if m.locale != "" {
+		if err := emulation.SetUserAgentOverride(m.userAgent).WithAcceptLanguage(httpclient.AcceptLanguage(m.locale)).Do(ctx); err != nil {
+			return err
+		}
+		// ICU wants an underscore between language and region
+		if err := emulation.SetLocaleOverride().WithLocale(strings.ReplaceAll(m.locale, "-", "_")).Do(ctx); err != nil {
+			return err
 		}
 	}
+	if m.timezone != "" {
+		if err := emulation.SetTimezoneOverride(m.timezone).Do(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *ChromeManager) prepareChromium(ctx context.Context) (string, error) {
+	// check if chromium is installed locally
+	if path := systemChromium(); path != "" {
+		slog.Debug("Using system chromium", "path", path)
+		return path, nil
+	}
 
 	platform, zipName, execRelPath := getPlatformInfo()
 	chromeDir := filepath.Join(m.dataDir, "chromium_bin")
@@ -161,7 +317,7 @@ func (m *ChromeManager) prepareChromium() (string, error) {
 	slog.Debug("Checking for Chromium snapshot updates...")
 
 	// ask google for the latest revision
-	resp, err := http.Get(fmt.Sprintf(LastChangeURL, platform))
+	resp, err := httpclient.Default().Get(fmt.Sprintf(LastChangeURL, platform))
 	var latestRevision string
 	if err == nil {
 		defer resp.Body.Close()
@@ -198,12 +354,12 @@ func (m *ChromeManager) prepareChromium() (string, error) {
 	downloadURL := fmt.Sprintf(ChromiumBaseURL, platform, latestRevision, zipName)
 	tmpZip := filepath.Join(m.dataDir, "chrome_temp.zip")
 
-	task := download.NewDownloadTask(downloadURL, tmpZip).
+	task := download.NewDownloadTask(tmpZip, downloadURL).
 		SetOverwriteFile(true).
 		SetCustomMessage("Downloading Chromium")
 	task.OutputPathHasExtension = true
 
-	if err := m.downloader.DownloadToFile(context.Background(), task); err != nil {
+	if err := m.downloader.DownloadToFile(ctx, task); err != nil {
 		return "", err
 	}
 	defer os.Remove(tmpZip)
@@ -226,6 +382,35 @@ func (m *ChromeManager) prepareChromium() (string, error) {
 	return fullExecPath, nil
 }
 
+// InstalledChromiumPath returns the browser a download would use without downloading anything, an empty string if
+// there is none yet.
+func (m *ChromeManager) InstalledChromiumPath() string {
+	if path := systemChromium(); path != "" {
+		return path
+	}
+	_, _, execRelPath := getPlatformInfo()
+	path := filepath.Join(m.dataDir, "chromium_bin", execRelPath)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+func systemChromium() string {
+	for _, bin := range []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable"} {
+		if path, err := exec.LookPath(bin); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// InstalledUblockVersion returns the version of the uBlock Origin extension in the data directory, or an empty string if it isn't installed yet.
+func (m *ChromeManager) InstalledUblockVersion() string {
+	version, _ := os.ReadFile(filepath.Join(m.dataDir, "current_ublock_version"))
+	return strings.TrimSpace(string(version))
+}
+
 // getPlatformInfo returns (PlatformSegment, ZipName, ExecutableSubPath)
 func getPlatformInfo() (string, string, string) {
 	switch runtime.GOOS {
@@ -250,7 +435,7 @@ func (m *ChromeManager) prepareUblock(ctx context.Context, ublockDir string) err
 		return nil
 	}
 
-	latestTag, downloadURL, err := m.fetchLatestUblockInfo()
+	latestTag, downloadURL, err := m.fetchLatestUblockInfo(ctx)
 	if err != nil {
 		slog.Warn("Failed to fetch latest uBlock info from GitHub, using fallback", "error", err)
 		latestTag = "fallback"
@@ -273,24 +458,14 @@ func (m *ChromeManager) prepareUblock(ctx context.Context, ublockDir string) err
 
 	zipPath := filepath.Join(m.dataDir, "uBlock.zip")
 
-	resp, err := http.Get(downloadURL)
-	if err != nil {
-		return fmt.Errorf("failed to download uBlock: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status from github: %s", resp.Status)
-	}
+	// through the asset downloader, so it shares the rate limit with the FFmpeg download
+	task := download.NewDownloadTask(zipPath, downloadURL).
+		SetOverwriteFile(true).
+		SetCustomMessage("Downloading uBlock Origin")
+	task.OutputPathHasExtension = true
 
-	out, err := os.Create(zipPath)
-	if err != nil {
-		return err
-	}
-	_, err = io.Copy(out, resp.Body)
-	out.Close()
-	if err != nil {
-		return err
+	if err := m.downloader.DownloadToFile(ctx, task); err != nil {
+		return fmt.Errorf("failed to download uBlock: %w", err)
 	}
 	defer os.Remove(zipPath)
 
@@ -308,40 +483,6 @@ func (m *ChromeManager) prepareUblock(ctx context.Context, ublockDir string) err
 	return nil
 }
 
-func (m *ChromeManager) fetchLatestUblockInfo() (string, string, error) {
-	resp, err := http.Get(UblockGithubAPIURL)
-	if err != nil {
-		return "", "", err
-	}
-	defer resp.Body.Close()
-
-	var release struct {
-		TagName string `json:"tag_name"`
-		Assets  []struct {
-			Name               string `json:"name"`
-			BrowserDownloadURL string `json:"browser_download_url"`
-		} `json:"assets"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return "", "", err
-	}
-
-	var downloadURL string
-	for _, asset := range release.Assets {
-		if strings.Contains(asset.Name, "chromium") {
-			downloadURL = asset.BrowserDownloadURL
-			break
-		}
-	}
-
-	if release.TagName == "" || downloadURL == "" {
-		return "", "", fmt.Errorf("missing tag or download url in github response")
-	}
-
-	return release.TagName, downloadURL, nil
-}
-
 func (m *ChromeManager) unzip(src, dest string) error {
 	r, err := zip.OpenReader(src)
 	if err != nil {
@@ -382,21 +523,42 @@ func (m *ChromeManager) unzip(src, dest string) error {
 	return nil
 }
 
+// getUblockDirectory returns the directory of the extracted release that contains the extension manifest.
 func (m *ChromeManager) getUblockDirectory(ublockDir string) (string, error) {
-	entries, err := os.ReadDir(ublockDir)
+	dir, err := findExtensionDirectory(ublockDir)
 	if err != nil {
 		return "", err
 	}
+	slog.Debug("Resolved uBlock Origin extension", "path", dir)
+	return dir, nil
+}
 
-	if len(entries) == 0 {
-		return "", fmt.Errorf("ublock directory is empty")
+// findExtensionDirectory walks the tree for the shallowest directory with a manifest.json. The release archives
+// changed their layout before, so the depth of the extension isn't fixed.
+func findExtensionDirectory(root string) (string, error) {
+	found := ""
+	foundDepth := -1
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || entry.Name() != "manifest.json" {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		depth := strings.Count(dir, string(filepath.Separator))
+		if foundDepth == -1 || depth < foundDepth {
+			found, foundDepth = dir, depth
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
 	}
-
-	if len(entries) == 1 && entries[0].IsDir() {
-		return filepath.Join(ublockDir, entries[0].Name()), nil
+	if found == "" {
+		return "", fmt.Errorf("no manifest.json found in %s", root)
 	}
-
-	return ublockDir, nil
+	return found, nil
 }
 
 // GetUserAgent returns the user agent string of the current browser.
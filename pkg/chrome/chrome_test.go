@@ -0,0 +1,89 @@
+package chrome
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindExtensionDirectory(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []string
+		expected string
+	}{
+		{"flat", []string{"manifest.json", "js/background.js"}, "."},
+		{"single subdirectory", []string{"uBOLite.chromium/manifest.json", "uBOLite.chromium/js/background.js"}, "uBOLite.chromium"},
+		{"nested", []string{"README.md", "release/uBOLite.chromium/manifest.json", "release/uBOLite.chromium/rulesets/manifest.json"}, "release/uBOLite.chromium"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, name := range tt.files {
+				path := filepath.Join(root, name)
+				os.MkdirAll(filepath.Dir(path), 0755)
+				os.WriteFile(path, []byte("{}"), 0644)
+			}
+
+			got, err := findExtensionDirectory(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := filepath.Join(root, tt.expected); got != expected {
+				t.Errorf("\nExpected: %s\nGot:      %s", expected, got)
+			}
+		})
+	}
+
+	if _, err := findExtensionDirectory(t.TempDir()); err == nil {
+		t.Error("expected an error without manifest.json")
+	}
+}
+
+func TestGetRequireUblock(t *testing.T) {
+	m := NewManager(t.TempDir(), nil).SetRequireUblock(true)
+	// skips Prepare, the missing extension has to stop Get before the browser starts
+	m.execPath = filepath.Join(t.TempDir(), "chromium")
+
+	_, _, err := m.Get(context.Background(), true, false)
+	if !errors.Is(err, ErrUblockMissing) {
+		t.Errorf("\nExpected: %v\nGot:      %v", ErrUblockMissing, err)
+	}
+}
+
+func TestParseFlag(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Flag
+		valid    bool
+	}{
+		{"lang=de-DE", Flag{"lang", "de-DE"}, true},
+		{"--disable-features=Translate,MediaRouter", Flag{"disable-features", "Translate,MediaRouter"}, true},
+		{"mute-audio", Flag{"mute-audio", true}, true},
+		{"disable-gpu=false", Flag{"disable-gpu", false}, true},
+		{"user-data-dir=", Flag{"user-data-dir", ""}, true},
+		{"", Flag{}, false},
+		{"=de-DE", Flag{}, false},
+		{"lang de-DE", Flag{}, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFlag(tt.input)
+		if (err == nil) != tt.valid || got != tt.expected {
+			t.Errorf("%q\nExpected: %+v (valid=%v)\nGot:      %+v (%v)", tt.input, tt.expected, tt.valid, got, err)
+		}
+	}
+}
+
+func TestCacheInDataDir(t *testing.T) {
+	dataDir := t.TempDir()
+	m := NewManager(dataDir, nil)
+	for _, path := range append(m.UblockCache(), m.ChromiumCache()...) {
+		if filepath.Dir(path) != dataDir {
+			t.Errorf("\nExpected: %s in the data directory\nGot:      outside", path)
+		}
+	}
+}
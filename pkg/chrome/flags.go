@@ -0,0 +1,34 @@
+package chrome
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Flag is a command line switch of Chromium, added by --chrome-flag.
+type Flag struct {
+	Name string
+	// Value is a string, or a bool for switches without a value. false removes the switch.
+	Value any
+}
+
+var flagName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// ParseFlag parses "name=value", or "name" for a switch without a value. The leading dashes are optional. The values
+// true and false turn a switch on or off, so a switch gad sets by default can be removed with "disable-gpu=false".
+func ParseFlag(s string) (Flag, error) {
+	name, value, hasValue := strings.Cut(strings.TrimSpace(s), "=")
+	name = strings.TrimLeft(name, "-")
+	if !flagName.MatchString(name) {
+		return Flag{}, fmt.Errorf("invalid chrome flag %q, expected name=value or name", s)
+	}
+	switch {
+	case !hasValue || value == "true":
+		return Flag{Name: name, Value: true}, nil
+	case value == "false":
+		return Flag{Name: name, Value: false}, nil
+	default:
+		return Flag{Name: name, Value: value}, nil
+	}
+}
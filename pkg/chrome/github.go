@@ -0,0 +1,139 @@
+package chrome
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bugmaschine/gad/pkg/httpclient"
+)
+
+// releaseCacheTTL is how long the cached GitHub release is used without asking GitHub again.
+// The unauthenticated API only allows 60 requests per hour and IP.
+const releaseCacheTTL = 6 * time.Hour
+
+const releaseCacheFile = "ublock_release.json"
+
+// releaseCache is the last answer of the GitHub API, stored in the data directory.
+type releaseCache struct {
+	FetchedAt   time.Time `json:"fetched_at"`
+	ETag        string    `json:"etag"`
+	TagName     string    `json:"tag_name"`
+	DownloadURL string    `json:"download_url"`
+}
+
+func (m *ChromeManager) fetchLatestUblockInfo(ctx context.Context) (string, string, error) {
+	return m.fetchLatestRelease(ctx, UblockGithubAPIURL, time.Now())
+}
+
+// fetchLatestRelease returns the tag and chromium download of the latest release. Answers are cached for
+// releaseCacheTTL, after that the cache is revalidated with its ETag, which doesn't count against the rate limit.
+func (m *ChromeManager) fetchLatestRelease(ctx context.Context, apiURL string, now time.Time) (string, string, error) {
+	cachePath := filepath.Join(m.dataDir, releaseCacheFile)
+	cache := loadReleaseCache(cachePath)
+
+	if cache != nil && now.Sub(cache.FetchedAt) < releaseCacheTTL {
+		slog.Debug("Using cached uBlock release info", "tag", cache.TagName, "fetched_at", cache.FetchedAt)
+		return cache.TagName, cache.DownloadURL, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if cache != nil && cache.ETag != "" {
+		req.Header.Set("If-None-Match", cache.ETag)
+	}
+
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return staleRelease(cache, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		if cache != nil {
+			cache.FetchedAt = now
+			saveReleaseCache(cachePath, cache)
+			return cache.TagName, cache.DownloadURL, nil
+		}
+		return "", "", fmt.Errorf("github answered not modified without a cached release")
+	default:
+		return staleRelease(cache, fmt.Errorf("bad status from github: %s", resp.Status))
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name               string `json:"name"`
+			BrowserDownloadURL string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return staleRelease(cache, err)
+	}
+
+	var downloadURL string
+	for _, asset := range release.Assets {
+		if strings.Contains(asset.Name, "chromium") {
+			downloadURL = asset.BrowserDownloadURL
+			break
+		}
+	}
+
+	if release.TagName == "" || downloadURL == "" {
+		return staleRelease(cache, fmt.Errorf("missing tag or download url in github response"))
+	}
+
+	saveReleaseCache(cachePath, &releaseCache{
+		FetchedAt:   now,
+		ETag:        resp.Header.Get("ETag"),
+		TagName:     release.TagName,
+		DownloadURL: downloadURL,
+	})
+	return release.TagName, downloadURL, nil
+}
+
+// staleRelease prefers an outdated cache over the hardcoded fallback if GitHub can't be reached.
+func staleRelease(cache *releaseCache, err error) (string, string, error) {
+	if cache == nil {
+		return "", "", err
+	}
+	slog.Debug("Failed to refresh uBlock release info, using the cached one", "error", err)
+	return cache.TagName, cache.DownloadURL, nil
+}
+
+func loadReleaseCache(path string) *releaseCache {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cache releaseCache
+	if err := json.Unmarshal(data, &cache); err != nil || cache.TagName == "" || cache.DownloadURL == "" {
+		return nil
+	}
+	return &cache
+}
+
+func saveReleaseCache(path string, cache *releaseCache) {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		slog.Debug("Failed to write uBlock release cache", "error", err)
+	}
+}
@@ -0,0 +1,53 @@
+package chrome
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchLatestReleaseCache(t *testing.T) {
+	requests := 0
+	conditional := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"tag_name":"1.0","assets":[{"name":"ublock.firefox.xpi","browser_download_url":"ff"},{"name":"ublock.chromium.zip","browser_download_url":"chromium"}]}`))
+	}))
+	defer server.Close()
+
+	m := NewManager(t.TempDir(), nil)
+	now := time.Now()
+
+	tests := []struct {
+		at                  time.Time
+		requests            int
+		conditionalRequests int
+	}{
+		{now, 1, 0},
+		{now.Add(time.Hour), 1, 0},
+		{now.Add(releaseCacheTTL + time.Minute), 2, 1},
+		// the 304 refreshed the cache
+		{now.Add(releaseCacheTTL + 2*time.Minute), 2, 1},
+	}
+
+	for i, tt := range tests {
+		tag, url, err := m.fetchLatestRelease(context.Background(), server.URL, tt.at)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if tag != "1.0" || url != "chromium" {
+			t.Errorf("%d\nExpected: 1.0 chromium\nGot: %s %s", i, tag, url)
+		}
+		if requests != tt.requests || conditional != tt.conditionalRequests {
+			t.Errorf("%d\nExpected: %d requests, %d conditional\nGot: %d requests, %d conditional", i, tt.requests, tt.conditionalRequests, requests, conditional)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package chrome
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bugmaschine/gad/pkg/version"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// harRedacted replaces the values of sensitive headers.
+const harRedacted = "<redacted>"
+
+// harSensitiveHeaders carry the session of the user, they are redacted unless the secrets are kept.
+var harSensitiveHeaders = []string{"authorization", "cookie", "proxy-authorization", "set-cookie"}
+
+// HarRecorder records the requests of browser tabs as HTTP Archive, a trace of a scrape that can be attached to
+// bug reports and opened in the developer tools of any browser. Cookies and credentials are redacted unless
+// keepSecrets is set.
+type HarRecorder struct {
+	path        string
+	keepSecrets bool
+
+	mu      sync.Mutex
+	entries []*harEntry
+}
+
+func NewHarRecorder(path string, keepSecrets bool) *HarRecorder {
+	return &HarRecorder{path: path, keepSecrets: keepSecrets}
+}
+
+// Path is the file Save writes.
+func (r *HarRecorder) Path() string {
+	return r.path
+}
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	// Error is why the request failed, HAR allows custom fields starting with an underscore
+	Error string `json:"_error,omitempty"`
+
+	// sent and responded are the monotonic timestamps of the browser, for the timings
+	sent      time.Time
+	responded time.Time
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int64          `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Listen records the requests of the tab of ctx until it is closed. The network domain is enabled for every tab.
+func (r *HarRecorder) Listen(ctx context.Context) {
+	// request IDs are only unique within a tab
+	pending := make(map[network.RequestID]*harEntry)
+	chromedp.ListenTarget(ctx, func(ev any) {
+		r.handle(pending, ev)
+	})
+}
+
+// handle records a network event of a tab, pending holds its requests that didn't finish yet.
+func (r *HarRecorder) handle(pending map[network.RequestID]*harEntry, ev any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch e := ev.(type) {
+	case *network.EventRequestWillBeSent:
+		// a redirect keeps the ID of the request it came from
+		if entry := pending[e.RequestID]; entry != nil && e.RedirectResponse != nil {
+			r.respond(entry, e.RedirectResponse, e.Timestamp)
+			entry.finish(e.Timestamp)
+		}
+		if strings.HasPrefix(e.Request.URL, "data:") {
+			delete(pending, e.RequestID)
+			return
+		}
+		entry := r.request(e)
+		pending[e.RequestID] = entry
+		r.entries = append(r.entries, entry)
+	case *network.EventResponseReceived:
+		if entry := pending[e.RequestID]; entry != nil {
+			r.respond(entry, e.Response, e.Timestamp)
+		}
+	case *network.EventLoadingFinished:
+		if entry := pending[e.RequestID]; entry != nil {
+			entry.Response.BodySize = int64(e.EncodedDataLength)
+			entry.finish(e.Timestamp)
+			delete(pending, e.RequestID)
+		}
+	case *network.EventLoadingFailed:
+		if entry := pending[e.RequestID]; entry != nil {
+			entry.Error = e.ErrorText
+			entry.finish(e.Timestamp)
+			delete(pending, e.RequestID)
+		}
+	}
+}
+
+func (r *HarRecorder) request(e *network.EventRequestWillBeSent) *harEntry {
+	entry := &harEntry{
+		Request: harRequest{
+			Method:      e.Request.Method,
+			URL:         e.Request.URL + e.Request.URLFragment,
+			Cookies:     []harNameValue{},
+			Headers:     r.headers(e.Request.Headers),
+			QueryString: queryString(e.Request.URL),
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+	}
+	if e.WallTime != nil {
+		entry.StartedDateTime = e.WallTime.Time()
+	}
+	if e.Timestamp != nil {
+		entry.sent = e.Timestamp.Time()
+	}
+	return entry
+}
+
+func (r *HarRecorder) respond(entry *harEntry, resp *network.Response, at *cdp.MonotonicTime) {
+	entry.Response.Status = resp.Status
+	entry.Response.StatusText = resp.StatusText
+	entry.Response.HTTPVersion = resp.Protocol
+	entry.Response.Headers = r.headers(resp.Headers)
+	entry.Response.Content = harContent{Size: int64(resp.EncodedDataLength), MimeType: resp.MimeType}
+	for _, header := range entry.Response.Headers {
+		if strings.EqualFold(header.Name, "location") {
+			entry.Response.RedirectURL = header.Value
+		}
+	}
+	entry.Request.HTTPVersion = resp.Protocol
+	// the browser knows the headers it actually sent only once the response is there
+	if len(resp.RequestHeaders) > 0 {
+		entry.Request.Headers = r.headers(resp.RequestHeaders)
+	}
+	if at != nil {
+		entry.responded = at.Time()
+	}
+}
+
+// finish fills in the timings in milliseconds, as far as the timestamps of the browser allow.
+func (e *harEntry) finish(at *cdp.MonotonicTime) {
+	if at == nil || e.sent.IsZero() {
+		return
+	}
+	end := at.Time()
+	e.Time = milliseconds(end.Sub(e.sent))
+	if e.responded.IsZero() {
+		return
+	}
+	e.Timings.Wait = milliseconds(e.responded.Sub(e.sent))
+	e.Timings.Receive = milliseconds(end.Sub(e.responded))
+}
+
+func milliseconds(d time.Duration) float64 {
+	return max(float64(d)/float64(time.Millisecond), 0)
+}
+
+// headers converts the headers of the browser into HAR, sorted by name and with the secrets redacted.
+func (r *HarRecorder) headers(headers network.Headers) []harNameValue {
+	list := make([]harNameValue, 0, len(headers))
+	for name, value := range headers {
+		v := fmt.Sprint(value)
+		if !r.keepSecrets && slices.Contains(harSensitiveHeaders, strings.ToLower(name)) {
+			v = harRedacted
+		}
+		list = append(list, harNameValue{Name: name, Value: v})
+	}
+	slices.SortFunc(list, func(a, b harNameValue) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return list
+}
+
+func queryString(raw string) []harNameValue {
+	list := []harNameValue{}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return list
+	}
+	for name, values := range u.Query() {
+		for _, value := range values {
+			list = append(list, harNameValue{Name: name, Value: value})
+		}
+	}
+	slices.SortFunc(list, func(a, b harNameValue) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return list
+}
+
+// Save writes everything recorded so far to the file of the recorder and returns the number of requests. Later
+// calls replace the file, so it holds all scrapes of the run.
+func (r *HarRecorder) Save() (int, error) {
+	r.mu.Lock()
+	har := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "gad", Version: version.Get().Version},
+		// HAR wants an empty list, not null
+		Entries: append([]*harEntry{}, r.entries...),
+	}}
+	data, err := json.MarshalIndent(har, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(r.path+".tmp", data, 0644); err != nil {
+		return 0, err
+	}
+	return len(har.Log.Entries), os.Rename(r.path+".tmp", r.path)
+}
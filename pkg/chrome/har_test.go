@@ -0,0 +1,98 @@
+package chrome
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+)
+
+func TestHarRecorder(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) *cdp.MonotonicTime {
+		t := cdp.MonotonicTime(start.Add(time.Duration(ms) * time.Millisecond))
+		return &t
+	}
+	wall := cdp.TimeSinceEpoch(start)
+	events := []any{
+		&network.EventRequestWillBeSent{RequestID: "1", Timestamp: at(0), WallTime: &wall, Request: &network.Request{
+			Method: "GET", URL: "https://filemoon.example/e/abc?token=1", Headers: network.Headers{"Cookie": "session=secret", "Referer": "https://aniworld.to/"},
+		}},
+		// redirected, the next request keeps the ID
+		&network.EventRequestWillBeSent{RequestID: "1", Timestamp: at(100), WallTime: &wall, RedirectResponse: &network.Response{
+			Status: 302, Headers: network.Headers{"Location": "https://filemoon.example/d/abc"}, Protocol: "h2",
+		}, Request: &network.Request{Method: "GET", URL: "https://filemoon.example/d/abc"}},
+		&network.EventResponseReceived{RequestID: "1", Timestamp: at(150), Response: &network.Response{
+			Status: 200, MimeType: "text/html", Protocol: "h2", Headers: network.Headers{"Set-Cookie": "session=new"},
+		}},
+		&network.EventLoadingFinished{RequestID: "1", Timestamp: at(200), EncodedDataLength: 1234},
+		&network.EventRequestWillBeSent{RequestID: "2", Timestamp: at(300), Request: &network.Request{Method: "GET", URL: "data:image/png;base64,AAAA"}},
+		&network.EventRequestWillBeSent{RequestID: "3", Timestamp: at(300), Request: &network.Request{Method: "POST", URL: "https://filemoon.example/attest"}},
+		&network.EventLoadingFailed{RequestID: "3", Timestamp: at(400), ErrorText: "net::ERR_BLOCKED_BY_CLIENT"},
+	}
+
+	path := filepath.Join(t.TempDir(), "traces", "scrape.har")
+	recorder := NewHarRecorder(path, false)
+	pending := make(map[network.RequestID]*harEntry)
+	for _, ev := range events {
+		recorder.handle(pending, ev)
+	}
+	if requests, err := recorder.Save(); err != nil || requests != 3 {
+		t.Fatalf("\nExpected: 3 requests\nGot:      %d (%v)", requests, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatal(err)
+	}
+	entries := har.Log.Entries
+	if har.Log.Version != "1.2" || len(entries) != 3 {
+		t.Fatalf("\nExpected: HAR 1.2 with 3 entries\nGot:      %s", data)
+	}
+
+	tests := []struct {
+		entry    *harEntry
+		url      string
+		status   int64
+		time     float64
+		redirect string
+		error    string
+	}{
+		{entries[0], "https://filemoon.example/e/abc?token=1", 302, 100, "https://filemoon.example/d/abc", ""},
+		{entries[1], "https://filemoon.example/d/abc", 200, 100, "", ""},
+		{entries[2], "https://filemoon.example/attest", 0, 100, "", "net::ERR_BLOCKED_BY_CLIENT"},
+	}
+	for _, tt := range tests {
+		got := tt.entry
+		if got.Request.URL != tt.url || got.Response.Status != tt.status || got.Time != tt.time || got.Response.RedirectURL != tt.redirect || got.Error != tt.error {
+			t.Errorf("\nExpected: %s %d %.0fms %q %q\nGot:      %s %d %.0fms %q %q", tt.url, tt.status, tt.time, tt.redirect, tt.error,
+				got.Request.URL, got.Response.Status, got.Time, got.Response.RedirectURL, got.Error)
+		}
+	}
+	if q := entries[0].Request.QueryString; len(q) != 1 || q[0] != (harNameValue{"token", "1"}) {
+		t.Errorf("\nExpected: [{token 1}]\nGot:      %v", q)
+	}
+	if entries[1].Response.BodySize != 1234 || entries[1].Timings.Wait != 50 || entries[1].Timings.Receive != 50 {
+		t.Errorf("\nExpected: 1234 bytes, 50ms wait, 50ms receive\nGot:      %d bytes, %+v", entries[1].Response.BodySize, entries[1].Timings)
+	}
+
+	// the session of the user stays out of the trace
+	expected := []harNameValue{{"Cookie", harRedacted}, {"Referer", "https://aniworld.to/"}}
+	if got := entries[0].Request.Headers; len(got) != 2 || got[0] != expected[0] || got[1] != expected[1] {
+		t.Errorf("\nExpected: %v\nGot:      %v", expected, got)
+	}
+	if got := entries[1].Response.Headers; len(got) != 1 || got[0].Value != harRedacted {
+		t.Errorf("\nExpected: Set-Cookie redacted\nGot:      %v", got)
+	}
+	if got := NewHarRecorder(path, true).headers(network.Headers{"Cookie": "session=secret"}); got[0].Value != "session=secret" {
+		t.Errorf("\nExpected: the cookie kept\nGot:      %v", got)
+	}
+}
@@ -0,0 +1,83 @@
+package chrome
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+	"github.com/chromedp/chromedp"
+)
+
+// loginSelectors and ageSelectors are elements of login forms and age confirmations. They are kept generic, the
+// check only runs on pages where the expected content didn't show up.
+var (
+	loginSelectors = []string{
+		`input[type="password"]`,
+		`form[action*="login" i]`,
+		`form[action*="signin" i]`,
+		`#loginForm`,
+	}
+	ageSelectors = []string{
+		`#age-gate`,
+		`.age-gate`,
+		`[id*="age-verif" i]`,
+		`[class*="age-verif" i]`,
+		`[id*="agegate" i]`,
+		`[class*="agegate" i]`,
+	}
+)
+
+// loginPath matches the pages sites redirect to if the content requires an account.
+var loginPath = regexp.MustCompile(`(?i)/(login|signin|sign-in|anmelden|account/login)(/|\.php|$)`)
+
+// wallCheckTimeout keeps a page that is still loading from blocking the check.
+const wallCheckTimeout = 10 * time.Second
+
+// DetectWall checks whether the current page of the browser is a login or age wall. It returns a
+// *downloaders.WallError, or nil if there is none or the page couldn't be inspected. Get attaches it to
+// the browser context with downloaders.WithWallDetector.
+func DetectWall(ctx context.Context) error {
+	login, _ := json.Marshal(loginSelectors)
+	age, _ := json.Marshal(ageSelectors)
+	script := fmt.Sprintf(`(() => {
+		const visible = selectors => selectors.some(s => Array.from(document.querySelectorAll(s)).some(el => el.getClientRects().length > 0));
+		return {url: location.href, login: visible(%s), age: visible(%s)};
+	})()`, login, age)
+
+	var page struct {
+		Url   string `json:"url"`
+		Login bool   `json:"login"`
+		Age   bool   `json:"age"`
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, wallCheckTimeout)
+	defer cancel()
+	if err := chromedp.Run(checkCtx, chromedp.Evaluate(script, &page)); err != nil {
+		slog.Debug("Failed to check the page for a login wall", "error", err)
+		return nil
+	}
+
+	kind, ok := classifyWall(page.Url, page.Login, page.Age)
+	if !ok {
+		return nil
+	}
+	return &downloaders.WallError{Url: page.Url, Kind: kind}
+}
+
+// classifyWall decides on the kind of wall from the page url and the selectors that matched.
+func classifyWall(pageUrl string, login, age bool) (downloaders.WallKind, bool) {
+	switch {
+	case age:
+		return downloaders.WallAge, true
+	case login:
+		return downloaders.WallLogin, true
+	}
+	if u, err := url.Parse(pageUrl); err == nil && loginPath.MatchString(u.Path) {
+		return downloaders.WallLogin, true
+	}
+	return 0, false
+}
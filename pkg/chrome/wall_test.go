@@ -0,0 +1,31 @@
+package chrome
+
+import (
+	"testing"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+)
+
+func TestClassifyWall(t *testing.T) {
+	tests := []struct {
+		url      string
+		login    bool
+		age      bool
+		expected downloaders.WallKind
+	}{
+		{"https://aniworld.to/anime/stream/yuruyuri", false, false, 0},
+		{"https://aniworld.to/login", false, false, downloaders.WallLogin},
+		{"https://s.to/account/login/?redirect=/serie", false, false, downloaders.WallLogin},
+		{"https://example.com/login.php", false, false, downloaders.WallLogin},
+		{"https://example.com/anime/login-screen-anime", false, false, 0},
+		{"https://aniworld.to/anime/stream/yuruyuri", true, false, downloaders.WallLogin},
+		{"https://aniworld.to/anime/stream/yuruyuri", true, true, downloaders.WallAge},
+	}
+
+	for _, tt := range tests {
+		kind, ok := classifyWall(tt.url, tt.login, tt.age)
+		if kind != tt.expected || ok != (tt.expected != 0) {
+			t.Errorf("%s login=%v age=%v\nExpected: %v\nGot:      %v %v", tt.url, tt.login, tt.age, tt.expected, kind, ok)
+		}
+	}
+}
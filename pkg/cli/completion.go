@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+	"github.com/bugmaschine/gad/internal/extractors"
+	"github.com/bugmaschine/gad/pkg/download"
+	"github.com/spf13/cobra"
+)
+
+// registerCompletions adds dynamic shell completion for flags with a known set of values.
+func registerCompletions(cmd *cobra.Command) {
+	fixed := func(values ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+			return values, cobra.ShellCompDirectiveNoFileComp
+		}
+	}
+
+	_ = cmd.RegisterFlagCompletionFunc("extractor", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return extractorNames(), cobra.ShellCompDirectiveNoFileComp
+	})
+	_ = cmd.RegisterFlagCompletionFunc("priorities", completePriorities)
+	_ = cmd.RegisterFlagCompletionFunc("hoster", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return extractorNames(), cobra.ShellCompDirectiveNoFileComp
+	})
+	_ = cmd.RegisterFlagCompletionFunc("type", fixed("raw", "dub", "sub"))
+	_ = cmd.RegisterFlagCompletionFunc("lang", fixed("en", "de", "all"))
+	_ = cmd.RegisterFlagCompletionFunc("type-language", fixed("raw", "dub", "sub", "en", "de", "endub", "ensub", "gerdub", "gersub"))
+	_ = cmd.RegisterFlagCompletionFunc("quality", fixed("best", "1080p", "720p", "480p", "360p"))
+	_ = cmd.RegisterFlagCompletionFunc("audio-format", fixed(
+		string(download.AudioFormatM4A),
+		string(download.AudioFormatMP3),
+		string(download.AudioFormatOpus),
+	))
+	_ = cmd.RegisterFlagCompletionFunc("sub-lang", fixed("en", "de", "all"))
+	_ = cmd.RegisterFlagCompletionFunc("sub-mode", fixed(
+		string(download.SubtitleExternal),
+		string(download.SubtitleEmbed),
+	))
+	_ = cmd.RegisterFlagCompletionFunc("naming", fixed(
+		download.NamingDefault.String(),
+		download.NamingSonarr.String(),
+		download.NamingPlex.String(),
+	))
+	_ = cmd.RegisterFlagCompletionFunc("skip-existing", fixed(
+		downloaders.SkipModeOff.String(),
+		downloaders.SkipModeByName.String(),
+		downloaders.SkipModeByNameAndSize.String(),
+		downloaders.SkipModeOverwrite.String(),
+	))
+}
+
+func extractorNames() []string {
+	var names []string
+	for _, e := range extractors.GetExtractors() {
+		for _, name := range e.Names() {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return names
+}
+
+// completePriorities completes the last entry of the comma separated priority list.
+func completePriorities(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	prefix := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix = toComplete[:i+1]
+	}
+
+	var completions []string
+	for _, name := range append(extractorNames(), "*") {
+		completions = append(completions, prefix+name)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
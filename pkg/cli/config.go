@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Flag sources of a Setting.
+const (
+	SourceDefault = "default"
+	SourceFlag    = "flag"
+)
+
+// redacted replaces the values of sensitive settings in the output of --print-config.
+const redacted = "<redacted>"
+
+// sensitiveNames are parts of flag and variable names whose values are never printed.
+var sensitiveNames = []string{"cookie", "token", "password", "secret", "auth"}
+
+// Setting is the effective value of a flag and where it came from, see --print-config.
+type Setting struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// collectSettings returns every flag of flags with its value, keyed by name. Deprecated aliases and the flags
+// that only print something are left out.
+func collectSettings(flags *pflag.FlagSet) map[string]Setting {
+	settings := make(map[string]Setting)
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Deprecated != "" || f.Name == "help" || f.Name == "version" || f.Name == "print-config" {
+			return
+		}
+		source := SourceDefault
+		if f.Changed {
+			source = SourceFlag
+		}
+		settings[f.Name] = Setting{Value: Redact(f.Name, f.Value.String()), Source: source}
+	})
+	return settings
+}
+
+// Redact hides value if name looks like it holds a secret, and the password of URLs like proxies with credentials.
+func Redact(name, value string) string {
+	if value == "" {
+		return value
+	}
+	lower := strings.ToLower(name)
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(lower, sensitive) {
+			return redacted
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return value
+}
@@ -0,0 +1,24 @@
+package cli
+
+// Exit codes of gad. A second Ctrl+C exits immediately with 130.
+const (
+	// ExitOK means every episode was downloaded, or failed without --strict-exit.
+	ExitOK = 0
+	// ExitFatal means the run couldn't go on: a flag was invalid, a series failed to load or the failure policy
+	// stopped the run.
+	ExitFatal = 1
+	// ExitFailures means the run finished, but with --strict-exit some episodes failed or were left out.
+	ExitFailures = 2
+)
+
+// ExitCode returns the exit code of a run that ended fatally or with failed episodes.
+func (a *Args) ExitCode(fatal bool, failed int) int {
+	switch {
+	case fatal:
+		return ExitFatal
+	case failed > 0 && a.StrictExit:
+		return ExitFailures
+	default:
+		return ExitOK
+	}
+}
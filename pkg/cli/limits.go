@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+const (
+	// MaxConcurrentDownloads is the most downloads that run at once, hosters throttle or ban long before it.
+	MaxConcurrentDownloads = 64
+	// MaxParallelParts is the most byte ranges of one file downloaded at once.
+	MaxParallelParts = 32
+	// reservedFiles are the file descriptors left for everything but the downloads, like the browser and logs.
+	reservedFiles = 64
+)
+
+// clampLimits checks --concurrent and --parallel-parts. Values below 1 are refused, values too high for
+// MaxConcurrentDownloads, MaxParallelParts or the open file limit are lowered with a warning.
+func (a *Args) clampLimits() error {
+	concurrent, parts, err := clampConcurrency(a.ConcurrentDownloads, a.ParallelParts, openFileLimit())
+	if err != nil {
+		return err
+	}
+	a.ConcurrentDownloads, a.ParallelParts = concurrent, parts
+	return nil
+}
+
+// clampConcurrency lowers concurrent downloads with parts each to what fits into fileLimit. Every part holds a
+// connection and the file is open as well. A fileLimit of 0 means it is unknown.
+func clampConcurrency(concurrent, parts int, fileLimit uint64) (int, int, error) {
+	if concurrent < 1 {
+		return 0, 0, fmt.Errorf("--concurrent must be at least 1, got %d", concurrent)
+	}
+	if parts < 1 {
+		return 0, 0, fmt.Errorf("--parallel-parts must be at least 1, got %d", parts)
+	}
+
+	if parts > MaxParallelParts {
+		slog.Warn("Too many parallel parts, lowering them", "parallel_parts", parts, "max", MaxParallelParts)
+		parts = MaxParallelParts
+	}
+	maxConcurrent := MaxConcurrentDownloads
+	if fileLimit > 0 {
+		perDownload := uint64(parts + 1)
+		fitting := 1
+		if fileLimit > reservedFiles+perDownload {
+			fitting = int(min((fileLimit-reservedFiles)/perDownload, MaxConcurrentDownloads))
+		}
+		maxConcurrent = fitting
+	}
+	if concurrent > maxConcurrent {
+		slog.Warn("Too many concurrent downloads for the limits of this system, lowering them", "concurrent", concurrent, "max", maxConcurrent, "open_file_limit", fileLimit)
+		concurrent = maxConcurrent
+	}
+	return concurrent, parts, nil
+}
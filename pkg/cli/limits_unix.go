@@ -0,0 +1,14 @@
+//go:build unix
+
+package cli
+
+import "syscall"
+
+// openFileLimit returns the soft limit of open files of the process, 0 if it can't be read.
+func openFileLimit() uint64 {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0
+	}
+	return uint64(limit.Cur)
+}
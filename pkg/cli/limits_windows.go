@@ -0,0 +1,8 @@
+//go:build windows
+
+package cli
+
+// openFileLimit returns 0, Windows has no practical limit of open handles per process.
+func openFileLimit() uint64 {
+	return 0
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/bugmaschine/gad/pkg/utils"
 )
 
 // GetDataDir returns the path to the data directory, creating it if it doesn't exist.
@@ -47,3 +50,41 @@ func GetSaveDirectory(customSaveDirectory string) (string, error) {
 	}
 	return cwd, nil
 }
+
+// CheckWritable creates dir if needed and writes and removes a temporary file in it, so a read-only mount or missing
+// permissions show up before any work is done.
+func CheckWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, ".gad-write-test-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// RemoveCache removes the files and directories of a cache below root and returns the bytes they took. Paths outside
+// of root are refused, so cleaning a cache can't take downloaded media with it.
+func RemoveCache(root string, paths []string) (int64, error) {
+	var reclaimed int64
+	for _, path := range paths {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return reclaimed, fmt.Errorf("%s is not inside %s", path, root)
+		}
+		size, err := utils.PathSize(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return reclaimed, err
+		}
+		if err := utils.RemoveDirAllIgnoreNotExists(path); err != nil {
+			return reclaimed, err
+		}
+		reclaimed += size
+	}
+	return reclaimed, nil
+}
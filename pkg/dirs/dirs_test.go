@@ -0,0 +1,59 @@
+package dirs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckWritable(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "downloads", "series")
+	if err := CheckWritable(dir); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("\nExpected: no files left\nGot:      %d", len(entries))
+	}
+
+	// a file where the directory should be, permissions don't stop root
+	file := filepath.Join(root, "file")
+	os.WriteFile(file, nil, 0644)
+	if err := CheckWritable(filepath.Join(file, "downloads")); err == nil {
+		t.Error("expected an error below a file")
+	}
+}
+
+func TestRemoveCache(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "uBlock", "js"), 0755)
+	os.WriteFile(filepath.Join(root, "uBlock", "js", "background.js"), make([]byte, 100), 0644)
+	os.WriteFile(filepath.Join(root, "current_ublock_version"), make([]byte, 10), 0644)
+	// the work directory of the downloads is in the data directory as well
+	os.MkdirAll(filepath.Join(root, "tmp"), 0755)
+	os.WriteFile(filepath.Join(root, "tmp", "Episode 1.mp4"), make([]byte, 1000), 0644)
+
+	reclaimed, err := RemoveCache(root, []string{
+		filepath.Join(root, "uBlock"),
+		filepath.Join(root, "current_ublock_version"),
+		filepath.Join(root, "uBlock.zip"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reclaimed != 110 {
+		t.Errorf("\nExpected: %d\nGot:      %d", 110, reclaimed)
+	}
+	if _, err := os.Stat(filepath.Join(root, "uBlock")); !os.IsNotExist(err) {
+		t.Errorf("\nExpected: uBlock removed\nGot:      %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "tmp", "Episode 1.mp4")); err != nil {
+		t.Errorf("\nExpected: the episode kept\nGot:      %v", err)
+	}
+
+	for _, path := range []string{root, filepath.Dir(root), filepath.Join(root, "..", "downloads")} {
+		if _, err := RemoveCache(root, []string{path}); err == nil {
+			t.Errorf("%s\nExpected: refused outside of the data directory\nGot:      removed", path)
+		}
+	}
+}
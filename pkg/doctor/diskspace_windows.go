@@ -0,0 +1,18 @@
+//go:build windows
+
+package doctor
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the bytes available to the current user on the volume of dir.
+func freeSpace(dir string) (uint64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
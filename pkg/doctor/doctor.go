@@ -0,0 +1,252 @@
+// Package doctor checks whether the environment is able to scrape and download, see "gad doctor".
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bugmaschine/gad/pkg/chrome"
+	"github.com/bugmaschine/gad/pkg/dirs"
+	"github.com/bugmaschine/gad/pkg/download"
+	"github.com/bugmaschine/gad/pkg/ffmpeg"
+	"github.com/chromedp/chromedp"
+)
+
+// minFreeSpace is the free space below which the save directory gets a warning, a single episode can take a GiB.
+const minFreeSpace = 5 * 1024 * 1024 * 1024
+
+// extensionStartTimeout is how long the uBlock service worker gets to show up after the browser started.
+const extensionStartTimeout = 5 * time.Second
+
+type Status int
+
+const (
+	StatusPass Status = iota
+	StatusWarn
+	StatusFail
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPass:
+		return "PASS"
+	case StatusWarn:
+		return "WARN"
+	default:
+		return "FAIL"
+	}
+}
+
+// Check is the outcome of a single check.
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// Report collects the checks in the order they ran.
+type Report struct {
+	Checks []Check
+}
+
+func (r *Report) add(name string, status Status, detail string) {
+	r.Checks = append(r.Checks, Check{Name: name, Status: status, Detail: detail})
+}
+
+// Passed reports whether no check failed, warnings are fine.
+func (r *Report) Passed() bool {
+	for _, c := range r.Checks {
+		if c.Status == StatusFail {
+			return false
+		}
+	}
+	return true
+}
+
+// Print writes one line per check and a summary.
+func (r *Report) Print(w io.Writer) {
+	width := 0
+	for _, c := range r.Checks {
+		width = max(width, len(c.Name))
+	}
+
+	counts := make(map[Status]int)
+	for _, c := range r.Checks {
+		counts[c.Status]++
+		fmt.Fprintf(w, "[%s] %-*s  %s\n", c.Status, width, c.Name, c.Detail)
+	}
+	fmt.Fprintf(w, "\n%d passed, %d warnings, %d failed\n", counts[StatusPass], counts[StatusWarn], counts[StatusFail])
+}
+
+// Options are the parts of the environment gad would use for a download.
+type Options struct {
+	DataDir    string
+	SaveDir    string
+	Downloader *download.Downloader
+	Chrome     *chrome.ChromeManager
+	// Headless is false with --browser
+	Headless bool
+}
+
+// Run prepares FFmpeg and the browser like a download would and checks everything, a failing check doesn't stop the others.
+func Run(ctx context.Context, opts Options) *Report {
+	r := &Report{}
+	r.checkFfmpeg(ctx, opts)
+	r.checkSaveDirectory(opts.SaveDir)
+	r.checkBrowser(ctx, opts)
+	return r
+}
+
+func (r *Report) checkFfmpeg(ctx context.Context, opts Options) {
+	path, err := ffmpeg.New(opts.DataDir).AutoDownload(ctx, opts.Downloader)
+	if err != nil {
+		r.add("FFmpeg", StatusFail, err.Error())
+		return
+	}
+	v, err := ffmpeg.Version(path)
+	if err != nil {
+		r.add("FFmpeg", StatusFail, fmt.Sprintf("%s doesn't run: %v", path, err))
+		return
+	}
+	r.add("FFmpeg", StatusPass, fmt.Sprintf("%s (%s)", v, path))
+}
+
+func (r *Report) checkSaveDirectory(dir string) {
+	if err := dirs.CheckWritable(dir); err != nil {
+		r.add("Save directory", StatusFail, err.Error())
+		return
+	}
+	r.add("Save directory", StatusPass, dir+" is writable")
+
+	free, err := freeSpace(dir)
+	switch {
+	case err != nil:
+		r.add("Disk space", StatusWarn, fmt.Sprintf("unknown: %v", err))
+	case free < minFreeSpace:
+		r.add("Disk space", StatusWarn, download.FormatSize(int64(free))+" free")
+	default:
+		r.add("Disk space", StatusPass, download.FormatSize(int64(free))+" free")
+	}
+}
+
+// fingerprint holds the properties bot detection scripts commonly look at.
+type fingerprint struct {
+	Webdriver bool   `json:"webdriver"`
+	Chrome    bool   `json:"chrome"`
+	Plugins   int    `json:"plugins"`
+	Languages int    `json:"languages"`
+	UserAgent string `json:"userAgent"`
+	WebGL     string `json:"webgl"`
+}
+
+const fingerprintScript = `(() => {
+	let webgl = "";
+	try {
+		const gl = document.createElement("canvas").getContext("webgl");
+		const info = gl && gl.getExtension("WEBGL_debug_renderer_info");
+		webgl = info ? gl.getParameter(info.UNMASKED_RENDERER_WEBGL) : "";
+	} catch (e) {}
+	return {
+		webdriver: navigator.webdriver === true,
+		chrome: typeof window.chrome === "object",
+		plugins: navigator.plugins.length,
+		languages: navigator.languages.length,
+		userAgent: navigator.userAgent,
+		webgl: webgl
+	};
+})()`
+
+func (r *Report) checkBrowser(ctx context.Context, opts Options) {
+	browserCtx, cancel, err := opts.Chrome.Get(ctx, opts.Headless, false)
+	if err != nil {
+		r.add("Browser", StatusFail, err.Error())
+		return
+	}
+	defer cancel()
+
+	var fp fingerprint
+	// the patches are applied to new documents, so a page has to be loaded first
+	err = chromedp.Run(browserCtx,
+		chromedp.Navigate("data:text/html,<title>gad doctor</title>"),
+		chromedp.Evaluate(fingerprintScript, &fp),
+	)
+	if err != nil {
+		r.add("Browser", StatusFail, err.Error())
+		return
+	}
+	r.add("Browser", StatusPass, "started")
+	r.Checks = append(r.Checks, evaluateFingerprint(fp)...)
+
+	r.checkUblock(browserCtx, opts.Chrome)
+}
+
+// evaluateFingerprint turns the fingerprint into checks, only the tells the patches are supposed to hide fail.
+func evaluateFingerprint(fp fingerprint) []Check {
+	checks := []Check{
+		{"navigator.webdriver", StatusPass, "hidden"},
+		{"window.chrome", StatusPass, "present"},
+		{"Plugins", StatusPass, fmt.Sprintf("%d found", fp.Plugins)},
+		{"Languages", StatusPass, fmt.Sprintf("%d found", fp.Languages)},
+		{"User agent", StatusPass, fp.UserAgent},
+		{"WebGL renderer", StatusPass, fp.WebGL},
+	}
+	if fp.Webdriver {
+		checks[0].Status, checks[0].Detail = StatusFail, "exposed, the anti-automation patch didn't apply"
+	}
+	if !fp.Chrome {
+		checks[1].Status, checks[1].Detail = StatusWarn, "missing, some sites flag this as headless"
+	}
+	if fp.Plugins == 0 {
+		checks[2].Status = StatusWarn
+	}
+	if fp.Languages == 0 {
+		checks[3].Status = StatusWarn
+	}
+	if strings.Contains(fp.UserAgent, "Headless") {
+		checks[4].Status, checks[4].Detail = StatusFail, fp.UserAgent+" reveals headless mode"
+	}
+	// the GPU is disabled on purpose, so a software renderer is expected and only worth a note
+	if fp.WebGL == "" {
+		checks[5].Status, checks[5].Detail = StatusWarn, "unavailable"
+	} else if strings.Contains(fp.WebGL, "SwiftShader") {
+		checks[5].Status = StatusWarn
+	}
+	return checks
+}
+
+// checkUblock looks for the service worker of the extension, it only exists if Chrome loaded it.
+func (r *Report) checkUblock(ctx context.Context, m *chrome.ChromeManager) {
+	version := m.InstalledUblockVersion()
+	if version == "" {
+		r.add("uBlock Origin", StatusFail, "not installed")
+		return
+	}
+
+	deadline := time.Now().Add(extensionStartTimeout)
+	for {
+		targets, err := chromedp.Targets(ctx)
+		if err != nil {
+			r.add("uBlock Origin", StatusFail, err.Error())
+			return
+		}
+		for _, t := range targets {
+			if strings.HasPrefix(t.URL, "chrome-extension://") {
+				r.add("uBlock Origin", StatusPass, version+" loaded")
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			r.add("uBlock Origin", StatusFail, version+" is installed but Chrome didn't load it")
+			return
+		}
+		select {
+		case <-ctx.Done():
+			r.add("uBlock Origin", StatusFail, ctx.Err().Error())
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
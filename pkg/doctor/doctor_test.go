@@ -0,0 +1,70 @@
+package doctor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateFingerprint(t *testing.T) {
+	patched := fingerprint{Chrome: true, Plugins: 5, Languages: 2, UserAgent: "Mozilla/5.0 Chrome/140.0", WebGL: "ANGLE (NVIDIA)"}
+
+	tests := []struct {
+		name     string
+		modify   func(*fingerprint)
+		check    string
+		expected Status
+	}{
+		{"patched", func(*fingerprint) {}, "navigator.webdriver", StatusPass},
+		{"webdriver exposed", func(fp *fingerprint) { fp.Webdriver = true }, "navigator.webdriver", StatusFail},
+		{"headless user agent", func(fp *fingerprint) { fp.UserAgent = "Mozilla/5.0 HeadlessChrome/140.0" }, "User agent", StatusFail},
+		{"no window.chrome", func(fp *fingerprint) { fp.Chrome = false }, "window.chrome", StatusWarn},
+		{"software renderer", func(fp *fingerprint) { fp.WebGL = "ANGLE (Google, Vulkan (SwiftShader Device))" }, "WebGL renderer", StatusWarn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp := patched
+			tt.modify(&fp)
+			for _, c := range evaluateFingerprint(fp) {
+				if c.Name == tt.check && c.Status != tt.expected {
+					t.Errorf("\nExpected: %s\nGot:      %s (%s)", tt.expected, c.Status, c.Detail)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSaveDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "downloads")
+	r := &Report{}
+	r.checkSaveDirectory(dir)
+
+	if !r.Passed() {
+		var out bytes.Buffer
+		r.Print(&out)
+		t.Fatalf("expected the checks to pass:\n%s", out.String())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("\nExpected: no files left\nGot:      %d", len(entries))
+	}
+}
+
+func TestReportPrint(t *testing.T) {
+	r := &Report{}
+	r.add("FFmpeg", StatusPass, "7.1")
+	r.add("Browser", StatusFail, "not found")
+
+	var out bytes.Buffer
+	r.Print(&out)
+	expected := "[PASS] FFmpeg   7.1\n[FAIL] Browser  not found\n\n1 passed, 0 warnings, 1 failed\n"
+	if out.String() != expected {
+		t.Errorf("\nExpected: %q\nGot:      %q", expected, out.String())
+	}
+	if r.Passed() || !strings.Contains(out.String(), "FAIL") {
+		t.Error("expected the report to fail")
+	}
+}
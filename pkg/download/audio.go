@@ -0,0 +1,178 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bugmaschine/gad/pkg/utils"
+	"github.com/grafov/m3u8"
+)
+
+// AudioFormat is the format --audio-only converts to, it is also the extension of the file.
+type AudioFormat string
+
+const (
+	AudioFormatM4A  AudioFormat = "m4a"
+	AudioFormatMP3  AudioFormat = "mp3"
+	AudioFormatOpus AudioFormat = "opus"
+)
+
+// AudioFormats are the supported formats, for help texts and completions.
+var AudioFormats = []AudioFormat{AudioFormatM4A, AudioFormatMP3, AudioFormatOpus}
+
+// audioSourceSuffix marks the temporary download the audio gets extracted from, e.g. "<name>.source.mp4".
+const audioSourceSuffix = ".source"
+
+// ParseAudioFormat checks s against AudioFormats.
+func ParseAudioFormat(s string) (AudioFormat, error) {
+	for _, format := range AudioFormats {
+		if strings.EqualFold(s, string(format)) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown audio format %q, expected one of %v", s, AudioFormats)
+}
+
+// codecArgs are the FFmpeg options to try one after another. The sites almost only have AAC, which m4a keeps
+// as it is, other codecs are transcoded.
+func (f AudioFormat) codecArgs() [][]string {
+	switch f {
+	case AudioFormatMP3:
+		return [][]string{{"-c:a", "libmp3lame", "-q:a", "2"}}
+	case AudioFormatOpus:
+		return [][]string{{"-c:a", "libopus", "-b:a", "128k"}}
+	}
+	return [][]string{{"-c:a", "copy"}, {"-c:a", "aac", "-b:a", "192k"}}
+}
+
+// downloadAudio downloads the stream of task to a temporary file and extracts the audio in task.AudioFormat from it.
+// HLS audio renditions and DASH audio representations are downloaded without the video.
+func (d *Downloader) downloadAudio(ctx context.Context, task *DownloadTask) error {
+	outputPath := task.FinalOutputPath()
+	if task.SkipExisting {
+		if _, err := os.Stat(outputPath); err == nil {
+			slogInfo("skipping download for %s: file already exists", filepath.Base(outputPath))
+			return nil
+		}
+	}
+	if d.ffmpegPath == "" {
+		return d.ffmpegRequired("audio only")
+	}
+	if _, err := os.Stat(outputPath); err == nil && !task.OverwriteFile {
+		return &os.PathError{Op: "open", Path: outputPath, Err: fs.ErrExist}
+	}
+
+	extractPath := outputPath
+	if d.tempDir != "" {
+		workDir, err := d.newWorkDir()
+		if err != nil {
+			return err
+		}
+		defer d.removeWorkDir(workDir)
+		extractPath = filepath.Join(workDir, filepath.Base(outputPath))
+	}
+
+	source := *task
+	source.OutputPath = strings.TrimSuffix(extractPath, filepath.Ext(extractPath)) + audioSourceSuffix
+	source.OutputPathHasExtension = false
+	source.AudioFormat = ""
+	source.SkipExisting = false
+	source.OverwriteFile = true
+	source.audioOnly = true
+	if source.CustomMessage == "" {
+		source.CustomMessage = filepath.Base(outputPath)
+	}
+	sourcePath := source.FinalOutputPath()
+	defer func() {
+		utils.RemoveFileIgnoreNotExists(sourcePath)
+		utils.RemoveFileIgnoreNotExists(hlsFallbackPath(sourcePath))
+	}()
+
+	var limitErr *ErrLimitExceeded
+	err := d.DownloadToFile(ctx, &source)
+	if err != nil && !errors.As(err, &limitErr) {
+		return err
+	}
+
+	input := sourcePath
+	// the raw stream is kept if FFmpeg failed to mux the HLS parts
+	if _, statErr := os.Stat(input); statErr != nil {
+		input = hlsFallbackPath(sourcePath)
+	}
+	if extractErr := d.extractAudio(ctx, input, extractPath, task.AudioFormat); extractErr != nil {
+		return extractErr
+	}
+	if extractPath != outputPath {
+		if moveErr := moveFromWorkDir(extractPath, outputPath); moveErr != nil {
+			return moveErr
+		}
+	}
+	return err
+}
+
+// extractAudio writes the first audio stream of input to output.
+func (d *Downloader) extractAudio(ctx context.Context, input, output string, format AudioFormat) error {
+	var err error
+	for _, codec := range format.codecArgs() {
+		args := append([]string{"-y", "-i", input, "-vn", "-map", "0:a:0"}, codec...)
+		args = append(append(args, d.outputArgs(output)...), output)
+		if err = d.runFfmpeg(ctx, args); err == nil {
+			return nil
+		}
+		slog.Debug("Failed to extract audio", "codec", codec, "error", err)
+	}
+	utils.RemoveFileIgnoreNotExists(output)
+	return fmt.Errorf("failed to extract audio: %w", err)
+}
+
+// audioRendition returns the audio rendition of the variant with its own playlist, preferring the default one.
+// Variants without one carry the audio in their own segments.
+func audioRendition(v *m3u8.Variant) *m3u8.Alternative {
+	var found *m3u8.Alternative
+	for _, alt := range v.Alternatives {
+		if alt == nil || alt.Type != "AUDIO" || alt.URI == "" || (v.Audio != "" && alt.GroupId != v.Audio) {
+			continue
+		}
+		if alt.Default {
+			return alt
+		}
+		if found == nil {
+			found = alt
+		}
+	}
+	return found
+}
+
+// downloadAudioRendition downloads the separate audio rendition of a HLS variant next to outputPath, to be muxed with
+// its video. The segments are collected in their own directory beside partsDir, so both resume independently. The
+// returned path is where the audio ended up, also if the download failed.
+func (d *Downloader) downloadAudioRendition(ctx context.Context, audioURL *url.URL, referer, outputPath, partsDir, message string, refresh *refresher) (string, error) {
+	ext := filepath.Ext(outputPath)
+	audioPath := strings.TrimSuffix(outputPath, ext) + hlsAudioSuffix + ext
+	audioPartsDir := strings.TrimSuffix(partsDir, hlsPartsSuffix) + hlsAudioSuffix + hlsPartsSuffix
+
+	resp, err := d.get(ctx, audioURL.String(), referer)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	slog.Info("Downloading the audio rendition", "file", message)
+	var limitErr *ErrLimitExceeded
+	_, err = d.m3u8Download(ctx, resp, referer, audioPath, audioPartsDir, nil, message+" (audio)", nil, refresh, true)
+	if err != nil && !errors.As(err, &limitErr) {
+		return audioPath, err
+	}
+	// the raw stream is kept if FFmpeg failed to mux the parts
+	if _, statErr := os.Stat(audioPath); statErr != nil {
+		return hlsFallbackPath(audioPath), nil
+	}
+	return audioPath, nil
+}
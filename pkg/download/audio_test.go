@@ -0,0 +1,219 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bugmaschine/gad/internal/extractors"
+)
+
+func TestParseAudioFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected AudioFormat
+		valid    bool
+	}{
+		{"m4a", AudioFormatM4A, true},
+		{"MP3", AudioFormatMP3, true},
+		{"opus", AudioFormatOpus, true},
+		{"flac", "", false},
+	}
+
+	for _, tt := range tests {
+		format, err := ParseAudioFormat(tt.input)
+		if (err == nil) != tt.valid || format != tt.expected {
+			t.Errorf("%s\nExpected: %q valid=%v\nGot:      %q %v", tt.input, tt.expected, tt.valid, format, err)
+		}
+	}
+
+	task := NewDownloadTask("/save/Episode 1", "").SetAudioFormat(AudioFormatOpus)
+	if got := task.FinalOutputPath(); got != "/save/Episode 1.opus" {
+		t.Errorf("\nExpected: /save/Episode 1.opus\nGot:      %s", got)
+	}
+}
+
+func TestLoadAudioRendition(t *testing.T) {
+	master := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac-lo",NAME="Deutsch",LANGUAGE="de",DEFAULT=YES,URI="audio/lo.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac-hi",NAME="English",LANGUAGE="en",URI="audio/hi-en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac-hi",NAME="Deutsch",LANGUAGE="de",DEFAULT=YES,URI="audio/hi-de.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,AUDIO="aac-lo"
+360/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,AUDIO="aac-hi"
+1080/index.m3u8
+`
+	media := "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXT-X-ENDLIST\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/master.m3u8" {
+			w.Write([]byte(master))
+			return
+		}
+		w.Write([]byte(media))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		audioOnly bool
+		quality   extractors.QualityCap
+		expected  string
+	}{
+		{false, extractors.QualityCap{}, "/1080/index.m3u8"},
+		{true, extractors.QualityCap{}, "/audio/hi-de.m3u8"},
+		// the audio group of the picked variant
+		{true, extractors.QualityCap{MaxHeight: 480}, "/audio/lo.m3u8"},
+	}
+
+	for _, tt := range tests {
+		d := NewDownloader("", false, 0)
+		d.SetQuality(tt.quality)
+		resp, err := d.get(context.Background(), server.URL+"/master.m3u8", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, playlistURL, _, _, err := d.loadMediaPlaylist(context.Background(), resp, "", tt.audioOnly)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if playlistURL.Path != tt.expected {
+			t.Errorf("audio only %v, cap %v\nExpected: %s\nGot:      %s", tt.audioOnly, tt.quality, tt.expected, playlistURL.Path)
+		}
+	}
+}
+
+func TestAudioTracks(t *testing.T) {
+	base, _ := url.Parse("https://cdn.example.com/stream/manifest.mpd")
+	tracks, err := parseDASH([]byte(testManifest), base, extractors.QualityCap{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if audio := audioTracks(tracks); len(audio) != 1 || audio[0].kind != "audio" {
+		t.Errorf("\nExpected: the audio track\nGot:      %+v", audio)
+	}
+	// without separate audio the video is downloaded and the audio extracted from it
+	if video := audioTracks(tracks[:1]); len(video) != 1 || video[0].kind != "video" {
+		t.Errorf("\nExpected: the video track\nGot:      %+v", video)
+	}
+}
+
+func TestDownloadAudioWithoutFFmpeg(t *testing.T) {
+	d := NewDownloader("", false, 0)
+	task := NewDownloadTask(filepath.Join(t.TempDir(), "episode"), "http://127.0.0.1:0/video.mp4").SetAudioFormat(AudioFormatM4A)
+	if err := d.DownloadToFile(context.Background(), task); !errors.Is(err, ErrFFmpegRequired) {
+		t.Errorf("\nExpected: %v\nGot:      %v", ErrFFmpegRequired, err)
+	}
+}
+
+func TestMuxAudioRendition(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake FFmpeg is a shell script")
+	}
+	master := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Deutsch",LANGUAGE="de",DEFAULT=YES,URI="audio/de.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,AUDIO="aac"
+1080/index.m3u8
+`
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/master.m3u8":
+			w.Write([]byte(master))
+		case strings.HasSuffix(r.URL.Path, ".m3u8"):
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXTINF:4,\nseg1.ts\n#EXT-X-ENDLIST\n"))
+		default:
+			w.Write([]byte(r.URL.Path))
+		}
+	}))
+	defer server.Close()
+
+	// records its arguments and writes the last one, the output
+	dir := t.TempDir()
+	ffmpegPath := filepath.Join(dir, "ffmpeg")
+	os.WriteFile(ffmpegPath, []byte("#!/bin/sh\necho \"$@\" >> \"$0.log\"\nfor last; do :; done\necho muxed > \"$last\"\n"), 0755)
+
+	d := NewDownloader("", false, 0)
+	d.SetFfmpegPath(ffmpegPath)
+	task := NewDownloadTask(filepath.Join(dir, "episode"), server.URL+"/master.m3u8")
+	if err := d.DownloadToFile(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/1080/seg0.ts", "/1080/seg1.ts", "/audio/seg0.ts", "/audio/seg1.ts"} {
+		if !slices.Contains(requested, path) {
+			t.Errorf("\nExpected: %s to be downloaded\nGot:      %v", path, requested)
+		}
+	}
+	audioPath := filepath.Join(dir, "episode"+hlsAudioSuffix+".mp4")
+	log, _ := os.ReadFile(ffmpegPath + ".log")
+	if expected := "-i " + audioPath + " -map 0:v -map 1:a -c copy"; !strings.Contains(string(log), expected) {
+		t.Errorf("\nExpected: %s\nGot:      %s", expected, log)
+	}
+	if _, err := os.Stat(audioPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("\nExpected: the audio to be removed after muxing\nGot:      %v", err)
+	}
+	if got, _ := os.ReadFile(task.FinalOutputPath()); string(got) != "muxed\n" {
+		t.Errorf("\nExpected: muxed\nGot:      %q", got)
+	}
+}
+
+func TestAudioRenditionNotMuxed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake FFmpeg is a shell script")
+	}
+	master := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Deutsch",LANGUAGE="de",DEFAULT=YES,URI="audio/de.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,AUDIO="aac"
+1080/index.m3u8
+`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/master.m3u8":
+			w.Write([]byte(master))
+		case strings.HasSuffix(r.URL.Path, ".m3u8"):
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXT-X-ENDLIST\n"))
+		default:
+			w.Write([]byte(r.URL.Path))
+		}
+	}))
+	defer server.Close()
+
+	// fails the final mux of the parts with the audio, everything else works
+	const failsMux = "#!/bin/sh\ncase \"$*\" in *concat*) exit 1;; esac\nfor last; do :; done\necho muxed > \"$last\"\n"
+
+	for _, ffmpeg := range []string{"", failsMux} {
+		dir := t.TempDir()
+		d := NewDownloader("", false, 0)
+		if ffmpeg != "" {
+			ffmpegPath := filepath.Join(dir, "ffmpeg")
+			os.WriteFile(ffmpegPath, []byte(ffmpeg), 0755)
+			d.SetFfmpegPath(ffmpegPath)
+		}
+		task := NewDownloadTask(filepath.Join(dir, "episode"), server.URL+"/master.m3u8")
+		err := d.DownloadToFile(context.Background(), task)
+		if err == nil || (ffmpeg == "" && !errors.Is(err, ErrFFmpegRequired)) {
+			t.Errorf("\nExpected: an error instead of a video without sound\nGot:      %v", err)
+		}
+		if _, err := os.Stat(hlsFallbackPath(task.FinalOutputPath())); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("\nExpected: no raw stream\nGot:      %v", err)
+		}
+		// an empty file under the final name would count as the finished episode
+		if _, err := os.Stat(task.FinalOutputPath()); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("\nExpected: no file with the name of the episode\nGot:      %v", err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package download
+
+import (
+	"sync"
+)
+
+// SizeBudget caps the bytes downloaded in one run, see --max-total-size. It is shared by the managers of a queue.
+// Downloads that already started always finish, so the cap can be exceeded by the downloads running in parallel.
+type SizeBudget struct {
+	max        int64
+	start      int64
+	downloaded func() int64
+
+	mu       sync.Mutex
+	running  int
+	finished int
+	// finishedBytes is the size of the finished episodes, the next episode is estimated to be as large as their average
+	finishedBytes int64
+}
+
+// NewSizeBudget counts the bytes d downloads from now on.
+func NewSizeBudget(d *Downloader, max int64) *SizeBudget {
+	return &SizeBudget{max: max, start: d.downloaded.Load(), downloaded: d.downloaded.Load}
+}
+
+// Used returns the bytes downloaded since the budget was created.
+func (b *SizeBudget) Used() int64 {
+	return b.downloaded() - b.start
+}
+
+// reserve reports whether another download fits. The running downloads and the new one are
+// estimated by the average size of the finished ones, nothing is known before the first one finished.
+func (b *SizeBudget) reserve() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var estimate int64
+	if b.finished > 0 {
+		estimate = b.finishedBytes / int64(b.finished) * int64(b.running+1)
+	}
+	used := b.Used()
+	if used >= b.max || used+estimate > b.max {
+		return false
+	}
+	b.running++
+	return true
+}
+
+// release ends a reserved download, size is 0 if it failed.
+func (b *SizeBudget) release(size int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.running--
+	if size > 0 {
+		b.finished++
+		b.finishedBytes += size
+	}
+}
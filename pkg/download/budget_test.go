@@ -0,0 +1,28 @@
+package download
+
+import "testing"
+
+func TestSizeBudget(t *testing.T) {
+	d := NewDownloader("", false, 0)
+	// bytes from before the budget, e.g. FFmpeg, don't count
+	d.downloaded.Add(1000)
+	b := NewSizeBudget(d, 100)
+
+	check := func(name string, expected bool) {
+		t.Helper()
+		if got := b.reserve(); got != expected {
+			t.Errorf("%s (used %d)\nExpected: %v\nGot:      %v", name, b.Used(), expected, got)
+		}
+	}
+
+	check("nothing known yet", true)
+	d.downloaded.Add(30)
+	b.release(30)
+	check("one more of 30 fits", true)
+	check("a third one fits next to the running one", true)
+	check("a fourth one would exceed the cap", false)
+	d.downloaded.Add(60)
+	b.release(30)
+	b.release(30)
+	check("the next one wouldn't fit anymore", false)
+}
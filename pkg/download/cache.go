@@ -1,21 +1,61 @@
 package download
 
 import (
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
 )
 
 type DirectoryCache struct {
 	mu    sync.RWMutex
-	files map[string]struct{}
+	dir   string
+	mode  downloaders.SkipMode
+	files map[string]int64
+	state *SeriesState
+	// finished holds the files that were downloaded during this run, they are complete without a record in the state
+	finished map[string]struct{}
 }
 
-func NewDirectoryCache(dir string) (*DirectoryCache, error) {
+func NewDirectoryCache(dir string, mode downloaders.SkipMode) (*DirectoryCache, error) {
 	cache := &DirectoryCache{
-		files: make(map[string]struct{}),
+		dir:      dir,
+		mode:     mode,
+		files:    make(map[string]int64),
+		finished: make(map[string]struct{}),
 	}
 
-	entries, err := os.ReadDir(dir)
+	// walk recursively, so episodes inside templated season folders are found as well.
+	// files are keyed by their path relative to dir.
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			// segments of unfinished HLS downloads
+			if path != dir && strings.HasSuffix(entry.Name(), hlsPartsSuffix) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// thumbnails, subtitles and leftovers share the name of their episode, they must not count as the episode itself
+		if isThumbnail(entry.Name()) || isSubtitle(entry.Name()) || isLeftover(entry) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		cache.files[rel] = info.Size()
+		return nil
+	})
 	if err != nil {
 		if os.IsNotExist(err) {
 			return cache, nil
@@ -23,38 +63,40 @@ func NewDirectoryCache(dir string) (*DirectoryCache, error) {
 		return nil, err
 	}
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			cache.files[entry.Name()] = struct{}{}
-		}
-	}
-
 	return cache, nil
 }
 
 func (c *DirectoryCache) CheckIfEpisodeExists(name string) bool {
+	if !c.mode.Skips() {
+		return false
+	}
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	// Check with .mp4 and .ts as in Rust code (implicitly handled by checking common names)
-	if _, ok := c.files[name+".mp4"]; ok {
-		return true
-	}
-	if _, ok := c.files[name+".ts"]; ok {
-		return true
+	candidates := []string{name + ".mp4", name + ".ts", name + ".mkv", name}
+	for _, format := range AudioFormats {
+		candidates = append(candidates, name+"."+string(format))
 	}
-	if _, ok := c.files[name]; ok {
-		return true
+	for _, candidate := range candidates {
+		if size, ok := c.files[candidate]; ok && c.isComplete(candidate, size) {
+			return true
+		}
 	}
 
 	return false
 }
 
 func (c *DirectoryCache) HasPrefix(prefix string) bool {
+	if !c.mode.Skips() {
+		return false
+	}
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	for f := range c.files {
+	for f, size := range c.files {
 		if len(f) >= len(prefix) && f[:len(prefix)] == prefix {
 			// If the next character is a digit, then it's a collision (e.g. S01E10 matching S01E105)
 			if len(f) > len(prefix) {
@@ -63,8 +105,54 @@ func (c *DirectoryCache) HasPrefix(prefix string) bool {
 					continue
 				}
 			}
-			return true
+			if c.isComplete(f, size) {
+				return true
+			}
 		}
 	}
 	return false
 }
+
+// Add records a file that was just downloaded, name is relative to the cached directory and includes the extension.
+// Later checks of the same run see it without walking the directory again.
+func (c *DirectoryCache) Add(name string) {
+	var size int64
+	if info, err := os.Stat(filepath.Join(c.dir, name)); err == nil {
+		size = info.Size()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[name] = size
+	c.finished[name] = struct{}{}
+}
+
+// SetState sets the series state whose recorded sizes by-name-and-size compares the files with.
+func (c *DirectoryCache) SetState(state *SeriesState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state = state
+}
+
+// Remove forgets a file, e.g. one whose checksum doesn't match, so it is downloaded again.
+func (c *DirectoryCache) Remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.files, name)
+	delete(c.finished, name)
+}
+
+// isComplete checks the size against the series state in by-name-and-size mode.
+// Files without a record count as complete, see SeriesState.FileComplete.
+func (c *DirectoryCache) isComplete(name string, size int64) bool {
+	if c.mode != downloaders.SkipModeByNameAndSize {
+		return true
+	}
+	if _, ok := c.finished[name]; ok {
+		return true
+	}
+	if c.state == nil {
+		return size > 0
+	}
+	return c.state.FileComplete(name, size)
+}
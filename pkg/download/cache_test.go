@@ -0,0 +1,103 @@
+package download
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+)
+
+func TestDirectoryCacheAdd(t *testing.T) {
+	for _, mode := range []downloaders.SkipMode{downloaders.SkipModeByName, downloaders.SkipModeByNameAndSize} {
+		dir := t.TempDir()
+		cache, err := NewDirectoryCache(dir, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := filepath.Join("Season 01", "Series - S01E01")
+		if cache.CheckIfEpisodeExists(name) {
+			t.Errorf("%s: episode exists before it was downloaded", mode)
+		}
+
+		// by-name-and-size has no state for it, the download of this run is still complete
+		os.MkdirAll(filepath.Join(dir, "Season 01"), 0755)
+		os.WriteFile(filepath.Join(dir, name+".mp4"), []byte("video"), 0644)
+		cache.Add(name + ".mp4")
+		if !cache.CheckIfEpisodeExists(name) || !cache.HasPrefix(filepath.Join("Season 01", "Series - S01E01")) {
+			t.Errorf("%s: added episode wasn't found", mode)
+		}
+	}
+}
+
+func TestDirectoryCacheByNameAndSize(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Series - S01E01.mp4": "complete",
+		"Series - S01E02.mp4": "trunc",
+		"Series - S01E03.mp4": "unrecorded",
+		"Series - S01E04.mp4": "",
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	state, err := LoadSeriesState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Record(EpisodeState{Season: 1, Episode: 1, Status: EpisodeCompleted, File: "Series - S01E01.mp4", Size: 8})
+	state.Record(EpisodeState{Season: 1, Episode: 2, Status: EpisodeCompleted, File: "Series - S01E02.mp4", Size: 8})
+
+	cache, err := NewDirectoryCache(dir, downloaders.SkipModeByNameAndSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.SetState(state)
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"Series - S01E01", true},  // complete
+		{"Series - S01E02", false}, // truncated
+		{"Series - S01E03", true},  // unrecorded
+		{"Series - S01E04", false}, // unrecorded but empty
+	}
+	for _, tt := range tests {
+		if got := cache.CheckIfEpisodeExists(tt.name); got != tt.expected {
+			t.Errorf("%s\nExpected: %v\nGot:      %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestDirectoryCacheConcurrentAdd(t *testing.T) {
+	cache, err := NewDirectoryCache(t.TempDir(), downloaders.SkipModeByName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		name := fmt.Sprintf("Series - S01E%02d", i+1)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cache.Add(name + ".mp4")
+		}()
+		go func() {
+			defer wg.Done()
+			cache.CheckIfEpisodeExists(name)
+			cache.HasPrefix("Series - S01E")
+		}()
+	}
+	wg.Wait()
+
+	for i := range 50 {
+		if name := fmt.Sprintf("Series - S01E%02d", i+1); !cache.CheckIfEpisodeExists(name) {
+			t.Errorf("%s wasn't added", name)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package download
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ChecksumsFileName is written into the save directory with the SHA-256 of every finished download. It uses the
+// format of sha256sum, so "sha256sum -c checksums.sha256" verifies the files without gad.
+const ChecksumsFileName = "checksums.sha256"
+
+// Checksums holds the hashes of checksums.sha256, keyed by the path relative to the save directory.
+type Checksums struct {
+	mu   sync.Mutex
+	path string
+	sums map[string]string
+}
+
+// LoadChecksums reads checksums.sha256 of dir. A missing file results in an empty list, lines that aren't in the
+// format of sha256sum are skipped.
+func LoadChecksums(dir string) (*Checksums, error) {
+	c := &Checksums{path: filepath.Join(dir, ChecksumsFileName), sums: make(map[string]string)}
+
+	file, err := os.Open(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// "<hash>  <name>", a star in front of the name marks the binary mode of sha256sum
+		sum, name, ok := strings.Cut(scanner.Text(), " ")
+		name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+		if !ok || len(sum) != sha256.Size*2 || name == "" {
+			continue
+		}
+		c.sums[filepath.FromSlash(name)] = strings.ToLower(sum)
+	}
+	return c, scanner.Err()
+}
+
+// Get returns the recorded hash of name.
+func (c *Checksums) Get(name string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sum, ok := c.sums[name]
+	return sum, ok
+}
+
+// Names returns the recorded files sorted by name.
+func (c *Checksums) Names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sortedNames()
+}
+
+func (c *Checksums) sortedNames() []string {
+	names := make([]string, 0, len(c.sums))
+	for name := range c.sums {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Record stores the hash of a finished download and writes the file.
+func (c *Checksums) Record(name, sum string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sums[name] = sum
+
+	var b strings.Builder
+	for _, name := range c.sortedNames() {
+		fmt.Fprintf(&b, "%s  %s\n", c.sums[name], filepath.ToSlash(name))
+	}
+	return os.WriteFile(c.path, []byte(b.String()), 0644)
+}
+
+// hashFile returns the hex encoded SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// findMismatches hashes the recorded files of the save directory again and removes the ones that don't match from
+// the cache, so they are downloaded again. It returns them, their downloads have to replace the broken files.
+// Files that don't exist anymore are left to the cache.
+func (m *DownloadManager) findMismatches(checksums *Checksums, cache *DirectoryCache) map[string]struct{} {
+	names := checksums.Names()
+	slog.Info("Verifying checksums", "files", len(names))
+
+	mismatched := make(map[string]struct{})
+	for _, name := range names {
+		expected, _ := checksums.Get(name)
+		sum, err := hashFile(filepath.Join(m.saveDir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			slog.Warn("Failed to verify checksum", "file", name, "error", err)
+			continue
+		}
+		if sum != expected {
+			slog.Warn("Checksum mismatch, the episode is downloaded again", "file", name, "expected", expected, "got", sum)
+			mismatched[name] = struct{}{}
+			if cache != nil {
+				cache.Remove(name)
+			}
+		}
+	}
+	return mismatched
+}
+
+// recordChecksum adds a finished download to checksums.sha256. The hash is computed while downloading where the
+// bytes are written as they arrive, files written by FFmpeg, in parts or changed afterwards are read once more.
+func (m *DownloadManager) recordChecksum(checksums *Checksums, dt *DownloadTask) {
+	rel, err := filepath.Rel(m.saveDir, dt.FinalOutputPath())
+	if err != nil {
+		return
+	}
+
+	sum := dt.sha256
+	if sum == "" {
+		if sum, err = hashFile(dt.FinalOutputPath()); err != nil {
+			slog.Warn("Failed to hash download", "file", dt.Filename(), "error", err)
+			return
+		}
+	}
+	if err := checksums.Record(rel, sum); err != nil {
+		slog.Warn("Failed to write checksums", "error", err)
+	}
+}
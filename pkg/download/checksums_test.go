@@ -0,0 +1,87 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+)
+
+func TestLoadChecksums(t *testing.T) {
+	dir := t.TempDir()
+	sum := hex.EncodeToString(make([]byte, sha256.Size))
+	content := sum + "  Season 1/Series - S01E01.mp4\n" +
+		sum + " *binary.mkv\n" +
+		"not a checksum line\n"
+	if err := os.WriteFile(filepath.Join(dir, ChecksumsFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checksums, err := LoadChecksums(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Season 1/Series - S01E01.mp4", "binary.mkv"}
+	names := checksums.Names()
+	if len(names) != len(expected) {
+		t.Fatalf("\nExpected: %v\nGot:      %v", expected, names)
+	}
+	for i, name := range names {
+		if name != filepath.FromSlash(expected[i]) {
+			t.Errorf("\nExpected: %s\nGot:      %s", expected[i], name)
+		}
+	}
+}
+
+func TestProgressDownloadsChecksums(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write([]byte("episode"))
+	}))
+	defer server.Close()
+
+	saveDir := t.TempDir()
+	run := func(verify bool) *DownloadManager {
+		d := NewDownloader("", false, 0)
+		m := NewDownloadManager(d, 1, saveDir, downloaders.SeriesInfo{Title: "Series"}, downloaders.SkipModeByName).
+			SetChecksums(true, verify)
+		m.Submit(ManagerTask{DownloadUrl: server.URL, EpisodeInfo: downloaders.EpisodeInfo{Season: 1, Episode: 1}})
+		m.Close()
+		if err := m.ProgressDownloads(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	run(false)
+	checksums, err := LoadChecksums(saveDir)
+	if err != nil || len(checksums.Names()) != 1 {
+		t.Fatalf("\nExpected: one checksum\nGot:      %v %v", checksums.Names(), err)
+	}
+	name := checksums.Names()[0]
+	hash := sha256.Sum256([]byte("episode"))
+	if sum, _ := checksums.Get(name); sum != hex.EncodeToString(hash[:]) {
+		t.Errorf("\nExpected: %x\nGot:      %s", hash, sum)
+	}
+
+	// a broken file is downloaded again, an intact one is skipped
+	path := filepath.Join(saveDir, name)
+	if err := os.WriteFile(path, []byte("broken!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if summary := run(true).Summary(); summary.Completed != 1 {
+		t.Errorf("\nExpected: 1 completed\nGot:      %+v", summary)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "episode" {
+		t.Errorf("\nExpected: %q\nGot:      %q", "episode", data)
+	}
+	if summary := run(true).Summary(); summary.Skipped != 1 {
+		t.Errorf("\nExpected: 1 skipped\nGot:      %+v", summary)
+	}
+}
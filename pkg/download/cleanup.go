@@ -0,0 +1,98 @@
+package download
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bugmaschine/gad/pkg/utils"
+)
+
+// workDirPrefix names the directories downloads are assembled in inside the temp dir.
+const workDirPrefix = "download-"
+
+// Leftover is a temporary file or directory of a download that didn't finish, e.g. because gad crashed.
+type Leftover struct {
+	Path string
+	Size int64
+}
+
+// FindLeftovers searches dir recursively for the segment directories of HLS downloads, temporary state files,
+// half written muxes and cover art remuxes, the single tracks of multi language downloads and the sources of audio only downloads.
+// Only the segments of HLS downloads can be resumed, a new run starts everything else from scratch.
+func FindLeftovers(dir string) ([]Leftover, error) {
+	var leftovers []Leftover
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir || !isLeftover(entry) {
+			return nil
+		}
+
+		size, err := utils.PathSize(path)
+		if err != nil {
+			return err
+		}
+		leftovers = append(leftovers, Leftover{Path: path, Size: size})
+		if entry.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return leftovers, err
+}
+
+// FindTempLeftovers returns the work directories in the temp dir, see Downloader.SetTempDir. Finished and canceled
+// downloads remove theirs, so they are only left behind by crashes or by another gad that is still running. The
+// segment directories of interrupted HLS downloads are returned as well.
+func FindTempLeftovers(tempDir string) ([]Leftover, error) {
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var leftovers []Leftover
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), workDirPrefix) && !strings.HasSuffix(entry.Name(), hlsPartsSuffix) {
+			continue
+		}
+		path := filepath.Join(tempDir, entry.Name())
+		size, err := utils.PathSize(path)
+		if err != nil {
+			return nil, err
+		}
+		leftovers = append(leftovers, Leftover{Path: path, Size: size})
+	}
+	return leftovers, nil
+}
+
+// RemoveLeftovers deletes the leftovers and returns the amount of bytes freed, it stops at the first error.
+func RemoveLeftovers(leftovers []Leftover) (int64, error) {
+	var freed int64
+	for _, l := range leftovers {
+		if err := utils.RemoveDirAllIgnoreNotExists(l.Path); err != nil {
+			return freed, err
+		}
+		freed += l.Size
+	}
+	return freed, nil
+}
+
+func isLeftover(entry fs.DirEntry) bool {
+	name := entry.Name()
+	if entry.IsDir() {
+		return strings.HasSuffix(name, hlsPartsSuffix)
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	return name == StateFileName+".tmp" || strings.HasSuffix(base, coverSuffix) || strings.HasSuffix(base, audioSourceSuffix) ||
+		strings.HasSuffix(base, muxingSuffix) || isTrackFile(name)
+}
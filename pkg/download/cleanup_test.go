@@ -0,0 +1,78 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Series - S01E01.mp4":                        "episode",
+		"Series - S01E01-thumb.jpg":                  "image",
+		"Season 01/Series - S01E02.mp4.parts/a.ts":   "12345",
+		"Season 01/Series - S01E02.mp4.parts/b.ts":   "67890",
+		"Series - S01E03.cover.mp4":                  "cover",
+		"Series - S01E04 - GerDub+GerSub.track1.mp4": "track",
+		"Series - S01E05.muxing.mp4":                 "half",
+		StateFileName + ".tmp":                       "{}",
+		StateFileName:                                "{}",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	leftovers, err := FindLeftovers(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []string
+	for _, l := range leftovers {
+		rel, _ := filepath.Rel(dir, l.Path)
+		found = append(found, rel)
+	}
+	slices.Sort(found)
+	expected := []string{filepath.Join("Season 01", "Series - S01E02.mp4.parts"), "Series - S01E03.cover.mp4", "Series - S01E04 - GerDub+GerSub.track1.mp4", "Series - S01E05.muxing.mp4", StateFileName + ".tmp"}
+	if !slices.Equal(found, expected) {
+		t.Errorf("\nExpected: %v\nGot:      %v", expected, found)
+	}
+
+	freed, err := RemoveLeftovers(leftovers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 26 {
+		t.Errorf("\nExpected: 26 bytes\nGot:      %d", freed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Series - S01E01.mp4")); err != nil {
+		t.Errorf("finished episode got removed: %v", err)
+	}
+
+	if leftovers, _ := FindLeftovers(filepath.Join(dir, "missing")); len(leftovers) != 0 {
+		t.Errorf("\nExpected: no leftovers\nGot:      %v", leftovers)
+	}
+}
+
+func TestTempLeftovers(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, workDirPrefix+"123", "episode.mp4.parts"), 0755)
+	os.WriteFile(filepath.Join(tempDir, workDirPrefix+"123", "episode.mp4"), []byte("video"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "unrelated.txt"), []byte("text"), 0644)
+
+	leftovers, err := FindTempLeftovers(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers) != 1 || leftovers[0].Path != filepath.Join(tempDir, workDirPrefix+"123") || leftovers[0].Size != 5 {
+		t.Errorf("\nExpected: %s with 5 bytes\nGot:      %+v", workDirPrefix+"123", leftovers)
+	}
+
+	if leftovers, err := FindTempLeftovers(filepath.Join(tempDir, "missing")); err != nil || len(leftovers) != 0 {
+		t.Errorf("\nExpected: nothing\nGot:      %v %v", leftovers, err)
+	}
+}
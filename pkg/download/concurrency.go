@@ -0,0 +1,176 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bugmaschine/gad/pkg/httpclient"
+)
+
+// throughputGain is how much faster a higher concurrency has to be to keep ramping up.
+const throughputGain = 1.05
+
+// ConcurrencyStats is a snapshot of the concurrency controller.
+type ConcurrencyStats struct {
+	// Limit is the amount of downloads currently allowed at the same time
+	Limit  int
+	Active int
+	Max    int
+}
+
+// concurrencyController limits the parallel downloads of a DownloadManager. In adaptive mode it works like AIMD:
+// it starts with one download and adds one more for as long as the combined throughput keeps improving, while a
+// throttled (429) or stalled download halves the limit. It never goes above max.
+type concurrencyController struct {
+	mu       sync.Mutex
+	adaptive bool
+	max      int
+	limit    int
+	active   int
+	// wake gets closed whenever a slot might have become free
+	wake chan struct{}
+
+	// downloaded returns the total amount of downloaded bytes, the throughput is measured with it
+	downloaded func() int64
+	now        func() time.Time
+
+	// measurement of the current limit, it is evaluated once limit downloads finished
+	levelStart      time.Time
+	levelBytes      int64
+	levelDone       int
+	bestThroughput  float64
+	reachedTopSpeed bool
+	// epoch increases with every decrease. Downloads started before it ran into the same throttling
+	// and must not halve the limit again.
+	epoch uint64
+}
+
+func newConcurrencyController(max int, adaptive bool, downloaded func() int64) *concurrencyController {
+	c := &concurrencyController{
+		adaptive:   adaptive,
+		max:        max,
+		limit:      max,
+		wake:       make(chan struct{}),
+		downloaded: downloaded,
+		now:        time.Now,
+	}
+	if adaptive {
+		c.limit = 1
+	}
+	c.resetLevel()
+	return c
+}
+
+// acquire blocks until a download may start or ctx is done. The returned epoch has to be passed to report.
+func (c *concurrencyController) acquire(ctx context.Context) (uint64, error) {
+	for {
+		c.mu.Lock()
+		if c.active < c.limit {
+			c.active++
+			epoch := c.epoch
+			c.mu.Unlock()
+			return epoch, nil
+		}
+		wake := c.wake
+		c.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// release frees the slot taken by acquire.
+func (c *concurrencyController) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.active--
+	close(c.wake)
+	c.wake = make(chan struct{})
+}
+
+// report adjusts the limit based on the result of a finished download.
+func (c *concurrencyController) report(epoch uint64, err error) {
+	if !c.adaptive {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case isThrottled(err):
+		if epoch == c.epoch {
+			c.decrease(err)
+		}
+	case err == nil:
+		c.levelDone++
+		if c.levelDone >= c.limit {
+			c.evaluateLevel()
+		}
+	}
+}
+
+// evaluateLevel ramps up if the throughput at the current limit beat the one below.
+func (c *concurrencyController) evaluateLevel() {
+	elapsed := c.now().Sub(c.levelStart).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	throughput := float64(c.downloaded()-c.levelBytes) / elapsed
+
+	if throughput > c.bestThroughput*throughputGain {
+		c.bestThroughput = throughput
+		if c.limit < c.max {
+			c.limit++
+			slog.Debug("Increasing concurrent downloads", "limit", c.limit, "throughput", throughput)
+		}
+	} else if !c.reachedTopSpeed {
+		c.reachedTopSpeed = true
+		slog.Debug("More concurrent downloads don't help anymore", "limit", c.limit, "throughput", throughput)
+	}
+	c.resetLevel()
+}
+
+func (c *concurrencyController) decrease(err error) {
+	c.limit = max(1, c.limit/2)
+	c.epoch++
+	// the conditions changed, so the old numbers can't be compared against anymore
+	c.bestThroughput = 0
+	c.reachedTopSpeed = false
+	c.resetLevel()
+	slog.Info("Hoster is throttling, reducing concurrent downloads", "limit", c.limit, "reason", err)
+}
+
+func (c *concurrencyController) resetLevel() {
+	c.levelStart = c.now()
+	c.levelDone = 0
+	if c.downloaded != nil {
+		c.levelBytes = c.downloaded()
+	}
+}
+
+func (c *concurrencyController) stats() ConcurrencyStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ConcurrencyStats{Limit: c.limit, Active: c.active, Max: c.max}
+}
+
+// isThrottled reports whether a download failed because the server wants us to slow down.
+func isThrottled(err error) bool {
+	if err == nil {
+		return false
+	}
+	var statusErr *ErrHTTPStatus
+	if errors.As(err, &statusErr) && (statusErr.Code == http.StatusTooManyRequests || statusErr.Code == http.StatusServiceUnavailable) {
+		return true
+	}
+	return errors.Is(err, httpclient.ErrStalled)
+}
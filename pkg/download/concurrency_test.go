@@ -0,0 +1,88 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bugmaschine/gad/pkg/httpclient"
+)
+
+func TestConcurrencyController(t *testing.T) {
+	var downloaded int64
+	now := time.Unix(0, 0)
+	c := newConcurrencyController(4, true, func() int64 { return downloaded })
+	c.now = func() time.Time { return now }
+	c.resetLevel()
+
+	// finish a whole round at the current limit, each round takes a second
+	round := func(bytesPerSecond int64, err error) {
+		limit := c.stats().Limit
+		epochs := make([]uint64, limit)
+		for i := range epochs {
+			epoch, err := c.acquire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			epochs[i] = epoch
+		}
+		now = now.Add(time.Second)
+		downloaded += bytesPerSecond
+		for _, epoch := range epochs {
+			c.report(epoch, err)
+			c.release()
+		}
+	}
+
+	throttled := &ErrHTTPStatus{Code: http.StatusTooManyRequests}
+	stalled := fmt.Errorf("failed to download segment: %w", httpclient.ErrStalled)
+
+	tests := []struct {
+		bytesPerSecond int64
+		err            error
+		expected       int
+	}{
+		{100, nil, 2},
+		{200, nil, 3},
+		{300, nil, 4},
+		// never above the maximum
+		{400, nil, 4},
+		// all of them got throttled at once, that only halves it once
+		{400, throttled, 2},
+		{200, nil, 3},
+		// no improvement, so it stays
+		{200, nil, 3},
+		{200, stalled, 1},
+		// other errors don't change anything
+		{0, fmt.Errorf("some error"), 1},
+	}
+
+	for i, tt := range tests {
+		round(tt.bytesPerSecond, tt.err)
+		if got := c.stats().Limit; got != tt.expected {
+			t.Errorf("round %d\nExpected: %d\nGot:      %d", i, tt.expected, got)
+		}
+	}
+}
+
+func TestConcurrencyControllerBlocks(t *testing.T) {
+	c := newConcurrencyController(2, false, nil)
+	c.acquire(context.Background())
+	c.acquire(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.acquire(ctx); err == nil {
+		t.Fatal("expected acquire to block at the limit")
+	}
+
+	c.release()
+	if _, err := c.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.stats(); stats.Active != 2 || stats.Limit != 2 {
+		t.Errorf("\nExpected: 2 active, limit 2\nGot:      %+v", stats)
+	}
+}
@@ -0,0 +1,558 @@
+package download
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bugmaschine/gad/internal/extractors"
+	"github.com/bugmaschine/gad/pkg/utils"
+)
+
+// mpd is the part of an MPEG-DASH manifest needed for on-demand streams.
+type mpd struct {
+	Type     string      `xml:"type,attr"`
+	Duration string      `xml:"mediaPresentationDuration,attr"`
+	BaseURL  string      `xml:"BaseURL"`
+	Periods  []mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	Duration       string             `xml:"duration,attr"`
+	BaseURL        string             `xml:"BaseURL"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	MimeType        string              `xml:"mimeType,attr"`
+	ContentType     string              `xml:"contentType,attr"`
+	BaseURL         string              `xml:"BaseURL"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *mpdSegmentList     `xml:"SegmentList"`
+	Representations []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	ID              string              `xml:"id,attr"`
+	Bandwidth       int                 `xml:"bandwidth,attr"`
+	Height          int                 `xml:"height,attr"`
+	MimeType        string              `xml:"mimeType,attr"`
+	BaseURL         string              `xml:"BaseURL"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *mpdSegmentList     `xml:"SegmentList"`
+}
+
+type mpdSegmentTemplate struct {
+	Initialization string `xml:"initialization,attr"`
+	Media          string `xml:"media,attr"`
+	StartNumber    *int   `xml:"startNumber,attr"`
+	Timescale      int    `xml:"timescale,attr"`
+	Duration       int64  `xml:"duration,attr"`
+	Timeline       []mpdS `xml:"SegmentTimeline>S"`
+}
+
+// mpdS is an entry of a SegmentTimeline, r repeats it, -1 until the end of the period.
+type mpdS struct {
+	T *int64 `xml:"t,attr"`
+	D int64  `xml:"d,attr"`
+	R int    `xml:"r,attr"`
+}
+
+type mpdSegmentList struct {
+	Timescale      int   `xml:"timescale,attr"`
+	Duration       int64 `xml:"duration,attr"`
+	Initialization *struct {
+		SourceURL string `xml:"sourceURL,attr"`
+	} `xml:"Initialization"`
+	SegmentURLs []struct {
+		Media string `xml:"media,attr"`
+	} `xml:"SegmentURL"`
+}
+
+// dashTrack is one representation picked from the manifest, its segments are downloaded into one file.
+type dashTrack struct {
+	kind string
+	// height and bandwidth of the representation, for the logs
+	height    int
+	bandwidth int
+	// init is empty if the segments are self-contained
+	init     string
+	segments []dashSegment
+}
+
+type dashSegment struct {
+	url string
+	// duration is in seconds
+	duration float64
+}
+
+func (t dashTrack) duration() float64 {
+	var total float64
+	for _, s := range t.segments {
+		total += s.duration
+	}
+	return total
+}
+
+// isDASH reports whether a response is a DASH manifest.
+func isDASH(u *url.URL, contentType string) bool {
+	return strings.HasSuffix(strings.ToLower(u.Path), ".mpd") || strings.Contains(strings.ToLower(contentType), "application/dash+xml")
+}
+
+// parseDASH picks the best video within the quality cap and the best audio representation of the first period.
+// Live manifests are refused, their segment list is never complete.
+func parseDASH(data []byte, manifestURL *url.URL, quality extractors.QualityCap) ([]dashTrack, error) {
+	var m mpd
+	err := xml.Unmarshal(data, &m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode mpd: %w", err)
+	}
+	if m.Type == "dynamic" {
+		return nil, fmt.Errorf("live DASH streams are not supported")
+	}
+	if len(m.Periods) == 0 {
+		return nil, fmt.Errorf("no periods in mpd")
+	}
+	if len(m.Periods) > 1 {
+		slog.Warn("The DASH stream has multiple periods, only the first one is downloaded", "periods", len(m.Periods))
+	}
+
+	period := m.Periods[0]
+	durationAttr := period.Duration
+	if durationAttr == "" {
+		durationAttr = m.Duration
+	}
+	// optional if every representation has a segment timeline
+	var duration time.Duration
+	if durationAttr != "" {
+		if duration, err = parseISODuration(durationAttr); err != nil {
+			return nil, err
+		}
+	}
+
+	base, err := resolveBase(manifestURL, m.BaseURL, period.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var video, audio []representationRef
+	for _, set := range period.AdaptationSets {
+		for _, rep := range set.Representations {
+			ref := representationRef{set: set, rep: rep}
+			switch ref.kind() {
+			case "video":
+				video = append(video, ref)
+			case "audio":
+				audio = append(audio, ref)
+			}
+		}
+	}
+	if len(video) == 0 && len(audio) == 0 {
+		return nil, fmt.Errorf("no audio or video in mpd")
+	}
+
+	var picked []representationRef
+	if len(video) > 0 {
+		picked = append(picked, selectRepresentation(video, quality))
+	}
+	if len(audio) > 0 {
+		picked = append(picked, selectRepresentation(audio, extractors.QualityCap{}))
+	}
+
+	var tracks []dashTrack
+	for _, ref := range picked {
+		track, err := ref.track(base, duration)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+type representationRef struct {
+	set mpdAdaptationSet
+	rep mpdRepresentation
+}
+
+func (r representationRef) kind() string {
+	for _, mime := range []string{r.rep.MimeType, r.set.MimeType, r.set.ContentType} {
+		if kind, _, _ := strings.Cut(mime, "/"); kind == "video" || kind == "audio" {
+			return kind
+		}
+	}
+	return ""
+}
+
+// track resolves the segments of the representation, the inner elements override the ones of the adaptation set.
+func (r representationRef) track(base *url.URL, period time.Duration) (dashTrack, error) {
+	base, err := resolveBase(base, r.set.BaseURL, r.rep.BaseURL)
+	if err != nil {
+		return dashTrack{}, err
+	}
+	track := dashTrack{kind: r.kind(), height: r.rep.Height, bandwidth: r.rep.Bandwidth}
+
+	template := r.rep.SegmentTemplate
+	if template == nil {
+		template = r.set.SegmentTemplate
+	}
+	list := r.rep.SegmentList
+	if list == nil {
+		list = r.set.SegmentList
+	}
+
+	switch {
+	case template != nil:
+		return templateTrack(track, template, r.rep, base, period)
+	case list != nil:
+		timescale := max(list.Timescale, 1)
+		if list.Initialization != nil {
+			if track.init, err = resolve(base, list.Initialization.SourceURL); err != nil {
+				return dashTrack{}, err
+			}
+		}
+		for _, s := range list.SegmentURLs {
+			u, err := resolve(base, s.Media)
+			if err != nil {
+				return dashTrack{}, err
+			}
+			track.segments = append(track.segments, dashSegment{url: u, duration: float64(list.Duration) / float64(timescale)})
+		}
+	default:
+		// SegmentBase or nothing at all, the whole representation is one file
+		track.segments = []dashSegment{{url: base.String(), duration: period.Seconds()}}
+	}
+	if len(track.segments) == 0 {
+		return dashTrack{}, fmt.Errorf("representation %s has no segments", r.rep.ID)
+	}
+	return track, nil
+}
+
+func templateTrack(track dashTrack, template *mpdSegmentTemplate, rep mpdRepresentation, base *url.URL, period time.Duration) (dashTrack, error) {
+	timescale := int64(max(template.Timescale, 1))
+	number := 1
+	if template.StartNumber != nil {
+		number = *template.StartNumber
+	}
+
+	if template.Initialization != "" {
+		u, err := resolve(base, expandTemplate(template.Initialization, rep, 0, 0))
+		if err != nil {
+			return dashTrack{}, err
+		}
+		track.init = u
+	}
+
+	add := func(time, duration int64) error {
+		u, err := resolve(base, expandTemplate(template.Media, rep, number, time))
+		if err != nil {
+			return err
+		}
+		track.segments = append(track.segments, dashSegment{url: u, duration: float64(duration) / float64(timescale)})
+		number++
+		return nil
+	}
+
+	end := int64(period.Seconds() * float64(timescale))
+	if len(template.Timeline) > 0 {
+		var t int64
+		for i, s := range template.Timeline {
+			if s.T != nil {
+				t = *s.T
+			}
+			if s.D <= 0 {
+				continue
+			}
+			repeat := s.R
+			if repeat < 0 {
+				// until the next entry or the end of the period
+				until := end
+				if i+1 < len(template.Timeline) && template.Timeline[i+1].T != nil {
+					until = *template.Timeline[i+1].T
+				}
+				repeat = int(math.Ceil(float64(until-t)/float64(s.D))) - 1
+			}
+			for range repeat + 1 {
+				if err := add(t, s.D); err != nil {
+					return dashTrack{}, err
+				}
+				t += s.D
+			}
+		}
+		return track, nil
+	}
+
+	if template.Duration <= 0 || end <= 0 {
+		return dashTrack{}, fmt.Errorf("representation %s has neither a segment timeline nor a duration", rep.ID)
+	}
+	count := int(math.Ceil(float64(end) / float64(template.Duration)))
+	for i := range count {
+		duration := min(template.Duration, end-int64(i)*template.Duration)
+		if err := add(int64(i)*template.Duration, duration); err != nil {
+			return dashTrack{}, err
+		}
+	}
+	return track, nil
+}
+
+var templateIdentifierRe = regexp.MustCompile(`\$(RepresentationID|Number|Time|Bandwidth)(%0\d+d)?\$`)
+
+// expandTemplate fills in the identifiers of a SegmentTemplate, $$ is an escaped dollar sign.
+func expandTemplate(template string, rep mpdRepresentation, number int, time int64) string {
+	parts := strings.Split(template, "$$")
+	for i, part := range parts {
+		parts[i] = templateIdentifierRe.ReplaceAllStringFunc(part, func(match string) string {
+			m := templateIdentifierRe.FindStringSubmatch(match)
+			format := m[2]
+			if format == "" {
+				format = "%d"
+			}
+			switch m[1] {
+			case "RepresentationID":
+				return rep.ID
+			case "Number":
+				return fmt.Sprintf(format, number)
+			case "Time":
+				return fmt.Sprintf(format, time)
+			default:
+				return fmt.Sprintf(format, rep.Bandwidth)
+			}
+		})
+	}
+	return strings.Join(parts, "$")
+}
+
+// selectRepresentation picks the highest bandwidth that fits the quality cap, like selectVariant for HLS.
+func selectRepresentation(refs []representationRef, quality extractors.QualityCap) representationRef {
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].rep.Bandwidth > refs[j].rep.Bandwidth
+	})
+	for _, ref := range refs {
+		if quality.Allows(ref.rep.Height, ref.rep.Bandwidth) {
+			return ref
+		}
+	}
+	lowest := refs[len(refs)-1]
+	slog.Warn("No representation fits the quality cap, using the lowest one", "cap", quality, "height", lowest.rep.Height)
+	return lowest
+}
+
+// resolveBase applies the BaseURL elements from the outside in, empty ones are skipped.
+func resolveBase(base *url.URL, refs ...string) (*url.URL, error) {
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		next, err := base.Parse(ref)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BaseURL %q: %w", ref, err)
+		}
+		base = next
+	}
+	return base, nil
+}
+
+func resolve(base *url.URL, ref string) (string, error) {
+	u, err := base.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid segment URL %q: %w", ref, err)
+	}
+	return u.String(), nil
+}
+
+var isoDurationRe = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration reads the durations of DASH manifests like PT1H2M3.5S, years and months aren't used there.
+func parseISODuration(s string) (time.Duration, error) {
+	m := isoDurationRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	var seconds float64
+	for i, unit := range []float64{24 * 60 * 60, 60 * 60, 60, 1} {
+		if m[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		seconds += v * unit
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// audioTracks drops the video of a manifest with separate audio, otherwise the audio has to be extracted later.
+func audioTracks(tracks []dashTrack) []dashTrack {
+	var audio []dashTrack
+	for _, track := range tracks {
+		if track.kind == "audio" {
+			audio = append(audio, track)
+		}
+	}
+	if len(audio) == 0 {
+		return tracks
+	}
+	return audio
+}
+
+// dashDownload downloads the picked representations into one file each and muxes them into outputPath.
+// The segments of the tracks are fetched in the order of their start time, so a limit stops them at the same point.
+func (d *Downloader) dashDownload(ctx context.Context, resp *http.Response, referer, outputPath, message string, progress func(downloaded, total int64), audioOnly bool) error {
+	manifest, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	tracks, err := parseDASH(manifest, resp.Request.URL, d.quality)
+	if err != nil {
+		return err
+	}
+	if audioOnly {
+		tracks = audioTracks(tracks)
+	}
+	for _, track := range tracks {
+		slog.Info("Selected representation", "file", message, "kind", track.kind, "height", track.height, "bandwidth", track.bandwidth)
+	}
+	if len(tracks) > 1 && d.ffmpegPath == "" {
+		return d.ffmpegRequired("DASH has separate audio and video")
+	}
+
+	partsDir := outputPath + hlsPartsSuffix
+	if err := os.MkdirAll(partsDir, 0755); err != nil {
+		return err
+	}
+	defer d.removeSegments(partsDir)
+
+	var totalDuration float64
+	files := make([]*os.File, len(tracks))
+	paths := make([]string, len(tracks))
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}()
+	for i, track := range tracks {
+		totalDuration += track.duration()
+		paths[i] = filepath.Join(partsDir, fmt.Sprintf("%s_%d.mp4", track.kind, i))
+		if files[i], err = os.Create(paths[i]); err != nil {
+			return err
+		}
+		if track.init == "" {
+			continue
+		}
+		init, err := d.fetchSegment(ctx, SegmentSource{Urls: []string{track.init}}, referer)
+		if err != nil {
+			return fmt.Errorf("failed to download init segment: %w", err)
+		}
+		if _, err := files[i].Write(init); err != nil {
+			return err
+		}
+	}
+
+	d.ensureTotalBar()
+	bar := d.addEpisodeBar(message)
+
+	var downloadedBytes int64
+	var downloadedDuration float64
+	var lastEstimation int64
+	var limitErr error
+	next := make([]int, len(tracks))
+	// start time of the next segment of every track
+	position := make([]float64, len(tracks))
+
+	for {
+		current := -1
+		for i, track := range tracks {
+			if next[i] < len(track.segments) && (current == -1 || position[i] < position[current]) {
+				current = i
+			}
+		}
+		if current == -1 {
+			break
+		}
+
+		if err := d.pause.wait(ctx); err != nil {
+			return err
+		}
+		if d.maxDuration > 0 && position[current] >= d.maxDuration.Seconds() {
+			limitErr = &ErrLimitExceeded{Limit: "duration", Max: d.maxDuration.String()}
+			break
+		}
+		if d.maxSize > 0 && downloadedBytes >= d.maxSize {
+			limitErr = &ErrLimitExceeded{Limit: "size", Max: FormatSize(d.maxSize)}
+			break
+		}
+
+		segment := tracks[current].segments[next[current]]
+		data, err := d.fetchSegment(ctx, SegmentSource{Urls: []string{segment.url}}, referer)
+		if err != nil {
+			return err
+		}
+		n, err := files[current].Write(data)
+		if err != nil {
+			return err
+		}
+		next[current]++
+		position[current] += segment.duration
+
+		downloadedBytes += int64(n)
+		downloadedDuration += segment.duration
+		estimatedTotal := downloadedBytes
+		if downloadedDuration > 0 {
+			estimatedTotal = int64(float64(downloadedBytes) * totalDuration / downloadedDuration)
+		}
+		bar.SetTotal(estimatedTotal, false)
+		d.addTotalSize(estimatedTotal - lastEstimation)
+		lastEstimation = estimatedTotal
+		bar.SetCurrent(downloadedBytes)
+		d.addTotalPos(int64(n))
+		if progress != nil {
+			progress(downloadedBytes, estimatedTotal)
+		}
+	}
+
+	bar.SetTotal(downloadedBytes, true)
+	bar.SetCurrent(downloadedBytes)
+	for i, f := range files {
+		files[i] = nil
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	if d.ffmpegPath == "" {
+		return utils.MoveFile(paths[0], outputPath)
+	}
+
+	var args []string
+	for _, path := range paths {
+		args = append(args, "-i", path)
+	}
+	for i := range paths {
+		args = append(args, "-map", strconv.Itoa(i))
+	}
+	args = append(append([]string{"-y"}, args...), "-c", "copy")
+	args = append(append(args, d.outputArgs(outputPath)...), outputPath)
+
+	slog.Debug("Muxing DASH tracks with FFmpeg", "tracks", len(paths), "out", outputPath)
+	if err := d.muxAtomically(ctx, args); err != nil {
+		return fmt.Errorf("failed to mux DASH tracks: %w", err)
+	}
+	return limitErr
+}
@@ -0,0 +1,204 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bugmaschine/gad/internal/extractors"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"PT1H2M3.5S", time.Hour + 2*time.Minute + 3500*time.Millisecond, false},
+		{"PT24M", 24 * time.Minute, false},
+		{"P1DT1S", 24*time.Hour + time.Second, false},
+		{"PT", 0, true},
+		{"1H", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseISODuration(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.expected {
+			t.Errorf("%s\nExpected: %v (error %v)\nGot:      %v (%v)", tt.input, tt.expected, tt.wantErr, got, err)
+		}
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	rep := mpdRepresentation{ID: "v1", Bandwidth: 500000}
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"$RepresentationID$/seg-$Number$.m4s", "v1/seg-7.m4s"},
+		{"seg-$Number%05d$.m4s", "seg-00007.m4s"},
+		{"$Bandwidth$/$Time$.m4s", "500000/9000.m4s"},
+		{"cost$$-$Number$", "cost$-7"},
+	}
+
+	for _, tt := range tests {
+		if got := expandTemplate(tt.template, rep, 7, 9000); got != tt.expected {
+			t.Errorf("%s\nExpected: %s\nGot:      %s", tt.template, tt.expected, got)
+		}
+	}
+}
+
+const testManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT10S">
+  <Period>
+    <AdaptationSet mimeType="video/mp4">
+      <SegmentTemplate initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/$Number$.m4s" startNumber="1" timescale="1000" duration="4000"/>
+      <Representation id="1080" bandwidth="5000000" height="1080"/>
+      <Representation id="720" bandwidth="3000000" height="720"/>
+      <Representation id="480" bandwidth="1000000" height="480"/>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" lang="de">
+      <BaseURL>audio/</BaseURL>
+      <SegmentTemplate initialization="init.mp4" media="$Time$.m4s" timescale="100">
+        <SegmentTimeline>
+          <S t="0" d="500" r="1"/>
+          <S d="0" r="-1"/>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation id="a" bandwidth="128000"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+func TestParseDASH(t *testing.T) {
+	base, _ := url.Parse("https://cdn.example.com/stream/manifest.mpd")
+	tracks, err := parseDASH([]byte(testManifest), base, extractors.QualityCap{MaxHeight: 720})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 {
+		t.Fatalf("\nExpected: 2 tracks\nGot:      %d", len(tracks))
+	}
+
+	video := tracks[0]
+	expectedVideo := []string{
+		"https://cdn.example.com/stream/720/1.m4s",
+		"https://cdn.example.com/stream/720/2.m4s",
+		"https://cdn.example.com/stream/720/3.m4s",
+	}
+	if video.kind != "video" || video.init != "https://cdn.example.com/stream/720/init.mp4" || !slices.Equal(segmentUrls(video), expectedVideo) {
+		t.Errorf("\nExpected: %v\nGot:      %+v", expectedVideo, video)
+	}
+	// the last segment is cut at the end of the period
+	if d := video.duration(); d != 10 {
+		t.Errorf("\nExpected: video duration 10\nGot:      %v", d)
+	}
+
+	// broken timeline entries without a duration are skipped instead of repeating forever
+	audio := tracks[1]
+	expectedAudio := []string{
+		"https://cdn.example.com/stream/audio/0.m4s",
+		"https://cdn.example.com/stream/audio/500.m4s",
+	}
+	if audio.kind != "audio" || audio.init != "https://cdn.example.com/stream/audio/init.mp4" || !slices.Equal(segmentUrls(audio), expectedAudio) {
+		t.Errorf("\nExpected: %v\nGot:      %+v", expectedAudio, audio)
+	}
+}
+
+func TestParseDASHQualityCap(t *testing.T) {
+	base, _ := url.Parse("https://cdn.example.com/stream/manifest.mpd")
+	tests := []struct {
+		quality  extractors.QualityCap
+		expected string
+	}{
+		{extractors.QualityCap{}, "1080"},
+		{extractors.QualityCap{MaxBitrate: 4000000}, "720"},
+		{extractors.QualityCap{MaxHeight: 1080, MaxBitrate: 2000000}, "480"},
+		{extractors.QualityCap{MaxHeight: 240}, "480"},
+	}
+
+	for _, tt := range tests {
+		tracks, err := parseDASH([]byte(testManifest), base, tt.quality)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tracks[0].init; got != "https://cdn.example.com/stream/"+tt.expected+"/init.mp4" {
+			t.Errorf("\nCap:      %v\nExpected: %s\nGot:      %s", tt.quality, tt.expected, got)
+		}
+	}
+}
+
+func TestParseDASHLive(t *testing.T) {
+	base, _ := url.Parse("https://cdn.example.com/manifest.mpd")
+	if _, err := parseDASH([]byte(`<MPD type="dynamic"><Period/></MPD>`), base, extractors.QualityCap{}); err == nil {
+		t.Error("live manifest should be refused")
+	}
+}
+
+func segmentUrls(track dashTrack) []string {
+	var urls []string
+	for _, s := range track.segments {
+		urls = append(urls, s.url)
+	}
+	return urls
+}
+
+func TestDashDownload(t *testing.T) {
+	manifest := `<MPD type="static" mediaPresentationDuration="PT8S"><Period>
+  <AdaptationSet mimeType="video/mp4">
+    <Representation id="v" bandwidth="1000" height="720">
+      <SegmentList timescale="1" duration="4">
+        <Initialization sourceURL="init.mp4"/>
+        <SegmentURL media="seg1.m4s"/>
+        <SegmentURL media="seg2.m4s"/>
+      </SegmentList>
+    </Representation>
+  </AdaptationSet>
+</Period></MPD>`
+	files := map[string]string{
+		"/video/manifest.mpd": manifest,
+		"/video/init.mp4":     "init|",
+		"/video/seg1.m4s":     "one|",
+		"/video/seg2.m4s":     "two",
+		"/muxed/manifest.mpd": testManifest,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(data))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	d := NewDownloader("", false, 0)
+	// a single track needs no FFmpeg
+	if err := d.DownloadToFile(context.Background(), NewDownloadTask(filepath.Join(dir, "episode"), server.URL+"/video/manifest.mpd")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "episode.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "init|one|two"; string(got) != expected {
+		t.Errorf("\nExpected: %s\nGot:      %s", expected, got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "episode.mp4"+hlsPartsSuffix)); !os.IsNotExist(err) {
+		t.Errorf("segment directory wasn't removed: %v", err)
+	}
+
+	// separate audio has to be muxed
+	err = d.DownloadToFile(context.Background(), NewDownloadTask(filepath.Join(dir, "muxed"), server.URL+"/muxed/manifest.mpd"))
+	if !errors.Is(err, ErrFFmpegRequired) {
+		t.Errorf("\nExpected: %v\nGot:      %v", ErrFFmpegRequired, err)
+	}
+}
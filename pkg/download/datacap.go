@@ -0,0 +1,46 @@
+package download
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// dataCapInterval is how often the downloaded bytes are compared with the cap, the cap is exceeded by up to
+// that much time of downloading.
+var dataCapInterval = time.Second
+
+// DataCap throttles the downloads once the run downloaded Bytes, like the reduced speed of a mobile plan after
+// its high speed volume, see --cap-after.
+type DataCap struct {
+	Bytes int64
+	// Rate is in bytes per second
+	Rate float64
+}
+
+// SetDataCap downloads at full speed until dataCap.Bytes were downloaded from now on and limits the rate to dataCap.Rate
+// afterwards, until ctx is done. The bytes of every download of d count, so it is shared by the series of a queue.
+// It has to be called before the first download starts.
+func (d *Downloader) SetDataCap(ctx context.Context, dataCap DataCap) {
+	if d.limiter == nil {
+		d.limiter = rate.NewLimiter(rate.Inf, 0)
+	}
+	start := d.downloaded.Load()
+
+	go func() {
+		ticker := time.NewTicker(dataCapInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if d.downloaded.Load()-start >= dataCap.Bytes {
+				d.applyRate("Data cap reached", dataCap.Rate)
+				return
+			}
+		}
+	}()
+}
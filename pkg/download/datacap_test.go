@@ -0,0 +1,37 @@
+package download
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestDataCap(t *testing.T) {
+	defer func(interval time.Duration) { dataCapInterval = interval }(dataCapInterval)
+	dataCapInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := NewDownloader("", false, 0)
+	// bytes of earlier downloads don't count
+	d.downloaded.Add(5000)
+	d.SetDataCap(ctx, DataCap{Bytes: 1000, Rate: 100})
+
+	d.downloaded.Add(999)
+	time.Sleep(50 * time.Millisecond)
+	if got := d.limiter.Limit(); got != rate.Inf {
+		t.Errorf("below the cap\nExpected: %v\nGot:      %v", rate.Inf, got)
+	}
+
+	d.downloaded.Add(1)
+	deadline := time.Now().Add(2 * time.Second)
+	for d.limiter.Limit() == rate.Inf && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := d.limiter.Limit(); got != 100 {
+		t.Errorf("at the cap\nExpected: %v\nGot:      %v", rate.Limit(100), got)
+	}
+}
@@ -0,0 +1,166 @@
+package download
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dedupeExtensions are the files Deduplicator compares, sidecars and thumbnails are too small to be worth it.
+var dedupeExtensions = []string{".mp4", ".mkv", ".ts"}
+
+// Deduplicator replaces finished downloads with hardlinks to identical files elsewhere below its root,
+// e.g. recap episodes that are listed in several series. One instance is shared by every series of a run.
+type Deduplicator struct {
+	root string
+
+	mu      sync.Mutex
+	scanned bool
+	// files by size, only files of the same size get hashed
+	files  map[int64][]string
+	hashes map[string]fileHash
+}
+
+// fileHash caches the hash of a file as long as it didn't change.
+type fileHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+func NewDeduplicator(root string) *Deduplicator {
+	return &Deduplicator{
+		root:   root,
+		files:  make(map[int64][]string),
+		hashes: make(map[string]fileHash),
+	}
+}
+
+// Dedupe links path to an identical file below the root and returns that file, or "" if there is none.
+// If the filesystem can't hardlink, path is kept as the copy it already is and the error is returned.
+func (x *Deduplicator) Dedupe(path string) (string, error) {
+	path = filepath.Clean(path)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if !x.scanned {
+		if err := x.scan(); err != nil {
+			return "", fmt.Errorf("failed to scan %s: %w", x.root, err)
+		}
+		x.scanned = true
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	size := info.Size()
+	candidates := x.files[size]
+	if !slices.Contains(candidates, path) {
+		x.files[size] = append(candidates, path)
+	}
+	if size == 0 {
+		return "", nil
+	}
+
+	var sum string
+	for _, candidate := range candidates {
+		if candidate == path {
+			continue
+		}
+		candidateInfo, err := os.Stat(candidate)
+		if err != nil || candidateInfo.Size() != size {
+			continue
+		}
+		if os.SameFile(info, candidateInfo) {
+			return candidate, nil
+		}
+
+		if sum == "" {
+			if sum, err = x.hash(path, info); err != nil {
+				return "", err
+			}
+		}
+		candidateSum, err := x.hash(candidate, candidateInfo)
+		if err != nil {
+			slog.Debug("Failed to hash file for deduplication", "file", candidate, "error", err)
+			continue
+		}
+		if candidateSum != sum {
+			continue
+		}
+
+		if err := replaceWithLink(candidate, path); err != nil {
+			return "", err
+		}
+		return candidate, nil
+	}
+	return "", nil
+}
+
+// scan indexes the existing files below the root, they are only hashed once a download of the same size shows up.
+func (x *Deduplicator) scan() error {
+	err := filepath.WalkDir(x.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != x.root && isLeftover(entry) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isDedupeCandidate(entry) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		x.files[info.Size()] = append(x.files[info.Size()], path)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (x *Deduplicator) hash(path string, info os.FileInfo) (string, error) {
+	if cached, ok := x.hashes[path]; ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+
+	sum, err := hashFile(path)
+	if err != nil {
+		return "", err
+	}
+	x.hashes[path] = fileHash{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	return sum, nil
+}
+
+func isDedupeCandidate(entry fs.DirEntry) bool {
+	name := entry.Name()
+	return slices.Contains(dedupeExtensions, strings.ToLower(filepath.Ext(name))) && !isThumbnail(name) && !isLeftover(entry)
+}
+
+// replaceWithLink swaps path for a hardlink to target. The link is created next to path first,
+// so path stays untouched if linking isn't supported.
+func replaceWithLink(target, path string) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".link")
+	os.Remove(tmp)
+	if err := os.Link(target, tmp); err != nil {
+		return fmt.Errorf("failed to hardlink, keeping the copy: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
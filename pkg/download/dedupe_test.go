@@ -0,0 +1,58 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeduplicator(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"Series A/Series A - S01E05.mp4":       "recap",
+		"Series A/Series A - S01E05-thumb.mp4": "other",
+		"Series B/Series B - S00E01.mp4":       "recap",
+		"Series B/Series B - S00E02.mp4":       "other",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	x := NewDeduplicator(root)
+
+	tests := []struct {
+		name     string
+		file     string
+		expected string
+	}{
+		{"identical file gets linked", "Series B/Series B - S00E01.mp4", "Series A/Series A - S01E05.mp4"},
+		{"already linked", "Series B/Series B - S00E01.mp4", "Series A/Series A - S01E05.mp4"},
+		{"same size but different content, thumbnails don't count", "Series B/Series B - S00E02.mp4", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := x.Dedupe(filepath.Join(root, tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := ""
+			if tt.expected != "" {
+				expected = filepath.Join(root, tt.expected)
+			}
+			if got != expected {
+				t.Errorf("\nExpected: %s\nGot:      %s", expected, got)
+			}
+			if expected == "" {
+				return
+			}
+
+			linked, _ := os.Stat(filepath.Join(root, tt.file))
+			original, _ := os.Stat(expected)
+			if !os.SameFile(linked, original) {
+				t.Errorf("%s is not a hardlink of %s", tt.file, tt.expected)
+			}
+		})
+	}
+}
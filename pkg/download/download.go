@@ -3,21 +3,26 @@ package download
 import (
 	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"encoding/binary"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/bugmaschine/gad/internal/extractors"
+	"github.com/bugmaschine/gad/pkg/httpclient"
+	"github.com/bugmaschine/gad/pkg/utils"
 	"github.com/grafov/m3u8"
 	"github.com/vbauerster/mpb/v8"
 	"github.com/vbauerster/mpb/v8/decor"
@@ -32,8 +37,41 @@ type Downloader struct {
 	limiter    *rate.Limiter
 	userAgent  string
 	ffmpegPath string
-	debug      bool
-	mu         sync.Mutex
+	// ffmpegDisabled keeps the raw streams, downloads are never muxed even if FFmpeg is installed
+	ffmpegDisabled bool
+	// ffmpegArgs are user supplied output options for every mux, see ffmpeg.ParseArgs
+	ffmpegArgs []string
+	// ffmpeg bounds the FFmpeg processes of all downloads
+	ffmpeg *ffmpegPool
+	// faststart moves the index of mp4 files to the front, so players can start before reading the whole file
+	faststart bool
+	// noSeekOutput writes fragmented mp4 files, set by SetNoSeekOutput or once an output failed to seek
+	noSeekOutput atomic.Bool
+	// ffprobePath verifies the muxes before they get their final name, empty skips the check
+	ffprobePath string
+	// subtitleLangs are the subtitle renditions of HLS streams to download, subtitleMode where they end up
+	subtitleLangs SubtitleLanguages
+	subtitleMode  SubtitleMode
+	// dedupe links finished episodes to identical files, nil disables it
+	dedupe *Deduplicator
+	pause  *pauseGate
+	// quality limits the variant picked from HLS master playlists and DASH manifests, the zero value picks the best one.
+	quality extractors.QualityCap
+	// maxDuration and maxSize stop downloads that would never end, 0 means no limit.
+	maxDuration time.Duration
+	maxSize     int64
+	// downloaded counts all bytes written to disk, for throughput measurements
+	downloaded atomic.Int64
+	// tempDir is where downloads get assembled before they are moved to the save directory, empty assembles in place
+	tempDir string
+	// segmentRetries is how often a failed HLS or DASH segment is requested again per host
+	segmentRetries int
+	// keepSegments leaves the segment directories of HLS and DASH downloads behind for debugging
+	keepSegments bool
+	// progressLogInterval logs the throughput of plain downloads this often, 0 disables it
+	progressLogInterval time.Duration
+	debug               bool
+	mu                  sync.Mutex
 }
 
 func NewDownloader(userAgent string, debug bool, limitRate float64) *Downloader {
@@ -44,18 +82,116 @@ func NewDownloader(userAgent string, debug bool, limitRate float64) *Downloader
 
 	p := mpb.New()
 	return &Downloader{
-		client:    &http.Client{},
-		progress:  p,
-		limiter:   rLimit,
-		userAgent: userAgent,
-		debug:     debug,
+		client:         httpclient.Default(),
+		progress:       p,
+		limiter:        rLimit,
+		userAgent:      userAgent,
+		debug:          debug,
+		faststart:      true,
+		pause:          newPauseGate(),
+		ffmpeg:         newFfmpegPool(0, 0),
+		segmentRetries: DefaultSegmentRetries,
 	}
 }
 
+// SetProgressOutput writes the progress bars to w instead of stdout, call it before the first download.
+func (d *Downloader) SetProgressOutput(w io.Writer) {
+	d.progress = mpb.New(mpb.WithOutput(w))
+}
+
+// SetQuality limits the variant picked from HLS master playlists and DASH manifests, the zero value picks the best one.
+func (d *Downloader) SetQuality(quality extractors.QualityCap) {
+	d.quality = quality
+}
+
+// SetMaxDuration stops HLS downloads after the given playtime. It is also required for playlists without an end.
+func (d *Downloader) SetMaxDuration(duration time.Duration) {
+	d.maxDuration = duration
+}
+
+// SetMaxSize stops downloads after the given amount of bytes.
+func (d *Downloader) SetMaxSize(size int64) {
+	d.maxSize = size
+}
+
+// SetHTTPClient replaces the shared client from httpclient.Default, e.g. with a stub in tests.
+func (d *Downloader) SetHTTPClient(client *http.Client) {
+	d.client = client
+}
+
+// SetTempDir assembles downloads in dir and moves them to their output path once they are done. It is created if needed.
+func (d *Downloader) SetTempDir(dir string) {
+	d.tempDir = dir
+}
+
+// SetSegmentRetries sets how often a failed HLS or DASH segment is requested again from the same host, before the
+// alternate hosts are tried and the download fails. Client errors like 404 aren't retried.
+func (d *Downloader) SetSegmentRetries(retries int) {
+	d.segmentRetries = max(retries, 0)
+}
+
+// SetKeepSegments leaves the segment directory of HLS and DASH downloads with the concat list behind instead of
+// removing it. With a temp dir the work directory of the download stays in it.
+func (d *Downloader) SetKeepSegments(keep bool) {
+	d.keepSegments = keep
+}
+
+// SetProgressLogInterval logs the speed, the bytes so far and the ETA of plain downloads every interval, for logs
+// without the progress bars. 0 disables it.
+func (d *Downloader) SetProgressLogInterval(interval time.Duration) {
+	d.progressLogInterval = interval
+}
+
 func (d *Downloader) SetFfmpegPath(path string) {
 	d.ffmpegPath = path
 }
 
+// DisableFfmpeg keeps the downloads as they come: HLS streams as .ts, DASH and direct files untouched. Downloads
+// that can't be done without muxing fail with ErrFFmpegDisabled.
+func (d *Downloader) DisableFfmpeg() {
+	d.ffmpegDisabled = true
+	d.ffmpegPath = ""
+}
+
+// ffmpegRequired is the error of a download that can't be done without FFmpeg.
+func (d *Downloader) ffmpegRequired(what string) error {
+	if d.ffmpegDisabled {
+		return fmt.Errorf("%s: %w", what, ErrFFmpegDisabled)
+	}
+	return fmt.Errorf("%s: %w", what, ErrFFmpegRequired)
+}
+
+// SetFfmpegArgs adds output options to the FFmpeg calls that mux downloads. They go right before the output file,
+// so they can override the defaults of gad, e.g. the codec.
+func (d *Downloader) SetFfmpegArgs(args []string) {
+	d.ffmpegArgs = args
+}
+
+// SetFaststart toggles moving the index of muxed mp4 files to the front, it is on by default. mkv and ts don't need it.
+func (d *Downloader) SetFaststart(faststart bool) {
+	d.faststart = faststart
+}
+
+// SetNoSeekOutput writes mp4 files as fragmented mp4, which needs no seeking in the output. Without it this
+// happens on its own once FFmpeg failed to seek in an output.
+func (d *Downloader) SetNoSeekOutput(noSeek bool) {
+	d.noSeekOutput.Store(noSeek)
+}
+
+// SetDeduplicator hardlinks finished episodes to identical files found by dedupe, nil disables it.
+func (d *Downloader) SetDeduplicator(dedupe *Deduplicator) {
+	d.dedupe = dedupe
+}
+
+// outputArgs are the options for an FFmpeg output: faststart for mp4 followed by the user supplied options.
+func (d *Downloader) outputArgs(outputPath string) []string {
+	var args []string
+	if d.faststart && strings.EqualFold(filepath.Ext(outputPath), ".mp4") {
+		args = append(args, "-movflags", "+faststart")
+	}
+	return append(args, d.ffmpegArgs...)
+}
+
 func (d *Downloader) DownloadToFile(ctx context.Context, task *DownloadTask) error {
 	slog.Debug("Starting download to file", "url", task.Url, "path", task.OutputPath)
 	if task.SkipExisting {
@@ -65,42 +201,38 @@ func (d *Downloader) DownloadToFile(ctx context.Context, task *DownloadTask) err
 		}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", task.Url, nil)
-	if err != nil {
-		return err
+	ctx = withHeaders(ctx, extractors.HosterHeaders(task.Hoster))
+
+	outputPath := task.FinalOutputPath()
+	message := task.CustomMessage
+	if message == "" {
+		message = filepath.Base(outputPath)
 	}
+	ctx = withLogFile(ctx, message)
 
-	if d.userAgent != "" {
-		req.Header.Set("User-Agent", d.userAgent)
+	if task.AudioFormat != "" {
+		return d.downloadAudio(ctx, task)
 	}
-	if task.Referer != "" {
-		req.Header.Set("Referer", task.Referer)
+	// the tracks and parts of an episode name the subtitles after the episode
+	if _, ok := subtitleBase(ctx); !ok {
+		ctx = withSubtitleBase(ctx, strings.TrimSuffix(outputPath, filepath.Ext(outputPath)))
 	}
 
-	resp, err := d.client.Do(req)
+	// the task may have waited in the queue long enough for a signed URL to expire
+	refresh := &refresher{refresh: task.Refresh}
+	resp, streamUrl, referer, err := d.getRefreshing(ctx, task.Url, task.Referer, refresh)
 	if err != nil {
 		return err
 	}
 	slog.Debug("Got response", "status", resp.Status, "content-type", resp.Header.Get("Content-Type"))
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
-	}
-
 	contentType := resp.Header.Get("Content-Type")
-	isM3U8 := strings.Contains(strings.ToLower(resp.Request.URL.String()), ".m3u8") ||
-		strings.Contains(strings.ToLower(contentType), "application/vnd.apple.mpegurl") ||
-		strings.Contains(strings.ToLower(contentType), "application/x-mpegURL")
+	isM3U8 := isHLS(resp.Request.URL, contentType)
 
-	outputPath := task.OutputPath
-	if !task.OutputPathHasExtension {
-		outputPath += ".mp4"
-	}
-
-	message := task.CustomMessage
-	if message == "" {
-		message = filepath.Base(outputPath)
+	// no need to start a download that can't finish
+	if !isM3U8 && !isDASH(resp.Request.URL, contentType) && d.maxSize > 0 && resp.ContentLength > d.maxSize {
+		return &ErrLimitExceeded{Limit: "size", Max: FormatSize(d.maxSize)}
 	}
 
 	flags := os.O_CREATE | os.O_WRONLY
@@ -110,19 +242,190 @@ func (d *Downloader) DownloadToFile(ctx context.Context, task *DownloadTask) err
 		flags |= os.O_EXCL
 	}
 
-	targetFile, err := os.OpenFile(outputPath, flags, 0644)
+	workPath := outputPath
+	if d.tempDir != "" {
+		// the work directory is always empty, so the existing file has to be checked here
+		if _, err := os.Stat(outputPath); err == nil && !task.OverwriteFile {
+			return &os.PathError{Op: "open", Path: outputPath, Err: fs.ErrExist}
+		}
+		workDir, err := d.newWorkDir()
+		if err != nil {
+			return err
+		}
+		defer d.removeWorkDir(workDir)
+		workPath = filepath.Join(workDir, filepath.Base(outputPath))
+	}
+
+	targetFile, err := os.OpenFile(workPath, flags, 0644)
 	if err != nil {
 		return err
 	}
 	defer targetFile.Close()
+	if isM3U8 || isDASH(resp.Request.URL, contentType) {
+		// FFmpeg replaces the placeholder with its output, an open handle would keep windows from renaming over it
+		targetFile.Close()
+	}
 
+	slog.Info("Downloading stream", "file", message, "type", streamType(resp, contentType), "url", RedactUrl(streamUrl))
+	progress, stopThroughput := task.Progress, func() {}
+	if d.progressLogInterval > 0 && !isM3U8 && !isDASH(resp.Request.URL, contentType) {
+		throughput := &throughputLog{file: message, interval: d.progressLogInterval}
+		progress = throughput.progress(task.Progress)
+		stopThroughput = throughput.start(ctx)
+	}
+	var muxed string
 	if isM3U8 {
-		slog.Debug("Detected M3U8 playlist, starting HLS download")
-		return d.m3u8Download(ctx, resp, task.Referer, outputPath, message)
+		muxed, err = d.m3u8Download(ctx, resp, referer, workPath, d.segmentDir(outputPath), nil, message, task.Progress, refresh, task.audioOnly)
+	} else if isDASH(resp.Request.URL, contentType) {
+		err = d.dashDownload(ctx, resp, referer, workPath, message, task.Progress, task.audioOnly)
+	} else if canSplit(resp, task.ParallelParts) {
+		err = d.parallelDownload(ctx, resp, streamUrl, referer, refresh, targetFile, task.ParallelParts, message, progress)
 	} else {
-		slog.Debug("Starting simple file download")
-		return d.simpleDownload(ctx, resp, targetFile, message)
+		resp.Body = &resumingBody{ctx: ctx, d: d, body: resp.Body, url: streamUrl, referer: referer, refresher: refresh, end: -1}
+		// the bytes arrive in order, even if the body resumes after a broken connection
+		hash := sha256.New()
+		if err = d.simpleDownload(ctx, resp, io.MultiWriter(targetFile, hash), message, progress); err == nil {
+			task.sha256 = hex.EncodeToString(hash.Sum(nil))
+		}
+	}
+	stopThroughput()
+	if muxed != "" {
+		// the episode got another extension, FinalOutputPath has to name it from now on
+		workPath = muxed
+		outputPath = strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + filepath.Ext(muxed)
+		task.OutputPath, task.OutputPathHasExtension = outputPath, true
+	}
+
+	var limitErr *ErrLimitExceeded
+	// a failed or interrupted download is of no use, an empty placeholder or a partial file under the final name
+	// would be taken for the finished episode. Only downloads stopped by a limit are kept.
+	if err != nil && !errors.As(err, &limitErr) {
+		targetFile.Close()
+		if err := utils.RemoveFileIgnoreNotExists(workPath); err != nil {
+			slog.Warn("Failed to remove incomplete download", "path", workPath, "error", err)
+		}
+		return err
+	}
+
+	if workPath != outputPath && (err == nil || errors.As(err, &limitErr)) {
+		targetFile.Close()
+		if moveErr := moveFromWorkDir(workPath, outputPath); moveErr != nil {
+			return moveErr
+		}
+	}
+	if isM3U8 && (err == nil || errors.As(err, &limitErr)) {
+		targetFile.Close()
+		removeRawPlaceholder(outputPath)
+	}
+	return err
+}
+
+// removeRawPlaceholder deletes the empty output file of an HLS download that was kept as .ts instead, otherwise it
+// would be taken for the finished episode.
+func removeRawPlaceholder(outputPath string) {
+	tsPath := hlsFallbackPath(outputPath)
+	if tsPath == outputPath {
+		return
+	}
+	if _, err := os.Stat(tsPath); err != nil {
+		return
+	}
+	if info, err := os.Stat(outputPath); err == nil && info.Size() == 0 {
+		utils.RemoveFileIgnoreNotExists(outputPath)
+	}
+}
+
+// newWorkDir creates a directory in the temp dir for the files of one download, the caller has to remove it.
+func (d *Downloader) newWorkDir() (string, error) {
+	if err := os.MkdirAll(d.tempDir, 0755); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(d.tempDir, workDirPrefix+"*")
+}
+
+// removeWorkDir deletes the work directory of a download, unless it holds the segments kept by SetKeepSegments.
+func (d *Downloader) removeWorkDir(dir string) {
+	if d.keepSegments {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), hlsPartsSuffix) {
+				return
+			}
+		}
+	}
+	utils.RemoveDirAllIgnoreNotExists(dir)
+}
+
+// moveFromWorkDir moves a finished download to its output path, including the raw stream HLS falls back to.
+func moveFromWorkDir(workPath, outputPath string) error {
+	if err := utils.MoveFile(workPath, outputPath); err != nil {
+		return fmt.Errorf("failed to move download from the temp dir: %w", err)
+	}
+	if tsPath := hlsFallbackPath(workPath); tsPath != workPath {
+		if _, err := os.Stat(tsPath); err == nil {
+			if err := utils.MoveFile(tsPath, hlsFallbackPath(outputPath)); err != nil {
+				return fmt.Errorf("failed to move download from the temp dir: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// isHLS reports whether a response is a m3u8 playlist, judged by the URL or the content type.
+func isHLS(u *url.URL, contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return strings.Contains(strings.ToLower(u.String()), ".m3u8") ||
+		strings.Contains(contentType, "application/vnd.apple.mpegurl") ||
+		strings.Contains(contentType, "application/x-mpegurl")
+}
+
+func (d *Downloader) newRequest(ctx context.Context, url, referer string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.userAgent != "" {
+		req.Header.Set("User-Agent", d.userAgent)
+	}
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+	applyHeaders(ctx, req)
+	if origin := requestOrigin(req.Header.Get("Referer"), req.URL); origin != "" && req.Header.Get("Origin") == "" {
+		req.Header.Set("Origin", origin)
 	}
+	return req, nil
+}
+
+// requestOrigin returns the origin of referer if it is another one than of target, like the player of an embed page
+// sends it. Hosters that lock their files to the embed page check it together with the referer.
+func requestOrigin(referer string, target *url.URL) string {
+	ref, err := url.Parse(referer)
+	if err != nil || ref.Scheme == "" || ref.Host == "" {
+		return ""
+	}
+	if strings.EqualFold(ref.Scheme, target.Scheme) && strings.EqualFold(ref.Host, target.Host) {
+		return ""
+	}
+	return ref.Scheme + "://" + ref.Host
+}
+
+// get sends a GET request with the user agent and referer set. Anything but 200 OK is returned as *ErrHTTPStatus.
+func (d *Downloader) get(ctx context.Context, url, referer string) (*http.Response, error) {
+	req, err := d.newRequest(ctx, url, referer)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &ErrHTTPStatus{Code: resp.StatusCode, Url: url}
+	}
+	return resp, nil
 }
 
 func (d *Downloader) ensureTotalBar() {
@@ -136,6 +439,9 @@ func (d *Downloader) ensureTotalBar() {
 				decor.CountersKibiByte("% .2f / % .2f"),
 			),
 			d.downloadInfo(),
+			mpb.AppendDecorators(decor.Any(func(decor.Statistics) string {
+				return d.ffmpeg.status()
+			})),
 		)
 	}
 }
@@ -150,7 +456,30 @@ func (d *Downloader) downloadInfo() mpb.BarOption {
 	)
 }
 
+// addEpisodeBar adds the bar of a segmented download, its total is estimated as the segments come in.
+func (d *Downloader) addEpisodeBar(message string) *mpb.Bar {
+	return d.progress.AddBar(0,
+		mpb.PrependDecorators(
+			decor.Name(message+" ", decor.WC{W: len(message) + 1}),
+			decor.CountersKibiByte("% .2f / % .2f"),
+		),
+		d.downloadInfo(),
+	)
+}
+
+// addFileBar adds the bar of a plain download, whose size is known up front.
+func (d *Downloader) addFileBar(message string, size int64) *mpb.Bar {
+	return d.progress.AddBar(size,
+		mpb.PrependDecorators(
+			decor.Name(message, decor.WC{W: len(message) + 1}),
+			decor.CountersKibiByte("% .2f / % .2f"),
+		),
+		d.downloadInfo(),
+	)
+}
+
 func (d *Downloader) addTotalPos(n int64) {
+	d.downloaded.Add(n)
 	if d.totalBar != nil {
 		d.totalBar.IncrBy(int(n))
 	}
@@ -165,29 +494,18 @@ func (d *Downloader) addTotalSize(n int64) {
 	}
 }
 
-func (d *Downloader) simpleDownload(ctx context.Context, resp *http.Response, targetFile *os.File, message string) error {
+func (d *Downloader) simpleDownload(ctx context.Context, resp *http.Response, targetFile io.Writer, message string, progress func(downloaded, total int64)) error {
 	contentLength := resp.ContentLength
 
 	d.ensureTotalBar()
 	d.addTotalSize(contentLength)
 
-	// generic progress bar
-	bar := d.progress.AddBar(contentLength,
-		mpb.PrependDecorators(
-			decor.Name(message, decor.WC{W: len(message) + 1}),
-			decor.CountersKibiByte("% .2f / % .2f"),
-		),
-		d.downloadInfo(),
-	)
+	bar := d.addFileBar(message, contentLength)
 
-	var reader io.Reader = resp.Body
-	if d.limiter != nil {
-		reader = &rateLimitedReader{
-			r:       resp.Body,
-			limiter: d.limiter,
-			ctx:     ctx,
-		}
-	}
+	body, stop := cancelableBody(ctx, resp.Body)
+	defer stop()
+
+	reader := NewRateLimitedReader(&pausableReader{r: body, gate: d.pause, ctx: ctx}, d.limiter, ctx)
 
 	proxyReader := bar.ProxyReader(reader)
 	defer proxyReader.Close()
@@ -197,98 +515,77 @@ func (d *Downloader) simpleDownload(ctx context.Context, resp *http.Response, ta
 	if d.totalBar != nil {
 		finalReader = io.TeeReader(proxyReader, totalWriter{d})
 	}
+	if progress != nil {
+		finalReader = &progressReader{r: finalReader, total: max(contentLength, 0), progress: progress}
+	}
 
-	_, err := io.Copy(targetFile, finalReader)
-	if err != nil {
+	if d.maxSize <= 0 {
+		_, err := io.Copy(targetFile, finalReader)
 		return err
 	}
 
-	return nil
-}
-
-func (d *Downloader) m3u8Download(ctx context.Context, resp *http.Response, referer, outputPath, message string) error {
-	m3u8Bytes, err := io.ReadAll(resp.Body)
+	n, err := io.Copy(targetFile, io.LimitReader(finalReader, d.maxSize))
 	if err != nil {
 		return err
 	}
+	// the server didn't send a length, check if there is more than allowed
+	if n == d.maxSize {
+		if extra, _ := finalReader.Read(make([]byte, 1)); extra > 0 {
+			return &ErrLimitExceeded{Limit: "size", Max: FormatSize(d.maxSize)}
+		}
+	}
+	return nil
+}
 
-	p, listType, err := m3u8.DecodeFrom(bytes.NewReader(m3u8Bytes), true)
+// m3u8Download collects the segments in partsDir and muxes them into outputPath. If the download fails, the
+// segments so far are kept there and the next attempt resumes after them, see hlsProgress. With a stream the
+// segments are written to it in order instead, outputPath and partsDir aren't used then. muxed is the file the
+// episode was written to instead of outputPath, the mkv of embedded subtitles, see subtitleMuxPath.
+func (d *Downloader) m3u8Download(ctx context.Context, resp *http.Response, referer, outputPath, partsDir string, stream io.Writer, message string, progress func(downloaded, total int64), refresh *refresher, audioOnly bool) (muxed string, err error) {
+	mediaPlaylist, mediaPlaylistURL, alternates, renditions, err := d.loadMediaPlaylist(ctx, resp, referer, audioOnly)
 	if err != nil {
-		return fmt.Errorf("failed to decode m3u8: %w", err)
+		return "", err
+	}
+	audioURL := renditions.audio
+	tsPath := hlsFallbackPath(outputPath)
+	if audioURL != nil && d.ffmpegPath == "" && stream == nil && tsPath != outputPath {
+		// without the audio the episode would be a silent video that counts as done
+		return "", d.ffmpegRequired("separate audio rendition")
+	}
+	if audioURL != nil && (stream != nil || tsPath == outputPath) {
+		slog.Warn("The audio is in a separate rendition that can only be muxed into an mp4 with FFmpeg, the video has no sound", "file", message)
+		audioURL = nil
 	}
 
-	var mediaPlaylist *m3u8.MediaPlaylist
-	mediaPlaylistURL := resp.Request.URL
-
-	if listType == m3u8.MASTER {
-		master := p.(*m3u8.MasterPlaylist)
-		if len(master.Variants) == 0 {
-			return fmt.Errorf("no variants in master playlist")
+	if !mediaPlaylist.Closed {
+		if d.maxDuration <= 0 {
+			return "", ErrLiveStream
 		}
+		slog.Warn("Playlist has no end, it is probably a live stream. Stopping at the maximum duration", "file", message, "max_duration", d.maxDuration)
+	}
 
-		// Sort variants by bandwidth (descending) as simple quality heuristic
-		sort.Slice(master.Variants, func(i, j int) bool {
-			return master.Variants[i].Bandwidth > master.Variants[j].Bandwidth
-		})
-
-		bestVariant := master.Variants[0]
-		variantURL, err := mediaPlaylistURL.Parse(bestVariant.URI)
-		if err != nil {
-			return fmt.Errorf("failed to parse variant URL: %w", err)
-		}
+	d.ensureTotalBar()
+	bar := d.addEpisodeBar(message)
 
-		mediaPlaylistURL = variantURL
-		req, err := http.NewRequestWithContext(ctx, "GET", variantURL.String(), nil)
+	parts, resumed := newHlsStream(stream), (*hlsProgress)(nil)
+	if stream == nil {
+		parts, resumed, err = openHlsParts(partsDir, playlistFingerprint(mediaPlaylistURL, mediaPlaylist))
 		if err != nil {
-			return err
+			return "", err
 		}
-		if d.userAgent != "" {
-			req.Header.Set("User-Agent", d.userAgent)
-		}
-		if referer != "" {
-			req.Header.Set("Referer", referer)
-		}
-
-		vResp, err := d.client.Do(req)
-		if err != nil {
-			return err
+	}
+	defer func() {
+		parts.close()
+		if stream != nil {
+			return
 		}
-		defer vResp.Body.Close()
-
-		vp, vt, err := m3u8.DecodeFrom(vResp.Body, true)
-		if err != nil || vt != m3u8.MEDIA {
-			return fmt.Errorf("failed to decode media playlist: %w", err)
+		var limitErr *ErrLimitExceeded
+		if err != nil && !errors.As(err, &limitErr) && parts.resumable() {
+			slog.Info("Keeping the downloaded segments, the next attempt resumes after them", "file", message, "path", partsDir)
+			return
 		}
-		mediaPlaylist = vp.(*m3u8.MediaPlaylist)
-	} else if listType == m3u8.MEDIA {
-		mediaPlaylist = p.(*m3u8.MediaPlaylist)
-	} else {
-		return fmt.Errorf("unsupported playlist type")
-	}
-
-	d.ensureTotalBar()
-
-	// per episode bar
-
-	bar := d.progress.AddBar(0, // Total will be updated as we go
-		mpb.PrependDecorators(
-			decor.Name(message+" ", decor.WC{W: len(message) + 1}),
-			decor.CountersKibiByte("% .2f / % .2f"),
-		),
-		d.downloadInfo(),
-	)
-
-	// Use a temporary .ts file for m3u8
-	tsPath := outputPath
-	if strings.HasSuffix(outputPath, ".mp4") {
-		tsPath = strings.TrimSuffix(outputPath, ".mp4") + ".ts"
-	}
-
-	targetFile, err := os.OpenFile(tsPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
-	if err != nil {
-		return err
-	}
-	defer targetFile.Close()
+		d.removeSegments(partsDir)
+	}()
 
 	var totalDuration float64
 	for _, seg := range mediaPlaylist.Segments {
@@ -300,112 +597,128 @@ func (d *Downloader) m3u8Download(ctx context.Context, resp *http.Response, refe
 
 	var downloadedBytes int64
 	var downloadedDuration float64
-	var currentKey []byte
-	var currentIV []byte
+	decrypter := newHlsDecrypter()
 	var lastEstimation int64
+	var currentMap *m3u8.Map
+	var partMapURI string
+	initSections := make(map[string][]byte)
+	var limitErr error
+
+	start := 0
+	if resumed != nil {
+		start = resumed.Segments
+		downloadedBytes = resumed.Bytes
+		downloadedDuration = resumed.Duration
+		partMapURI = resumed.MapURI
+		bar.SetCurrent(downloadedBytes)
+		d.addTotalPos(downloadedBytes)
+		slog.Info("Resuming download", "file", message, "segments", start, "size", FormatSize(downloadedBytes))
+	}
+	// the key of the resumed segment may have been set by one of the skipped ones
+	var skippedKey *m3u8.Key
 
-	for i, segment := range mediaPlaylist.Segments {
+	for i := 0; i < len(mediaPlaylist.Segments); i++ {
+		segment := mediaPlaylist.Segments[i]
 		if segment == nil {
 			break
 		}
+		if i < start {
+			if segment.Map != nil {
+				currentMap = segment.Map
+			}
+			if segment.Key != nil {
+				skippedKey = segment.Key
+			}
+			continue
+		}
 
-		if segment.Key != nil {
-			if segment.Key.Method == "AES-128" {
-				keyURL, err := mediaPlaylistURL.Parse(segment.Key.URI)
-				if err != nil {
-					return err
-				}
-
-				req, err := http.NewRequestWithContext(ctx, "GET", keyURL.String(), nil)
-				if err != nil {
-					return err
-				}
-				if d.userAgent != "" {
-					req.Header.Set("User-Agent", d.userAgent)
-				}
-				if referer != "" {
-					req.Header.Set("Referer", referer)
-				}
+		if err := d.pause.wait(ctx); err != nil {
+			return "", err
+		}
+		if d.maxDuration > 0 && downloadedDuration >= d.maxDuration.Seconds() {
+			limitErr = &ErrLimitExceeded{Limit: "duration", Max: d.maxDuration.String()}
+			break
+		}
+		if d.maxSize > 0 && downloadedBytes >= d.maxSize {
+			limitErr = &ErrLimitExceeded{Limit: "size", Max: FormatSize(d.maxSize)}
+			break
+		}
 
-				kResp, err := d.client.Do(req)
-				if err != nil {
-					return err
-				}
-				currentKey, err = io.ReadAll(kResp.Body)
-				kResp.Body.Close()
-				if err != nil {
-					return err
-				}
+		// EXT-X-MAP only gets attached to the first segment it applies to
+		if segment.Map != nil {
+			currentMap = segment.Map
+		}
+		mapURI := ""
+		if currentMap != nil {
+			mapURI = currentMap.URI
+		}
 
-				if segment.Key.IV != "" {
-					ivStr := strings.TrimPrefix(segment.Key.IV, "0x")
-					currentIV, err = hex.DecodeString(ivStr)
+		if !parts.started() || segment.Discontinuity || mapURI != partMapURI {
+			var init []byte
+			if currentMap != nil {
+				init = initSections[mapURI]
+				if init == nil {
+					init, err = d.fetchInit(ctx, currentMap, mediaPlaylistURL, referer)
 					if err != nil {
-						return err
+						return "", err
 					}
-				} else {
-					// Use sequence number as IV if not provided
-					seq := uint64(mediaPlaylist.SeqNo) + uint64(i)
-					currentIV = make([]byte, 16)
-					binary.BigEndian.PutUint64(currentIV[8:], seq)
+					initSections[mapURI] = init
 				}
-			} else {
-				return fmt.Errorf("unsupported encryption method: %s", segment.Key.Method)
 			}
+			if err := parts.start(init); err != nil {
+				return "", err
+			}
+			partMapURI = mapURI
 		}
 
-		segmentURL, err := mediaPlaylistURL.Parse(segment.URI)
-		if err != nil {
-			return err
-		}
-
-		req, err := http.NewRequestWithContext(ctx, "GET", segmentURL.String(), nil)
-		if err != nil {
-			return err
-		}
-		if d.userAgent != "" {
-			req.Header.Set("User-Agent", d.userAgent)
-		}
-		if referer != "" {
-			req.Header.Set("Referer", referer)
+		key := segment.Key
+		if key == nil && i == start {
+			key = skippedKey
 		}
-
-		sResp, err := d.client.Do(req)
-		if err != nil {
-			return err
+		if key != nil {
+			if err := decrypter.update(ctx, d, key, mediaPlaylistURL, referer); err != nil {
+				return "", err
+			}
 		}
 
-		segmentBytes, err := io.ReadAll(sResp.Body)
-		sResp.Body.Close()
+		source, err := NewSegmentSource(segment.URI, mediaPlaylistURL, alternates)
 		if err != nil {
-			return err
+			return "", err
 		}
 
-		if currentKey != nil {
-			block, err := aes.NewCipher(currentKey)
+		segmentBytes, err := d.fetchSegment(ctx, source, referer)
+		if isRefused(err) {
+			// signed segment URLs expired, a fresh playlist lists the same segments with new signatures
+			var refreshed *m3u8.MediaPlaylist
+			refreshed, mediaPlaylistURL, alternates, referer, err = d.refreshMediaPlaylist(ctx, refresh, err, audioOnly)
 			if err != nil {
-				return err
+				return "", err
 			}
-			mode := cipher.NewCBCDecrypter(block, currentIV)
-			// PKCS7 padding is handled by the M3U8 standard, but we might need to unpad if it's not a multiple of block size (though it should be for AES-128 in HLS)
-			decrypted := make([]byte, len(segmentBytes))
-			mode.CryptBlocks(decrypted, segmentBytes)
-
-			// Unpad PKCS7
-			paddingLen := int(decrypted[len(decrypted)-1])
-			if paddingLen > 0 && paddingLen <= aes.BlockSize {
-				segmentBytes = decrypted[:len(decrypted)-paddingLen]
-			} else {
-				segmentBytes = decrypted
+			if len(refreshed.Segments) <= i || refreshed.Segments[i] == nil {
+				return "", fmt.Errorf("the refreshed playlist has fewer segments, %d were downloaded already", i)
 			}
+			mediaPlaylist = refreshed
+			i--
+			continue
+		}
+		if err != nil {
+			return "", err
 		}
 
-		n, err := targetFile.Write(segmentBytes)
+		segmentBytes, err = decrypter.decrypt(segmentBytes, mediaPlaylist.SeqNo+uint64(i))
 		if err != nil {
-			return err
+			return "", fmt.Errorf("failed to decrypt segment %d: %w", i, err)
+		}
+
+		n, err := parts.Write(segmentBytes)
+		if err != nil {
+			return "", err
 		}
 		downloadedBytes += int64(n)
 		downloadedDuration += segment.Duration
+		if err := parts.save(i+1, downloadedBytes, downloadedDuration, partMapURI); err != nil {
+			return "", fmt.Errorf("failed to save the progress: %w", err)
+		}
 
 		// Estimation
 		estimatedTotal := int64((float64(downloadedBytes) * totalDuration) / downloadedDuration)
@@ -418,29 +731,239 @@ func (d *Downloader) m3u8Download(ctx context.Context, resp *http.Response, refe
 
 		bar.SetCurrent(downloadedBytes)
 		d.addTotalPos(int64(n))
+		if progress != nil {
+			progress(downloadedBytes, estimatedTotal)
+		}
 	}
 
 	bar.SetTotal(downloadedBytes, true)
 	bar.SetCurrent(downloadedBytes)
 
-	targetFile.Close()
+	if err := parts.close(); err != nil {
+		return "", err
+	}
+	if stream != nil {
+		return "", limitErr
+	}
 
-	// Post-processing with FFmpeg
+	var audioPath string
+	if audioURL != nil {
+		audioPath, err = d.downloadAudioRendition(ctx, audioURL, referer, outputPath, partsDir, message, refresh)
+		if audioPath != "" {
+			defer func() {
+				utils.RemoveFileIgnoreNotExists(audioPath)
+				utils.RemoveFileIgnoreNotExists(hlsFallbackPath(audioPath))
+			}()
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var subtitles []*subtitle
+	if base, ok := subtitleBase(ctx); ok && base != "" && len(renditions.subtitles) > 0 {
+		subtitles = d.downloadSubtitles(ctx, renditions.subtitles, referer, outputPath, message)
+	}
+	embed := d.subtitleMode == SubtitleEmbed && len(subtitles) > 0
+
+	// Single pass mux of all parts with FFmpeg
 	if d.ffmpegPath != "" && tsPath != outputPath {
-		slog.Debug("Remuxing with FFmpeg", "in", tsPath, "out", outputPath)
-		cmd := exec.Command(d.ffmpegPath, "-y", "-i", tsPath, "-c", "copy", outputPath)
-		if !d.debug {
-			cmd.Stdout = nil
-			cmd.Stderr = nil
-		}
-		if err := cmd.Run(); err == nil {
-			os.Remove(tsPath)
+		target := outputPath
+		if embed {
+			target = subtitleMuxPath(outputPath)
+		}
+		listPath, err := parts.writeConcatList()
+		if err != nil {
+			return "", err
+		}
+
+		slog.Debug("Muxing with FFmpeg", "parts", len(parts.files), "audio", audioPath, "subtitles", len(subtitles), "out", target)
+		args := []string{"-y", "-f", "concat", "-safe", "0", "-i", listPath}
+		inputs := 1
+		if audioPath != "" {
+			args = append(args, "-i", audioPath, "-map", "0:v", "-map", "1:a")
+			inputs++
+		} else if embed {
+			// the subtitles need explicit maps, which turn off picking the streams of the video automatically
+			args = append(args, "-map", "0:v", "-map", "0:a?")
+		}
+		var subtitleArgs []string
+		if embed {
+			var subtitleInputs []string
+			subtitleInputs, subtitleArgs = subtitleMuxArgs(subtitles, inputs)
+			args = append(args, subtitleInputs...)
+		}
+		args = append(append(append(args, "-c", "copy"), subtitleArgs...), d.outputArgs(target)...)
+		if err := d.muxAtomically(ctx, append(args, target)); err != nil {
+			if audioPath != "" {
+				// the raw stream has no sound, the parts stay for the next attempt
+				return "", fmt.Errorf("muxing the audio rendition: %w", err)
+			}
+			slog.Warn("FFmpeg mux failed, keeping the raw stream", "error", err)
 		} else {
-			slog.Warn("FFmpeg remux failed", "error", err)
+			if !embed {
+				placeSubtitles(ctx, subtitles, message)
+				return "", limitErr
+			}
+			removeSubtitles(subtitles)
+			if target == outputPath {
+				return "", limitErr
+			}
+			// the empty placeholder of DownloadToFile
+			if info, err := os.Stat(outputPath); err == nil && info.Size() == 0 {
+				utils.RemoveFileIgnoreNotExists(outputPath)
+			}
+			return target, limitErr
 		}
 	}
 
-	return nil
+	if err := parts.concatInto(tsPath); err != nil {
+		return "", err
+	}
+	if embed {
+		slog.Warn("The subtitles couldn't be embedded, saving them next to the episode", "file", message)
+	}
+	placeSubtitles(ctx, subtitles, message)
+	return "", limitErr
+}
+
+// loadMediaPlaylist decodes the playlist of resp. For a master playlist the variant is picked and its media playlist
+// fetched, the alternates are the mirrors of that variant. If the audio of the variant is in a separate rendition,
+// its playlist URL is returned too, unless audioOnly picked that rendition instead of the video, and so are the
+// subtitle renditions asked for with SetSubtitles.
+func (d *Downloader) loadMediaPlaylist(ctx context.Context, resp *http.Response, referer string, audioOnly bool) (*m3u8.MediaPlaylist, *url.URL, []*url.URL, hlsRenditions, error) {
+	m3u8Bytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, nil, hlsRenditions{}, err
+	}
+
+	p, listType, err := m3u8.DecodeFrom(bytes.NewReader(m3u8Bytes), true)
+	if err != nil {
+		return nil, nil, nil, hlsRenditions{}, fmt.Errorf("failed to decode m3u8: %w", err)
+	}
+
+	mediaPlaylistURL := resp.Request.URL
+	switch listType {
+	case m3u8.MEDIA:
+		return p.(*m3u8.MediaPlaylist), mediaPlaylistURL, nil, hlsRenditions{}, nil
+	case m3u8.MASTER:
+	default:
+		return nil, nil, nil, hlsRenditions{}, fmt.Errorf("unsupported playlist type")
+	}
+
+	master := p.(*m3u8.MasterPlaylist)
+	if len(master.Variants) == 0 {
+		return nil, nil, nil, hlsRenditions{}, fmt.Errorf("no variants in master playlist")
+	}
+
+	// Sort variants by bandwidth (descending) as simple quality heuristic
+	sort.Slice(master.Variants, func(i, j int) bool {
+		return master.Variants[i].Bandwidth > master.Variants[j].Bandwidth
+	})
+
+	bestVariant := selectVariant(master.Variants, d.quality)
+	slog.Info("Selected variant", "file", logFile(ctx), "resolution", bestVariant.Resolution, "bandwidth", bestVariant.Bandwidth,
+		"variants", len(master.Variants))
+	variantURL, err := mediaPlaylistURL.Parse(bestVariant.URI)
+	if err != nil {
+		return nil, nil, nil, hlsRenditions{}, fmt.Errorf("failed to parse variant URL: %w", err)
+	}
+
+	alternates := alternateVariants(master, bestVariant, mediaPlaylistURL)
+	if len(alternates) > 0 {
+		slog.Debug("Found alternate hosts for variant", "count", len(alternates))
+	}
+	var renditions hlsRenditions
+	if audio := audioRendition(bestVariant); audio != nil {
+		slog.Debug("Using the audio rendition", "name", audio.Name, "language", audio.Language, "group", audio.GroupId)
+		if renditions.audio, err = mediaPlaylistURL.Parse(audio.URI); err != nil {
+			return nil, nil, nil, hlsRenditions{}, fmt.Errorf("failed to parse audio rendition URL: %w", err)
+		}
+		if audioOnly {
+			// the mirrors are of the variant, not of its audio
+			variantURL, renditions.audio, alternates = renditions.audio, nil, nil
+		}
+	}
+	if d.subtitleLangs.Enabled() && !audioOnly {
+		if renditions.subtitles, err = subtitleRenditions(bestVariant, d.subtitleLangs, mediaPlaylistURL); err != nil {
+			return nil, nil, nil, hlsRenditions{}, err
+		}
+	}
+	vResp, err := d.get(ctx, variantURL.String(), referer)
+	if err != nil {
+		return nil, nil, nil, hlsRenditions{}, err
+	}
+	defer vResp.Body.Close()
+
+	vp, vt, err := m3u8.DecodeFrom(vResp.Body, true)
+	if err != nil || vt != m3u8.MEDIA {
+		return nil, nil, nil, hlsRenditions{}, fmt.Errorf("failed to decode media playlist: %w", err)
+	}
+	return vp.(*m3u8.MediaPlaylist), variantURL, alternates, renditions, nil
+}
+
+// hlsRenditions are the renditions of a HLS variant that are downloaded besides its own playlist.
+type hlsRenditions struct {
+	audio     *url.URL
+	subtitles []*subtitle
+}
+
+// refreshMediaPlaylist resolves the stream again after cause and loads its media playlist.
+func (d *Downloader) refreshMediaPlaylist(ctx context.Context, refresh *refresher, cause error, audioOnly bool) (*m3u8.MediaPlaylist, *url.URL, []*url.URL, string, error) {
+	streamUrl, referer, err := refresh.next(ctx, cause, "")
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+	resp, streamUrl, referer, err := d.getRefreshing(ctx, streamUrl, referer, refresh)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+	defer resp.Body.Close()
+
+	playlist, playlistURL, alternates, _, err := d.loadMediaPlaylist(ctx, resp, referer, audioOnly)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+	slog.Debug("Continuing with the refreshed playlist", "url", streamUrl)
+	return playlist, playlistURL, alternates, referer, nil
+}
+
+// hlsFallbackPath is where the parts end up without FFmpeg, a .ts next to the mp4.
+func hlsFallbackPath(outputPath string) string {
+	if strings.HasSuffix(outputPath, ".mp4") {
+		return strings.TrimSuffix(outputPath, ".mp4") + ".ts"
+	}
+	return outputPath
+}
+
+// followFallback points the task at the .ts its stream was kept as, if it wasn't muxed into the mp4.
+func (t *DownloadTask) followFallback() {
+	outputPath := t.FinalOutputPath()
+	tsPath := hlsFallbackPath(outputPath)
+	if tsPath == outputPath {
+		return
+	}
+	if _, err := os.Stat(outputPath); err == nil {
+		return
+	}
+	if _, err := os.Stat(tsPath); err == nil {
+		t.OutputPath = tsPath
+		t.OutputPathHasExtension = true
+	}
+}
+
+// selectVariant picks the first variant of the bandwidth sorted list that fits the quality cap.
+// Variants without resolution or bandwidth are accepted, if none fits the last (smallest) one is used.
+func selectVariant(variants []*m3u8.Variant, quality extractors.QualityCap) *m3u8.Variant {
+	for _, v := range variants {
+		height, _ := extractors.ParseResolution(v.Resolution)
+		if quality.Allows(height, int(v.Bandwidth)) {
+			return v
+		}
+	}
+	lowest := variants[len(variants)-1]
+	slog.Warn("No variant fits the quality cap, using the lowest one", "cap", quality, "resolution", lowest.Resolution)
+	return lowest
 }
 
 type totalWriter struct {
@@ -452,26 +975,53 @@ func (tw totalWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// progressReader reports the bytes read so far after every read.
+type progressReader struct {
+	r        io.Reader
+	read     int64
+	total    int64
+	progress func(downloaded, total int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.read += int64(n)
+		r.progress(r.read, r.total)
+	}
+	return n, err
+}
+
 func (d *Downloader) Wait() {
 	d.progress.Wait()
 }
 
-type rateLimitedReader struct {
-	r       io.Reader
-	limiter *rate.Limiter
-	ctx     context.Context
+// contextReader fails reads with the context error once ctx is done, instead of whatever the closed body returns.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
 }
 
-func (r *rateLimitedReader) Read(p []byte) (int, error) {
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
 	n, err := r.r.Read(p)
-	if n > 0 {
-		if err := r.limiter.WaitN(r.ctx, n); err != nil {
-			return n, err
-		}
+	if err != nil && r.ctx.Err() != nil {
+		return n, r.ctx.Err()
 	}
 	return n, err
 }
 
+// cancelableBody closes body as soon as ctx is done, so a Read blocked on a stalled server returns right away.
+// The returned func has to be called once the body isn't read anymore.
+func cancelableBody(ctx context.Context, body io.ReadCloser) (io.Reader, func()) {
+	stop := context.AfterFunc(ctx, func() {
+		body.Close()
+	})
+	return &contextReader{ctx: ctx, r: body}, func() { stop() }
+}
+
 func slogInfo(format string, args ...interface{}) {
 	slog.Info(fmt.Sprintf(format, args...))
 }
@@ -0,0 +1,303 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bugmaschine/gad/pkg/httpclient"
+)
+
+func TestDownloadToFileHTTPStatus(t *testing.T) {
+	tests := []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError}
+
+	for _, code := range tests {
+		t.Run(http.StatusText(code), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(code)
+			}))
+			defer server.Close()
+
+			d := NewDownloader("", false, 0)
+			task := NewDownloadTask(filepath.Join(t.TempDir(), "episode"), server.URL)
+
+			err := d.DownloadToFile(context.Background(), task)
+			var statusErr *ErrHTTPStatus
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("\nExpected: *ErrHTTPStatus\nGot:      %v", err)
+			}
+			if statusErr.Code != code {
+				t.Errorf("\nExpected: %d\nGot:      %d", code, statusErr.Code)
+			}
+		})
+	}
+}
+
+func TestDownloadToFileMaxSize(t *testing.T) {
+	body := strings.Repeat("x", 100)
+
+	tests := []struct {
+		name          string
+		contentLength bool
+		maxSize       int64
+		exceeded      bool
+	}{
+		{"with length", true, 50, true},
+		{"without length", false, 50, true},
+		{"exact size", false, 100, false},
+		{"below limit", true, 200, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentLength {
+					w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				}
+				w.Write([]byte(body))
+				// forces a chunked response
+				w.(http.Flusher).Flush()
+			}))
+			defer server.Close()
+
+			d := NewDownloader("", false, 0)
+			d.SetMaxSize(tt.maxSize)
+			task := NewDownloadTask(filepath.Join(t.TempDir(), "episode"), server.URL)
+
+			err := d.DownloadToFile(context.Background(), task)
+			var limitErr *ErrLimitExceeded
+			if errors.As(err, &limitErr) != tt.exceeded {
+				t.Errorf("\nExpected: exceeded=%v\nGot:      %v", tt.exceeded, err)
+			}
+			if !tt.exceeded && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// stallingServer sends the first chunk of a response and then hangs until the client goes away.
+// started is closed once the first chunk got flushed.
+func TestDownloadToFileTempDir(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("video"))
+	}))
+	defer server.Close()
+
+	saveDir := t.TempDir()
+	tempDir := filepath.Join(t.TempDir(), "tmp")
+	d := NewDownloader("", false, 0)
+	d.SetTempDir(tempDir)
+
+	task := NewDownloadTask(filepath.Join(saveDir, "episode"), server.URL)
+	if err := d.DownloadToFile(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(task.FinalOutputPath()); string(data) != "video" {
+		t.Errorf("\nExpected: video\nGot:      %q", data)
+	}
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("\nExpected: empty temp dir\nGot:      %d entries", len(entries))
+	}
+
+	// the existing file must not be replaced without OverwriteFile, just like without a temp dir
+	if err := d.DownloadToFile(context.Background(), task); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("\nExpected: %v\nGot:      %v", fs.ErrExist, err)
+	}
+}
+
+func stallingServer(t *testing.T, contentType string, first []byte) (*httptest.Server, chan struct{}) {
+	t.Helper()
+	started := make(chan struct{})
+	var once sync.Once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("Content-Length", "1000000")
+		w.Write(first)
+		w.(http.Flusher).Flush()
+		once.Do(func() { close(started) })
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	return server, started
+}
+
+// expectNoLeakedGoroutines waits until the goroutines started after baseline are gone.
+func expectNoLeakedGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Errorf("\nExpected: %d goroutines\nGot:      %d", baseline, runtime.NumGoroutine())
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDownloadToFileCancel(t *testing.T) {
+	server, started := stallingServer(t, "video/mp4", []byte("first bytes"))
+
+	d := NewDownloader("", false, 0)
+	d.SetHTTPClient(&http.Client{Transport: &http.Transport{}})
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	dir := t.TempDir()
+	task := NewDownloadTask(filepath.Join(dir, "episode"), server.URL)
+	done := make(chan error, 1)
+	go func() { done <- d.DownloadToFile(ctx, task) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("\nExpected: %v\nGot:      %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("download didn't stop after cancel")
+	}
+
+	if _, err := os.Stat(task.FinalOutputPath()); !os.IsNotExist(err) {
+		t.Errorf("\nExpected: incomplete download removed\nGot:      %v", err)
+	}
+	server.CloseClientConnections()
+	expectNoLeakedGoroutines(t, baseline)
+}
+
+func TestDownloadToFileHosterHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// like the CDN of vidmoly, which refuses requests without its origin
+		if r.Header.Get("Origin") != "https://vidmoly.to" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("Referer") != "https://vidmoly.to/embed-abc.html" {
+			t.Errorf("\nExpected: %q\nGot:      %q", "https://vidmoly.to/embed-abc.html", r.Header.Get("Referer"))
+		}
+		w.Write([]byte("video"))
+	}))
+	defer server.Close()
+
+	d := NewDownloader("", false, 0)
+	path := filepath.Join(t.TempDir(), "episode.mp4")
+	// without a referer there is no origin to send either
+	task := NewDownloadTask(path, server.URL)
+	task.OutputPathHasExtension = true
+
+	var statusErr *ErrHTTPStatus
+	if err := d.DownloadToFile(context.Background(), task); !errors.As(err, &statusErr) || statusErr.Code != http.StatusForbidden {
+		t.Fatalf("\nExpected: 403 without the hoster\nGot:      %v", err)
+	}
+
+	// the referer the extractor found wins over the preset
+	if err := d.DownloadToFile(context.Background(), task.SetHoster("Vidmoly").SetReferer("https://vidmoly.to/embed-abc.html")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "video" {
+		t.Errorf("\nExpected: %q\nGot:      %q", "video", data)
+	}
+}
+
+func TestDownloadToFileReadTimeout(t *testing.T) {
+	body := strings.Repeat("x", 1000)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// half of the file, then nothing until the client gives up
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write([]byte(body[:500]))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		if r.Header.Get("Range") != "bytes=500-" {
+			t.Errorf("\nExpected: %q\nGot:      %q", "bytes=500-", r.Header.Get("Range"))
+		}
+		w.Header().Set("Content-Range", "bytes 500-999/1000")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(body[500:]))
+	}))
+	defer server.Close()
+
+	cfg := httpclient.DefaultConfig()
+	cfg.StallTimeout = 100 * time.Millisecond
+	d := NewDownloader("", false, 0)
+	d.SetHTTPClient(httpclient.New(cfg))
+	path := filepath.Join(t.TempDir(), "episode.mp4")
+	task := NewDownloadTask(path, server.URL)
+	task.OutputPathHasExtension = true
+
+	done := make(chan error, 1)
+	go func() { done <- d.DownloadToFile(context.Background(), task) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stalled download wasn't canceled")
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != body {
+		t.Errorf("\nExpected: %d bytes\nGot:      %d", len(body), len(data))
+	}
+	if requests.Load() != 2 {
+		t.Errorf("\nExpected: 2 requests\nGot:      %d", requests.Load())
+	}
+}
+
+func TestDisableFfmpeg(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".m3u8") {
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXTINF:4,\nseg1.ts\n#EXT-X-ENDLIST\n"))
+			return
+		}
+		w.Write([]byte(strings.TrimSuffix(filepath.Base(r.URL.Path), ".ts") + "|"))
+	}))
+	defer server.Close()
+
+	d := NewDownloader("", false, 0)
+	// never run, a disabled FFmpeg is not used even if it was found
+	d.SetFfmpegPath(filepath.Join(t.TempDir(), "ffmpeg"))
+	d.DisableFfmpeg()
+
+	task := NewDownloadTask(filepath.Join(t.TempDir(), "episode"), server.URL+"/index.m3u8")
+	if err := d.DownloadToFile(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	// the empty mp4 would count as the finished episode
+	if _, err := os.Stat(task.FinalOutputPath()); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("\nExpected: no placeholder mp4\nGot:      %v", err)
+	}
+	task.followFallback()
+	if expected := filepath.Join(filepath.Dir(task.OutputPath), "episode.ts"); task.FinalOutputPath() != expected {
+		t.Errorf("\nExpected: %s\nGot:      %s", expected, task.FinalOutputPath())
+	}
+	got, _ := os.ReadFile(task.FinalOutputPath())
+	if expected := "seg0|seg1|"; string(got) != expected {
+		t.Errorf("\nExpected: %s\nGot:      %s", expected, got)
+	}
+
+	err := d.DownloadParts(context.Background(), NewDownloadTask(filepath.Join(t.TempDir(), "parts"), server.URL), nil)
+	if !errors.Is(err, ErrFFmpegDisabled) || !errors.Is(err, ErrFFmpegRequired) {
+		t.Errorf("\nExpected: %v\nGot:      %v", ErrFFmpegDisabled, err)
+	}
+}
@@ -0,0 +1,33 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrHTTPStatus is returned if a server answered with anything but 200 OK, check for it with errors.As.
+type ErrHTTPStatus struct {
+	Code int
+	Url  string
+}
+
+func (e *ErrHTTPStatus) Error() string {
+	return fmt.Sprintf("bad status: %d %s", e.Code, http.StatusText(e.Code))
+}
+
+// ErrLiveStream is returned for HLS playlists without #EXT-X-ENDLIST, unless a maximum duration is set.
+// Such playlists are live or looping streams that would never finish.
+var ErrLiveStream = errors.New("playlist has no end, it is probably a live stream")
+
+// ErrLimitExceeded is returned if a download got stopped at the maximum duration or size, check for it with errors.As.
+// What was downloaded until then is kept.
+type ErrLimitExceeded struct {
+	// Limit is either "duration" or "size"
+	Limit string
+	Max   string
+}
+
+func (e *ErrLimitExceeded) Error() string {
+	return fmt.Sprintf("stopped at the maximum %s of %s", e.Limit, e.Max)
+}
@@ -0,0 +1,183 @@
+package download
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// ErrTooManyFailures is returned by ProgressDownloads once the FailurePolicy gave up on the run.
+var ErrTooManyFailures = errors.New("too many failed downloads")
+
+// FailedEpisode is a download that failed, one line of the --fail-summary file. Url, Season, Episode and Language
+// identify the episode, so --retry-file can download it again in a later run.
+type FailedEpisode struct {
+	Series string `json:"series"`
+	// Url is the page of the series the episode was scraped from
+	Url      string `json:"url"`
+	Season   uint32 `json:"season"`
+	Episode  uint32 `json:"episode"`
+	Language string `json:"language"`
+	// Dir is the absolute save directory of the series, empty in files of older versions
+	Dir    string `json:"dir,omitempty"`
+	Hoster string `json:"hoster,omitempty"`
+	Error  string `json:"error"`
+}
+
+// FailurePolicy collects the failed downloads of a run and decides when to give up, see --continue-on-error and
+// --max-failures. Like SizeBudget it is shared by the managers of a queue, so the limit applies to the whole run.
+type FailurePolicy struct {
+	continueOnError bool
+	maxFailures     int
+
+	mu      sync.Mutex
+	failed  []FailedEpisode
+	aborted chan struct{}
+}
+
+// NewFailurePolicy stops the run at the first failure without continueOnError, or once maxFailures downloads
+// failed. maxFailures 0 means no limit.
+func NewFailurePolicy(continueOnError bool, maxFailures int) *FailurePolicy {
+	return &FailurePolicy{continueOnError: continueOnError, maxFailures: maxFailures, aborted: make(chan struct{})}
+}
+
+// record adds a failure and reports whether the run goes on.
+func (p *FailurePolicy) record(f FailedEpisode) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failed = append(p.failed, f)
+	if p.continueOnError && (p.maxFailures <= 0 || len(p.failed) < p.maxFailures) {
+		return true
+	}
+	select {
+	case <-p.aborted:
+	default:
+		close(p.aborted)
+	}
+	return false
+}
+
+// Aborted is closed once the policy gave up on the run.
+func (p *FailurePolicy) Aborted() <-chan struct{} {
+	return p.aborted
+}
+
+// GaveUp reports whether the policy stopped the run.
+func (p *FailurePolicy) GaveUp() bool {
+	select {
+	case <-p.aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Failed returns the failed downloads so far, in the order they failed.
+func (p *FailurePolicy) Failed() []FailedEpisode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.failed)
+}
+
+// WriteFailSummary writes the failed downloads as JSON lines to path, replacing the file.
+func WriteFailSummary(path string, failed []FailedEpisode) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, f := range failed {
+		if err := enc.Encode(f); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReadFailSummary reads a file written by WriteFailSummary. Episodes listed more than once, e.g. the parts of a
+// split episode, are returned once.
+func ReadFailSummary(path string) ([]FailedEpisode, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var failed []FailedEpisode
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var f FailedEpisode
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if f.Url == "" {
+			return nil, fmt.Errorf("%s:%d: the episode has no series url", path, line)
+		}
+		if !slices.ContainsFunc(failed, f.sameEpisode) {
+			failed = append(failed, f)
+		}
+	}
+	return failed, scanner.Err()
+}
+
+func (f FailedEpisode) sameEpisode(other FailedEpisode) bool {
+	return f.Url == other.Url && f.Season == other.Season && f.Episode == other.Episode && f.Language == other.Language
+}
+
+// RetryGroup is the failed episodes of one series in one language, they are retried with one scrape.
+type RetryGroup struct {
+	Url      string
+	Dir      string
+	Language string
+	Episodes []FailedEpisode
+}
+
+// GroupFailures groups failed episodes by series and language, in the order the series first appear.
+func GroupFailures(failed []FailedEpisode) []RetryGroup {
+	var groups []RetryGroup
+	for _, f := range failed {
+		i := slices.IndexFunc(groups, func(g RetryGroup) bool {
+			return g.Url == f.Url && g.Language == f.Language && g.Dir == f.Dir
+		})
+		if i < 0 {
+			groups = append(groups, RetryGroup{Url: f.Url, Dir: f.Dir, Language: f.Language})
+			i = len(groups) - 1
+		}
+		groups[i].Episodes = append(groups[i].Episodes, f)
+	}
+	return groups
+}
+
+// Seasons returns the seasons of the group in ascending order, only they have to be scraped.
+func (g RetryGroup) Seasons() []uint32 {
+	var seasons []uint32
+	for _, f := range g.Episodes {
+		if !slices.Contains(seasons, f.Season) {
+			seasons = append(seasons, f.Season)
+		}
+	}
+	slices.Sort(seasons)
+	return seasons
+}
+
+// Includes reports whether the episode is one of the group, for DownloadSettings.EpisodeFilter.
+func (g RetryGroup) Includes(season, episode uint32) bool {
+	return slices.ContainsFunc(g.Episodes, func(f FailedEpisode) bool {
+		return f.Season == season && f.Episode == episode
+	})
+}
@@ -0,0 +1,75 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestFailSummaryRoundTrip(t *testing.T) {
+	failed := []FailedEpisode{
+		{Series: "Frieren", Url: "https://aniworld.to/anime/stream/frieren", Season: 1, Episode: 3, Language: "GerSub", Dir: "/media/Frieren", Hoster: "VOE", Error: "status 403"},
+		{Series: "Frieren", Url: "https://aniworld.to/anime/stream/frieren", Season: 0, Episode: 1, Language: "GerDub,GerSub", Error: "no hoster"},
+		// the second part of a split episode fails on its own
+		{Series: "Frieren", Url: "https://aniworld.to/anime/stream/frieren", Season: 1, Episode: 3, Language: "GerSub", Dir: "/media/Frieren", Hoster: "Vidoza", Error: "timeout"},
+	}
+	path := filepath.Join(t.TempDir(), "failed.jsonl")
+	if err := WriteFailSummary(path, failed); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadFailSummary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, failed[:2]) {
+		t.Errorf("\nExpected: %+v\nGot:      %+v", failed[:2], got)
+	}
+
+	// blank lines are fine, broken ones point to their line
+	os.WriteFile(path, []byte("\n{\"url\":\"https://aniworld.to/anime/stream/frieren\",\"season\":1,\"episode\":2}\n{\"season\":1}\n"), 0644)
+	if _, err := ReadFailSummary(path); err == nil || err.Error() != path+":3: the episode has no series url" {
+		t.Errorf("\nExpected: %s:3: the episode has no series url\nGot:      %v", path, err)
+	}
+	os.WriteFile(path, []byte("{\"url\":"), 0644)
+	if _, err := ReadFailSummary(path); err == nil {
+		t.Errorf("\nExpected: an error for broken JSON\nGot:      nil")
+	}
+}
+
+func TestGroupFailures(t *testing.T) {
+	const frieren, overlord = "https://aniworld.to/anime/stream/frieren", "https://aniworld.to/anime/stream/overlord"
+	failed := []FailedEpisode{
+		{Url: frieren, Season: 2, Episode: 1, Language: "GerSub"},
+		{Url: overlord, Season: 1, Episode: 5, Language: "GerDub"},
+		{Url: frieren, Season: 1, Episode: 3, Language: "GerSub"},
+		{Url: frieren, Season: 1, Episode: 4, Language: "GerDub"},
+	}
+
+	groups := GroupFailures(failed)
+	tests := []struct {
+		url      string
+		language string
+		seasons  []uint32
+		episodes int
+	}{
+		{frieren, "GerSub", []uint32{1, 2}, 2},
+		{overlord, "GerDub", []uint32{1}, 1},
+		{frieren, "GerDub", []uint32{1}, 1},
+	}
+	if len(groups) != len(tests) {
+		t.Fatalf("\nExpected: %d groups\nGot:      %+v", len(tests), groups)
+	}
+	for i, tt := range tests {
+		g := groups[i]
+		if g.Url != tt.url || g.Language != tt.language || !slices.Equal(g.Seasons(), tt.seasons) || len(g.Episodes) != tt.episodes {
+			t.Errorf("\nExpected: %s %s %v %d episodes\nGot:      %s %s %v %d episodes", tt.url, tt.language, tt.seasons, tt.episodes,
+				g.Url, g.Language, g.Seasons(), len(g.Episodes))
+		}
+	}
+	if !groups[0].Includes(1, 3) || groups[0].Includes(1, 4) {
+		t.Errorf("\nExpected: only S01E03 of season 1 in the group\nGot:      %+v", groups[0].Episodes)
+	}
+}
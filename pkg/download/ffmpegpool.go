@@ -0,0 +1,154 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultFfmpegHwConcurrency is the number of FFmpeg processes that may use a hardware encoder or decoder at once.
+// Consumer GPUs only allow a few sessions, more of them fail instead of waiting.
+const DefaultFfmpegHwConcurrency = 2
+
+// hwArgMarkers are parts of FFmpeg arguments that open a hardware session, e.g. "-c:v h264_nvenc" or "-hwaccel cuda".
+var hwArgMarkers = []string{"-hwaccel", "_nvenc", "_cuvid", "_qsv", "_vaapi", "_videotoolbox", "_amf", "_v4l2m2m"}
+
+// ffmpegPool bounds the FFmpeg processes of all downloads, e.g. when many episodes finish at the same time.
+// Commands with a hardware session take a slot of the smaller hardware limit as well.
+type ffmpegPool struct {
+	slots   chan struct{}
+	hwSlots chan struct{}
+	running atomic.Int32
+	waiting atomic.Int32
+}
+
+// newFfmpegPool creates a pool for cpu processes at once, hw of them with a hardware session. 0 uses the number of
+// CPUs and DefaultFfmpegHwConcurrency.
+func newFfmpegPool(cpu, hw int) *ffmpegPool {
+	if cpu <= 0 {
+		cpu = runtime.NumCPU()
+	}
+	if hw <= 0 {
+		hw = DefaultFfmpegHwConcurrency
+	}
+	return &ffmpegPool{slots: make(chan struct{}, cpu), hwSlots: make(chan struct{}, min(hw, cpu))}
+}
+
+// acquire waits for a free slot and returns the function that gives it back.
+func (p *ffmpegPool) acquire(ctx context.Context, hw bool) (func(), error) {
+	p.waiting.Add(1)
+	defer p.waiting.Add(-1)
+
+	// the hardware slot comes first, so a command waiting for it doesn't keep a slot from the others
+	if hw {
+		select {
+		case p.hwSlots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		if hw {
+			<-p.hwSlots
+		}
+		return nil, ctx.Err()
+	}
+
+	p.running.Add(1)
+	return func() {
+		p.running.Add(-1)
+		<-p.slots
+		if hw {
+			<-p.hwSlots
+		}
+	}, nil
+}
+
+// status describes the FFmpeg processes for the total bar, it is empty while none are running or waiting.
+func (p *ffmpegPool) status() string {
+	running, waiting := p.running.Load(), p.waiting.Load()
+	switch {
+	case running == 0 && waiting == 0:
+		return ""
+	case waiting == 0:
+		return fmt.Sprintf(" | muxing %d", running)
+	default:
+		return fmt.Sprintf(" | muxing %d, %d waiting", running, waiting)
+	}
+}
+
+// usesHardware reports whether FFmpeg opens a hardware session with args. gad itself doesn't use one, only the
+// arguments from SetFfmpegArgs are checked so file names can't match.
+func usesHardware(args []string) bool {
+	for _, arg := range args {
+		for _, marker := range hwArgMarkers {
+			if strings.Contains(arg, marker) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetFfmpegConcurrency limits how many FFmpeg processes run at once and how many of them may use a hardware encoder
+// or decoder. 0 uses the number of CPUs and DefaultFfmpegHwConcurrency. Set it before starting downloads.
+func (d *Downloader) SetFfmpegConcurrency(cpu, hw int) {
+	d.ffmpeg = newFfmpegPool(cpu, hw)
+}
+
+// runFfmpeg runs FFmpeg with args, the last one is the output. mp4 outputs that fail to seek, e.g. on a network
+// share, are written again as fragmented mp4 and so are all later ones.
+func (d *Downloader) runFfmpeg(ctx context.Context, args []string) error {
+	output := args[len(args)-1]
+	if !NeedsSeek(output) {
+		return d.execFfmpeg(ctx, args)
+	}
+	if d.noSeekOutput.Load() {
+		return d.execFfmpeg(ctx, StreamableArgs(args))
+	}
+	err := d.execFfmpeg(ctx, args)
+	var ffErr *ffmpegError
+	if err == nil || ctx.Err() != nil || !errors.As(err, &ffErr) || !IsSeekError(ffErr.output) {
+		return err
+	}
+	slog.Warn("The output can't seek, writing fragmented mp4 files from now on. --no-seek-output skips the failing attempt",
+		"file", filepath.Base(output), "error", err)
+	d.noSeekOutput.Store(true)
+	if err := d.execFfmpeg(ctx, StreamableArgs(args)); err != nil {
+		return fmt.Errorf("the output can't seek and the fragmented mp4 failed as well, set --temp-dir to a local disk: %w", err)
+	}
+	return nil
+}
+
+// execFfmpeg runs FFmpeg with args once a slot of the pool is free.
+func (d *Downloader) execFfmpeg(ctx context.Context, args []string) error {
+	hw := usesHardware(d.ffmpegArgs)
+	release, err := d.ffmpeg.acquire(ctx, hw)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	slog.Debug("Running FFmpeg", "hardware", hw, "running", d.ffmpeg.running.Load(), "waiting", d.ffmpeg.waiting.Load())
+	cmd := exec.CommandContext(ctx, d.ffmpegPath, args...)
+	output := &tailBuffer{max: 4096}
+	cmd.Stderr = output
+	if d.debug {
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = io.MultiWriter(os.Stderr, output)
+	}
+	if err := cmd.Run(); err != nil {
+		return &ffmpegError{err: err, output: string(output.buf)}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package download
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFfmpegPoolLimits(t *testing.T) {
+	pool := newFfmpegPool(2, 1)
+	ctx := context.Background()
+
+	releaseHw, err := pool.acquire(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the only hardware slot is taken
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	if _, err := pool.acquire(timeout, true); err == nil {
+		t.Errorf("\nExpected: a second hardware session to wait\nGot:      %v", err)
+	}
+	cancel()
+
+	release, err := pool.acquire(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pool.status(); got != " | muxing 2" {
+		t.Errorf("\nExpected: %q\nGot:      %q", " | muxing 2", got)
+	}
+	timeout, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+	if _, err := pool.acquire(timeout, false); err == nil {
+		t.Errorf("\nExpected: a third process to wait\nGot:      %v", err)
+	}
+	cancel()
+
+	releaseHw()
+	release()
+	if got := pool.status(); got != "" {
+		t.Errorf("\nExpected: %q\nGot:      %q", "", got)
+	}
+	if len(pool.slots) != 0 || len(pool.hwSlots) != 0 {
+		t.Errorf("\nExpected: all slots free\nGot:      %d %d", len(pool.slots), len(pool.hwSlots))
+	}
+}
+
+func TestUsesHardware(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected bool
+	}{
+		{nil, false},
+		{[]string{"-c:v", "libx264", "-crf", "23"}, false},
+		{[]string{"-c:v", "h264_nvenc"}, true},
+		{[]string{"-hwaccel", "cuda"}, true},
+		{[]string{"-c:v", "hevc_videotoolbox"}, true},
+		{[]string{"-vcodec", "h264_qsv"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := usesHardware(tt.args); got != tt.expected {
+			t.Errorf("%v\nExpected: %v\nGot:      %v", tt.args, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package download
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/bugmaschine/gad/pkg/utils"
+)
+
+// FolderStrategy is how the title of a series is compared with the folders already in the save directory.
+type FolderStrategy int
+
+const (
+	// FolderExact only reuses a folder named exactly like the cleaned title.
+	FolderExact FolderStrategy = iota
+	// FolderNormalized ignores case, punctuation and spacing.
+	FolderNormalized
+	// FolderTokenRatio compares the words of the normalized names, in any order.
+	FolderTokenRatio
+	// FolderLevenshtein compares the normalized names letter by letter, for typos and small spelling differences.
+	FolderLevenshtein
+)
+
+// FolderMatch is the value of --folder-match. A folder is reused if its score reaches Threshold, between 0 and 1.
+type FolderMatch struct {
+	Strategy  FolderStrategy
+	Threshold float64
+}
+
+// DefaultFolderMatch is used if --folder-match is empty.
+var DefaultFolderMatch = FolderMatch{Strategy: FolderTokenRatio, Threshold: 0.8}
+
+var folderStrategies = []struct {
+	name      string
+	strategy  FolderStrategy
+	threshold float64
+}{
+	{"exact", FolderExact, 1},
+	{"normalized", FolderNormalized, 1},
+	{"token-ratio", FolderTokenRatio, 0.8},
+	{"levenshtein", FolderLevenshtein, 0.85},
+}
+
+// ParseFolderMatch parses the value of --folder-match, a strategy optionally followed by a threshold like
+// "levenshtein:0.9".
+func ParseFolderMatch(s string) (FolderMatch, error) {
+	if s == "" {
+		return DefaultFolderMatch, nil
+	}
+	name, threshold, hasThreshold := strings.Cut(strings.ToLower(s), ":")
+	for _, candidate := range folderStrategies {
+		if candidate.name != name {
+			continue
+		}
+		match := FolderMatch{Strategy: candidate.strategy, Threshold: candidate.threshold}
+		if hasThreshold {
+			value, err := strconv.ParseFloat(threshold, 64)
+			if err != nil || value <= 0 || value > 1 {
+				return FolderMatch{}, fmt.Errorf("invalid folder match threshold %q, expected a number above 0 and up to 1", threshold)
+			}
+			match.Threshold = value
+		}
+		return match, nil
+	}
+	return FolderMatch{}, fmt.Errorf("invalid folder match %q, expected one of exact, normalized, token-ratio, levenshtein", s)
+}
+
+func (s FolderStrategy) String() string {
+	for _, candidate := range folderStrategies {
+		if candidate.strategy == s {
+			return candidate.name
+		}
+	}
+	return "unknown"
+}
+
+// Score returns how similar the folder name is to the title, from 0 to 1. Folders created by gad hold the cleaned
+// title, which drops characters like colons, so both the title and its cleaned form are compared.
+func (m FolderMatch) Score(title, folder string) float64 {
+	cleaned := utils.CleanFolderName(title)
+	if m.Strategy == FolderExact {
+		if cleaned == folder {
+			return 1
+		}
+		return 0
+	}
+	return max(m.normalizedScore(title, folder), m.normalizedScore(cleaned, folder))
+}
+
+func (m FolderMatch) normalizedScore(title, folder string) float64 {
+	titleWords, folderWords := normalizeFolderName(title), normalizeFolderName(folder)
+	switch m.Strategy {
+	case FolderTokenRatio:
+		return tokenRatio(titleWords, folderWords)
+	case FolderLevenshtein:
+		return levenshteinRatio(strings.Join(titleWords, " "), strings.Join(folderWords, " "))
+	default:
+		if strings.Join(titleWords, " ") == strings.Join(folderWords, " ") {
+			return 1
+		}
+		return 0
+	}
+}
+
+// Best returns the folder most similar to the title and its score. Below the threshold there is no match, and the
+// name is empty. Ties go to the first folder.
+func (m FolderMatch) Best(title string, folders []string) (string, float64) {
+	best, bestScore := "", 0.0
+	for _, folder := range folders {
+		if score := m.Score(title, folder); score >= m.Threshold && score > bestScore {
+			best, bestScore = folder, score
+		}
+	}
+	return best, bestScore
+}
+
+// FindSeriesFolder returns the folder in dir that holds the series with the title, or "" if there is none.
+func (m FolderMatch) FindSeriesFolder(dir, title string) (string, float64, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	var folders []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			folders = append(folders, entry.Name())
+		}
+	}
+	name, score := m.Best(title, folders)
+	return name, score, nil
+}
+
+// normalizeFolderName splits name into lower case words, dropping punctuation. Apostrophes join the letters around
+// them, so "Frieren's" stays one word.
+func normalizeFolderName(name string) []string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case r == '\'' || r == '’':
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Fields(b.String())
+}
+
+// tokenRatio is the share of words both names have, counting repeated words as often as they appear in both.
+func tokenRatio(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	counts := make(map[string]int, len(a))
+	for _, word := range a {
+		counts[word]++
+	}
+	common := 0
+	for _, word := range b {
+		if counts[word] > 0 {
+			counts[word]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(a)+len(b))
+}
+
+// levenshteinRatio is 1 minus the edit distance of a and b relative to the longer of both.
+func levenshteinRatio(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 0
+	}
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
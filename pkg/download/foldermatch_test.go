@@ -0,0 +1,111 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFolderMatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected FolderMatch
+		wantErr  bool
+	}{
+		{"", DefaultFolderMatch, false},
+		{"exact", FolderMatch{FolderExact, 1}, false},
+		{"Normalized", FolderMatch{FolderNormalized, 1}, false},
+		{"token-ratio", FolderMatch{FolderTokenRatio, 0.8}, false},
+		{"levenshtein:0.9", FolderMatch{FolderLevenshtein, 0.9}, false},
+		{"levenshtein:0", FolderMatch{}, true},
+		{"token-ratio:1.5", FolderMatch{}, true},
+		{"soundex", FolderMatch{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFolderMatch(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.expected {
+			t.Errorf("%q\nExpected: %+v (error %v)\nGot:      %+v (%v)", tt.input, tt.expected, tt.wantErr, got, err)
+		}
+	}
+}
+
+func TestFolderMatchBest(t *testing.T) {
+	// the site renamed the series after the first run, the colon and the apostrophe changed
+	const title = "Frieren: Beyond Journey's End"
+	folders := []string{"Frieren - Beyond Journey’s End", "Sousou no Frieren", "The Eminence in Shadow"}
+
+	tests := []struct {
+		match    string
+		expected string
+	}{
+		{"exact", ""},
+		{"normalized", "Frieren - Beyond Journey’s End"},
+		{"token-ratio", "Frieren - Beyond Journey’s End"},
+		{"levenshtein", "Frieren - Beyond Journey’s End"},
+	}
+
+	for _, tt := range tests {
+		match, err := ParseFolderMatch(tt.match)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, score := match.Best(title, folders)
+		if got != tt.expected {
+			t.Errorf("%s\nExpected: %q\nGot:      %q (%.2f)", tt.match, tt.expected, got, score)
+		}
+		if got == "" && score != 0 {
+			t.Errorf("%s\nExpected: no score without a match\nGot:      %.2f", tt.match, score)
+		}
+	}
+}
+
+func TestFolderMatchBelowThreshold(t *testing.T) {
+	// sequels share most words with the first season, they must not land in its folder
+	folders := []string{"Overlord", "Attack on Titan"}
+
+	tests := []struct {
+		match string
+		title string
+	}{
+		{"exact", "Overlord II"},
+		{"normalized", "Overlord II"},
+		{"token-ratio", "Overlord II"},
+		{"levenshtein", "Overlord II"},
+		{"token-ratio", "Attack on Titan Junior High"},
+		{"levenshtein", "Attack on Titan Junior High"},
+	}
+
+	for _, tt := range tests {
+		match, _ := ParseFolderMatch(tt.match)
+		if got, score := match.Best(tt.title, folders); got != "" || score != 0 {
+			t.Errorf("%s %q\nExpected: no match\nGot:      %q (%.2f)", tt.match, tt.title, got, score)
+		}
+	}
+}
+
+func TestFindSeriesFolder(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "Re Zero - Starting Life in Another World"), 0755)
+	os.WriteFile(filepath.Join(dir, "Re Zero - Starting Life in Another World 2"), nil, 0644)
+
+	got, _, err := DefaultFolderMatch.FindSeriesFolder(dir, "Re:Zero - Starting Life in Another World")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// files are never taken for the folder
+	if got != "Re Zero - Starting Life in Another World" {
+		t.Errorf("\nExpected: %q\nGot:      %q", "Re Zero - Starting Life in Another World", got)
+	}
+
+	// the folder earlier versions created from the cleaned title
+	dir = t.TempDir()
+	os.Mkdir(filepath.Join(dir, "ReZero - Starting Life in Another World"), 0755)
+	if got, _, _ := DefaultFolderMatch.FindSeriesFolder(dir, "Re:Zero - Starting Life in Another World"); got != "ReZero - Starting Life in Another World" {
+		t.Errorf("\nExpected: %q\nGot:      %q", "ReZero - Starting Life in Another World", got)
+	}
+
+	if got, _, err := DefaultFolderMatch.FindSeriesFolder(filepath.Join(dir, "missing"), "Overlord"); got != "" || err != nil {
+		t.Errorf("\nExpected: no match in a missing directory\nGot:      %q (%v)", got, err)
+	}
+}
@@ -0,0 +1,27 @@
+package download
+
+import (
+	"context"
+	"net/http"
+)
+
+type headersKey struct{}
+
+// withHeaders makes every request of the download below ctx send headers, see DownloadTask.SetHoster.
+func withHeaders(ctx context.Context, headers http.Header) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, headersKey{}, headers)
+}
+
+// applyHeaders adds the headers of ctx to req. Headers req already has are kept, e.g. the referer the extractor
+// found is more specific than the preset of its hoster.
+func applyHeaders(ctx context.Context, req *http.Request) {
+	headers, _ := ctx.Value(headersKey{}).(http.Header)
+	for key, values := range headers {
+		if req.Header.Get(key) == "" {
+			req.Header[key] = values
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package download
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bugmaschine/gad/pkg/utils"
+	"github.com/grafov/m3u8"
+)
+
+// hlsPartsSuffix is appended to the output path for the temporary segment directory.
+const hlsPartsSuffix = ".parts"
+
+// hlsAudioSuffix marks the separate audio rendition of a HLS download until it is muxed with the video, e.g.
+// "<name>.audio.mp4".
+const hlsAudioSuffix = ".audio"
+
+// hlsParts collects the segments of a HLS download in a temporary directory. A new part is started at every
+// discontinuity and every change of the init section, ffmpeg's concat demuxer then fixes up the timestamps
+// between the parts. Simply appending everything to one file breaks playback for streams with ads or codec changes.
+type hlsParts struct {
+	dir   string
+	files []string
+	// sizes and heads of the files are recorded by save, see hlsProgress
+	sizes   []int64
+	heads   [][]byte
+	current *os.File
+	// playlist is the fingerprint of the media playlist the segments are of, see openHlsParts
+	playlist string
+	// stream receives the segments instead of the files, see newHlsStream
+	stream    io.Writer
+	streaming bool
+}
+
+func newHlsParts(dir string) (*hlsParts, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &hlsParts{dir: dir}, nil
+}
+
+// newHlsStream returns parts that pass every segment straight on to w instead of collecting them, for downloads to
+// a pipe. Nothing is recorded to resume.
+func newHlsStream(w io.Writer) *hlsParts {
+	return &hlsParts{stream: w}
+}
+
+// started reports whether a part is open for the next segment.
+func (p *hlsParts) started() bool {
+	return p.current != nil || p.streaming
+}
+
+// start closes the current part and opens the next one. fMP4 streams have an init section, which has to be at the
+// beginning of every part.
+func (p *hlsParts) start(init []byte) error {
+	if p.stream != nil {
+		p.streaming = true
+		_, err := p.stream.Write(init)
+		return err
+	}
+	if err := p.close(); err != nil {
+		return err
+	}
+
+	ext := ".ts"
+	if init != nil {
+		ext = ".mp4"
+	}
+	name := fmt.Sprintf("part_%05d%s", len(p.files), ext)
+
+	f, err := os.Create(filepath.Join(p.dir, name))
+	if err != nil {
+		return err
+	}
+	p.current = f
+	p.files = append(p.files, name)
+	p.sizes = append(p.sizes, 0)
+	p.heads = append(p.heads, nil)
+
+	if init != nil {
+		if _, err := p.Write(init); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *hlsParts) Write(b []byte) (int, error) {
+	if p.stream != nil {
+		p.streaming = true
+		return p.stream.Write(b)
+	}
+	if p.current == nil {
+		if err := p.start(nil); err != nil {
+			return 0, err
+		}
+	}
+	n, err := p.current.Write(b)
+	last := len(p.files) - 1
+	p.sizes[last] += int64(n)
+	if head := p.heads[last]; len(head) < hlsHeadSize {
+		p.heads[last] = append(head, b[:min(n, hlsHeadSize-len(head))]...)
+	}
+	return n, err
+}
+
+func (p *hlsParts) close() error {
+	if p.current == nil {
+		return nil
+	}
+	err := p.current.Close()
+	p.current = nil
+	return err
+}
+
+// writeConcatList writes the list for ffmpeg's concat demuxer and returns its path.
+func (p *hlsParts) writeConcatList() (string, error) {
+	var sb strings.Builder
+	sb.WriteString("ffconcat version 1.0\n")
+	for _, name := range p.files {
+		// paths are relative to the list, the names never contain quotes
+		sb.WriteString(fmt.Sprintf("file '%s'\n", name))
+	}
+
+	path := filepath.Join(p.dir, "list.ffconcat")
+	return path, os.WriteFile(path, []byte(sb.String()), 0644)
+}
+
+// concatInto appends all parts into one file, used if there is no ffmpeg to do it properly.
+func (p *hlsParts) concatInto(path string) error {
+	target, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	for _, name := range p.files {
+		f, err := os.Open(filepath.Join(p.dir, name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(target, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return target.Close()
+}
+
+// removeSegments deletes the segment directory of a download, or logs where it is with SetKeepSegments.
+func (d *Downloader) removeSegments(dir string) {
+	if d.keepSegments {
+		slog.Info("Keeping segments", "path", dir)
+		return
+	}
+	if err := utils.RemoveDirAllIgnoreNotExists(dir); err != nil {
+		slog.Warn("Failed to remove segment directory", "path", dir, "error", err)
+	}
+}
+
+// fetchInit downloads the init section of a fMP4 stream.
+func (d *Downloader) fetchInit(ctx context.Context, m *m3u8.Map, playlist *url.URL, referer string) ([]byte, error) {
+	initURL, err := playlist.Parse(m.URI)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.fetchBytes(ctx, initURL.String(), referer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download init section: %w", err)
+	}
+
+	if m.Limit > 0 {
+		if m.Offset+m.Limit > int64(len(data)) {
+			return nil, fmt.Errorf("init section byte range %d@%d is out of bounds", m.Limit, m.Offset)
+		}
+		data = data[m.Offset : m.Offset+m.Limit]
+	}
+	return data, nil
+}
+
+// hlsDecrypter tracks the EXT-X-KEY in effect for the following segments. Keys are cached by URI,
+// as some streams rotate between a few keys.
+type hlsDecrypter struct {
+	keys map[string][]byte
+	// key is nil while the segments aren't encrypted
+	key []byte
+	// iv is nil if it has to be derived from the media sequence number
+	iv []byte
+}
+
+func newHlsDecrypter() *hlsDecrypter {
+	return &hlsDecrypter{keys: make(map[string][]byte)}
+}
+
+// update switches to the given key, fetching it with the referer of the stream if it wasn't seen before.
+func (h *hlsDecrypter) update(ctx context.Context, d *Downloader, key *m3u8.Key, playlist *url.URL, referer string) error {
+	switch strings.ToUpper(key.Method) {
+	case "", "NONE":
+		h.key, h.iv = nil, nil
+		return nil
+	case "AES-128":
+	default:
+		return fmt.Errorf("unsupported encryption method: %s", key.Method)
+	}
+
+	keyURL, err := playlist.Parse(key.URI)
+	if err != nil {
+		return err
+	}
+
+	k, ok := h.keys[keyURL.String()]
+	if !ok {
+		k, err = d.fetchBytes(ctx, keyURL.String(), referer)
+		if err != nil {
+			return fmt.Errorf("failed to download key: %w", err)
+		}
+		if len(k) != aes.BlockSize {
+			return fmt.Errorf("invalid AES-128 key length %d", len(k))
+		}
+		h.keys[keyURL.String()] = k
+	}
+
+	var iv []byte
+	if key.IV != "" {
+		iv, err = hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(key.IV, "0x"), "0X"))
+		if err != nil || len(iv) != aes.BlockSize {
+			return fmt.Errorf("invalid IV %q", key.IV)
+		}
+	}
+
+	h.key, h.iv = k, iv
+	return nil
+}
+
+// decrypt returns the plain segment, seq is its media sequence number which is the IV if none was given.
+func (h *hlsDecrypter) decrypt(data []byte, seq uint64) ([]byte, error) {
+	if h.key == nil {
+		return data, nil
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted segment size %d is not a multiple of the block size", len(data))
+	}
+
+	iv := h.iv
+	if iv == nil {
+		iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], seq)
+	}
+
+	block, err := aes.NewCipher(h.key)
+	if err != nil {
+		return nil, err
+	}
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	// strip the PKCS7 padding, broken padding almost always means a wrong key or IV
+	paddingLen := int(decrypted[len(decrypted)-1])
+	if paddingLen == 0 || paddingLen > aes.BlockSize {
+		return nil, fmt.Errorf("invalid padding, wrong key or IV")
+	}
+	for _, b := range decrypted[len(decrypted)-paddingLen:] {
+		if int(b) != paddingLen {
+			return nil, fmt.Errorf("invalid padding, wrong key or IV")
+		}
+	}
+	return decrypted[:len(decrypted)-paddingLen], nil
+}
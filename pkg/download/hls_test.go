@@ -0,0 +1,384 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHlsParts(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "episode.mp4.parts")
+	parts, err := newHlsParts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a plain TS part, then a discontinuity with a fMP4 init section
+	parts.Write([]byte("ts1"))
+	parts.Write([]byte("ts2"))
+	if err := parts.start([]byte("init")); err != nil {
+		t.Fatal(err)
+	}
+	parts.Write([]byte("frag"))
+	if err := parts.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFiles := []string{"part_00000.ts", "part_00001.mp4"}
+	if !slices.Equal(parts.files, expectedFiles) {
+		t.Errorf("\nExpected: %v\nGot:      %v", expectedFiles, parts.files)
+	}
+
+	listPath, err := parts.writeConcatList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, _ := os.ReadFile(listPath)
+	expectedList := "ffconcat version 1.0\nfile 'part_00000.ts'\nfile 'part_00001.mp4'\n"
+	if string(list) != expectedList {
+		t.Errorf("\nExpected: %q\nGot:      %q", expectedList, list)
+	}
+
+	out := filepath.Join(t.TempDir(), "episode.ts")
+	if err := parts.concatInto(out); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(out)
+	if string(got) != "ts1ts2initfrag" {
+		t.Errorf("\nExpected: %q\nGot:      %q", "ts1ts2initfrag", got)
+	}
+}
+
+// encryptSegment is the fixture side of AES-128 HLS: PKCS7 padding and CBC.
+func encryptSegment(t *testing.T, plain, key, iv []byte) []byte {
+	t.Helper()
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	padded := append(slices.Clone(plain), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, padded)
+	return encrypted
+}
+
+func TestHlsAES128(t *testing.T) {
+	key1 := []byte("0123456789abcdef")
+	key2 := []byte("fedcba9876543210")
+	explicitIV, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	// without an IV attribute the media sequence number is used, the playlist starts at 7
+	derivedIV := make([]byte, aes.BlockSize)
+	derivedIV[15] = 8
+
+	plain := [][]byte{
+		[]byte("first segment, explicit IV"),
+		[]byte("second segment, rotated key and derived IV"),
+		[]byte("third segment, not encrypted"),
+	}
+
+	playlist := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:7
+#EXT-X-KEY:METHOD=AES-128,URI="key1.bin",IV=0x000102030405060708090a0b0c0d0e0f
+#EXTINF:4.0,
+seg0.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key2.bin"
+#EXTINF:4.0,
+seg1.ts
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:4.0,
+seg2.ts
+#EXT-X-ENDLIST
+`
+	files := map[string][]byte{
+		"/index.m3u8": []byte(playlist),
+		"/key1.bin":   key1,
+		"/key2.bin":   key2,
+		"/seg0.ts":    encryptSegment(t, plain[0], key1, explicitIV),
+		"/seg1.ts":    encryptSegment(t, plain[1], key2, derivedIV),
+		"/seg2.ts":    plain[2],
+	}
+
+	keyRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, ".bin") {
+			keyRequests++
+			// keys are usually protected by the referer of the player
+			if r.Header.Get("Referer") != "https://player.example.com/" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
+		if strings.HasSuffix(r.URL.Path, ".m3u8") {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	d := NewDownloader("", false, 0)
+	task := NewDownloadTask(filepath.Join(dir, "episode"), server.URL+"/index.m3u8").
+		SetReferer("https://player.example.com/")
+	if err := d.DownloadToFile(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+
+	// no ffmpeg, so the raw stream is kept
+	got, err := os.ReadFile(filepath.Join(dir, "episode.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := bytes.Join(plain, nil)
+	if !bytes.Equal(got, expected) {
+		t.Errorf("\nExpected: %q\nGot:      %q", expected, got)
+	}
+	if keyRequests != 2 {
+		t.Errorf("\nExpected: 2 key requests\nGot:      %d", keyRequests)
+	}
+}
+
+func TestHlsDecryptWrongKey(t *testing.T) {
+	iv := make([]byte, aes.BlockSize)
+	encrypted := encryptSegment(t, []byte("some segment data"), []byte("0123456789abcdef"), iv)
+
+	h := newHlsDecrypter()
+	h.key, h.iv = []byte("not the real key"), iv
+	if _, err := h.decrypt(encrypted, 0); err == nil {
+		t.Errorf("expected an error for a wrong key")
+	}
+}
+
+func TestHlsLiveStream(t *testing.T) {
+	// no #EXT-X-ENDLIST, like a live or looping stream
+	playlist := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.0,
+seg0.ts
+#EXTINF:10.0,
+seg1.ts
+#EXTINF:10.0,
+seg2.ts
+`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.m3u8" {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Write([]byte(playlist))
+			return
+		}
+		w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/")))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		maxDuration time.Duration
+		expected    string
+	}{
+		// refused without a limit
+		{0, ""},
+		{15 * time.Second, "seg0.tsseg1.ts"},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		d := NewDownloader("", false, 0)
+		d.SetMaxDuration(tt.maxDuration)
+		err := d.DownloadToFile(context.Background(), NewDownloadTask(filepath.Join(dir, "episode"), server.URL+"/index.m3u8"))
+
+		if tt.maxDuration == 0 {
+			if !errors.Is(err, ErrLiveStream) {
+				t.Errorf("\nExpected: %v\nGot:      %v", ErrLiveStream, err)
+			}
+			continue
+		}
+
+		var limitErr *ErrLimitExceeded
+		if !errors.As(err, &limitErr) || limitErr.Limit != "duration" {
+			t.Fatalf("\nExpected: duration limit\nGot:      %v", err)
+		}
+		got, _ := os.ReadFile(filepath.Join(dir, "episode.ts"))
+		if string(got) != tt.expected {
+			t.Errorf("\nExpected: %q\nGot:      %q", tt.expected, got)
+		}
+	}
+}
+
+func TestHlsCancel(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:4
+#EXTINF:4.0,
+seg0.ts
+#EXTINF:4.0,
+seg1.ts
+#EXT-X-ENDLIST
+`
+	stalled, started := stallingServer(t, "", []byte("part of seg1"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Write([]byte(strings.Replace(playlist, "seg1.ts", stalled.URL+"/seg1.ts", 1)))
+		case "/seg0.ts":
+			w.Write([]byte("seg0"))
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	dir := t.TempDir()
+	d := NewDownloader("", false, 0)
+	err := d.DownloadToFile(ctx, NewDownloadTask(filepath.Join(dir, "episode"), server.URL+"/index.m3u8"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("\nExpected: %v\nGot:      %v", context.Canceled, err)
+	}
+
+	// the output isn't left behind, the segment directory is kept to resume
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "episode.mp4"+hlsPartsSuffix {
+		t.Errorf("\nExpected: only the segment directory\nGot:      %v", entries)
+	}
+}
+
+func TestHlsResume(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	iv := make([]byte, aes.BlockSize)
+	plain := [][]byte{[]byte("seg0"), []byte("seg1, the key was set by seg0"), []byte("seg2")}
+	// the key is only set before the first segment, the resumed one has to pick it up
+	playlist := `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin",IV=0x00000000000000000000000000000000
+#EXTINF:4.0,
+seg0.ts?token=%[1]s
+#EXTINF:4.0,
+seg1.ts?token=%[1]s
+#EXTINF:4.0,
+seg2.ts?token=%[1]s
+#EXT-X-ENDLIST
+`
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	broken := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/index.m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			// a new token for every resolve doesn't make it another stream
+			fmt.Fprintf(w, playlist, strconv.Itoa(requests[r.URL.Path]))
+		case "/key.bin":
+			w.Write(key)
+		case "/seg2.ts":
+			if broken {
+				http.NotFound(w, r)
+				return
+			}
+			fallthrough
+		default:
+			i, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/seg"), ".ts"))
+			w.Write(encryptSegment(t, plain[i], key, iv))
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	d := NewDownloader("", false, 0)
+	d.SetSegmentRetries(0)
+	task := NewDownloadTask(filepath.Join(dir, "episode"), server.URL+"/index.m3u8").SetOverwriteFile(true)
+	if err := d.DownloadToFile(context.Background(), task); err == nil {
+		t.Fatal("\nExpected: the broken segment to fail the download\nGot:      nil")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "episode.mp4"+hlsPartsSuffix, hlsProgressName)); err != nil {
+		t.Fatalf("\nExpected: the progress to be kept\nGot:      %v", err)
+	}
+
+	mu.Lock()
+	broken = false
+	mu.Unlock()
+	if err := d.DownloadToFile(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(dir, "episode.ts"))
+	if expected := bytes.Join(plain, nil); !bytes.Equal(got, expected) {
+		t.Errorf("\nExpected: %q\nGot:      %q", expected, got)
+	}
+	for _, path := range []string{"/seg0.ts", "/seg1.ts"} {
+		if requests[path] != 1 {
+			t.Errorf("%s\nExpected: downloaded once\nGot:      %d times", path, requests[path])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "episode.mp4"+hlsPartsSuffix)); !os.IsNotExist(err) {
+		t.Errorf("\nExpected: the segments to be removed\nGot:      %v", err)
+	}
+}
+
+func TestHlsKeepSegments(t *testing.T) {
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXTINF:4,\nseg1.ts\n#EXT-X-ENDLIST\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.m3u8" {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Write([]byte(playlist))
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	for _, withTempDir := range []bool{false, true} {
+		saveDir := t.TempDir()
+		tempDir := filepath.Join(t.TempDir(), "tmp")
+		d := NewDownloader("", false, 0)
+		d.SetKeepSegments(true)
+		if withTempDir {
+			d.SetTempDir(tempDir)
+		}
+
+		task := NewDownloadTask(filepath.Join(saveDir, "episode"), server.URL+"/index.m3u8")
+		if err := d.DownloadToFile(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(saveDir, "episode.ts")); err != nil {
+			t.Errorf("temp dir %v\nExpected: episode.ts in the save directory\nGot:      %v", withTempDir, err)
+		}
+
+		// the segments stay where they were downloaded, directly in the temp dir if there is one
+		pattern := filepath.Join(saveDir, "*"+hlsPartsSuffix, "part_*.ts")
+		if withTempDir {
+			pattern = filepath.Join(tempDir, "*"+hlsPartsSuffix, "part_*.ts")
+		}
+		if parts, _ := filepath.Glob(pattern); len(parts) != 1 {
+			t.Errorf("temp dir %v\nExpected: 1 kept part\nGot:      %v", withTempDir, parts)
+		}
+	}
+}
@@ -1,32 +1,79 @@
 package download
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"log/slog"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bugmaschine/gad/internal/downloaders"
+	"github.com/bugmaschine/gad/pkg/events"
 )
 
+// progressInterval is the minimum time between two progress events of a download.
+const progressInterval = 500 * time.Millisecond
+
 type ManagerTask struct {
 	DownloadUrl string
 	Referer     string
 	Language    downloaders.Language
 	VideoType   downloaders.VideoType
 	EpisodeInfo downloaders.EpisodeInfo
+	Hoster      string
+	// Resolution is the height of the variant the extractor picked, 0 if unknown
+	Resolution int
+	// Refresh resolves DownloadUrl again if it expires, nil if that's not possible
+	Refresh downloaders.RefreshFunc
+	// Tracks are muxed into one mkv if there is more than one, see Downloader.DownloadTracks
+	Tracks []downloaders.Track
+	// Part groups the tasks of an episode split into several files, they are joined by Downloader.DownloadParts
+	Part downloaders.Part
+
+	// parts holds all parts in order once the group is complete
+	parts []ManagerTask
 }
 
 type DownloadManager struct {
-	downloader    *Downloader
-	tasks         chan ManagerTask
-	maxConcurrent int
-	saveDir       string
-	seriesInfo    downloaders.SeriesInfo
-	skipExisting  bool
+	downloader     *Downloader
+	tasks          chan ManagerTask
+	maxConcurrent  int
+	saveDir        string
+	seriesInfo     downloaders.SeriesInfo
+	skipMode       downloaders.SkipMode
+	folderTemplate string
+	naming         Naming
+	controller     *concurrencyController
+	state          *SeriesState
+	thumbnails     bool
+	budget         *SizeBudget
+	events         events.Publisher
+	cache          *DirectoryCache
+	failures       *FailurePolicy
+	seriesUrl      string
+	parallelParts  int
+	audioFormat    AudioFormat
+
+	// checksums writes checksums.sha256, verifyChecksums checks the existing files against it first
+	checksums       bool
+	verifyChecksums bool
+
+	skippedMu sync.Mutex
+	skipped   []downloaders.EpisodeInfo
+
+	usageMu sync.Mutex
+	usage   DataUsage
+	// summary is set once ProgressDownloads returns
+	summary events.Summary
 }
 
-func NewDownloadManager(d *Downloader, maxConcurrent int, saveDir string, info downloaders.SeriesInfo, skip bool) *DownloadManager {
+func NewDownloadManager(d *Downloader, maxConcurrent int, saveDir string, info downloaders.SeriesInfo, skipMode downloaders.SkipMode) *DownloadManager {
 	if maxConcurrent <= 0 {
 		maxConcurrent = 1
 	}
@@ -36,10 +83,118 @@ func NewDownloadManager(d *Downloader, maxConcurrent int, saveDir string, info d
 		maxConcurrent: maxConcurrent,
 		saveDir:       saveDir,
 		seriesInfo:    info,
-		skipExisting:  skip,
+		skipMode:      skipMode,
+		controller:    newConcurrencyController(maxConcurrent, false, d.downloaded.Load),
 	}
 }
 
+// SetFolderTemplate organizes the episodes into subfolders of the save directory, see GetEpisodeDirectory.
+func (m *DownloadManager) SetFolderTemplate(template string) *DownloadManager {
+	m.folderTemplate = template
+	return m
+}
+
+// SetNaming picks the preset for the file names, the folder template is not changed by it.
+func (m *DownloadManager) SetNaming(naming Naming) *DownloadManager {
+	m.naming = naming
+	return m
+}
+
+// SetState records the outcome of every download in the series state, nil disables it.
+func (m *DownloadManager) SetState(state *SeriesState) *DownloadManager {
+	m.state = state
+	return m
+}
+
+// SetWriteThumbnails saves the episode thumbnail (or the series cover) next to every download and embeds it.
+func (m *DownloadManager) SetWriteThumbnails(thumbnails bool) *DownloadManager {
+	m.thumbnails = thumbnails
+	return m
+}
+
+// SetChecksums writes the SHA-256 of every finished download to checksums.sha256 in the save directory. With verify,
+// the recorded files are checked against it before downloading and the ones that don't match are downloaded again.
+func (m *DownloadManager) SetChecksums(write, verify bool) *DownloadManager {
+	m.checksums = write || verify
+	m.verifyChecksums = verify
+	return m
+}
+
+// SetSizeBudget stops starting downloads once the budget is used up, the episodes left out are reported by Skipped.
+func (m *DownloadManager) SetSizeBudget(budget *SizeBudget) *DownloadManager {
+	m.budget = budget
+	return m
+}
+
+// Skipped returns the episodes that were left out because the size budget ran out, sorted by season and episode.
+func (m *DownloadManager) Skipped() []downloaders.EpisodeInfo {
+	m.skippedMu.Lock()
+	skipped := slices.Clone(m.skipped)
+	m.skippedMu.Unlock()
+
+	slices.SortFunc(skipped, func(a, b downloaders.EpisodeInfo) int {
+		return cmp.Or(cmp.Compare(a.Season, b.Season), cmp.Compare(a.Episode, b.Episode))
+	})
+	return skipped
+}
+
+// DataUsage returns the bytes the downloads received so far.
+func (m *DownloadManager) DataUsage() DataUsage {
+	m.usageMu.Lock()
+	defer m.usageMu.Unlock()
+	return m.usage
+}
+
+// Summary returns the outcome of the downloads, it is complete once ProgressDownloads returned.
+func (m *DownloadManager) Summary() events.Summary {
+	return m.summary
+}
+
+// SetCache shares the cache of the save directory with the caller, finished downloads are added to it.
+// Without one, ProgressDownloads reads the save directory itself.
+func (m *DownloadManager) SetCache(cache *DirectoryCache) *DownloadManager {
+	m.cache = cache
+	return m
+}
+
+// SetParallelParts downloads plain files in that many byte ranges at the same time, see DownloadTask.ParallelParts.
+func (m *DownloadManager) SetParallelParts(parts int) *DownloadManager {
+	m.parallelParts = parts
+	return m
+}
+
+// SetAudioFormat only keeps the audio of the episodes in format, see DownloadTask.AudioFormat.
+func (m *DownloadManager) SetAudioFormat(format AudioFormat) *DownloadManager {
+	m.audioFormat = format
+	return m
+}
+
+// SetFailurePolicy records failed downloads in policy and stops the downloads once it gives up, ProgressDownloads
+// returns ErrTooManyFailures then. seriesUrl is recorded with every failure, so the episode can be found again.
+func (m *DownloadManager) SetFailurePolicy(policy *FailurePolicy, seriesUrl string) *DownloadManager {
+	m.failures = policy
+	m.seriesUrl = seriesUrl
+	return m
+}
+
+// SetEvents publishes the start, progress and outcome of every download and a summary at the end, nil disables it.
+func (m *DownloadManager) SetEvents(publisher events.Publisher) *DownloadManager {
+	m.events = publisher
+	return m
+}
+
+// SetAdaptiveConcurrency starts with one download at a time and adds more while the throughput improves,
+// backing off when the hoster throttles. The maximum passed to NewDownloadManager is never exceeded.
+func (m *DownloadManager) SetAdaptiveConcurrency(adaptive bool) *DownloadManager {
+	m.controller = newConcurrencyController(m.maxConcurrent, adaptive, m.downloader.downloaded.Load)
+	return m
+}
+
+// ConcurrencyStats returns the current concurrency level, safe to call while ProgressDownloads runs.
+func (m *DownloadManager) ConcurrencyStats() ConcurrencyStats {
+	return m.controller.stats()
+}
+
 func (m *DownloadManager) Submit(task ManagerTask) {
 	m.tasks <- task
 }
@@ -50,47 +205,244 @@ func (m *DownloadManager) Close() {
 
 func (m *DownloadManager) ProgressDownloads(ctx context.Context) error {
 	seriesName := PrepareSeriesNameForFile(m.seriesInfo.Title)
-	cache, _ := NewDirectoryCache(m.saveDir)
+	cache := m.cache
+	if cache == nil {
+		if cache, _ = NewDirectoryCache(m.saveDir, m.skipMode); cache != nil {
+			cache.SetState(m.state)
+		}
+	}
+
+	var checksums *Checksums
+	var mismatched map[string]struct{}
+	if m.checksums {
+		var err error
+		if checksums, err = LoadChecksums(m.saveDir); err != nil {
+			slog.Warn("Failed to read checksums, starting a new file", "error", err)
+			checksums = &Checksums{path: filepath.Join(m.saveDir, ChecksumsFileName), sums: make(map[string]string)}
+		}
+		if m.verifyChecksums {
+			mismatched = m.findMismatches(checksums, cache)
+		}
+	}
+
+	// canceled when the failure policy gives up, the running downloads stop as well
+	ctx, abort := context.WithCancel(ctx)
+	defer abort()
 
 	var wg sync.WaitGroup
-	sem := make(chan struct{}, m.maxConcurrent)
 	errChan := make(chan error, 1)
+	var completed, failed, skipped, canceled atomic.Int32
 
+	groups := newPartGroups()
 	for task := range m.tasks {
 		slog.Debug("Download manager received task", "url", task.DownloadUrl, "ep", task.EpisodeInfo)
+		if task.Part.Count > 1 {
+			var complete bool
+			if task, complete = groups.add(task); !complete {
+				continue
+			}
+		}
 		wg.Add(1)
 		go func(t ManagerTask) {
 			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
+			// nothing new starts while paused, the running downloads block on their next read
+			if err := m.downloader.pause.wait(ctx); err != nil {
+				canceled.Add(1)
+				return
+			}
+			// queued downloads don't start after a cancel
+			epoch, err := m.controller.acquire(ctx)
+			if err != nil {
+				canceled.Add(1)
+				return
+			}
+			defer m.controller.release()
+			if ctx.Err() != nil {
+				canceled.Add(1)
+				return
+			}
 
-			outputName := GetEpisodeName(seriesName, &t.VideoType, &t.EpisodeInfo, false)
+			episodeDir := GetEpisodeDirectory(m.folderTemplate, m.seriesInfo.Title, &t.EpisodeInfo)
+			outputName := m.naming.EpisodeName(seriesName, &t.VideoType, &t.EpisodeInfo)
+			multiTrack := len(t.Tracks) > 1
+			if multiTrack {
+				outputName = m.naming.MultiTrackName(seriesName, &t.EpisodeInfo, t.Tracks)
+			}
 
-			if m.skipExisting && cache != nil && cache.CheckIfEpisodeExists(outputName) {
+			if cache != nil && m.exists(cache, episodeDir, outputName, &t.EpisodeInfo) {
 				slog.Info("skipping download for file: already exists", "file", outputName)
 				slog.Debug("File exists check passed", "file", outputName)
+				skipped.Add(1)
 				return
 			}
 
-			dt := NewDownloadTask(filepath.Join(m.saveDir, outputName), t.DownloadUrl).
-				SetSkipExisting(m.skipExisting).
-				SetReferer(t.Referer)
-
-			if err := m.downloader.DownloadToFile(ctx, dt); err != nil {
-				slog.Warn("Failed download", "file", outputName, "error", err)
+			// the size of the finished episode, it improves the estimate of the budget
+			var size int64
+			if m.budget != nil {
+				if !m.budget.reserve() {
+					slog.Debug("Size budget used up, skipping", "file", outputName)
+					m.skippedMu.Lock()
+					m.skipped = append(m.skipped, t.EpisodeInfo)
+					m.skippedMu.Unlock()
+					skipped.Add(1)
+					return
+				}
+				defer func() { m.budget.release(size) }()
+			}
 
+			eventTask := &events.Task{
+				Series:  m.seriesInfo.Title,
+				Season:  t.EpisodeInfo.Season,
+				Episode: t.EpisodeInfo.Episode,
+				File:    filepath.Join(episodeDir, outputName),
+			}
+			if err := os.MkdirAll(filepath.Join(m.saveDir, episodeDir), 0755); err != nil {
+				slog.Warn("Failed to create episode directory", "directory", episodeDir, "error", err)
+				failed.Add(1)
+				m.publish(events.Event{Type: events.TypeTaskFailed, Task: eventTask, Error: err.Error()})
+				if !m.recordFailure(t, err) {
+					abort()
+				}
 				select {
 				case errChan <- err:
 				default:
 				}
-			} else {
+				return
+			}
+
+			dt := NewDownloadTask(filepath.Join(m.saveDir, episodeDir, outputName), t.DownloadUrl).
+				SetSkipExisting(m.skipMode == downloaders.SkipModeByName).
+				// in by-name-and-size mode we only get here if the existing file is incomplete, so it has to be replaced.
+				SetOverwriteFile(m.skipMode == downloaders.SkipModeOverwrite || m.skipMode == downloaders.SkipModeByNameAndSize).
+				SetReferer(t.Referer).
+				SetHoster(t.Hoster).
+				SetRefresh(t.Refresh).
+				SetParallelParts(m.parallelParts).
+				SetAudioFormat(m.audioFormat)
+
+			if multiTrack {
+				dt.OutputPath += ".mkv"
+				dt.OutputPathHasExtension = true
+			}
+			eventTask.File, _ = filepath.Rel(m.saveDir, dt.FinalOutputPath())
+			if _, ok := mismatched[eventTask.File]; ok {
+				dt.SetOverwriteFile(true)
+			}
+			// the full URL is in the debug log of the received task
+			slog.Info("Downloading episode", "file", outputName, "hoster", t.Hoster, "quality", qualityLabel(t.Resolution),
+				"url", RedactUrl(t.DownloadUrl))
+			if m.events != nil {
+				m.publish(events.Event{Type: events.TypeTaskStarted, Task: eventTask})
+				dt.SetProgress(m.progressPublisher(eventTask))
+			}
+
+			usage := &taskUsage{}
+			taskCtx := withTaskUsage(ctx, usage)
+			defer func() {
+				m.usageMu.Lock()
+				m.usage.add(usage, err != nil)
+				m.usageMu.Unlock()
+			}()
+
+			switch {
+			case len(t.parts) > 0:
+				err = m.downloader.DownloadParts(taskCtx, dt, m.partTasks(t.parts))
+			case multiTrack:
+				err = m.downloader.DownloadTracks(taskCtx, dt, t.Tracks)
+			default:
+				err = m.downloader.DownloadToFile(taskCtx, dt)
+			}
+			m.controller.report(epoch, err)
+			if err == nil {
+				// the records are of the file that was written
+				dt.followFallback()
+				eventTask.File, _ = filepath.Rel(m.saveDir, dt.FinalOutputPath())
+				if info, statErr := os.Stat(dt.FinalOutputPath()); statErr == nil {
+					size = info.Size()
+				}
+			}
+			// before the records, embedding the cover changes the size
+			if err == nil && m.thumbnails {
+				m.writeThumbnail(taskCtx, t, dt)
+				// the embedded cover changed the file
+				dt.sha256 = ""
+			}
+			if err == nil && m.downloader.dedupe != nil {
+				m.dedupe(dt)
+			}
+			// a cancel says nothing about the episode
+			if ctx.Err() == nil {
+				m.recordState(t, dt, err)
+			}
+			switch {
+			case err != nil && ctx.Err() != nil:
+				canceled.Add(1)
+				m.publish(events.Event{Type: events.TypeTaskFailed, Task: eventTask, Error: err.Error()})
+				slog.Info("Download canceled", "file", outputName)
+			case err != nil:
+				failed.Add(1)
+				m.publish(events.Event{Type: events.TypeTaskFailed, Task: eventTask, Error: err.Error()})
+				logDownloadError(outputName, err)
+				if !m.recordFailure(t, err) {
+					abort()
+				}
+			default:
 				slog.Debug("Download finished successfully", "file", outputName)
+				completed.Add(1)
+				m.publish(events.Event{Type: events.TypeTaskCompleted, Task: eventTask, Downloaded: size})
+				if checksums != nil {
+					m.recordChecksum(checksums, dt)
+				}
+				if cache != nil {
+					if rel, err := filepath.Rel(m.saveDir, dt.FinalOutputPath()); err == nil {
+						cache.Add(rel)
+					}
+				}
+			}
+			if err != nil {
+				select {
+				case errChan <- err:
+				default:
+				}
 			}
 		}(task)
 	}
 
+	// the tasks are done, parts that didn't arrive by now are missing
+	for _, t := range groups.incomplete() {
+		err := missingParts(t)
+		failed.Add(1)
+		m.publish(events.Event{Type: events.TypeTaskFailed, Task: &events.Task{
+			Series:  m.seriesInfo.Title,
+			Season:  t.EpisodeInfo.Season,
+			Episode: t.EpisodeInfo.Episode,
+		}, Error: err.Error()})
+		logDownloadError(m.naming.EpisodeName(seriesName, &t.VideoType, &t.EpisodeInfo), err)
+		if !m.recordFailure(t, err) {
+			abort()
+		}
+		select {
+		case errChan <- err:
+		default:
+		}
+	}
+
 	wg.Wait()
+	usage := m.DataUsage()
+	m.summary = events.Summary{
+		Series:     m.seriesInfo.Title,
+		Completed:  int(completed.Load()),
+		Failed:     int(failed.Load()),
+		Skipped:    int(skipped.Load()),
+		Canceled:   int(canceled.Load()),
+		DataUsed:   usage.Total(),
+		DataWasted: usage.Wasted,
+	}
+	m.publish(events.Event{Type: events.TypeSummary, Summary: &m.summary})
 
+	if m.failures != nil && m.failures.GaveUp() {
+		return ErrTooManyFailures
+	}
 	select {
 	case err := <-errChan:
 		return err
@@ -99,3 +451,152 @@ func (m *DownloadManager) ProgressDownloads(ctx context.Context) error {
 	}
 
 }
+
+// partTasks creates the downloads of the parts of a split episode, DownloadParts picks their paths.
+func (m *DownloadManager) partTasks(parts []ManagerTask) []*DownloadTask {
+	tasks := make([]*DownloadTask, len(parts))
+	for i, part := range parts {
+		tasks[i] = NewDownloadTask("", part.DownloadUrl).
+			SetReferer(part.Referer).
+			SetHoster(part.Hoster).
+			SetRefresh(part.Refresh)
+	}
+	return tasks
+}
+
+// recordFailure adds a failed download to the failure policy and reports whether the run goes on.
+func (m *DownloadManager) recordFailure(task ManagerTask, err error) bool {
+	if m.failures == nil {
+		return true
+	}
+	language := task.VideoType.String()
+	if len(task.Tracks) > 1 {
+		languages := make([]string, len(task.Tracks))
+		for i, track := range task.Tracks {
+			languages[i] = track.Lang.String()
+		}
+		language = strings.Join(languages, ",")
+	}
+	// --retry-file may run in another working directory
+	dir, absErr := filepath.Abs(m.saveDir)
+	if absErr != nil {
+		dir = m.saveDir
+	}
+	return m.failures.record(FailedEpisode{
+		Series:   m.seriesInfo.Title,
+		Url:      m.seriesUrl,
+		Season:   task.EpisodeInfo.Season,
+		Episode:  task.EpisodeInfo.Episode,
+		Language: language,
+		Dir:      dir,
+		Hoster:   task.Hoster,
+		Error:    err.Error(),
+	})
+}
+
+// exists checks the cache for the episode. The media server presets have one file per episode whose title may have
+// been missing in an earlier run, so any file of the episode counts.
+func (m *DownloadManager) exists(cache *DirectoryCache, episodeDir, outputName string, epInfo *downloaders.EpisodeInfo) bool {
+	if m.naming.HasLanguage() {
+		return cache.CheckIfEpisodeExists(filepath.Join(episodeDir, outputName))
+	}
+	return cache.HasPrefix(filepath.Join(episodeDir, m.naming.Prefix(PrepareSeriesNameForFile(m.seriesInfo.Title), epInfo)))
+}
+
+func (m *DownloadManager) publish(e events.Event) {
+	if m.events != nil {
+		m.events.Publish(e)
+	}
+}
+
+// progressPublisher throttles the progress of a download to one event per progressInterval.
+func (m *DownloadManager) progressPublisher(task *events.Task) func(downloaded, total int64) {
+	var last time.Time
+	return func(downloaded, total int64) {
+		if now := time.Now(); now.Sub(last) >= progressInterval {
+			last = now
+			m.publish(events.Event{Type: events.TypeProgress, Task: task, Downloaded: downloaded, Total: total})
+		}
+	}
+}
+
+// logDownloadError tells refused and capped downloads apart from real failures, so users know which flag to change.
+func logDownloadError(file string, err error) {
+	var limitErr *ErrLimitExceeded
+	switch {
+	case errors.Is(err, ErrLiveStream):
+		slog.Warn("Refused download, the stream has no end. Set --max-duration to record it anyway", "file", file)
+	case errors.As(err, &limitErr):
+		slog.Warn("Download stopped early, the file is incomplete", "file", file, "reason", limitErr)
+	case errors.Is(err, ErrFFmpegDisabled):
+		slog.Warn("Failed download, it needs FFmpeg which is disabled with --no-ffmpeg", "file", file, "error", err)
+	case errors.Is(err, ErrFFmpegRequired):
+		slog.Warn("Failed download, it needs FFmpeg which couldn't be set up. Install it or run gad again once it can be downloaded", "file", file, "error", err)
+	default:
+		slog.Warn("Failed download", "file", file, "error", err)
+	}
+}
+
+// writeThumbnail is best effort, a missing thumbnail doesn't fail the download.
+func (m *DownloadManager) writeThumbnail(ctx context.Context, task ManagerTask, dt *DownloadTask) {
+	imageUrl := task.EpisodeInfo.ThumbnailUrl
+	if imageUrl == "" {
+		imageUrl = m.seriesInfo.CoverUrl
+	}
+	if imageUrl == "" {
+		slog.Debug("No thumbnail available", "file", dt.Filename())
+		return
+	}
+
+	if _, err := m.downloader.WriteThumbnail(ctx, dt.FinalOutputPath(), imageUrl, "", task.EpisodeInfo.AirDate); err != nil {
+		slog.Warn("Failed to download thumbnail", "file", dt.Filename(), "error", err)
+	}
+}
+
+// dedupe is best effort, the download stays a regular file if it can't be linked.
+func (m *DownloadManager) dedupe(dt *DownloadTask) {
+	original, err := m.downloader.dedupe.Dedupe(dt.FinalOutputPath())
+	if err != nil {
+		slog.Warn("Failed to deduplicate download", "file", dt.Filename(), "error", err)
+		return
+	}
+	if original != "" {
+		slog.Info("Linked identical episode", "file", dt.Filename(), "original", original)
+	}
+}
+
+// recordState writes the outcome of a download to the series state.
+func (m *DownloadManager) recordState(task ManagerTask, dt *DownloadTask, err error) {
+	if m.state == nil {
+		return
+	}
+
+	language := task.VideoType.String()
+	if len(task.Tracks) > 1 {
+		languages := make([]string, len(task.Tracks))
+		for i, track := range task.Tracks {
+			languages[i] = track.Lang.String()
+		}
+		language = strings.Join(languages, "+")
+	}
+	entry := EpisodeState{
+		Season:   task.EpisodeInfo.Season,
+		Episode:  task.EpisodeInfo.Episode,
+		Status:   EpisodeCompleted,
+		Language: language,
+		Quality:  m.downloader.quality.String(),
+		Hoster:   task.Hoster,
+	}
+
+	if err != nil {
+		entry.Status = EpisodeFailed
+		entry.Error = err.Error()
+	} else if info, statErr := os.Stat(dt.FinalOutputPath()); statErr == nil && info.Size() > 0 {
+		entry.Size = info.Size()
+		entry.File, _ = filepath.Rel(m.saveDir, dt.FinalOutputPath())
+	}
+
+	if err := m.state.Record(entry); err != nil {
+		slog.Warn("Failed to write series state", "error", err)
+	}
+}
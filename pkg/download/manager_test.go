@@ -0,0 +1,150 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+	"github.com/bugmaschine/gad/pkg/events"
+)
+
+func TestProgressDownloadsCancel(t *testing.T) {
+	server, started := stallingServer(t, "video/mp4", []byte("first bytes"))
+
+	d := NewDownloader("", false, 0)
+	m := NewDownloadManager(d, 1, t.TempDir(), downloaders.SeriesInfo{Title: "Series"}, downloaders.SkipModeOff)
+	for i := uint32(1); i <= 3; i++ {
+		m.Submit(ManagerTask{
+			DownloadUrl: server.URL,
+			EpisodeInfo: downloaders.EpisodeInfo{Season: 1, Episode: i},
+		})
+	}
+	m.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	done := make(chan error, 1)
+	go func() { done <- m.ProgressDownloads(ctx) }()
+
+	// the queued episodes must not start after the cancel, else this would hang until the timeout
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("\nExpected: %v\nGot:      %v", context.Canceled, err)
+		}
+		// the running download and the queued ones
+		if summary := m.Summary(); summary.Canceled != 3 || summary.Failed != 0 {
+			t.Errorf("\nExpected: 3 canceled, 0 failed\nGot:      %+v", summary)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("manager didn't stop after cancel")
+	}
+}
+
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (p *recordingPublisher) Publish(e events.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, e)
+}
+
+func TestProgressDownloadsEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write([]byte("episode"))
+	}))
+	defer server.Close()
+
+	publisher := &recordingPublisher{}
+	d := NewDownloader("", false, 0)
+	m := NewDownloadManager(d, 1, t.TempDir(), downloaders.SeriesInfo{Title: "Series"}, downloaders.SkipModeOff).SetEvents(publisher)
+	m.Submit(ManagerTask{DownloadUrl: server.URL + "/ok", EpisodeInfo: downloaders.EpisodeInfo{Season: 1, Episode: 1}})
+	m.Submit(ManagerTask{DownloadUrl: server.URL + "/missing", EpisodeInfo: downloaders.EpisodeInfo{Season: 1, Episode: 2}})
+	m.Close()
+	m.ProgressDownloads(context.Background())
+
+	// the downloads run concurrently, so only the order per episode is fixed
+	byEpisode := make(map[uint32][]events.Type)
+	for _, e := range publisher.events {
+		if e.Task != nil {
+			byEpisode[e.Task.Episode] = append(byEpisode[e.Task.Episode], e.Type)
+		}
+	}
+	expected := map[uint32][]events.Type{
+		1: {events.TypeTaskStarted, events.TypeProgress, events.TypeTaskCompleted},
+		2: {events.TypeTaskStarted, events.TypeTaskFailed},
+	}
+	for episode, types := range expected {
+		if !slices.Equal(byEpisode[episode], types) {
+			t.Errorf("episode %d\nExpected: %v\nGot:      %v", episode, types, byEpisode[episode])
+		}
+	}
+
+	last := publisher.events[len(publisher.events)-1]
+	// the body of the 404 is never read
+	expectedSummary := events.Summary{Series: "Series", Completed: 1, Failed: 1, DataUsed: int64(len("episode"))}
+	if last.Type != events.TypeSummary || *last.Summary != expectedSummary {
+		t.Errorf("\nExpected: %+v\nGot:      %+v", expectedSummary, last)
+	}
+}
+
+func TestProgressDownloadsFailurePolicy(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		policy  *FailurePolicy
+		failed  int
+		aborted bool
+	}{
+		{"continue on error", NewFailurePolicy(true, 0), 4, false},
+		{"max failures", NewFailurePolicy(true, 2), 2, true},
+		{"fail fast", NewFailurePolicy(false, 0), 1, true},
+	}
+
+	for _, tt := range tests {
+		d := NewDownloader("", false, 0)
+		m := NewDownloadManager(d, 1, t.TempDir(), downloaders.SeriesInfo{Title: "Series"}, downloaders.SkipModeOff).
+			SetFailurePolicy(tt.policy, "https://example.com/series")
+		for i := uint32(1); i <= 4; i++ {
+			m.Submit(ManagerTask{DownloadUrl: server.URL, EpisodeInfo: downloaders.EpisodeInfo{Season: 1, Episode: i}})
+		}
+		m.Close()
+
+		err := m.ProgressDownloads(context.Background())
+		if aborted := errors.Is(err, ErrTooManyFailures); aborted != tt.aborted {
+			t.Errorf("%s\nExpected: aborted %v\nGot:      %v", tt.name, tt.aborted, err)
+		}
+		failed := tt.policy.Failed()
+		if len(failed) != tt.failed {
+			t.Errorf("%s\nExpected: %d failures\nGot:      %d", tt.name, tt.failed, len(failed))
+		}
+		if len(failed) > 0 && (failed[0].Series != "Series" || failed[0].Url != "https://example.com/series" || failed[0].Error == "") {
+			t.Errorf("%s\nExpected: the series and error in the failure\nGot:      %+v", tt.name, failed[0])
+		}
+		// --retry-file may run in another working directory
+		if len(failed) > 0 && !filepath.IsAbs(failed[0].Dir) {
+			t.Errorf("%s\nExpected: an absolute save directory\nGot:      %q", tt.name, failed[0].Dir)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+	"github.com/bugmaschine/gad/pkg/utils"
+)
+
+// trackSuffix marks the temporary downloads of the single languages, e.g. "<name>.track1.mp4".
+const trackSuffix = ".track"
+
+// ErrFFmpegRequired is returned if several files have to be muxed, e.g. multiple languages, or the audio has to be
+// extracted, but FFmpeg wasn't found or couldn't be downloaded.
+var ErrFFmpegRequired = errors.New("muxing requires FFmpeg")
+
+// ErrFFmpegDisabled wraps ErrFFmpegRequired if FFmpeg was turned off with --no-ffmpeg instead of missing.
+var ErrFFmpegDisabled = fmt.Errorf("%w, which is disabled", ErrFFmpegRequired)
+
+// MultiTrackName is the output name of a muxed download, the languages are listed in track order.
+func MultiTrackName(seriesName string, epInfo *downloaders.EpisodeInfo, tracks []downloaders.Track) string {
+	languages := make([]string, len(tracks))
+	for i, track := range tracks {
+		languages[i] = track.Lang.String()
+	}
+	return GetEpisodeName(seriesName, nil, epInfo, false) + " - " + strings.Join(languages, "+")
+}
+
+// DownloadTracks downloads every track on its own and muxes them into the task output, which has to be an mkv.
+// The first track is the default one. A track stopped at a limit still gets muxed, the error is returned afterwards.
+func (d *Downloader) DownloadTracks(ctx context.Context, task *DownloadTask, tracks []downloaders.Track) error {
+	outputPath := task.FinalOutputPath()
+	if task.SkipExisting {
+		if _, err := os.Stat(outputPath); err == nil {
+			slogInfo("skipping download for %s: file already exists", filepath.Base(outputPath))
+			return nil
+		}
+	}
+	if d.ffmpegPath == "" {
+		return d.ffmpegRequired("multiple languages")
+	}
+
+	muxPath := outputPath
+	if d.tempDir != "" {
+		if _, err := os.Stat(outputPath); err == nil && !task.OverwriteFile {
+			return &os.PathError{Op: "open", Path: outputPath, Err: fs.ErrExist}
+		}
+		workDir, err := d.newWorkDir()
+		if err != nil {
+			return err
+		}
+		defer utils.RemoveDirAllIgnoreNotExists(workDir)
+		muxPath = filepath.Join(workDir, filepath.Base(outputPath))
+	}
+
+	base := strings.TrimSuffix(muxPath, filepath.Ext(muxPath))
+	var inputs []string
+	defer func() {
+		for _, input := range inputs {
+			utils.RemoveFileIgnoreNotExists(input)
+		}
+	}()
+
+	var limitErr error
+	for i, track := range tracks {
+		trackTask := NewDownloadTask(base+trackSuffix+strconv.Itoa(i), track.Url).
+			SetOverwriteFile(true).
+			SetReferer(track.Referer).
+			SetHoster(track.Hoster).
+			SetRefresh(track.Refresh).
+			SetParallelParts(task.ParallelParts).
+			SetProgress(task.Progress).
+			SetCustomMessage(fmt.Sprintf("%s (%s)", filepath.Base(outputPath), track.Lang))
+
+		// the subtitles come with the first track, which has the default video
+		subtitleBase := ""
+		if i == 0 {
+			subtitleBase = strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+		}
+
+		var exceeded *ErrLimitExceeded
+		err := d.DownloadToFile(withSubtitleBase(ctx, subtitleBase), trackTask)
+		if err != nil && !errors.As(err, &exceeded) {
+			return fmt.Errorf("track %s: %w", track.Lang, err)
+		}
+		// known only now, embedded subtitles make the first track an mkv
+		inputs = append(inputs, trackTask.FinalOutputPath())
+		if err != nil {
+			limitErr = err
+		}
+	}
+
+	overwrite := "-n"
+	if task.OverwriteFile {
+		overwrite = "-y"
+	}
+	extra := d.outputArgs(muxPath)
+	if d.subtitleMode == SubtitleEmbed && d.subtitleLangs.Enabled() {
+		// the subtitles embedded into the first track
+		extra = append([]string{"-map", "0:s?"}, extra...)
+	}
+	if err := d.runFfmpeg(ctx, append([]string{overwrite}, muxArgs(inputs, tracks, extra, muxPath)...)); err != nil {
+		utils.RemoveFileIgnoreNotExists(muxPath)
+		return fmt.Errorf("failed to mux tracks: %w", err)
+	}
+	if muxPath != outputPath {
+		if err := moveFromWorkDir(muxPath, outputPath); err != nil {
+			return err
+		}
+	}
+	return limitErr
+}
+
+// muxArgs maps the video of the first input and the audio of every input into the output. Subs are burned into the
+// video on these sites, so the videos of further sub tracks are kept as additional, not default, video streams.
+// extra are further output options.
+func muxArgs(inputs []string, tracks []downloaders.Track, extra []string, output string) []string {
+	var args []string
+	for _, input := range inputs {
+		args = append(args, "-i", input)
+	}
+
+	videos := []int{0}
+	for i := 1; i < len(tracks); i++ {
+		if tracks[i].Lang.Type == downloaders.VideoTypeSub {
+			videos = append(videos, i)
+		}
+	}
+	for _, i := range videos {
+		args = append(args, "-map", fmt.Sprintf("%d:v:0", i))
+	}
+	for i := range tracks {
+		args = append(args, "-map", fmt.Sprintf("%d:a:0", i))
+	}
+	args = append(args, "-c", "copy")
+
+	for n, i := range videos {
+		args = append(args,
+			fmt.Sprintf("-metadata:s:v:%d", n), "title="+tracks[i].Lang.String(),
+			// the language of the burned in subtitles
+			fmt.Sprintf("-metadata:s:v:%d", n), "language="+tracks[i].Lang.SubtitleLanguage(),
+			fmt.Sprintf("-disposition:v:%d", n), disposition(n == 0),
+		)
+	}
+	for i, track := range tracks {
+		args = append(args,
+			fmt.Sprintf("-metadata:s:a:%d", i), "language="+track.Lang.AudioLanguage(),
+			fmt.Sprintf("-metadata:s:a:%d", i), "title="+track.Lang.String(),
+			fmt.Sprintf("-disposition:a:%d", i), disposition(i == 0),
+		)
+	}
+	args = append(args, extra...)
+	return append(args, output)
+}
+
+func disposition(isDefault bool) string {
+	if isDefault {
+		return "default"
+	}
+	return "0"
+}
+
+// isTrackFile matches the temporary downloads of DownloadTracks.
+func isTrackFile(name string) bool {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	i := strings.LastIndex(base, trackSuffix)
+	if i < 0 {
+		return false
+	}
+	_, err := strconv.Atoi(base[i+len(trackSuffix):])
+	return err == nil
+}
@@ -0,0 +1,91 @@
+package download
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+)
+
+func TestMuxArgs(t *testing.T) {
+	gerDub := downloaders.Track{Lang: downloaders.VideoType{Type: downloaders.VideoTypeDub, Language: downloaders.LanguageGerman}}
+	gerSub := downloaders.Track{Lang: downloaders.VideoType{Type: downloaders.VideoTypeSub, Language: downloaders.LanguageGerman}}
+	engDub := downloaders.Track{Lang: downloaders.VideoType{Type: downloaders.VideoTypeDub, Language: downloaders.LanguageEnglish}}
+
+	tests := []struct {
+		name     string
+		tracks   []downloaders.Track
+		expected []string
+	}{
+		{
+			name:   "dubs share the video",
+			tracks: []downloaders.Track{gerDub, engDub},
+			expected: []string{
+				"-i", "t0.mp4", "-i", "t1.mp4",
+				"-map", "0:v:0", "-map", "0:a:0", "-map", "1:a:0", "-c", "copy",
+				"-metadata:s:v:0", "title=GerDub", "-metadata:s:v:0", "language=und", "-disposition:v:0", "default",
+				"-metadata:s:a:0", "language=ger", "-metadata:s:a:0", "title=GerDub", "-disposition:a:0", "default",
+				"-metadata:s:a:1", "language=eng", "-metadata:s:a:1", "title=EngDub", "-disposition:a:1", "0",
+				"out.mkv",
+			},
+		},
+		{
+			name:   "subs keep their video",
+			tracks: []downloaders.Track{gerDub, gerSub},
+			expected: []string{
+				"-i", "t0.mp4", "-i", "t1.mp4",
+				"-map", "0:v:0", "-map", "1:v:0", "-map", "0:a:0", "-map", "1:a:0", "-c", "copy",
+				"-metadata:s:v:0", "title=GerDub", "-metadata:s:v:0", "language=und", "-disposition:v:0", "default",
+				"-metadata:s:v:1", "title=GerSub", "-metadata:s:v:1", "language=ger", "-disposition:v:1", "0",
+				"-metadata:s:a:0", "language=ger", "-metadata:s:a:0", "title=GerDub", "-disposition:a:0", "default",
+				"-metadata:s:a:1", "language=und", "-metadata:s:a:1", "title=GerSub", "-disposition:a:1", "0",
+				"out.mkv",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := muxArgs([]string{"t0.mp4", "t1.mp4"}, tt.tracks, nil, "out.mkv")
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("\nExpected: %v\nGot:      %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMultiTrackName(t *testing.T) {
+	tracks := []downloaders.Track{
+		{Lang: downloaders.VideoType{Type: downloaders.VideoTypeDub, Language: downloaders.LanguageGerman}},
+		{Lang: downloaders.VideoType{Type: downloaders.VideoTypeSub, Language: downloaders.LanguageGerman}},
+	}
+	got := MultiTrackName("Series", &downloaders.EpisodeInfo{Season: 1, Episode: 3}, tracks)
+	expected := "Series - S01E03 - GerDub+GerSub"
+	if got != expected {
+		t.Errorf("\nExpected: %s\nGot:      %s", expected, got)
+	}
+}
+
+func TestOutputArgs(t *testing.T) {
+	tests := []struct {
+		output    string
+		faststart bool
+		expected  []string
+	}{
+		{"out.mp4", true, []string{"-movflags", "+faststart", "-sn"}},
+		{"out.MP4", true, []string{"-movflags", "+faststart", "-sn"}},
+		{"out.mp4", false, []string{"-sn"}},
+		{"out.mkv", true, []string{"-sn"}},
+		{"out.ts", true, []string{"-sn"}},
+	}
+
+	for _, tt := range tests {
+		d := NewDownloader("", false, 0)
+		d.SetFaststart(tt.faststart)
+		d.SetFfmpegArgs([]string{"-sn"})
+		got := d.outputArgs(tt.output)
+		if !slices.Equal(got, tt.expected) {
+			t.Errorf("%s faststart=%v\nExpected: %v\nGot:      %v", tt.output, tt.faststart, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package download
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+)
+
+// Naming is a preset for the file names of episodes.
+type Naming int
+
+const (
+	// NamingDefault is "Series - S01E02 - GerDub", the video type keeps several languages of an episode apart.
+	NamingDefault Naming = iota
+	// NamingSonarr is "Series - S01E02 - Episode Title", the standard episode format of Sonarr.
+	NamingSonarr
+	// NamingPlex is "Series - s01e02 - Episode Title" inside "Series/Season 01" folders, as in the guide of Plex.
+	NamingPlex
+)
+
+// PlexFolderTemplate is used by NamingPlex if no folder template was given.
+const PlexFolderTemplate = "{series}/Season {season}"
+
+// ParseNaming parses the value of --naming.
+func ParseNaming(s string) (Naming, error) {
+	switch strings.ToLower(s) {
+	case "", "default":
+		return NamingDefault, nil
+	case "sonarr":
+		return NamingSonarr, nil
+	case "plex":
+		return NamingPlex, nil
+	default:
+		return NamingDefault, fmt.Errorf("invalid naming %q, expected one of default, sonarr, plex", s)
+	}
+}
+
+func (n Naming) String() string {
+	switch n {
+	case NamingSonarr:
+		return "sonarr"
+	case NamingPlex:
+		return "plex"
+	default:
+		return "default"
+	}
+}
+
+// HasLanguage reports whether the names contain the video type. The presets for media servers keep one file per episode,
+// so any language of an episode counts as downloaded.
+func (n Naming) HasLanguage() bool {
+	return n == NamingDefault
+}
+
+// FolderTemplate returns template, or the folder template the preset needs if it is empty.
+func (n Naming) FolderTemplate(template string) string {
+	if template == "" && n == NamingPlex {
+		return PlexFolderTemplate
+	}
+	return template
+}
+
+// EpisodeName names the file of an episode without extension. The presets add the episode title if the site has one.
+func (n Naming) EpisodeName(seriesName string, videoType *downloaders.VideoType, epInfo *downloaders.EpisodeInfo) string {
+	if n == NamingDefault {
+		return GetEpisodeName(seriesName, videoType, epInfo, false)
+	}
+
+	name := n.Prefix(seriesName, epInfo)
+	if title := PrepareSeriesNameForFile(epInfo.Title); title != "" {
+		name += " - " + title
+	}
+	return name
+}
+
+// MultiTrackName is EpisodeName for an episode muxed from several languages.
+func (n Naming) MultiTrackName(seriesName string, epInfo *downloaders.EpisodeInfo, tracks []downloaders.Track) string {
+	if n == NamingDefault {
+		return MultiTrackName(seriesName, epInfo, tracks)
+	}
+	return n.EpisodeName(seriesName, nil, epInfo)
+}
+
+// Prefix is the part of the name that is known before the episode page was scraped, "Series - S01E02" by default.
+func (n Naming) Prefix(seriesName string, epInfo *downloaders.EpisodeInfo) string {
+	untitled := *epInfo
+	untitled.Title = ""
+	name := GetEpisodeName(seriesName, nil, &untitled, false)
+	if n == NamingPlex {
+		// only the season and episode part, the series name keeps its case
+		marker := strings.TrimPrefix(name, seriesName+" - ")
+		name = strings.TrimSuffix(name, marker) + strings.ToLower(marker)
+	}
+	return name
+}
@@ -0,0 +1,81 @@
+package download
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+)
+
+// episodePattern is the standard episode format media managers parse ("Series - S01E02 - Title"), case insensitive like Sonarr and Plex.
+var episodePattern = regexp.MustCompile(`^(?P<series>.+?) - (?i:s)(?P<season>\d{2,})(?i:e)(?P<episode>\d{2,})(?: - (?P<title>.+))?$`)
+
+func TestNamingEpisodeName(t *testing.T) {
+	german := downloaders.VideoType{Type: downloaders.VideoTypeDub, Language: downloaders.LanguageGerman}
+	tests := []struct {
+		naming   Naming
+		epInfo   downloaders.EpisodeInfo
+		expected string
+	}{
+		{NamingDefault, downloaders.EpisodeInfo{Season: 1, Episode: 2, Title: "Ignored"}, "Frieren - S01E02 - GerDub"},
+		{NamingSonarr, downloaders.EpisodeInfo{Season: 1, Episode: 2, Title: "It Didn't Have to Be Magic..."}, "Frieren - S01E02 - It Didn't Have to Be Magic"},
+		{NamingSonarr, downloaders.EpisodeInfo{Season: 1, Episode: 7, MaxEpisodes: 112, Title: "Who? Me: The Hero"}, "Frieren - S01E007 - Who - Me - The Hero"},
+		{NamingSonarr, downloaders.EpisodeInfo{Season: 0, Episode: 1}, "Frieren - S00E01"},
+		{NamingPlex, downloaders.EpisodeInfo{Season: 2, Episode: 3, Title: "A/B Test"}, "Frieren - s02e03 - AB Test"},
+	}
+
+	for _, tt := range tests {
+		got := tt.naming.EpisodeName("Frieren", &german, &tt.epInfo)
+		if got != tt.expected {
+			t.Errorf("%s\nExpected: %s\nGot:      %s", tt.naming, tt.expected, got)
+			continue
+		}
+		if tt.naming == NamingDefault {
+			continue
+		}
+
+		// the names have to parse back into the same series, season and episode
+		match := episodePattern.FindStringSubmatch(got)
+		if match == nil {
+			t.Errorf("%s doesn't match the episode format", got)
+			continue
+		}
+		season, _ := strconv.Atoi(match[episodePattern.SubexpIndex("season")])
+		episode, _ := strconv.Atoi(match[episodePattern.SubexpIndex("episode")])
+		if series := match[episodePattern.SubexpIndex("series")]; series != "Frieren" || uint32(season) != tt.epInfo.Season || uint32(episode) != tt.epInfo.Episode {
+			t.Errorf("%s\nExpected: Frieren S%d E%d\nGot:      %s S%d E%d", got, tt.epInfo.Season, tt.epInfo.Episode, series, season, episode)
+		}
+	}
+}
+
+func TestNamingPrefix(t *testing.T) {
+	epInfo := downloaders.EpisodeInfo{Season: 1, Episode: 2, Title: "Title"}
+	tests := []struct {
+		naming   Naming
+		expected string
+	}{
+		{NamingDefault, "SPY x FAMILY - S01E02"},
+		{NamingSonarr, "SPY x FAMILY - S01E02"},
+		{NamingPlex, "SPY x FAMILY - s01e02"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.naming.Prefix("SPY x FAMILY", &epInfo); got != tt.expected {
+			t.Errorf("%s\nExpected: %s\nGot:      %s", tt.naming, tt.expected, got)
+		}
+	}
+}
+
+func TestParseNaming(t *testing.T) {
+	for _, input := range []string{"default", "Sonarr", "plex"} {
+		naming, err := ParseNaming(input)
+		if err != nil || !strings.EqualFold(naming.String(), input) {
+			t.Errorf("%s\nExpected: %s\nGot:      %s (%v)", input, input, naming, err)
+		}
+	}
+	if _, err := ParseNaming("jellyfin"); err == nil {
+		t.Error("unknown naming should fail")
+	}
+}
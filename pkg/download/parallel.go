@@ -0,0 +1,108 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/vbauerster/mpb/v8"
+	"golang.org/x/sync/errgroup"
+)
+
+// minPartSize keeps small files from being split into parts that cost more in requests than they gain.
+const minPartSize = 4 << 20
+
+// canSplit reports whether a plain download can be fetched in parts, the server has to accept ranges and send the size.
+func canSplit(resp *http.Response, parts int) bool {
+	return parts > 1 && resp.Header.Get("Accept-Ranges") == "bytes" && resp.ContentLength >= 2*minPartSize
+}
+
+// parallelDownload fetches the file in byte ranges at the same time and writes each part at its offset of targetFile.
+// The first part is read from resp, the response to the request without a range. The parts share the rate limit,
+// a part whose connection breaks resumes on its own like a simple download.
+func (d *Downloader) parallelDownload(ctx context.Context, resp *http.Response, streamUrl, referer string, refresh *refresher, targetFile *os.File, parts int, message string, progress func(downloaded, total int64)) error {
+	size := resp.ContentLength
+	parts = int(min(int64(parts), size/minPartSize))
+	partSize := size / int64(parts)
+	slog.Debug("Downloading in parts", "url", streamUrl, "parts", parts, "size", size)
+
+	if err := targetFile.Truncate(size); err != nil {
+		return err
+	}
+
+	d.ensureTotalBar()
+	d.addTotalSize(size)
+	counter := &partCounter{d: d, bar: d.addFileBar(message, size), total: size, progress: progress}
+
+	g, partCtx := errgroup.WithContext(ctx)
+	for i := range parts {
+		start := int64(i) * partSize
+		end := start + partSize - 1
+		if i == parts-1 {
+			end = size - 1
+		}
+
+		g.Go(func() error {
+			body := &resumingBody{ctx: partCtx, d: d, url: streamUrl, referer: referer, refresher: refresh, offset: start, end: end}
+			if i == 0 {
+				body.body = resp.Body
+			} else if err := body.reopen(); err != nil {
+				return fmt.Errorf("failed to request part %d: %w", i+1, err)
+			}
+			defer body.Close()
+
+			if err := d.downloadPart(partCtx, body, targetFile, start, end, counter); err != nil {
+				return fmt.Errorf("failed to download part %d: %w", i+1, err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// downloadPart copies the bytes from start to end of body to the same offset of targetFile.
+func (d *Downloader) downloadPart(ctx context.Context, body io.ReadCloser, targetFile *os.File, start, end int64, counter *partCounter) error {
+	cancelable, stop := cancelableBody(ctx, body)
+	defer stop()
+
+	reader := NewRateLimitedReader(&pausableReader{r: cancelable, gate: d.pause, ctx: ctx}, d.limiter, ctx)
+	// the first part reads from the full response, it stops where the second one starts
+	length := end - start + 1
+	n, err := io.Copy(io.NewOffsetWriter(targetFile, start), io.TeeReader(io.LimitReader(reader, length), counter))
+	if err != nil {
+		return err
+	}
+	if n < length {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// partCounter adds the bytes of all parts to the bars and the progress of the task.
+type partCounter struct {
+	d        *Downloader
+	bar      *mpb.Bar
+	total    int64
+	progress func(downloaded, total int64)
+
+	mu         sync.Mutex
+	downloaded int64
+}
+
+func (c *partCounter) Write(p []byte) (int, error) {
+	n := int64(len(p))
+	c.bar.IncrInt64(n)
+	c.d.addTotalPos(n)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.downloaded += n
+	if c.progress != nil {
+		c.progress(c.downloaded, c.total)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,93 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rangeServer serves content like a CDN, with range support unless ranges is false. It counts the range requests.
+func rangeServer(t *testing.T, content []byte, ranges bool) (*httptest.Server, *atomic.Int32) {
+	var rangeRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			rangeRequests.Add(1)
+		}
+		if !ranges {
+			r.Header.Del("Range")
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Write(content)
+			return
+		}
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server, &rangeRequests
+}
+
+func TestParallelDownload(t *testing.T) {
+	content := make([]byte, 4*minPartSize+12345)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	tests := []struct {
+		name          string
+		size          int
+		parts         int
+		ranges        bool
+		rangeRequests int32
+	}{
+		{"split", len(content), 4, true, 3},
+		{"fewer parts than requested for a small file", 2*minPartSize + 1, 8, true, 1},
+		{"too small to split", minPartSize, 4, true, 0},
+		{"no range support", len(content), 4, false, 0},
+		{"single part", len(content), 1, true, 0},
+	}
+
+	for _, tt := range tests {
+		server, rangeRequests := rangeServer(t, content[:tt.size], tt.ranges)
+		var lastProgress atomic.Int64
+		task := NewDownloadTask(filepath.Join(t.TempDir(), "episode"), server.URL+"/video.mp4").
+			SetParallelParts(tt.parts).
+			SetProgress(func(downloaded, total int64) { lastProgress.Store(downloaded) })
+
+		d := NewDownloader("", false, 0)
+		if err := d.DownloadToFile(context.Background(), task); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, _ := os.ReadFile(task.FinalOutputPath())
+		if !bytes.Equal(got, content[:tt.size]) {
+			t.Errorf("%s\nExpected: the %d bytes that were served\nGot:      %d different bytes", tt.name, tt.size, len(got))
+		}
+		if rangeRequests.Load() != tt.rangeRequests {
+			t.Errorf("%s\nExpected: %d range requests\nGot:      %d", tt.name, tt.rangeRequests, rangeRequests.Load())
+		}
+		if lastProgress.Load() != int64(tt.size) {
+			t.Errorf("%s\nExpected: progress up to %d\nGot:      %d", tt.name, tt.size, lastProgress.Load())
+		}
+	}
+}
+
+func TestParallelDownloadRateLimit(t *testing.T) {
+	content := make([]byte, 4*minPartSize)
+	server, _ := rangeServer(t, content, true)
+
+	// the limiter starts with a full burst of one second, the second half of the file has to wait for another second
+	limit := float64(len(content) / 2)
+	d := NewDownloader("", false, limit)
+	task := NewDownloadTask(filepath.Join(t.TempDir(), "episode"), server.URL+"/video.mp4").SetParallelParts(4)
+
+	start := time.Now()
+	if err := d.DownloadToFile(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("\nExpected: at least 1s with the shared rate limit\nGot:      %v", elapsed)
+	}
+}
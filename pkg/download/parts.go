@@ -0,0 +1,158 @@
+package download
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bugmaschine/gad/pkg/utils"
+)
+
+// ErrMissingParts is returned for an episode a hoster split into parts if not all of them were submitted.
+var ErrMissingParts = errors.New("missing parts of the episode")
+
+// partGroups collects the parts of split episodes until all of them arrived, see downloaders.Part.
+type partGroups struct {
+	groups map[string][]ManagerTask
+}
+
+func newPartGroups() *partGroups {
+	return &partGroups{groups: make(map[string][]ManagerTask)}
+}
+
+// add stores a part. Once the last part of its group arrived, it returns the first one with all parts in order.
+func (g *partGroups) add(task ManagerTask) (ManagerTask, bool) {
+	part := task.Part
+	if part.Index < 1 || part.Index > part.Count {
+		slog.Warn("Ignoring part with an invalid index", "group", part.Group, "index", part.Index, "count", part.Count)
+		return ManagerTask{}, false
+	}
+	parts := g.groups[part.Group]
+	if slices.ContainsFunc(parts, func(t ManagerTask) bool { return t.Part.Index == part.Index }) {
+		slog.Warn("Ignoring duplicate part", "group", part.Group, "index", part.Index)
+		return ManagerTask{}, false
+	}
+
+	parts = append(parts, task)
+	if len(parts) < part.Count {
+		g.groups[part.Group] = parts
+		return ManagerTask{}, false
+	}
+	delete(g.groups, part.Group)
+
+	slices.SortFunc(parts, func(a, b ManagerTask) int { return cmp.Compare(a.Part.Index, b.Part.Index) })
+	first := parts[0]
+	first.parts = parts
+	return first, true
+}
+
+// incomplete returns the groups that are still missing parts, each as its first part with the ones that arrived.
+func (g *partGroups) incomplete() []ManagerTask {
+	groups := make([]ManagerTask, 0, len(g.groups))
+	for _, parts := range g.groups {
+		slices.SortFunc(parts, func(a, b ManagerTask) int { return cmp.Compare(a.Part.Index, b.Part.Index) })
+		first := parts[0]
+		first.parts = parts
+		groups = append(groups, first)
+	}
+	slices.SortFunc(groups, func(a, b ManagerTask) int { return cmp.Compare(a.Part.Group, b.Part.Group) })
+	return groups
+}
+
+// missingParts describes which parts of an incomplete group didn't arrive.
+func missingParts(task ManagerTask) error {
+	var missing []string
+	for i := 1; i <= task.Part.Count; i++ {
+		if !slices.ContainsFunc(task.parts, func(t ManagerTask) bool { return t.Part.Index == i }) {
+			missing = append(missing, fmt.Sprint(i))
+		}
+	}
+	return fmt.Errorf("%w: %s of %d", ErrMissingParts, strings.Join(missing, ", "), task.Part.Count)
+}
+
+// DownloadParts downloads the parts of an episode one after another and joins them into the task output with the
+// concat demuxer of FFmpeg, which fixes up the timestamps between them. A part stopped at a limit ends the download,
+// the parts so far still get joined and the error is returned afterwards.
+func (d *Downloader) DownloadParts(ctx context.Context, task *DownloadTask, parts []*DownloadTask) error {
+	outputPath := task.FinalOutputPath()
+	if task.SkipExisting {
+		if _, err := os.Stat(outputPath); err == nil {
+			slogInfo("skipping download for %s: file already exists", filepath.Base(outputPath))
+			return nil
+		}
+	}
+	if d.ffmpegPath == "" {
+		return d.ffmpegRequired("multiple parts")
+	}
+
+	joinPath := outputPath
+	if d.tempDir != "" {
+		if _, err := os.Stat(outputPath); err == nil && !task.OverwriteFile {
+			return &os.PathError{Op: "open", Path: outputPath, Err: fs.ErrExist}
+		}
+		workDir, err := d.newWorkDir()
+		if err != nil {
+			return err
+		}
+		defer utils.RemoveDirAllIgnoreNotExists(workDir)
+		joinPath = filepath.Join(workDir, filepath.Base(outputPath))
+	}
+
+	// the same directory as the segments of HLS downloads, so --clean finds it after a crash
+	partsDir := strings.TrimSuffix(joinPath, filepath.Ext(joinPath)) + hlsPartsSuffix
+	list, err := newHlsParts(partsDir)
+	if err != nil {
+		return err
+	}
+	defer utils.RemoveDirAllIgnoreNotExists(partsDir)
+
+	var limitErr error
+	for i, part := range parts {
+		part.OutputPath = filepath.Join(partsDir, fmt.Sprintf("part_%05d", i))
+		part.OutputPathHasExtension = false
+		part.SetOverwriteFile(true).
+			SetParallelParts(task.ParallelParts).
+			SetAudioFormat(task.AudioFormat).
+			SetProgress(task.Progress).
+			SetCustomMessage(fmt.Sprintf("%s (part %d/%d)", filepath.Base(outputPath), i+1, len(parts)))
+
+		var exceeded *ErrLimitExceeded
+		// the subtitles of the parts would have to be shifted to be joined
+		err := d.DownloadToFile(withSubtitleBase(ctx, ""), part)
+		if err != nil && !errors.As(err, &exceeded) {
+			return fmt.Errorf("part %d: %w", i+1, err)
+		}
+		list.files = append(list.files, filepath.Base(part.FinalOutputPath()))
+		if err != nil {
+			limitErr = err
+			break
+		}
+	}
+
+	listPath, err := list.writeConcatList()
+	if err != nil {
+		return err
+	}
+	overwrite := "-n"
+	if task.OverwriteFile {
+		overwrite = "-y"
+	}
+	args := append([]string{overwrite, "-f", "concat", "-safe", "0", "-i", listPath, "-c", "copy"}, d.outputArgs(joinPath)...)
+	if err := d.runFfmpeg(ctx, append(args, joinPath)); err != nil {
+		utils.RemoveFileIgnoreNotExists(joinPath)
+		return fmt.Errorf("failed to join parts: %w", err)
+	}
+	if joinPath != outputPath {
+		if err := moveFromWorkDir(joinPath, outputPath); err != nil {
+			return err
+		}
+	}
+	return limitErr
+}
@@ -0,0 +1,75 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+)
+
+func part(group string, index, count int) ManagerTask {
+	return ManagerTask{DownloadUrl: group + "/" + string(rune('0'+index)), Part: downloaders.Part{Group: group, Index: index, Count: count}}
+}
+
+func TestPartGroups(t *testing.T) {
+	groups := newPartGroups()
+
+	for _, task := range []ManagerTask{part("a", 2, 3), part("a", 3, 3), part("a", 2, 3), part("a", 4, 3), part("b", 1, 2)} {
+		if _, complete := groups.add(task); complete {
+			t.Fatalf("\nExpected: group %s incomplete\nGot:      complete", task.Part.Group)
+		}
+	}
+
+	task, complete := groups.add(part("a", 1, 3))
+	if !complete {
+		t.Fatal("\nExpected: group a complete\nGot:      incomplete")
+	}
+	var urls []string
+	for _, p := range task.parts {
+		urls = append(urls, p.DownloadUrl)
+	}
+	if len(urls) != 3 || urls[0] != "a/1" || urls[1] != "a/2" || urls[2] != "a/3" {
+		t.Errorf("\nExpected: [a/1 a/2 a/3]\nGot:      %v", urls)
+	}
+
+	incomplete := groups.incomplete()
+	if len(incomplete) != 1 || incomplete[0].Part.Group != "b" {
+		t.Fatalf("\nExpected: group b incomplete\nGot:      %+v", incomplete)
+	}
+	if err := missingParts(incomplete[0]); !errors.Is(err, ErrMissingParts) || err.Error() != "missing parts of the episode: 2 of 2" {
+		t.Errorf("\nExpected: %q\nGot:      %v", "missing parts of the episode: 2 of 2", err)
+	}
+}
+
+func TestProgressDownloadsMissingParts(t *testing.T) {
+	policy := NewFailurePolicy(true, 0)
+	d := NewDownloader("", false, 0)
+	m := NewDownloadManager(d, 1, t.TempDir(), downloaders.SeriesInfo{Title: "Series"}, downloaders.SkipModeOff).
+		SetFailurePolicy(policy, "https://example.com/series")
+
+	task := part("s1e1", 1, 2)
+	task.EpisodeInfo = downloaders.EpisodeInfo{Season: 1, Episode: 1}
+	m.Submit(task)
+	m.Close()
+
+	if err := m.ProgressDownloads(context.Background()); !errors.Is(err, ErrMissingParts) {
+		t.Errorf("\nExpected: %v\nGot:      %v", ErrMissingParts, err)
+	}
+	if summary := m.Summary(); summary.Failed != 1 {
+		t.Errorf("\nExpected: 1 failed\nGot:      %+v", summary)
+	}
+	if failed := policy.Failed(); len(failed) != 1 || failed[0].Episode != 1 {
+		t.Errorf("\nExpected: episode 1 failed\nGot:      %+v", failed)
+	}
+}
+
+func TestDownloadPartsRequiresFFmpeg(t *testing.T) {
+	d := NewDownloader("", false, 0)
+	task := NewDownloadTask(filepath.Join(t.TempDir(), "episode"), "")
+	err := d.DownloadParts(context.Background(), task, []*DownloadTask{NewDownloadTask("", "a"), NewDownloadTask("", "b")})
+	if !errors.Is(err, ErrFFmpegRequired) {
+		t.Errorf("\nExpected: %v\nGot:      %v", ErrFFmpegRequired, err)
+	}
+}
@@ -0,0 +1,101 @@
+package download
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// pauseGate holds back new and running downloads while paused, see Downloader.Pause.
+type pauseGate struct {
+	mu     sync.Mutex
+	paused bool
+	// resumed gets closed on resume, waiters block on it while paused
+	resumed chan struct{}
+}
+
+func newPauseGate() *pauseGate {
+	return &pauseGate{resumed: make(chan struct{})}
+}
+
+// pause reports whether the state changed.
+func (g *pauseGate) pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		return false
+	}
+	g.paused = true
+	g.resumed = make(chan struct{})
+	return true
+}
+
+// resume reports whether the state changed.
+func (g *pauseGate) resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return false
+	}
+	g.paused = false
+	close(g.resumed)
+	return true
+}
+
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// wait blocks while paused or until ctx is done.
+func (g *pauseGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	paused, resumed := g.paused, g.resumed
+	g.mu.Unlock()
+	if !paused {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause stops all downloads of d at the next read and keeps new ones from starting until Resume.
+// The connections stay open, a long pause can make the server close them, which fails the download.
+func (d *Downloader) Pause() {
+	if d.pause.pause() {
+		slog.Info("Downloads paused")
+	}
+}
+
+// Resume continues the downloads stopped by Pause.
+func (d *Downloader) Resume() {
+	if d.pause.resume() {
+		slog.Info("Downloads resumed")
+	}
+}
+
+// Paused reports whether the downloads are paused.
+func (d *Downloader) Paused() bool {
+	return d.pause.isPaused()
+}
+
+// pausableReader waits for the gate before every read.
+type pausableReader struct {
+	r    io.Reader
+	gate *pauseGate
+	ctx  context.Context
+}
+
+func (r *pausableReader) Read(p []byte) (int, error) {
+	if err := r.gate.wait(r.ctx); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
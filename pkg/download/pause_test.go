@@ -0,0 +1,113 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+)
+
+func TestPauseGate(t *testing.T) {
+	g := newPauseGate()
+	if err := g.wait(context.Background()); err != nil {
+		t.Fatalf("not paused, but wait failed: %v", err)
+	}
+	if g.resume() {
+		t.Error("resume without pause changed the state")
+	}
+	if !g.pause() || g.pause() {
+		t.Error("only the first pause should change the state")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- g.wait(context.Background()) }()
+	select {
+	case <-done:
+		t.Fatal("wait returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	g.resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("\nExpected: %v\nGot:      %v", nil, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait didn't return after resume")
+	}
+
+	g.pause()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("\nExpected: %v\nGot:      %v", context.Canceled, err)
+	}
+}
+
+func TestPausableReader(t *testing.T) {
+	g := newPauseGate()
+	r := &pausableReader{r: strings.NewReader("abcdef"), gate: g, ctx: context.Background()}
+
+	buf := make([]byte, 3)
+	if n, _ := r.Read(buf); string(buf[:n]) != "abc" {
+		t.Fatalf("\nExpected: %s\nGot:      %s", "abc", buf[:n])
+	}
+
+	g.pause()
+	read := make(chan string, 1)
+	go func() {
+		n, _ := r.Read(buf)
+		read <- string(buf[:n])
+	}()
+	select {
+	case got := <-read:
+		t.Fatalf("read %q while paused", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	g.resume()
+	if got := <-read; got != "def" {
+		t.Errorf("\nExpected: %s\nGot:      %s", "def", got)
+	}
+}
+
+func TestProgressDownloadsPaused(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write([]byte("episode"))
+	}))
+	defer server.Close()
+
+	d := NewDownloader("", false, 0)
+	d.Pause()
+	m := NewDownloadManager(d, 1, t.TempDir(), downloaders.SeriesInfo{Title: "Series"}, downloaders.SkipModeOff)
+	m.Submit(ManagerTask{DownloadUrl: server.URL, EpisodeInfo: downloaders.EpisodeInfo{Season: 1, Episode: 1}})
+	m.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- m.ProgressDownloads(context.Background()) }()
+
+	time.Sleep(100 * time.Millisecond)
+	if n := requests.Load(); n != 0 {
+		t.Fatalf("%d requests while paused", n)
+	}
+	d.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("download didn't finish after resume")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("\nExpected: %d requests\nGot:      %d", 1, n)
+	}
+}
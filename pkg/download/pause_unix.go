@@ -0,0 +1,32 @@
+//go:build unix
+
+package download
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// HandlePauseSignals pauses the downloads on SIGUSR1 and resumes them on SIGUSR2, until ctx is done.
+func (d *Downloader) HandlePauseSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				if sig == syscall.SIGUSR1 {
+					d.Pause()
+				} else {
+					d.Resume()
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package download
+
+import (
+	"context"
+	"log/slog"
+)
+
+// HandlePauseSignals does nothing, Windows has no SIGUSR1 and SIGUSR2.
+func (d *Downloader) HandlePauseSignals(ctx context.Context) {
+	slog.Debug("Pausing with signals is not supported on Windows")
+}
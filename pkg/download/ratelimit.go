@@ -0,0 +1,48 @@
+package download
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitedReader throttles the reads from r to the limiter, which is usually shared by all downloads of a
+// Downloader so --rate applies to all of them together.
+type RateLimitedReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+	ctx     context.Context
+}
+
+// NewRateLimitedReader reads from r no faster than limiter allows. Waiting for the limiter stops once ctx is done.
+// A nil limiter doesn't throttle.
+func NewRateLimitedReader(r io.Reader, limiter *rate.Limiter, ctx context.Context) *RateLimitedReader {
+	return &RateLimitedReader{r: r, limiter: limiter, ctx: ctx}
+}
+
+func (r *RateLimitedReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if r.limiter == nil {
+		return r.r.Read(p)
+	}
+	// WaitN fails for more than the burst size, which is a second worth of data
+	if burst := r.limiter.Burst(); burst > 0 && len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.r.Read(p)
+	// the burst can shrink while reading if the rate schedule switches, so wait in chunks of the current one
+	for remaining := n; remaining > 0; {
+		chunk := remaining
+		if burst := r.limiter.Burst(); burst > 0 && chunk > burst {
+			chunk = burst
+		}
+		if err := r.limiter.WaitN(r.ctx, chunk); err != nil {
+			return n, err
+		}
+		remaining -= chunk
+	}
+	return n, err
+}
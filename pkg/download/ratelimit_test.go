@@ -0,0 +1,61 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitedReaderHonorsLimit(t *testing.T) {
+	// the first burst is free, the other 50 KB take half a second at 100 KB/s
+	limiter := rate.NewLimiter(100_000, 10_000)
+	data := bytes.Repeat([]byte("x"), 60_000)
+
+	start := time.Now()
+	got, err := io.ReadAll(NewRateLimitedReader(bytes.NewReader(data), limiter, context.Background()))
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(data) {
+		t.Errorf("\nExpected: %d bytes\nGot:      %d", len(data), len(got))
+	}
+	if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("\nExpected: about 500ms\nGot:      %v", elapsed)
+	}
+}
+
+func TestRateLimitedReaderCancel(t *testing.T) {
+	// after the first burst the next read waits a second, the cancel has to end it right away
+	limiter := rate.NewLimiter(1000, 1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := io.Copy(io.Discard, NewRateLimitedReader(strings.NewReader(strings.Repeat("x", 10_000)), limiter, ctx))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("\nExpected: %v\nGot:      %v", context.Canceled, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("\nExpected: the read to stop on cancel\nGot:      it took %v", elapsed)
+	}
+
+	// a reader of a canceled context doesn't read at all
+	r := NewRateLimitedReader(strings.NewReader("x"), nil, ctx)
+	if n, err := r.Read(make([]byte, 1)); n != 0 || !errors.Is(err, context.Canceled) {
+		t.Errorf("\nExpected: 0 bytes, %v\nGot:      %d bytes, %v", context.Canceled, n, err)
+	}
+}
+
+func TestRateLimitedReaderWithoutLimiter(t *testing.T) {
+	got, err := io.ReadAll(NewRateLimitedReader(strings.NewReader("unthrottled"), nil, context.Background()))
+	if err != nil || string(got) != "unthrottled" {
+		t.Errorf("\nExpected: %q\nGot:      %q (%v)", "unthrottled", got, err)
+	}
+}
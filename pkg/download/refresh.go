@@ -0,0 +1,166 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+)
+
+// maxRefreshes is how often one download may resolve its stream again, signed URLs usually last long enough for one more try.
+const maxRefreshes = 3
+
+// maxResumes is how often a plain download continues with a range request after the connection broke.
+const maxResumes = 5
+
+// isRefused reports whether the server refused the URL itself, which is how expired signed URLs fail. Some hosters
+// answer expired tokens with 410 Gone.
+func isRefused(err error) bool {
+	var statusErr *ErrHTTPStatus
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	switch statusErr.Code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+// refresher hands out new URLs for a download, at most maxRefreshes times. The parts of a parallel download share it.
+type refresher struct {
+	refresh downloaders.RefreshFunc
+
+	mu      sync.Mutex
+	used    int
+	url     string
+	referer string
+}
+
+// next resolves the stream again. It returns the original error if there is nothing to refresh.
+// stale is the URL the server refused, if another part already replaced it the new one is returned right away.
+// An empty stale always resolves again.
+func (r *refresher) next(ctx context.Context, cause error, stale string) (string, string, error) {
+	if r == nil || r.refresh == nil {
+		return "", "", cause
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stale != "" && r.url != "" && r.url != stale {
+		return r.url, r.referer, nil
+	}
+	if r.used >= maxRefreshes {
+		return "", "", cause
+	}
+	r.used++
+	slog.Info("The server refused the stream URL, resolving it again", "error", cause, "attempt", r.used)
+	url, referer, err := r.refresh(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("%w (refreshing the URL failed: %w)", cause, err)
+	}
+	r.url, r.referer = url, referer
+	return url, referer, nil
+}
+
+// getRefreshing is get, but a refused URL gets replaced by a fresh one. The URL and referer that worked are returned as well.
+func (d *Downloader) getRefreshing(ctx context.Context, url, referer string, r *refresher) (*http.Response, string, string, error) {
+	for {
+		resp, err := d.get(ctx, url, referer)
+		if err == nil || !isRefused(err) {
+			return resp, url, referer, err
+		}
+		if url, referer, err = r.next(ctx, err, url); err != nil {
+			return nil, "", "", err
+		}
+	}
+}
+
+// getRange requests the bytes from offset to end of a file, the rest of it if end is negative.
+// A server that ignores the range can't be resumed.
+func (d *Downloader) getRange(ctx context.Context, url, referer string, offset, end int64) (*http.Response, error) {
+	req, err := d.newRequest(ctx, url, referer)
+	if err != nil {
+		return nil, err
+	}
+	byteRange := "bytes=" + strconv.FormatInt(offset, 10) + "-"
+	if end >= 0 {
+		byteRange += strconv.FormatInt(end, 10)
+	}
+	req.Header.Set("Range", byteRange)
+
+	resp, err := d.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return nil, errors.New("the server doesn't support resuming")
+		}
+		return nil, &ErrHTTPStatus{Code: resp.StatusCode, Url: url}
+	}
+	return resp, nil
+}
+
+// resumingBody continues a plain download with a range request where the connection broke.
+// If the server refuses the URL by then, the refresher resolves a new one.
+type resumingBody struct {
+	ctx       context.Context
+	d         *Downloader
+	body      io.ReadCloser
+	url       string
+	referer   string
+	refresher *refresher
+	offset    int64
+	// end is the last byte of a part of a parallel download, -1 reads to the end of the file
+	end     int64
+	resumes int
+}
+
+func (r *resumingBody) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == nil || err == io.EOF || r.ctx.Err() != nil || r.resumes >= maxResumes {
+		return n, err
+	}
+
+	r.resumes++
+	slog.Debug("Download interrupted, resuming", "url", r.url, "offset", r.offset, "error", err)
+	if resumeErr := r.reopen(); resumeErr != nil {
+		return n, fmt.Errorf("%w (resuming failed: %w)", err, resumeErr)
+	}
+	return n, nil
+}
+
+func (r *resumingBody) reopen() error {
+	for {
+		resp, err := r.d.getRange(r.ctx, r.url, r.referer, r.offset, r.end)
+		if err == nil {
+			if r.body != nil {
+				r.body.Close()
+			}
+			r.body = resp.Body
+			return nil
+		}
+		if !isRefused(err) {
+			return err
+		}
+		if r.url, r.referer, err = r.refresher.next(r.ctx, err, r.url); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *resumingBody) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
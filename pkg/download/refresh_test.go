@@ -0,0 +1,169 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRefreshPlainDownload(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		rangeHeader := r.Header.Get("Range")
+		switch {
+		case token == "expired":
+			w.WriteHeader(http.StatusForbidden)
+		case rangeHeader == "" && token == "old":
+			// the connection breaks halfway through
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write([]byte(content[:len(content)/2]))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		case rangeHeader != "" && token == "old":
+			// and by then the signature expired
+			w.WriteHeader(http.StatusForbidden)
+		case rangeHeader != "":
+			offset, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rangeHeader, "bytes="), "-"))
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte(content[offset:]))
+		default:
+			w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		token     string
+		refreshes int32
+	}{
+		{"expired mid-download", "old", 1},
+		{"expired in the queue", "expired", 1},
+	}
+
+	for _, tt := range tests {
+		var refreshes atomic.Int32
+		output := filepath.Join(t.TempDir(), "episode")
+		task := NewDownloadTask(output, server.URL+"/video.mp4?token="+tt.token).
+			SetRefresh(func(ctx context.Context) (string, string, error) {
+				refreshes.Add(1)
+				return server.URL + "/video.mp4?token=new", "", nil
+			})
+
+		d := NewDownloader("", false, 0)
+		if err := d.DownloadToFile(context.Background(), task); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, _ := os.ReadFile(task.FinalOutputPath())
+		if string(got) != content {
+			t.Errorf("%s\nExpected: %d bytes\nGot:      %d bytes", tt.name, len(content), len(got))
+		}
+		if refreshes.Load() != tt.refreshes {
+			t.Errorf("%s\nExpected: %d refreshes\nGot:      %d", tt.name, tt.refreshes, refreshes.Load())
+		}
+	}
+}
+
+func TestRefreshWithoutRefreshFunc(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	d := NewDownloader("", false, 0)
+	err := d.DownloadToFile(context.Background(), NewDownloadTask(filepath.Join(t.TempDir(), "episode"), server.URL+"/video.mp4"))
+	if !isRefused(err) {
+		t.Errorf("\nExpected: 403\nGot:      %v", err)
+	}
+}
+
+func TestRefreshHLS(t *testing.T) {
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts?token=%[1]s\n#EXTINF:4,\nseg1.ts?token=%[1]s\n#EXTINF:4,\nseg2.ts?token=%[1]s\n#EXT-X-ENDLIST\n"
+	var served atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		switch {
+		case strings.HasSuffix(r.URL.Path, ".m3u8"):
+			fmt.Fprintf(w, playlist, token)
+		// the old signature stops working after the first segment
+		case token == "old" && served.Load() >= 1:
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			served.Add(1)
+			w.Write([]byte(strings.TrimSuffix(filepath.Base(r.URL.Path), ".ts") + "|"))
+		}
+	}))
+	defer server.Close()
+
+	output := filepath.Join(t.TempDir(), "episode")
+	task := NewDownloadTask(output, server.URL+"/index.m3u8?token=old").
+		SetRefresh(func(ctx context.Context) (string, string, error) {
+			return server.URL + "/index.m3u8?token=new", "", nil
+		})
+
+	d := NewDownloader("", false, 0)
+	if err := d.DownloadToFile(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	// without FFmpeg the segments end up in the .ts fallback
+	got, err := os.ReadFile(hlsFallbackPath(task.FinalOutputPath()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "seg0|seg1|seg2|"; string(got) != expected {
+		t.Errorf("\nExpected: %s\nGot:      %s", expected, got)
+	}
+}
+
+func TestRefreshLockedFile(t *testing.T) {
+	const embed = "https://vidoza.net/embed-abc.html"
+	// like the CDN of vidoza, the file is locked to the embed page and the token expires
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != embed || r.Header.Get("Origin") != "https://vidoza.net" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		// the signature covers the query as it is
+		if r.URL.RawQuery != "token=a%2Fb&expires=2&stream=1" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.Write([]byte("video"))
+	}))
+	defer server.Close()
+
+	refreshes := 0
+	path := filepath.Join(t.TempDir(), "episode")
+	task := NewDownloadTask(path, server.URL+"/v.mp4?token=a%2Fb&expires=1&stream=1").
+		SetReferer(embed).
+		SetRefresh(func(ctx context.Context) (string, string, error) {
+			refreshes++
+			return server.URL + "/v.mp4?token=a%2Fb&expires=2&stream=1", embed, nil
+		})
+
+	d := NewDownloader("", false, 0)
+	if err := d.DownloadToFile(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	if refreshes != 1 {
+		t.Errorf("\nExpected: 1 refresh for the expired token\nGot:      %d", refreshes)
+	}
+	if data, _ := os.ReadFile(task.FinalOutputPath()); string(data) != "video" {
+		t.Errorf("\nExpected: %q\nGot:      %q", "video", data)
+	}
+
+	// without the referer no token helps
+	err := d.DownloadToFile(context.Background(), NewDownloadTask(filepath.Join(t.TempDir(), "episode"), server.URL+"/v.mp4?token=a%2Fb&expires=2&stream=1"))
+	if !isRefused(err) {
+		t.Errorf("\nExpected: 403\nGot:      %v", err)
+	}
+}
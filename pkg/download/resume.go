@@ -0,0 +1,220 @@
+package download
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/grafov/m3u8"
+)
+
+// hlsProgressName is the file in the segment directory of a HLS download that records which segments are done.
+const hlsProgressName = "progress.json"
+
+// hlsHeadSize is how many bytes at the start of every part are recorded, to recognize them on resume.
+const hlsHeadSize = 32
+
+// hlsProgress is saved after every segment, so a download that was interrupted, by a crash or a cancel, continues
+// with the next segment instead of starting over. The segments are in order, so all up to Segments are in the parts.
+type hlsProgress struct {
+	// Playlist identifies the media playlist, the segments of another one are never reused
+	Playlist string        `json:"playlist"`
+	Segments int           `json:"segments"`
+	Bytes    int64         `json:"bytes"`
+	Duration float64       `json:"duration"`
+	MapURI   string        `json:"map_uri,omitempty"`
+	Files    []hlsPartFile `json:"files"`
+}
+
+type hlsPartFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// Head holds the first bytes of the part, decrypted like the rest of it
+	Head []byte `json:"head"`
+}
+
+// playlistFingerprint identifies a media playlist by its path and its segments. Queries are left out, as they
+// usually carry tokens that are different every time the stream is resolved.
+func playlistFingerprint(playlistURL *url.URL, playlist *m3u8.MediaPlaylist) string {
+	h := sha256.New()
+	io.WriteString(h, playlistURL.Path)
+	for _, segment := range playlist.Segments {
+		if segment == nil {
+			break
+		}
+		uri, _, _ := strings.Cut(segment.URI, "?")
+		io.WriteString(h, "\n"+uri+" "+strconv.FormatFloat(segment.Duration, 'f', -1, 64))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// openHlsParts returns the parts of an earlier attempt to download playlist into dir together with its progress,
+// with the last part open to append the next segment. If there is nothing to resume or the parts don't match the
+// progress, dir is cleared and progress is nil.
+func openHlsParts(dir, playlist string) (*hlsParts, *hlsProgress, error) {
+	parts, err := newHlsParts(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	parts.playlist = playlist
+
+	progress, err := parts.resume()
+	if err != nil {
+		slog.Info("Can't resume the download, starting over", "path", dir, "reason", err)
+	}
+	if progress == nil {
+		if err := clearDir(dir); err != nil {
+			return nil, nil, err
+		}
+	}
+	return parts, progress, nil
+}
+
+// resume validates the parts against the recorded progress and cuts off what was written after it, e.g. half a
+// segment. It returns nil without an error if there is no progress.
+func (p *hlsParts) resume() (*hlsProgress, error) {
+	data, err := os.ReadFile(filepath.Join(p.dir, hlsProgressName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var progress hlsProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return nil, fmt.Errorf("invalid progress: %w", err)
+	}
+	if progress.Playlist != p.playlist {
+		return nil, fmt.Errorf("the stream changed")
+	}
+	if progress.Segments == 0 || len(progress.Files) == 0 {
+		return nil, nil
+	}
+
+	for _, file := range progress.Files {
+		if err := validatePart(filepath.Join(p.dir, file.Name), file); err != nil {
+			return nil, err
+		}
+	}
+	keep := map[string]bool{hlsProgressName: true}
+	for _, file := range progress.Files {
+		keep[file.Name] = true
+	}
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !keep[entry.Name()] {
+			os.RemoveAll(filepath.Join(p.dir, entry.Name()))
+		}
+	}
+
+	last := progress.Files[len(progress.Files)-1]
+	current, err := os.OpenFile(filepath.Join(p.dir, last.Name), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range progress.Files {
+		p.files = append(p.files, file.Name)
+		p.sizes = append(p.sizes, file.Size)
+		p.heads = append(p.heads, file.Head)
+	}
+	p.current = current
+	return &progress, nil
+}
+
+// validatePart checks that the part at path still starts like it did and holds at least the recorded bytes, then
+// truncates it to them.
+func validatePart(path string, file hlsPartFile) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < file.Size {
+		return fmt.Errorf("%s has %d bytes, %d were recorded", file.Name, info.Size(), file.Size)
+	}
+	head := make([]byte, len(file.Head))
+	if _, err := io.ReadFull(f, head); err != nil || !bytes.Equal(head, file.Head) {
+		return fmt.Errorf("%s was changed", file.Name)
+	}
+	return f.Truncate(file.Size)
+}
+
+// save records that the first segments of the playlist are in the parts. The file is replaced atomically, so a
+// crash leaves either the old or the new progress.
+func (p *hlsParts) save(segments int, bytes int64, duration float64, mapURI string) error {
+	if p.stream != nil {
+		return nil
+	}
+	progress := hlsProgress{
+		Playlist: p.playlist,
+		Segments: segments,
+		Bytes:    bytes,
+		Duration: duration,
+		MapURI:   mapURI,
+		Files:    make([]hlsPartFile, len(p.files)),
+	}
+	for i, name := range p.files {
+		progress.Files[i] = hlsPartFile{Name: name, Size: p.sizes[i], Head: p.heads[i]}
+	}
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(p.dir, hlsProgressName)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// resumable reports whether the parts hold segments a later attempt can continue with.
+func (p *hlsParts) resumable() bool {
+	if p.stream != nil {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(p.dir, hlsProgressName))
+	return err == nil
+}
+
+// clearDir removes everything inside dir but dir itself.
+func clearDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// segmentDir is where the segments of the HLS download of outputPath are collected. It doesn't depend on the work
+// directory of the download, so the next attempt finds them again.
+func (d *Downloader) segmentDir(outputPath string) string {
+	if d.tempDir == "" {
+		return outputPath + hlsPartsSuffix
+	}
+	// output names only have to be unique within their directory
+	sum := sha256.Sum256([]byte(outputPath))
+	return filepath.Join(d.tempDir, fmt.Sprintf("%s-%x%s", filepath.Base(outputPath), sum[:4], hlsPartsSuffix))
+}
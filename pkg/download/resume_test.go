@@ -0,0 +1,73 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestOpenHlsParts(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "episode.mp4.parts")
+	parts, progress, err := openHlsParts(dir, "playlist")
+	if err != nil || progress != nil {
+		t.Fatalf("\nExpected: nothing to resume\nGot:      %+v (%v)", progress, err)
+	}
+	parts.Write([]byte("seg0"))
+	parts.start([]byte("init"))
+	parts.Write([]byte("seg1"))
+	if err := parts.save(2, 8, 8, "init.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	// half of the next segment, written before the crash
+	parts.Write([]byte("se"))
+	parts.close()
+
+	parts, progress, err = openHlsParts(dir, "playlist")
+	if err != nil || progress == nil {
+		t.Fatalf("\nExpected: the progress\nGot:      %+v (%v)", progress, err)
+	}
+	if progress.Segments != 2 || progress.Bytes != 8 || progress.MapURI != "init.mp4" {
+		t.Errorf("\nExpected: 2 segments with 8 bytes\nGot:      %+v", progress)
+	}
+	if expected := []string{"part_00000.ts", "part_00001.mp4"}; !slices.Equal(parts.files, expected) {
+		t.Errorf("\nExpected: %v\nGot:      %v", expected, parts.files)
+	}
+	parts.Write([]byte("seg2"))
+	parts.close()
+	if got, _ := os.ReadFile(filepath.Join(dir, "part_00001.mp4")); string(got) != "initseg1seg2" {
+		t.Errorf("\nExpected: the half segment to be cut off\nGot:      %q", got)
+	}
+
+	// another stream doesn't reuse the segments
+	if _, progress, _ := openHlsParts(dir, "other"); progress != nil {
+		t.Errorf("\nExpected: nothing to resume for another playlist\nGot:      %+v", progress)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("\nExpected: the directory to be cleared\nGot:      %v", entries)
+	}
+}
+
+func TestOpenHlsPartsChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(path string)
+	}{
+		{"truncated", func(path string) { os.Truncate(path, 2) }},
+		{"overwritten", func(path string) { os.WriteFile(path, []byte("xxxxxxxx"), 0644) }},
+		{"removed", func(path string) { os.Remove(path) }},
+	}
+
+	for _, tt := range tests {
+		dir := filepath.Join(t.TempDir(), "episode.mp4.parts")
+		parts, _, _ := openHlsParts(dir, "playlist")
+		parts.Write([]byte("seg0seg1"))
+		parts.save(2, 8, 8, "")
+		parts.close()
+
+		tt.change(filepath.Join(dir, "part_00000.ts"))
+		if _, progress, err := openHlsParts(dir, "playlist"); err != nil || progress != nil {
+			t.Errorf("%s\nExpected: starting over\nGot:      %+v (%v)", tt.name, progress, err)
+		}
+	}
+}
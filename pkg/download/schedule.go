@@ -0,0 +1,142 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const minutesPerDay = 24 * 60
+
+// RateWindow limits the download rate between two times of the day. End may be before Start, the window
+// then wraps around midnight.
+type RateWindow struct {
+	// Start and End are minutes since midnight, End is exclusive
+	Start int
+	End   int
+	// Rate is in bytes per second, 0 means unlimited
+	Rate float64
+}
+
+func (w RateWindow) contains(minute int) bool {
+	if w.Start < w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+func (w RateWindow) String() string {
+	return fmt.Sprintf("%s-%s", formatMinute(w.Start), formatMinute(w.End))
+}
+
+// RateSchedule is a set of windows covering the whole day without overlaps, see NewRateSchedule.
+type RateSchedule struct {
+	windows []RateWindow
+}
+
+// NewRateSchedule checks that every minute of the day is covered by exactly one window.
+func NewRateSchedule(windows []RateWindow) (*RateSchedule, error) {
+	var owner [minutesPerDay]int
+	for i, w := range windows {
+		if w.Start < 0 || w.Start >= minutesPerDay || w.End < 0 || w.End > minutesPerDay {
+			return nil, fmt.Errorf("window %s is outside of the day", w)
+		}
+		if w.Start == w.End {
+			return nil, fmt.Errorf("window %s is empty", w)
+		}
+		for m := 0; m < minutesPerDay; m++ {
+			if !w.contains(m) {
+				continue
+			}
+			if owner[m] != 0 {
+				return nil, fmt.Errorf("window %s overlaps with %s", w, windows[owner[m]-1])
+			}
+			owner[m] = i + 1
+		}
+	}
+
+	for m := 0; m < minutesPerDay; m++ {
+		if owner[m] != 0 {
+			continue
+		}
+		end := m
+		for end < minutesPerDay && owner[end] == 0 {
+			end++
+		}
+		return nil, fmt.Errorf("the schedule doesn't cover %s-%s", formatMinute(m), formatMinute(end))
+	}
+
+	return &RateSchedule{windows: windows}, nil
+}
+
+// RateAt returns the rate for the given time in its location, 0 means unlimited.
+func (s *RateSchedule) RateAt(t time.Time) float64 {
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range s.windows {
+		if w.contains(minute) {
+			return w.Rate
+		}
+	}
+	return 0
+}
+
+// NextChange returns the start of the window following the one active at t.
+func (s *RateSchedule) NextChange(t time.Time) time.Time {
+	minute := t.Hour()*60 + t.Minute()
+
+	next := -1
+	for _, w := range s.windows {
+		// minutes until the window starts, a window starting right now is the next one in a day
+		until := (w.Start - minute + minutesPerDay) % minutesPerDay
+		if until == 0 {
+			until = minutesPerDay
+		}
+		if next == -1 || until < next {
+			next = until
+		}
+	}
+	// wall clock minutes, so DST switches don't shift the windows
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, minute+next, 0, 0, t.Location())
+}
+
+// SetRateSchedule switches the rate limit whenever the schedule says so, until ctx is done.
+// It has to be called before the first download starts, the rate of the current window is applied right away.
+func (d *Downloader) SetRateSchedule(ctx context.Context, schedule *RateSchedule) {
+	if d.limiter == nil {
+		d.limiter = rate.NewLimiter(rate.Inf, 0)
+	}
+	d.applyRate("Rate schedule", schedule.RateAt(time.Now()))
+
+	go func() {
+		for {
+			timer := time.NewTimer(time.Until(schedule.NextChange(time.Now())))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			d.applyRate("Rate schedule", schedule.RateAt(time.Now()))
+		}
+	}()
+}
+
+// applyRate changes the limit of the running downloads, reason names the feature that changed it in the log.
+func (d *Downloader) applyRate(reason string, bytesPerSecond float64) {
+	if bytesPerSecond <= 0 {
+		d.limiter.SetLimit(rate.Inf)
+		d.limiter.SetBurst(0)
+		slog.Info(reason + ": unlimited")
+		return
+	}
+	d.limiter.SetLimit(rate.Limit(bytesPerSecond))
+	d.limiter.SetBurst(int(bytesPerSecond))
+	slog.Info(reason+": limiting download rate", "bytes_per_second", int64(bytesPerSecond))
+}
+
+func formatMinute(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
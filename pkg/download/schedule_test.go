@@ -0,0 +1,64 @@
+package download
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateSchedule(t *testing.T) {
+	// 08:00-18:00 limited, the rest of the day unlimited
+	schedule, err := NewRateSchedule([]RateWindow{
+		{Start: 8 * 60, End: 18 * 60, Rate: 1000},
+		{Start: 18 * 60, End: 8 * 60, Rate: 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		at         time.Duration
+		rate       float64
+		nextChange time.Duration
+	}{
+		{0, 0, 8 * time.Hour},
+		{7*time.Hour + 59*time.Minute, 0, 8 * time.Hour},
+		{8 * time.Hour, 1000, 18 * time.Hour},
+		{17*time.Hour + 30*time.Minute, 1000, 18 * time.Hour},
+		{18 * time.Hour, 0, 32 * time.Hour},
+		{23 * time.Hour, 0, 32 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		at := day.Add(tt.at)
+		if got := schedule.RateAt(at); got != tt.rate {
+			t.Errorf("RateAt(%s)\nExpected: %v\nGot:      %v", at.Format("15:04"), tt.rate, got)
+		}
+		if got := schedule.NextChange(at); !got.Equal(day.Add(tt.nextChange)) {
+			t.Errorf("NextChange(%s)\nExpected: %v\nGot:      %v", at.Format("15:04"), day.Add(tt.nextChange), got)
+		}
+	}
+}
+
+func TestRateScheduleValidation(t *testing.T) {
+	tests := []struct {
+		windows []RateWindow
+		valid   bool
+	}{
+		{[]RateWindow{{Start: 0, End: 24 * 60}}, true},
+		{[]RateWindow{{Start: 22 * 60, End: 6 * 60}, {Start: 6 * 60, End: 22 * 60}}, true},
+		// gap between 12:00 and 13:00
+		{[]RateWindow{{Start: 0, End: 12 * 60}, {Start: 13 * 60, End: 24 * 60}}, false},
+		// overlap between 11:00 and 12:00
+		{[]RateWindow{{Start: 0, End: 12 * 60}, {Start: 11 * 60, End: 24 * 60}}, false},
+		{[]RateWindow{{Start: 8 * 60, End: 8 * 60}}, false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRateSchedule(tt.windows)
+		if (err == nil) != tt.valid {
+			t.Errorf("%v\nExpected: valid=%v\nGot:      %v", tt.windows, tt.valid, err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package download
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FragmentedMovflags make FFmpeg write mp4 files as fragments, front to back like a stream. Plain mp4 files need to
+// seek back to the start for the index, which some mounts of network shares can't do.
+const FragmentedMovflags = "+frag_keyframe+empty_moov+default_base_moof"
+
+// seekContainers are the extensions of the outputs that need to seek.
+var seekContainers = []string{".mp4", ".m4a", ".mov"}
+
+// seekErrorMarkers are what FFmpeg prints if the output can't seek, e.g. on FUSE mounts of FTP or SMB shares.
+var seekErrorMarkers = []string{
+	"does not support non seekable output",
+	"illegal seek",
+	"output file for the second pass",
+	"operation not supported",
+}
+
+// NeedsSeek reports whether FFmpeg has to seek in the output to write it.
+func NeedsSeek(output string) bool {
+	return slices.Contains(seekContainers, strings.ToLower(filepath.Ext(output)))
+}
+
+// IsSeekError reports whether the output of a failed FFmpeg run says that the output file can't seek.
+func IsSeekError(output string) bool {
+	output = strings.ToLower(output)
+	return slices.ContainsFunc(seekErrorMarkers, func(marker string) bool {
+		return strings.Contains(output, marker)
+	})
+}
+
+// StreamableArgs rewrites FFmpeg arguments ending with an mp4 output to write a fragmented mp4 instead. Faststart
+// is dropped, it needs a second pass over the file.
+func StreamableArgs(args []string) []string {
+	streamable := make([]string, 0, len(args)+2)
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] != "-movflags" || i+1 >= len(args)-1 {
+			streamable = append(streamable, args[i])
+			continue
+		}
+		i++
+		var flags []string
+		for _, flag := range strings.FieldsFunc(args[i], func(r rune) bool { return r == '+' }) {
+			if flag != "faststart" {
+				flags = append(flags, "+"+flag)
+			}
+		}
+		if len(flags) > 0 {
+			streamable = append(streamable, "-movflags", strings.Join(flags, ""))
+		}
+	}
+	return append(streamable, "-movflags", FragmentedMovflags, args[len(args)-1])
+}
+
+// ffmpegError is a failed FFmpeg run with the end of what it printed, the reason is in the last lines.
+type ffmpegError struct {
+	err    error
+	output string
+}
+
+func (e *ffmpegError) Error() string {
+	lines := strings.Split(strings.TrimSpace(e.output), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return fmt.Sprintf("ffmpeg failed: %v: %s", e.err, last)
+	}
+	return fmt.Sprintf("ffmpeg failed: %v", e.err)
+}
+
+func (e *ffmpegError) Unwrap() error {
+	return e.err
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,98 @@
+package download
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStreamableArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{
+			[]string{"-y", "-i", "in.ts", "-c", "copy", "out.mp4"},
+			[]string{"-y", "-i", "in.ts", "-c", "copy", "-movflags", FragmentedMovflags, "out.mp4"},
+		},
+		// faststart needs a second pass over the file
+		{
+			[]string{"-i", "in.ts", "-movflags", "+faststart", "-sn", "out.mp4"},
+			[]string{"-i", "in.ts", "-sn", "-movflags", FragmentedMovflags, "out.mp4"},
+		},
+		{
+			[]string{"-i", "in.ts", "-movflags", "+faststart+use_metadata_tags", "out.mp4"},
+			[]string{"-i", "in.ts", "-movflags", "+use_metadata_tags", "-movflags", FragmentedMovflags, "out.mp4"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := StreamableArgs(tt.args); !slices.Equal(got, tt.expected) {
+			t.Errorf("%v\nExpected: %v\nGot:      %v", tt.args, tt.expected, got)
+		}
+	}
+}
+
+func TestIsSeekError(t *testing.T) {
+	tests := []struct {
+		output   string
+		expected bool
+	}{
+		{"[mp4 @ 0x55] muxer does not support non seekable output\nCould not write header", true},
+		{"[mp4 @ 0x55] Unable to re-open out.mp4 output file for the second pass (faststart)", true},
+		{"[file @ 0x55] Seek failed: Illegal seek", true},
+		{"out.mp4: No space left on device", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsSeekError(tt.output); got != tt.expected {
+			t.Errorf("%q\nExpected: %v\nGot:      %v", tt.output, tt.expected, got)
+		}
+	}
+	if !NeedsSeek("/mnt/share/Episode.MP4") || NeedsSeek("/mnt/share/Episode.mkv") || NeedsSeek("pipe:1") {
+		t.Errorf("\nExpected: only mp4 needs to seek")
+	}
+}
+
+func TestRunFfmpegWithoutSeek(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake FFmpeg is a shell script")
+	}
+	// fails like an mp4 muxer on a FUSE mount unless the output is fragmented
+	dir := t.TempDir()
+	ffmpegPath := filepath.Join(dir, "ffmpeg")
+	os.WriteFile(ffmpegPath, []byte(`#!/bin/sh
+echo "$@" >> "$0.log"
+case "$*" in
+*frag_keyframe*) exit 0 ;;
+esac
+echo "[mp4 @ 0x55] muxer does not support non seekable output" >&2
+exit 1
+`), 0755)
+
+	d := NewDownloader("", false, 0)
+	d.SetFfmpegPath(ffmpegPath)
+	output := filepath.Join(dir, "episode.mp4")
+	if err := d.runFfmpeg(context.Background(), []string{"-y", "-i", "in.ts", "-movflags", "+faststart", output}); err != nil {
+		t.Fatal(err)
+	}
+	// the next output skips the failing attempt, mkv never needed to seek
+	if err := d.runFfmpeg(context.Background(), []string{"-y", "-i", "in.ts", output}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.runFfmpeg(context.Background(), []string{"-y", "-i", "in.ts", filepath.Join(dir, "episode.mkv")}); err == nil || !strings.Contains(err.Error(), "does not support non seekable output") {
+		t.Errorf("\nExpected: the reason of FFmpeg in the error\nGot:      %v", err)
+	}
+
+	log, _ := os.ReadFile(ffmpegPath + ".log")
+	runs := strings.Split(strings.TrimSpace(string(log)), "\n")
+	if len(runs) != 4 || strings.Contains(runs[0], "frag_keyframe") || !strings.Contains(runs[1], "frag_keyframe") ||
+		strings.Contains(runs[1], "faststart") || !strings.Contains(runs[2], "frag_keyframe") {
+		t.Errorf("\nExpected: mp4, fragmented mp4, fragmented mp4, mkv\nGot:      %q", runs)
+	}
+}
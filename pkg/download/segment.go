@@ -0,0 +1,138 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/grafov/m3u8"
+)
+
+// DefaultSegmentRetries is how often a failed segment is requested again from one host before moving on to the next
+// one, see Downloader.SetSegmentRetries.
+const DefaultSegmentRetries = 2
+
+// SegmentSource holds every URL a HLS segment can be fetched from. The first one belongs to the chosen variant,
+// the others point to the same segment on the alternate hosts of the master playlist.
+type SegmentSource struct {
+	Urls []string
+}
+
+// NewSegmentSource resolves the segment uri against the media playlist and each alternate playlist.
+// Absolute segment URLs are only moved to an alternate host if they are on the host of the media playlist.
+func NewSegmentSource(uri string, playlist *url.URL, alternates []*url.URL) (SegmentSource, error) {
+	primary, err := playlist.Parse(uri)
+	if err != nil {
+		return SegmentSource{}, err
+	}
+	ref, err := url.Parse(uri)
+	if err != nil {
+		return SegmentSource{}, err
+	}
+
+	source := SegmentSource{Urls: []string{primary.String()}}
+	for _, alt := range alternates {
+		var candidate *url.URL
+		switch {
+		case !ref.IsAbs():
+			candidate = alt.ResolveReference(ref)
+		case primary.Host == playlist.Host:
+			moved := *primary
+			moved.Scheme = alt.Scheme
+			moved.Host = alt.Host
+			candidate = &moved
+		default:
+			continue
+		}
+
+		if !slices.Contains(source.Urls, candidate.String()) {
+			source.Urls = append(source.Urls, candidate.String())
+		}
+	}
+	return source, nil
+}
+
+// alternateVariants returns the playlist URLs of the variants that carry the same stream as best, which is how
+// multi CDN hosters list their mirrors.
+func alternateVariants(master *m3u8.MasterPlaylist, best *m3u8.Variant, base *url.URL) []*url.URL {
+	bestURL, err := base.Parse(best.URI)
+	if err != nil {
+		return nil
+	}
+
+	var alternates []*url.URL
+	for _, v := range master.Variants {
+		if v == best || v.Bandwidth != best.Bandwidth || v.Resolution != best.Resolution {
+			continue
+		}
+		u, err := base.Parse(v.URI)
+		if err != nil || u.String() == bestURL.String() {
+			continue
+		}
+		alternates = append(alternates, u)
+	}
+	return alternates
+}
+
+// fetchSegment downloads a segment, retrying and falling back to the alternate hosts before giving up.
+func (d *Downloader) fetchSegment(ctx context.Context, source SegmentSource, referer string) ([]byte, error) {
+	var errs []error
+	for i, u := range source.Urls {
+		if i > 0 {
+			slog.Debug("Trying alternate host for segment", "url", u)
+		}
+
+		attempts := d.segmentRetries + 1
+		for attempt := 1; attempt <= attempts; attempt++ {
+			data, err := d.fetchBytes(ctx, u, referer)
+			if err == nil {
+				return data, nil
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			slog.Debug("Segment download failed", "url", u, "attempt", attempt, "attempts", attempts, "error", err)
+			errs = append(errs, err)
+
+			// a client error won't go away by asking the same host again
+			var statusErr *ErrHTTPStatus
+			if errors.As(err, &statusErr) && statusErr.Code < 500 && statusErr.Code != http.StatusTooManyRequests {
+				break
+			}
+			if attempt < attempts {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(time.Duration(attempt) * 500 * time.Millisecond):
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("failed to download segment: %w", errors.Join(errs...))
+}
+
+func (d *Downloader) fetchBytes(ctx context.Context, url, referer string) ([]byte, error) {
+	resp, err := d.get(ctx, url, referer)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, stop := cancelableBody(ctx, resp.Body)
+	defer stop()
+
+	// segments count towards the rate limit as well
+	data, err := io.ReadAll(NewRateLimitedReader(body, d.limiter, ctx))
+	if err != nil {
+		// the attempt is repeated from the start
+		d.discard(ctx, int64(len(data)))
+		return nil, err
+	}
+	return data, nil
+}
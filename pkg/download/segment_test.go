@@ -0,0 +1,91 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNewSegmentSource(t *testing.T) {
+	playlist, _ := url.Parse("https://cdn1.example.com/hls/720/index.m3u8")
+	alternates := []*url.URL{}
+	for _, raw := range []string{"https://cdn2.example.com/hls/720/index.m3u8", "http://cdn3.example.net/mirror/720/index.m3u8"} {
+		u, _ := url.Parse(raw)
+		alternates = append(alternates, u)
+	}
+
+	tests := []struct {
+		name     string
+		uri      string
+		expected []string
+	}{
+		{"relative", "seg-1.ts", []string{
+			"https://cdn1.example.com/hls/720/seg-1.ts",
+			"https://cdn2.example.com/hls/720/seg-1.ts",
+			"http://cdn3.example.net/mirror/720/seg-1.ts",
+		}},
+		{"absolute on playlist host", "https://cdn1.example.com/hls/720/seg-1.ts?token=abc", []string{
+			"https://cdn1.example.com/hls/720/seg-1.ts?token=abc",
+			"https://cdn2.example.com/hls/720/seg-1.ts?token=abc",
+			"http://cdn3.example.net/hls/720/seg-1.ts?token=abc",
+		}},
+		{"absolute on other host", "https://segments.example.org/seg-1.ts", []string{
+			"https://segments.example.org/seg-1.ts",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSegmentSource(tt.uri, playlist, alternates)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got.Urls, tt.expected) {
+				t.Errorf("\nURI:      %s\nExpected: %v\nGot:      %v", tt.uri, tt.expected, got.Urls)
+			}
+		})
+	}
+
+	t.Run("no alternates", func(t *testing.T) {
+		got, _ := NewSegmentSource("seg-1.ts", playlist, nil)
+		if len(got.Urls) != 1 {
+			t.Errorf("\nExpected: 1 URL\nGot:      %v", got.Urls)
+		}
+	})
+}
+
+func TestFetchSegmentRetries(t *testing.T) {
+	tests := []struct {
+		retries  int
+		failures int32
+		valid    bool
+		requests int32
+	}{
+		{0, 1, false, 1},
+		{1, 1, true, 2},
+		{1, 2, false, 2},
+	}
+
+	for _, tt := range tests {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Add(1) <= tt.failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("segment"))
+		}))
+
+		d := NewDownloader("", false, 0)
+		d.SetSegmentRetries(tt.retries)
+		_, err := d.fetchSegment(context.Background(), SegmentSource{Urls: []string{server.URL}}, "")
+		server.Close()
+		if (err == nil) != tt.valid || requests.Load() != tt.requests {
+			t.Errorf("%+v\nExpected: valid=%v after %d requests\nGot:      %v after %d", tt, tt.valid, tt.requests, err, requests.Load())
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafov/m3u8"
+)
+
+// SpeedSample is the throughput measured with a number of parallel connections.
+type SpeedSample struct {
+	Connections    int     `json:"connections"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+}
+
+// SpeedTest downloads streamUrl without writing it anywhere, first over one connection and then doubling them up to
+// maxConnections, each step for duration. HLS and DASH streams are resolved to the segments a download would fetch.
+// The rate limit of the downloader doesn't apply, the point is to measure what the hoster delivers.
+func (d *Downloader) SpeedTest(ctx context.Context, streamUrl, referer string, duration time.Duration, maxConnections int) ([]SpeedSample, error) {
+	urls, err := d.speedTestUrls(ctx, streamUrl, referer)
+	if err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 {
+		return nil, errors.New("the stream has no segments")
+	}
+
+	var samples []SpeedSample
+	for connections := 1; connections <= max(maxConnections, 1); connections *= 2 {
+		sample, err := d.measure(ctx, urls, referer, connections, duration)
+		if err != nil {
+			return samples, err
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// RecommendConcurrency returns the sample with the fewest connections that reaches 90% of the best throughput.
+// More connections than that mostly add load on the hoster.
+func RecommendConcurrency(samples []SpeedSample) SpeedSample {
+	var best float64
+	for _, s := range samples {
+		best = max(best, s.BytesPerSecond)
+	}
+	sorted := append([]SpeedSample(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Connections < sorted[j].Connections })
+	for _, s := range sorted {
+		if s.BytesPerSecond >= 0.9*best {
+			return s
+		}
+	}
+	return SpeedSample{}
+}
+
+// measure downloads the urls round-robin over the given number of connections until duration is over.
+func (d *Downloader) measure(ctx context.Context, urls []string, referer string, connections int, duration time.Duration) (SpeedSample, error) {
+	measureCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var downloaded, next atomic.Int64
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	start := time.Now()
+	for range connections {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for measureCtx.Err() == nil {
+				resp, err := d.get(measureCtx, urls[(next.Add(1)-1)%int64(len(urls))], referer)
+				if err != nil {
+					if measureCtx.Err() == nil {
+						errOnce.Do(func() { firstErr = err })
+					}
+					return
+				}
+				io.Copy(countingWriter{&downloaded}, resp.Body)
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	if err := ctx.Err(); err != nil {
+		return SpeedSample{}, err
+	}
+	if downloaded.Load() == 0 && firstErr != nil {
+		return SpeedSample{}, firstErr
+	}
+	return SpeedSample{Connections: connections, BytesPerSecond: float64(downloaded.Load()) / elapsed.Seconds()}, nil
+}
+
+type countingWriter struct {
+	n *atomic.Int64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// speedTestUrls returns the segments of the HLS variant or DASH video a download would pick, or streamUrl itself for a plain file.
+func (d *Downloader) speedTestUrls(ctx context.Context, streamUrl, referer string) ([]string, error) {
+	resp, err := d.get(ctx, streamUrl, referer)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	contentType := resp.Header.Get("Content-Type")
+	switch {
+	case isHLS(resp.Request.URL, contentType):
+		return d.hlsSegmentUrls(ctx, resp.Body, resp.Request.URL.String(), referer)
+	case isDASH(resp.Request.URL, contentType):
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		tracks, err := parseDASH(data, resp.Request.URL, d.quality)
+		if err != nil {
+			return nil, err
+		}
+		var urls []string
+		for _, segment := range tracks[0].segments {
+			urls = append(urls, segment.url)
+		}
+		return urls, nil
+	default:
+		return []string{resp.Request.URL.String()}, nil
+	}
+}
+
+func (d *Downloader) hlsSegmentUrls(ctx context.Context, body io.Reader, playlistUrl, referer string) ([]string, error) {
+	p, listType, err := m3u8.DecodeFrom(body, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode m3u8: %w", err)
+	}
+
+	if listType == m3u8.MASTER {
+		variants, err := d.ListVariants(ctx, playlistUrl, referer)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range variants {
+			if !v.Selected {
+				continue
+			}
+			resp, err := d.get(ctx, v.Url, referer)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			return d.hlsSegmentUrls(ctx, resp.Body, resp.Request.URL.String(), referer)
+		}
+		return nil, errors.New("the master playlist has no variants")
+	}
+
+	base, err := url.Parse(playlistUrl)
+	if err != nil {
+		return nil, err
+	}
+	var urls []string
+	for _, segment := range p.(*m3u8.MediaPlaylist).Segments {
+		// the segment slice has unused capacity filled with nil
+		if segment == nil {
+			continue
+		}
+		u, err := base.Parse(segment.URI)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse segment URL: %w", err)
+		}
+		urls = append(urls, u.String())
+	}
+	return urls, nil
+}
@@ -0,0 +1,103 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bugmaschine/gad/internal/extractors"
+)
+
+func TestRecommendConcurrency(t *testing.T) {
+	tests := []struct {
+		samples  []SpeedSample
+		expected int
+	}{
+		// more connections stop helping after 2
+		{[]SpeedSample{{1, 1000}, {2, 1900}, {4, 2000}, {8, 1950}}, 2},
+		// the hoster limits every connection
+		{[]SpeedSample{{1, 500}, {2, 1000}, {4, 2000}}, 4},
+		// the line is full with one
+		{[]SpeedSample{{1, 5000}, {2, 4900}}, 1},
+		{nil, 0},
+	}
+
+	for _, tt := range tests {
+		if got := RecommendConcurrency(tt.samples); got.Connections != tt.expected {
+			t.Errorf("%v\nExpected: %d\nGot:      %d", tt.samples, tt.expected, got.Connections)
+		}
+	}
+}
+
+func TestSpeedTest(t *testing.T) {
+	master := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\nlow.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080\nhigh.m3u8\n"
+	media := "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\n%s0.ts\n#EXTINF:4,\n%s1.ts\n#EXT-X-ENDLIST\n"
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/master.m3u8":
+			w.Write([]byte(master))
+		case "/low.m3u8":
+			w.Write([]byte(strings.ReplaceAll(media, "%s", "low")))
+		case "/high.m3u8":
+			w.Write([]byte(strings.ReplaceAll(media, "%s", "high")))
+		default:
+			w.Write(make([]byte, 64*1024))
+		}
+	}))
+	defer server.Close()
+
+	d := NewDownloader("", false, 0)
+	d.SetQuality(extractors.QualityCap{MaxHeight: 720})
+	urls, err := d.speedTestUrls(context.Background(), server.URL+"/master.m3u8", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{server.URL + "/low0.ts", server.URL + "/low1.ts"}
+	if !slices.Equal(urls, expected) {
+		t.Errorf("\nExpected: %v\nGot:      %v", expected, urls)
+	}
+
+	samples, err := d.SpeedTest(context.Background(), server.URL+"/master.m3u8", "", 50*time.Millisecond, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 3 || samples[2].Connections != 4 {
+		t.Fatalf("\nExpected: samples for 1, 2 and 4 connections\nGot:      %v", samples)
+	}
+	for _, s := range samples {
+		if s.BytesPerSecond <= 0 {
+			t.Errorf("\nExpected: throughput with %d connections\nGot:      %v", s.Connections, s.BytesPerSecond)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if slices.Contains(requested, "/high0.ts") {
+		t.Error("segments of the variant above --quality were downloaded")
+	}
+}
+
+func TestSpeedTestStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/video.mp4" {
+			w.Write([]byte("video"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	d := NewDownloader("", false, 0)
+	if _, err := d.SpeedTest(context.Background(), server.URL+"/missing.mp4", "", 50*time.Millisecond, 1); err == nil {
+		t.Error("missing file should fail")
+	}
+}
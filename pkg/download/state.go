@@ -0,0 +1,244 @@
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// StateFileName is the per series manifest inside the save directory, see SeriesState.
+const StateFileName = "state.json"
+
+// StateVersion is the schema version written by this build. Newer files are refused instead of being
+// overwritten with fields missing, older ones get migrated on load.
+const StateVersion = 1
+
+// legacyIntegrityFileName is the sidecar older builds recorded the sizes of finished downloads in for
+// by-name-and-size. It is imported into the state once and removed.
+const legacyIntegrityFileName = ".gad-integrity.json"
+
+type EpisodeStatus string
+
+const (
+	EpisodeCompleted EpisodeStatus = "completed"
+	EpisodeFailed    EpisodeStatus = "failed"
+)
+
+// EpisodeState is the last known outcome for one episode in one language.
+type EpisodeState struct {
+	Season  uint32        `json:"season"`
+	Episode uint32        `json:"episode"`
+	Status  EpisodeStatus `json:"status"`
+	// Language is the video type as used in the file names, e.g. "Ger Dub"
+	Language string `json:"language"`
+	Quality  string `json:"quality,omitempty"`
+	// File is relative to the save directory
+	File      string    `json:"file,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	Hoster    string    `json:"hoster,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SeriesState records the progress of a series, so later runs can skip what is done and reuse what worked.
+type SeriesState struct {
+	mu       sync.Mutex
+	path     string
+	Version  int            `json:"version"`
+	Series   string         `json:"series,omitempty"`
+	Episodes []EpisodeState `json:"episodes"`
+}
+
+// LoadSeriesState reads the state of dir. A missing file results in an empty state.
+func LoadSeriesState(dir string) (*SeriesState, error) {
+	s := &SeriesState{
+		path:    filepath.Join(dir, StateFileName),
+		Version: StateVersion,
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+		}
+		if s.Version > StateVersion {
+			return nil, fmt.Errorf("%s was written by a newer version of gad (schema %d, supported %d)", s.path, s.Version, StateVersion)
+		}
+		// nothing to migrate yet, older files just get the current version on the next write
+		s.Version = StateVersion
+	}
+
+	if err := s.importIntegrity(dir); err != nil {
+		slog.Warn("Failed to import the integrity sidecar", "error", err)
+	}
+
+	return s, nil
+}
+
+// importIntegrity moves the sizes of the legacy integrity sidecar in dir into the state. The sidecar didn't know the
+// episodes, so its files are recorded as completed without season and episode.
+func (s *SeriesState) importIntegrity(dir string) error {
+	path := filepath.Join(dir, legacyIntegrityFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var sidecar struct {
+		Files map[string]struct {
+			Size int64 `json:"size"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for file, entry := range sidecar.Files {
+		if s.findFile(file) < 0 {
+			s.Episodes = append(s.Episodes, EpisodeState{Status: EpisodeCompleted, File: file, Size: entry.Size, UpdatedAt: time.Now()})
+		}
+	}
+	if err := s.save(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Get returns the state of an episode. An empty language matches the first entry of any language.
+func (s *SeriesState) Get(season, episode uint32, language string) (EpisodeState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.find(season, episode, language); i >= 0 {
+		return s.Episodes[i], true
+	}
+	return EpisodeState{}, false
+}
+
+// IsComplete reports whether the episode was downloaded completely and its file is still in dir with the same size.
+// An empty language accepts any language.
+func (s *SeriesState) IsComplete(dir string, season, episode uint32, language string) bool {
+	s.mu.Lock()
+	var candidates []EpisodeState
+	for _, e := range s.Episodes {
+		if e.Season == season && e.Episode == episode && (language == "" || e.Language == language) &&
+			e.Status == EpisodeCompleted && e.File != "" {
+			candidates = append(candidates, e)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, e := range candidates {
+		if info, err := os.Stat(filepath.Join(dir, e.File)); err == nil && info.Size() == e.Size {
+			return true
+		}
+	}
+	return false
+}
+
+// FileComplete reports whether file, relative to the save directory, has the size recorded for it when it was
+// downloaded. Files without a record count as complete unless they are empty, they were downloaded before the state
+// existed or put there by hand.
+func (s *SeriesState) FileComplete(file string, size int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if size == 0 {
+		return false
+	}
+	i := s.findFile(file)
+	return i < 0 || s.Episodes[i].Size == size
+}
+
+// PreferredHoster returns the hoster that delivered the episode last time, or any hoster that worked for the series.
+func (s *SeriesState) PreferredHoster(season, episode uint32) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.find(season, episode, ""); i >= 0 && s.Episodes[i].Status == EpisodeCompleted && s.Episodes[i].Hoster != "" {
+		return s.Episodes[i].Hoster
+	}
+	// the latest success is the best guess for episodes that were never downloaded
+	var latest *EpisodeState
+	for i := range s.Episodes {
+		e := &s.Episodes[i]
+		if e.Status == EpisodeCompleted && e.Hoster != "" && (latest == nil || e.UpdatedAt.After(latest.UpdatedAt)) {
+			latest = e
+		}
+	}
+	if latest == nil {
+		return ""
+	}
+	return latest.Hoster
+}
+
+// Record stores the state of an episode and writes the file.
+func (s *SeriesState) Record(state EpisodeState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state.UpdatedAt.IsZero() {
+		state.UpdatedAt = time.Now()
+	}
+	replaced := false
+	for i, e := range s.Episodes {
+		if e.Season == state.Season && e.Episode == state.Episode && e.Language == state.Language {
+			s.Episodes[i] = state
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		s.Episodes = append(s.Episodes, state)
+	}
+	return s.save()
+}
+
+// save writes the state, the caller holds the lock.
+func (s *SeriesState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, an interrupted write must not lose the whole state
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// findFile returns the completed entry of file, the latest one if the file was recorded more than once.
+func (s *SeriesState) findFile(file string) int {
+	found := -1
+	for i, e := range s.Episodes {
+		if e.File == file && e.Status == EpisodeCompleted && (found < 0 || !e.UpdatedAt.Before(s.Episodes[found].UpdatedAt)) {
+			found = i
+		}
+	}
+	return found
+}
+
+func (s *SeriesState) find(season, episode uint32, language string) int {
+	for i, e := range s.Episodes {
+		if e.Season == season && e.Episode == episode && (language == "" || e.Language == language) {
+			return i
+		}
+	}
+	return -1
+}
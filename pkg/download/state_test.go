@@ -0,0 +1,132 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSeriesState(t *testing.T) {
+	dir := t.TempDir()
+	state, err := LoadSeriesState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "S01E01 - Ger Dub.mp4"), []byte("complete"), 0644)
+	os.WriteFile(filepath.Join(dir, "S01E02 - Ger Dub.mp4"), []byte("truncated"), 0644)
+
+	start := time.Unix(1000, 0)
+	entries := []EpisodeState{
+		{Season: 1, Episode: 1, Status: EpisodeCompleted, Language: "Ger Dub", File: "S01E01 - Ger Dub.mp4", Size: 8, Hoster: "VOE", UpdatedAt: start},
+		{Season: 1, Episode: 2, Status: EpisodeCompleted, Language: "Ger Dub", File: "S01E02 - Ger Dub.mp4", Size: 100, Hoster: "Vidoza", UpdatedAt: start.Add(time.Minute)},
+		{Season: 1, Episode: 3, Status: EpisodeFailed, Language: "Ger Dub", Hoster: "Doodstream", UpdatedAt: start.Add(2 * time.Minute)},
+	}
+	for _, e := range entries {
+		if err := state.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// everything has to survive a reload
+	state, err = LoadSeriesState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completeTests := []struct {
+		episode  uint32
+		language string
+		expected bool
+	}{
+		{1, "Ger Dub", true},
+		{1, "", true},
+		{1, "Eng Sub", false},
+		// size doesn't match anymore
+		{2, "Ger Dub", false},
+		{3, "Ger Dub", false},
+		{4, "", false},
+	}
+	for _, tt := range completeTests {
+		if got := state.IsComplete(dir, 1, tt.episode, tt.language); got != tt.expected {
+			t.Errorf("IsComplete(%d, %q)\nExpected: %v\nGot:      %v", tt.episode, tt.language, tt.expected, got)
+		}
+	}
+
+	hosterTests := []struct {
+		episode  uint32
+		expected string
+	}{
+		{1, "VOE"},
+		{2, "Vidoza"},
+		// failed and unknown episodes get the latest hoster that worked
+		{3, "Vidoza"},
+		{4, "Vidoza"},
+	}
+	for _, tt := range hosterTests {
+		if got := state.PreferredHoster(1, tt.episode); got != tt.expected {
+			t.Errorf("PreferredHoster(%d)\nExpected: %q\nGot:      %q", tt.episode, tt.expected, got)
+		}
+	}
+
+	fileTests := []struct {
+		file     string
+		size     int64
+		expected bool
+	}{
+		{"S01E01 - Ger Dub.mp4", 8, true},
+		{"S01E02 - Ger Dub.mp4", 9, false},
+		// unrecorded files are complete unless they are empty
+		{"S01E09 - Ger Dub.mp4", 8, true},
+		{"S01E09 - Ger Dub.mp4", 0, false},
+	}
+	for _, tt := range fileTests {
+		if got := state.FileComplete(tt.file, tt.size); got != tt.expected {
+			t.Errorf("FileComplete(%q, %d)\nExpected: %v\nGot:      %v", tt.file, tt.size, tt.expected, got)
+		}
+	}
+
+	// a new result replaces the old one
+	state.Record(EpisodeState{Season: 1, Episode: 3, Status: EpisodeCompleted, Language: "Ger Dub", Hoster: "Streamtape"})
+	if e, _ := state.Get(1, 3, "Ger Dub"); e.Status != EpisodeCompleted || len(state.Episodes) != 3 {
+		t.Errorf("\nExpected: episode 3 completed, 3 entries\nGot:      %s, %d entries", e.Status, len(state.Episodes))
+	}
+}
+
+func TestSeriesStateNewerVersion(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, StateFileName), []byte(`{"version": 99, "episodes": []}`), 0644)
+
+	_, err := LoadSeriesState(dir)
+	if err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Errorf("\nExpected: newer version error\nGot:      %v", err)
+	}
+}
+
+func TestSeriesStateImportIntegrity(t *testing.T) {
+	dir := t.TempDir()
+	sidecar := filepath.Join(dir, legacyIntegrityFileName)
+	os.WriteFile(sidecar, []byte(`{"files": {"S01E01.mp4": {"size": 8}, "S01E02.mp4": {"size": 5}}}`), 0644)
+
+	state, err := LoadSeriesState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.FileComplete("S01E01.mp4", 8) || !state.FileComplete("S01E02.mp4", 5) {
+		t.Errorf("\nExpected: the sizes of the sidecar\nGot:      %+v", state.Episodes)
+	}
+	if _, err := os.Stat(sidecar); !os.IsNotExist(err) {
+		t.Errorf("\nExpected: the sidecar to be removed\nGot:      %v", err)
+	}
+
+	// the import was written to the state and happens only once
+	state, err = LoadSeriesState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Episodes) != 2 || !state.FileComplete("S01E01.mp4", 8) {
+		t.Errorf("\nExpected: 2 imported files\nGot:      %+v", state.Episodes)
+	}
+}
@@ -0,0 +1,85 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/bugmaschine/gad/internal/extractors"
+)
+
+// ErrNotStreamable is returned by DownloadToWriter for downloads that can't be written in one pass, like DASH
+// streams with separate audio and video.
+var ErrNotStreamable = errors.New("the download can't be streamed")
+
+// DownloadToWriter downloads task to w instead of a file, e.g. stdout to pipe it into a player. Direct files are
+// copied as they come, HLS streams are written segment by segment and remuxed to MPEG-TS by FFmpeg if there is one.
+// The output path of task only names the progress bar.
+func (d *Downloader) DownloadToWriter(ctx context.Context, task *DownloadTask, w io.Writer) error {
+	if task.AudioFormat != "" {
+		return fmt.Errorf("audio only: %w", ErrNotStreamable)
+	}
+	ctx = withHeaders(ctx, extractors.HosterHeaders(task.Hoster))
+
+	refresh := &refresher{refresh: task.Refresh}
+	resp, streamUrl, referer, err := d.getRefreshing(ctx, task.Url, task.Referer, refresh)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	message := task.CustomMessage
+	if message == "" {
+		message = filepath.Base(task.FinalOutputPath())
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	switch {
+	case isHLS(resp.Request.URL, contentType):
+		if d.ffmpegPath == "" {
+			_, err := d.m3u8Download(ctx, resp, referer, "", "", w, message, task.Progress, refresh, false)
+			return err
+		}
+		return d.pipeFfmpeg(ctx, w, func(stdin io.Writer) error {
+			_, err := d.m3u8Download(ctx, resp, referer, "", "", stdin, message, task.Progress, refresh, false)
+			return err
+		})
+	case isDASH(resp.Request.URL, contentType):
+		return fmt.Errorf("DASH: %w", ErrNotStreamable)
+	}
+
+	if d.maxSize > 0 && resp.ContentLength > d.maxSize {
+		return &ErrLimitExceeded{Limit: "size", Max: FormatSize(d.maxSize)}
+	}
+	resp.Body = &resumingBody{ctx: ctx, d: d, body: resp.Body, url: streamUrl, referer: referer, refresher: refresh, end: -1}
+	return d.simpleDownload(ctx, resp, w, message, task.Progress)
+}
+
+// pipeFfmpeg runs FFmpeg to copy what write produces into MPEG-TS on w. It fixes the timestamps between the parts
+// of HLS streams and turns fMP4 segments into a format that can be written without seeking.
+func (d *Downloader) pipeFfmpeg(ctx context.Context, w io.Writer, write func(stdin io.Writer) error) error {
+	args := append([]string{"-i", "pipe:0", "-map", "0", "-c", "copy"}, d.ffmpegArgs...)
+	cmd := exec.CommandContext(ctx, d.ffmpegPath, append(args, "-f", "mpegts", "pipe:1")...)
+	cmd.Stdout = w
+	if d.debug {
+		cmd.Stderr = os.Stderr
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	writeErr := write(stdin)
+	stdin.Close()
+	if err := cmd.Wait(); err != nil && writeErr == nil {
+		return fmt.Errorf("FFmpeg failed: %w", err)
+	}
+	return writeErr
+}
@@ -0,0 +1,58 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadToWriter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/index.m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXT-X-DISCONTINUITY\n#EXTINF:4,\nseg1.ts\n#EXT-X-ENDLIST\n"))
+		case r.URL.Path == "/manifest.mpd":
+			w.Header().Set("Content-Type", "application/dash+xml")
+			w.Write([]byte("<MPD></MPD>"))
+		case strings.HasSuffix(r.URL.Path, ".ts"):
+			w.Write([]byte(strings.TrimSuffix(filepath.Base(r.URL.Path), ".ts") + "|"))
+		default:
+			w.Write([]byte("video"))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path     string
+		expected string
+		err      error
+	}{
+		{"/video.mp4", "video", nil},
+		{"/index.m3u8", "seg0|seg1|", nil},
+		{"/manifest.mpd", "", ErrNotStreamable},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		var out bytes.Buffer
+		d := NewDownloader("", false, 0)
+		err := d.DownloadToWriter(context.Background(), NewDownloadTask(filepath.Join(dir, "episode"), server.URL+tt.path), &out)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s\nExpected: %v\nGot:      %v", tt.path, tt.err, err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("%s\nExpected: %q\nGot:      %q", tt.path, tt.expected, out.String())
+		}
+		// nothing goes to disk, not even the segments
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("%s\nExpected: no files\nGot:      %v", tt.path, entries)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type logFileKey struct{}
+
+// withLogFile names the file a download below ctx writes, so the logs of downloads running side by side can be
+// told apart.
+func withLogFile(ctx context.Context, file string) context.Context {
+	return context.WithValue(ctx, logFileKey{}, file)
+}
+
+func logFile(ctx context.Context) string {
+	file, _ := ctx.Value(logFileKey{}).(string)
+	return file
+}
+
+// RedactUrl drops the query and credentials of a stream URL for the logs, they usually hold the tokens that
+// grant access to it. Debug logs have the full URL.
+func RedactUrl(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid url>"
+	}
+	u.User = nil
+	if u.RawQuery != "" {
+		u.RawQuery = "<redacted>"
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// streamType names the kind of download resp starts, for the logs.
+func streamType(resp *http.Response, contentType string) string {
+	switch {
+	case isHLS(resp.Request.URL, contentType):
+		return "HLS"
+	case isDASH(resp.Request.URL, contentType):
+		return "DASH"
+	default:
+		return "direct"
+	}
+}
+
+// qualityLabel describes the height an extractor or a playlist picked, "unknown" if it didn't tell.
+func qualityLabel(height int) string {
+	if height <= 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dp", height)
+}
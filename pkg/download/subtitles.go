@@ -0,0 +1,343 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+	"github.com/bugmaschine/gad/pkg/utils"
+	"github.com/grafov/m3u8"
+)
+
+// SubtitleMode decides where the subtitle renditions of HLS streams end up.
+type SubtitleMode string
+
+const (
+	// SubtitleExternal saves every subtitle next to the episode, e.g. "<name>.eng.vtt".
+	SubtitleExternal SubtitleMode = "external"
+	// SubtitleEmbed muxes them into the episode as subtitle tracks.
+	SubtitleEmbed SubtitleMode = "embed"
+)
+
+// SubtitleModes are the supported modes, for help texts and completions.
+var SubtitleModes = []SubtitleMode{SubtitleExternal, SubtitleEmbed}
+
+// ParseSubtitleMode checks s against SubtitleModes.
+func ParseSubtitleMode(s string) (SubtitleMode, error) {
+	for _, mode := range SubtitleModes {
+		if strings.EqualFold(s, string(mode)) {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown subtitle mode %q, expected one of %v", s, SubtitleModes)
+}
+
+// SubtitleLanguages selects the subtitle renditions to download. The zero value downloads none.
+type SubtitleLanguages struct {
+	All bool
+	// Codes are ISO 639-2 codes in the order of preference, the first one found becomes the default track
+	Codes []string
+}
+
+// ParseSubtitleLanguages parses a comma separated list of languages like "en,de" or "all". The languages can be
+// ISO 639-1 or 639-2 codes or names like "Deutsch".
+func ParseSubtitleLanguages(s string) (SubtitleLanguages, error) {
+	var langs SubtitleLanguages
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+			continue
+		case strings.EqualFold(part, "all"):
+			langs.All = true
+			continue
+		}
+		code := subtitleLanguageCode(part)
+		if code == "und" {
+			return SubtitleLanguages{}, fmt.Errorf("unknown subtitle language %q, use a code like en or eng", part)
+		}
+		if !slices.Contains(langs.Codes, code) {
+			langs.Codes = append(langs.Codes, code)
+		}
+	}
+	if langs.All {
+		langs.Codes = nil
+	}
+	return langs, nil
+}
+
+// Enabled reports whether any subtitles are downloaded.
+func (l SubtitleLanguages) Enabled() bool {
+	return l.All || len(l.Codes) > 0
+}
+
+// SetSubtitles downloads the subtitle renditions of HLS streams in langs and saves or embeds them as mode says.
+func (d *Downloader) SetSubtitles(langs SubtitleLanguages, mode SubtitleMode) {
+	d.subtitleLangs = langs
+	d.subtitleMode = mode
+}
+
+// iso639 maps ISO 639-1 and the terminology codes of ISO 639-2 to the bibliographic ones FFmpeg and players know.
+var iso639 = map[string]string{
+	"ar": "ara", "cs": "cze", "da": "dan", "de": "ger", "el": "gre", "en": "eng", "es": "spa", "fi": "fin",
+	"fr": "fre", "he": "heb", "hi": "hin", "hu": "hun", "id": "ind", "it": "ita", "ja": "jpn", "ko": "kor",
+	"nl": "dut", "no": "nor", "pl": "pol", "pt": "por", "ro": "rum", "ru": "rus", "sv": "swe", "th": "tha",
+	"tr": "tur", "uk": "ukr", "vi": "vie", "zh": "chi",
+	"ces": "cze", "deu": "ger", "ell": "gre", "fra": "fre", "nld": "dut", "ron": "rum", "zho": "chi",
+}
+
+// subtitleLanguageCode returns the ISO 639-2 code of a language tag like "en-US", "ger" or "Deutsch", "und" if it
+// isn't known.
+func subtitleLanguageCode(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	primary, _, _ := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+	if code, ok := iso639[primary]; ok {
+		return code
+	}
+	if len(primary) == 3 && strings.Trim(primary, "abcdefghijklmnopqrstuvwxyz") == "" && primary != "und" {
+		return primary
+	}
+	return downloaders.ParseLanguage(tag).Code()
+}
+
+// subtitle is a subtitle rendition of a HLS variant.
+type subtitle struct {
+	url  *url.URL
+	code string
+	name string
+	// tag tells the files of a download apart, e.g. "eng" or "eng.forced"
+	tag       string
+	isDefault bool
+	// path is where the subtitle was downloaded to
+	path string
+}
+
+// subtitleRenditions returns the subtitle renditions of the variant that langs asks for, in the order of langs.
+func subtitleRenditions(v *m3u8.Variant, langs SubtitleLanguages, playlist *url.URL) ([]*subtitle, error) {
+	var available []*subtitle
+	var defaultIndex int
+	for _, alt := range v.Alternatives {
+		if alt == nil || alt.Type != "SUBTITLES" || alt.URI == "" || (v.Subtitles != "" && alt.GroupId != v.Subtitles) {
+			continue
+		}
+		u, err := playlist.Parse(alt.URI)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse subtitle rendition URL: %w", err)
+		}
+		// the decoder attaches the renditions of a group to a variant more than once
+		if slices.ContainsFunc(available, func(sub *subtitle) bool { return sub.url.String() == u.String() }) {
+			continue
+		}
+		code := subtitleLanguageCode(alt.Language)
+		if code == "und" {
+			code = subtitleLanguageCode(alt.Name)
+		}
+		if alt.Default {
+			defaultIndex = len(available)
+		}
+		sub := &subtitle{url: u, code: code, name: alt.Name, tag: code}
+		if strings.EqualFold(alt.Forced, "YES") {
+			sub.tag += ".forced"
+		}
+		available = append(available, sub)
+	}
+	if len(available) == 0 {
+		return nil, nil
+	}
+
+	var selected []*subtitle
+	if langs.All {
+		// without a preference the default of the playlist stays the default
+		available[defaultIndex].isDefault = true
+		selected = available
+	} else {
+		for _, code := range langs.Codes {
+			for _, sub := range available {
+				if sub.code == code {
+					selected = append(selected, sub)
+				}
+			}
+		}
+		if len(selected) > 0 {
+			selected[0].isDefault = true
+		}
+	}
+
+	// renditions of the same language and kind get numbered
+	seen := make(map[string]int)
+	for _, sub := range selected {
+		seen[sub.tag]++
+		if n := seen[sub.tag]; n > 1 {
+			sub.tag += "." + strconv.Itoa(n)
+		}
+	}
+	return selected, nil
+}
+
+type subtitleBaseKey struct{}
+
+// withSubtitleBase names the subtitles of the download below ctx after base, the path of the episode without its
+// extension. An empty base downloads none, e.g. for the further tracks of a multi language download.
+func withSubtitleBase(ctx context.Context, base string) context.Context {
+	return context.WithValue(ctx, subtitleBaseKey{}, base)
+}
+
+func subtitleBase(ctx context.Context) (string, bool) {
+	base, ok := ctx.Value(subtitleBaseKey{}).(string)
+	return base, ok
+}
+
+// isSubtitle matches the subtitles saved next to the episodes.
+func isSubtitle(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".vtt")
+}
+
+// downloadSubtitles downloads the subtitles next to outputPath. A subtitle that fails is left out, the episode is
+// fine without it.
+func (d *Downloader) downloadSubtitles(ctx context.Context, subs []*subtitle, referer, outputPath, message string) []*subtitle {
+	base := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+	var downloaded []*subtitle
+	for _, sub := range subs {
+		sub.path = base + "." + sub.tag + ".vtt"
+		if err := d.downloadSubtitle(ctx, sub.url, referer, sub.path); err != nil {
+			if ctx.Err() != nil {
+				return downloaded
+			}
+			slog.Warn("Failed to download the subtitles, continuing without them", "file", message, "language", sub.code, "error", err)
+			continue
+		}
+		downloaded = append(downloaded, sub)
+	}
+	if len(downloaded) > 0 {
+		slog.Info("Downloaded subtitles", "file", message, "languages", subtitleTags(downloaded))
+	}
+	return downloaded
+}
+
+// downloadSubtitle saves the subtitle at u to path. Its playlist usually splits the WebVTT into segments, they are
+// joined into one file.
+func (d *Downloader) downloadSubtitle(ctx context.Context, u *url.URL, referer, path string) error {
+	resp, err := d.get(ctx, u.String(), referer)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	segments := [][]byte{data}
+	p, listType, err := m3u8.DecodeFrom(bytes.NewReader(data), true)
+	if err == nil && listType == m3u8.MEDIA {
+		segments = nil
+		for _, seg := range p.(*m3u8.MediaPlaylist).Segments {
+			if seg == nil {
+				break
+			}
+			segURL, err := resp.Request.URL.Parse(seg.URI)
+			if err != nil {
+				return fmt.Errorf("failed to parse subtitle segment URL: %w", err)
+			}
+			segResp, err := d.get(ctx, segURL.String(), referer)
+			if err != nil {
+				return err
+			}
+			data, err := io.ReadAll(segResp.Body)
+			segResp.Body.Close()
+			if err != nil {
+				return err
+			}
+			segments = append(segments, data)
+		}
+	} else if !bytes.HasPrefix(bytes.TrimPrefix(data, []byte("\ufeff")), []byte("WEBVTT")) {
+		return fmt.Errorf("the subtitle is neither a playlist nor WebVTT")
+	}
+
+	if err := os.WriteFile(path+".tmp", joinVtt(segments), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// joinVtt joins the WebVTT segments of a subtitle playlist into one file. Only the cues of every segment are kept,
+// the header with X-TIMESTAMP-MAP is the same in all of them and the times of the cues already match the video once
+// FFmpeg lets it start at 0. Cues that span two segments are in both and kept once.
+func joinVtt(segments [][]byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("WEBVTT\n")
+	seen := make(map[string]bool)
+	for _, seg := range segments {
+		text := strings.ReplaceAll(strings.TrimPrefix(string(seg), "\ufeff"), "\r\n", "\n")
+		for i, block := range strings.Split(text, "\n\n") {
+			block = strings.Trim(block, "\n")
+			if block == "" || (i == 0 && strings.HasPrefix(block, "WEBVTT")) || seen[block] {
+				continue
+			}
+			seen[block] = true
+			b.WriteString("\n" + block + "\n")
+		}
+	}
+	return b.Bytes()
+}
+
+// subtitleMuxPath is the mkv an episode with embedded subtitles is muxed into. mp4 would only take them as mov_text,
+// which loses the styling of the WebVTT and isn't shown by every player.
+func subtitleMuxPath(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".mkv"
+}
+
+// subtitleMuxArgs adds the subtitles to a mux, with inputs numbered from first on. The input options come first,
+// then the output options to put after "-c copy".
+func subtitleMuxArgs(subs []*subtitle, first int) ([]string, []string) {
+	var inputs, outputs []string
+	for i, sub := range subs {
+		inputs = append(inputs, "-i", sub.path)
+		outputs = append(outputs, "-map", strconv.Itoa(first+i))
+	}
+	for i, sub := range subs {
+		outputs = append(outputs, fmt.Sprintf("-metadata:s:s:%d", i), "language="+sub.code)
+		if sub.name != "" {
+			outputs = append(outputs, fmt.Sprintf("-metadata:s:s:%d", i), "title="+sub.name)
+		}
+		outputs = append(outputs, fmt.Sprintf("-disposition:s:%d", i), disposition(sub.isDefault))
+	}
+	return inputs, outputs
+}
+
+// placeSubtitles moves the downloaded subtitles next to the episode of ctx, see withSubtitleBase.
+func placeSubtitles(ctx context.Context, subs []*subtitle, message string) {
+	base, _ := subtitleBase(ctx)
+	for _, sub := range subs {
+		path := base + "." + sub.tag + ".vtt"
+		if path == sub.path {
+			continue
+		}
+		if err := utils.MoveFile(sub.path, path); err != nil {
+			slog.Warn("Failed to move the subtitles next to the episode", "file", message, "language", sub.code, "error", err)
+		}
+	}
+}
+
+func removeSubtitles(subs []*subtitle) {
+	for _, sub := range subs {
+		utils.RemoveFileIgnoreNotExists(sub.path)
+	}
+}
+
+func subtitleTags(subs []*subtitle) string {
+	tags := make([]string, len(subs))
+	for i, sub := range subs {
+		tags[i] = sub.tag
+	}
+	return strings.Join(tags, ", ")
+}
@@ -0,0 +1,237 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/grafov/m3u8"
+)
+
+func TestParseSubtitleLanguages(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected SubtitleLanguages
+		wantErr  bool
+	}{
+		{"", SubtitleLanguages{}, false},
+		{"all", SubtitleLanguages{All: true}, false},
+		{"en,de", SubtitleLanguages{Codes: []string{"eng", "ger"}}, false},
+		{" DE , eng, deu ", SubtitleLanguages{Codes: []string{"ger", "eng"}}, false},
+		{"en-US,Deutsch", SubtitleLanguages{Codes: []string{"eng", "ger"}}, false},
+		{"all,en", SubtitleLanguages{All: true}, false},
+		{"en,xx", SubtitleLanguages{}, true},
+		{"klingon", SubtitleLanguages{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSubtitleLanguages(tt.input)
+		if (err != nil) != tt.wantErr || got.All != tt.expected.All || !slices.Equal(got.Codes, tt.expected.Codes) {
+			t.Errorf("%q\nExpected: %+v (error %v)\nGot:      %+v (%v)", tt.input, tt.expected, tt.wantErr, got, err)
+		}
+	}
+}
+
+func TestSubtitleLanguageCode(t *testing.T) {
+	tests := []struct {
+		tag      string
+		expected string
+	}{
+		{"en", "eng"},
+		{"en-US", "eng"},
+		{"pt_BR", "por"},
+		{"deu", "ger"},
+		{"jpn", "jpn"},
+		{"English", "eng"},
+		{"", "und"},
+		{"und", "und"},
+	}
+
+	for _, tt := range tests {
+		if got := subtitleLanguageCode(tt.tag); got != tt.expected {
+			t.Errorf("%q\nExpected: %s\nGot:      %s", tt.tag, tt.expected, got)
+		}
+	}
+}
+
+const subtitleMaster = `#EXTM3U
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",LANGUAGE="en",DEFAULT=YES,URI="subs/en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Deutsch",LANGUAGE="de",URI="subs/de.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Deutsch (Forced)",LANGUAGE="de",FORCED=YES,URI="subs/de-forced.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Français",LANGUAGE="fr",URI="subs/fr.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="other",NAME="Español",LANGUAGE="es",URI="subs/es.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,SUBTITLES="subs"
+1080/index.m3u8
+`
+
+func TestSubtitleRenditions(t *testing.T) {
+	p, _, err := m3u8.DecodeFrom(strings.NewReader(subtitleMaster), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	variant := p.(*m3u8.MasterPlaylist).Variants[0]
+	playlist, _ := url.Parse("https://example.com/master.m3u8")
+
+	tests := []struct {
+		langs    string
+		expected []string
+		// isDefault is the tag of the default track
+		isDefault string
+	}{
+		{"de,en", []string{"ger", "ger.forced", "eng"}, "ger"},
+		{"fr", []string{"fre"}, "fre"},
+		{"all", []string{"eng", "ger", "ger.forced", "fre"}, "eng"},
+		// not in the group of the variant
+		{"es", nil, ""},
+	}
+
+	for _, tt := range tests {
+		langs, _ := ParseSubtitleLanguages(tt.langs)
+		subs, err := subtitleRenditions(variant, langs, playlist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tags []string
+		isDefault := ""
+		for _, sub := range subs {
+			tags = append(tags, sub.tag)
+			if sub.isDefault {
+				isDefault += sub.tag
+			}
+		}
+		if !slices.Equal(tags, tt.expected) || isDefault != tt.isDefault {
+			t.Errorf("%s\nExpected: %v, default %q\nGot:      %v, default %q", tt.langs, tt.expected, tt.isDefault, tags, isDefault)
+		}
+	}
+}
+
+func TestJoinVtt(t *testing.T) {
+	segments := [][]byte{
+		[]byte("WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:900000,LOCAL:00:00:00.000\n\n00:00:01.000 --> 00:00:03.000\nHallo\n\n00:00:05.000 --> 00:00:07.000\nüber die Grenze\n"),
+		// the cue spanning both segments is repeated, with windows line breaks and a byte order mark
+		[]byte("\ufeffWEBVTT\r\nX-TIMESTAMP-MAP=MPEGTS:900000,LOCAL:00:00:00.000\r\n\r\n00:00:05.000 --> 00:00:07.000\r\nüber die Grenze\r\n\r\n00:00:08.000 --> 00:00:09.000\r\nTschüss\r\n"),
+		[]byte("WEBVTT\n\n"),
+	}
+	expected := "WEBVTT\n\n00:00:01.000 --> 00:00:03.000\nHallo\n\n00:00:05.000 --> 00:00:07.000\nüber die Grenze\n\n00:00:08.000 --> 00:00:09.000\nTschüss\n"
+
+	if got := string(joinVtt(segments)); got != expected {
+		t.Errorf("\nExpected: %q\nGot:      %q", expected, got)
+	}
+}
+
+func TestSubtitleMuxArgs(t *testing.T) {
+	subs := []*subtitle{
+		{code: "ger", name: "Deutsch", isDefault: true, path: "e.ger.vtt"},
+		{code: "eng", path: "e.eng.vtt"},
+	}
+
+	inputs, outputs := subtitleMuxArgs(subs, 2)
+	if expected := []string{"-i", "e.ger.vtt", "-i", "e.eng.vtt"}; !slices.Equal(inputs, expected) {
+		t.Errorf("\nExpected: %v\nGot:      %v", expected, inputs)
+	}
+	expected := []string{"-map", "2", "-map", "3",
+		"-metadata:s:s:0", "language=ger", "-metadata:s:s:0", "title=Deutsch", "-disposition:s:0", "default",
+		"-metadata:s:s:1", "language=eng", "-disposition:s:1", "0"}
+	if !slices.Equal(outputs, expected) {
+		t.Errorf("\nExpected: %v\nGot:      %v", expected, outputs)
+	}
+}
+
+func TestSubtitleMuxPath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Episode 1.mp4", "Episode 1.mkv"},
+		{filepath.Join("Season 1", "Episode 1.ts"), filepath.Join("Season 1", "Episode 1.mkv")},
+		{"Episode 1.mkv", "Episode 1.mkv"},
+	}
+
+	for _, tt := range tests {
+		if got := subtitleMuxPath(tt.input); got != tt.expected {
+			t.Errorf("%s\nExpected: %s\nGot:      %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestDownloadSubtitles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake FFmpeg is a shell script")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/master.m3u8":
+			w.Write([]byte(subtitleMaster))
+		case strings.HasPrefix(r.URL.Path, "/subs/") && strings.HasSuffix(r.URL.Path, ".m3u8"):
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.vtt\n#EXTINF:4,\nseg1.vtt\n#EXT-X-ENDLIST\n"))
+		case strings.HasSuffix(r.URL.Path, ".vtt"):
+			w.Write([]byte("WEBVTT\n\n00:00:01.000 --> 00:00:02.000\n" + r.URL.Path + "\n"))
+		case strings.HasSuffix(r.URL.Path, ".m3u8"):
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXTINF:4,\nseg1.ts\n#EXT-X-ENDLIST\n"))
+		default:
+			w.Write([]byte(r.URL.Path))
+		}
+	}))
+	defer server.Close()
+
+	for _, mode := range SubtitleModes {
+		// records its arguments and writes the last one, the output
+		dir := t.TempDir()
+		ffmpegPath := filepath.Join(dir, "ffmpeg")
+		os.WriteFile(ffmpegPath, []byte("#!/bin/sh\necho \"$@\" >> \"$0.log\"\nfor last; do :; done\necho muxed > \"$last\"\n"), 0755)
+
+		d := NewDownloader("", false, 0)
+		d.SetFfmpegPath(ffmpegPath)
+		d.SetTempDir(filepath.Join(dir, "tmp"))
+		langs, _ := ParseSubtitleLanguages("de,en")
+		d.SetSubtitles(langs, mode)
+		task := NewDownloadTask(filepath.Join(dir, "episode"), server.URL+"/master.m3u8")
+		if err := d.DownloadToFile(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+
+		log, _ := os.ReadFile(ffmpegPath + ".log")
+		for _, tag := range []string{"ger", "ger.forced", "eng"} {
+			path := filepath.Join(dir, "episode."+tag+".vtt")
+			got, err := os.ReadFile(path)
+			if mode == SubtitleEmbed {
+				if !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("%s %s\nExpected: no file after embedding\nGot:      %v", mode, tag, err)
+				}
+				continue
+			}
+			if !strings.Contains(string(got), "seg0.vtt") || !strings.Contains(string(got), "seg1.vtt") || strings.Count(string(got), "WEBVTT") != 1 {
+				t.Errorf("%s %s\nExpected: both segments joined\nGot:      %q (%v)", mode, tag, got, err)
+			}
+		}
+
+		embedded := strings.Contains(string(log), "-metadata:s:s:0 language=ger -metadata:s:s:0 title=Deutsch -disposition:s:0 default")
+		if embedded != (mode == SubtitleEmbed) {
+			t.Errorf("%s\nExpected: embedded %v\nGot:      %s", mode, mode == SubtitleEmbed, log)
+		}
+
+		// mp4 would only take the subtitles as mov_text, embedding them makes the episode an mkv
+		expected, other := filepath.Join(dir, "episode.mp4"), filepath.Join(dir, "episode.mkv")
+		if mode == SubtitleEmbed {
+			expected, other = other, expected
+		}
+		if task.FinalOutputPath() != expected {
+			t.Errorf("%s\nExpected: %s\nGot:      %s", mode, expected, task.FinalOutputPath())
+		}
+		if got, _ := os.ReadFile(expected); string(got) != "muxed\n" {
+			t.Errorf("%s\nExpected: the muxed episode in %s\nGot:      %q", mode, expected, got)
+		}
+		if _, err := os.Stat(other); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s\nExpected: no %s\nGot:      %v", mode, other, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package download
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// throughputLog logs the progress of a plain download every interval. Without segments there is nothing else to
+// log until it is done, so a log file can't tell a slow download from a stuck one otherwise.
+type throughputLog struct {
+	file       string
+	interval   time.Duration
+	downloaded atomic.Int64
+	total      atomic.Int64
+}
+
+// progress records the bytes so far and passes them on to next, which may be nil.
+func (t *throughputLog) progress(next func(downloaded, total int64)) func(downloaded, total int64) {
+	return func(downloaded, total int64) {
+		t.downloaded.Store(downloaded)
+		t.total.Store(total)
+		if next != nil {
+			next(downloaded, total)
+		}
+	}
+}
+
+// start logs every interval until ctx is done or the returned func is called.
+func (t *throughputLog) start(ctx context.Context) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+
+		last, lastTime := int64(0), time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				downloaded := t.downloaded.Load()
+				slog.Info("Download progress", throughputAttrs(t.file, downloaded, t.total.Load(), downloaded-last, now.Sub(lastTime))...)
+				last, lastTime = downloaded, now
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// throughputAttrs describes a download that got delta bytes in the last elapsed time. The ETA assumes it goes on
+// at that speed, a total of 0 means the size is unknown.
+func throughputAttrs(file string, downloaded, total, delta int64, elapsed time.Duration) []any {
+	speed := float64(delta) / elapsed.Seconds()
+	progress := FormatSize(downloaded)
+	if total > 0 {
+		progress += " / " + FormatSize(total)
+	}
+	attrs := []any{"file", file, "downloaded", progress, "speed", FormatSize(int64(speed)) + "/s"}
+	switch {
+	case total <= 0:
+	case delta <= 0:
+		attrs = append(attrs, "eta", "stalled")
+	default:
+		eta := time.Duration(float64(total-downloaded) / speed * float64(time.Second))
+		attrs = append(attrs, "eta", eta.Round(time.Second).String())
+	}
+	return attrs
+}
@@ -0,0 +1,53 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestThroughputAttrs(t *testing.T) {
+	tests := []struct {
+		downloaded, total, delta int64
+		expected                 string
+	}{
+		// 1 MiB/s with 10 MiB to go
+		{10 << 20, 20 << 20, 10 << 20, "[file ep.mp4 downloaded 10.0 MiB / 20.0 MiB speed 1.0 MiB/s eta 10s]"},
+		{10 << 20, 20 << 20, 0, "[file ep.mp4 downloaded 10.0 MiB / 20.0 MiB speed 0 B/s eta stalled]"},
+		// the server didn't send the size
+		{10 << 20, 0, 10 << 20, "[file ep.mp4 downloaded 10.0 MiB speed 1.0 MiB/s]"},
+	}
+
+	for _, tt := range tests {
+		got := fmt.Sprint(throughputAttrs("ep.mp4", tt.downloaded, tt.total, tt.delta, 10*time.Second))
+		if got != tt.expected {
+			t.Errorf("\nExpected: %s\nGot:      %s", tt.expected, got)
+		}
+	}
+}
+
+func TestThroughputLogStops(t *testing.T) {
+	var got int64
+	throughput := &throughputLog{file: "ep.mp4", interval: time.Millisecond}
+	progress := throughput.progress(func(downloaded, total int64) { got = downloaded })
+	progress(100, 1000)
+	if got != 100 || throughput.downloaded.Load() != 100 || throughput.total.Load() != 1000 {
+		t.Errorf("\nExpected: 100 of 1000 recorded and passed on\nGot:      %d of %d, %d passed on", throughput.downloaded.Load(), throughput.total.Load(), got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := throughput.start(ctx)
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the ticker didn't stop")
+	}
+}
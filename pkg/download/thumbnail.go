@@ -0,0 +1,109 @@
+package download
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bugmaschine/gad/pkg/utils"
+)
+
+// thumbnailSuffix is appended to the video name for the thumbnail sidecar, media servers like Jellyfin pick it up.
+const thumbnailSuffix = "-thumb"
+
+// coverSuffix marks the temporary file written while embedding the cover art.
+const coverSuffix = ".cover"
+
+// WriteThumbnail downloads the image next to the video as "<name>-thumb.jpg" and embeds it as cover art into mp4 and
+// mkv files if FFmpeg is available. The air date is embedded as well if known. It returns the path of the sidecar.
+func (d *Downloader) WriteThumbnail(ctx context.Context, videoPath, imageUrl, referer, airDate string) (string, error) {
+	resp, err := d.get(ctx, imageUrl, referer)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	thumbPath := strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + thumbnailSuffix + thumbnailExtension(imageUrl)
+	file, err := os.Create(thumbPath)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		utils.RemoveFileIgnoreNotExists(thumbPath)
+		return "", err
+	}
+
+	if err := d.embedCover(ctx, videoPath, thumbPath, airDate); err != nil {
+		slog.Warn("Failed to embed thumbnail, keeping it as sidecar only", "file", filepath.Base(videoPath), "error", err)
+	}
+	return thumbPath, nil
+}
+
+// embedCover remuxes the video with the image as attached picture. Only mp4 and mkv support that, and mp4 no webp.
+func (d *Downloader) embedCover(ctx context.Context, videoPath, imagePath, airDate string) error {
+	ext := strings.ToLower(filepath.Ext(videoPath))
+	if d.ffmpegPath == "" || (ext != ".mp4" && ext != ".mkv") || (ext == ".mp4" && filepath.Ext(imagePath) == ".webp") {
+		return nil
+	}
+
+	// ffmpeg can't write in place, the temporary file keeps the extension so the muxer is picked correctly
+	tmpPath := strings.TrimSuffix(videoPath, ext) + coverSuffix + ext
+	args := []string{"-y", "-i", videoPath, "-i", imagePath, "-map", "0", "-map", "1", "-c", "copy", "-disposition:v:1", "attached_pic"}
+	if ext == ".mkv" {
+		// mkv takes covers as attachments, which also keeps them apart from the video streams of muxed languages
+		args = []string{"-y", "-i", videoPath, "-attach", imagePath, "-map", "0", "-c", "copy",
+			"-metadata:s:t", "mimetype=" + imageMimeType(imagePath), "-metadata:s:t", "filename=cover" + filepath.Ext(imagePath)}
+	}
+	if airDate != "" {
+		args = append(args, "-metadata", "date="+airDate)
+	}
+	// the remux would put the index of an mp4 back to the end
+	if d.faststart && ext == ".mp4" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	args = append(args, tmpPath)
+
+	if err := d.runFfmpeg(ctx, args); err != nil {
+		utils.RemoveFileIgnoreNotExists(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, videoPath)
+}
+
+// thumbnailExtension keeps png and webp images recognizable, everything else is saved as jpg.
+func thumbnailExtension(imageUrl string) string {
+	u, err := url.Parse(imageUrl)
+	if err != nil {
+		return ".jpg"
+	}
+	switch ext := strings.ToLower(path.Ext(u.Path)); ext {
+	case ".png", ".webp":
+		return ext
+	default:
+		return ".jpg"
+	}
+}
+
+func imageMimeType(imagePath string) string {
+	switch filepath.Ext(imagePath) {
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	default:
+		return "image/jpeg"
+	}
+}
+
+func isThumbnail(name string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(name, filepath.Ext(name)), thumbnailSuffix)
+}
@@ -0,0 +1,64 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
+)
+
+func TestWriteThumbnail(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.jpg" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	video := filepath.Join(dir, "Series - S01E01 - Ger Dub.mp4")
+	os.WriteFile(video, []byte("video"), 0644)
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{server.URL + "/cover.jpg?width=300", "Series - S01E01 - Ger Dub-thumb.jpg"},
+		{server.URL + "/cover.png", "Series - S01E01 - Ger Dub-thumb.png"},
+		{server.URL + "/cover", "Series - S01E01 - Ger Dub-thumb.jpg"},
+	}
+
+	d := NewDownloader("", false, 0)
+	for _, tt := range tests {
+		path, err := d.WriteThumbnail(context.Background(), video, tt.url, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Base(path) != tt.expected {
+			t.Errorf("\nExpected: %s\nGot:      %s", tt.expected, filepath.Base(path))
+		}
+		if data, _ := os.ReadFile(path); string(data) != "image" {
+			t.Errorf("\nExpected: image\nGot:      %q", data)
+		}
+	}
+
+	if _, err := d.WriteThumbnail(context.Background(), video, server.URL+"/missing.jpg", "", ""); err == nil {
+		t.Errorf("expected an error for a missing thumbnail")
+	}
+
+	// the sidecars must not make the episode look downloaded
+	os.Remove(video)
+	cache, err := NewDirectoryCache(dir, downloaders.SkipModeByName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.HasPrefix("Series - S01E01") {
+		t.Errorf("thumbnail counted as episode")
+	}
+}
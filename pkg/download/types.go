@@ -2,6 +2,8 @@ package download
 
 import (
 	"path/filepath"
+
+	"github.com/bugmaschine/gad/internal/downloaders"
 )
 
 type DownloadTask struct {
@@ -12,6 +14,20 @@ type DownloadTask struct {
 	SkipExisting           bool
 	CustomMessage          string
 	Referer                string
+	// Hoster is the extractor that produced Url, the headers its CDN needs are sent with every request
+	Hoster string
+	// Progress is called with the downloaded bytes and the (estimated) total, which is 0 if unknown
+	Progress func(downloaded, total int64)
+	// Refresh is asked for a new URL if the server refuses the current one with 401 or 403, nil gives up instead
+	Refresh downloaders.RefreshFunc
+	// ParallelParts splits plain files into that many byte ranges downloaded at the same time, if the server supports it
+	ParallelParts int
+	// AudioFormat only keeps the audio in this format, empty keeps the video
+	AudioFormat AudioFormat
+	// audioOnly prefers the audio renditions of HLS and DASH, set for the source of an AudioFormat download
+	audioOnly bool
+	// sha256 is the hash of the finished file if it was computed while downloading, see DownloadManager.recordChecksum
+	sha256 string
 }
 
 func NewDownloadTask(outputPath, url string) *DownloadTask {
@@ -41,6 +57,42 @@ func (t *DownloadTask) SetReferer(referer string) *DownloadTask {
 	return t
 }
 
+func (t *DownloadTask) SetHoster(hoster string) *DownloadTask {
+	t.Hoster = hoster
+	return t
+}
+
+func (t *DownloadTask) SetProgress(progress func(downloaded, total int64)) *DownloadTask {
+	t.Progress = progress
+	return t
+}
+
+func (t *DownloadTask) SetRefresh(refresh downloaders.RefreshFunc) *DownloadTask {
+	t.Refresh = refresh
+	return t
+}
+
+func (t *DownloadTask) SetParallelParts(parts int) *DownloadTask {
+	t.ParallelParts = parts
+	return t
+}
+
+func (t *DownloadTask) SetAudioFormat(format AudioFormat) *DownloadTask {
+	t.AudioFormat = format
+	return t
+}
+
+// FinalOutputPath is the path the download ends up at, including the default extension.
+func (t *DownloadTask) FinalOutputPath() string {
+	switch {
+	case t.OutputPathHasExtension:
+		return t.OutputPath
+	case t.AudioFormat != "":
+		return t.OutputPath + "." + string(t.AudioFormat)
+	}
+	return t.OutputPath + ".mp4"
+}
+
 func (t *DownloadTask) Filename() string {
 	return filepath.Base(t.OutputPath)
 }
@@ -0,0 +1,77 @@
+package download
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// DataUsage is the traffic of the downloads of a manager. Useful bytes ended up in finished episodes, wasted ones
+// were thrown away: segment attempts that broke off and downloads that failed or were canceled.
+type DataUsage struct {
+	Useful int64
+	Wasted int64
+}
+
+// Total is everything that was received, as counted against a metered connection.
+func (u DataUsage) Total() int64 {
+	return u.Useful + u.Wasted
+}
+
+// taskUsage counts the bytes received for one download, it travels with the context of the download.
+type taskUsage struct {
+	received  atomic.Int64
+	discarded atomic.Int64
+}
+
+type taskUsageKey struct{}
+
+func withTaskUsage(ctx context.Context, u *taskUsage) context.Context {
+	return context.WithValue(ctx, taskUsageKey{}, u)
+}
+
+func taskUsageFrom(ctx context.Context) *taskUsage {
+	u, _ := ctx.Value(taskUsageKey{}).(*taskUsage)
+	return u
+}
+
+// do sends req and counts the bytes of the response body for the download of its context.
+func (d *Downloader) do(req *http.Request) (*http.Response, error) {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if u := taskUsageFrom(req.Context()); u != nil {
+		resp.Body = &countingBody{ReadCloser: resp.Body, usage: u}
+	}
+	return resp, nil
+}
+
+// discard marks n received bytes of the download of ctx as thrown away.
+func (d *Downloader) discard(ctx context.Context, n int64) {
+	if u := taskUsageFrom(ctx); u != nil && n > 0 {
+		u.discarded.Add(n)
+	}
+}
+
+// add books the bytes of a finished download, all of them are wasted if it failed.
+func (u *DataUsage) add(task *taskUsage, failed bool) {
+	received, discarded := task.received.Load(), task.discarded.Load()
+	if failed {
+		discarded = received
+	}
+	u.Useful += received - discarded
+	u.Wasted += discarded
+}
+
+type countingBody struct {
+	io.ReadCloser
+	usage *taskUsage
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.usage.received.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,61 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDataUsageRetriedSegment(t *testing.T) {
+	const playlist = "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4.0,\nseg0.ts\n#EXTINF:4.0,\nseg1.ts\n#EXT-X-ENDLIST\n"
+	segment := strings.Repeat("x", 100)
+
+	var mu sync.Mutex
+	dropped := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/index.m3u8":
+			w.Write([]byte(playlist))
+		case "/seg1.ts":
+			if !dropped {
+				// the connection breaks after 40 bytes, the whole segment is requested again
+				dropped = true
+				w.Header().Set("Content-Length", strconv.Itoa(len(segment)))
+				w.Write([]byte(segment[:40]))
+				return
+			}
+			fallthrough
+		default:
+			w.Write([]byte(segment))
+		}
+	}))
+	defer server.Close()
+
+	d := NewDownloader("", false, 0)
+	usage := &taskUsage{}
+	task := NewDownloadTask(filepath.Join(t.TempDir(), "episode"), server.URL+"/index.m3u8")
+	if err := d.DownloadToFile(withTaskUsage(context.Background(), usage), task); err != nil {
+		t.Fatal(err)
+	}
+
+	var got DataUsage
+	got.add(usage, false)
+	expected := DataUsage{Useful: int64(len(playlist) + 2*len(segment)), Wasted: 40}
+	if got != expected {
+		t.Errorf("\nExpected: %+v\nGot:      %+v", expected, got)
+	}
+
+	// nothing of a failed download is useful
+	var failed DataUsage
+	failed.add(usage, true)
+	if failed.Useful != 0 || failed.Wasted != expected.Total() {
+		t.Errorf("\nExpected: %d wasted\nGot:      %+v", expected.Total(), failed)
+	}
+}
@@ -3,11 +3,14 @@ package download
 import (
 	"fmt"
 	"math"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/bugmaschine/gad/internal/downloaders"
+	"github.com/bugmaschine/gad/pkg/utils"
 )
 
 func PrepareSeriesNameForFile(name string) string {
@@ -117,6 +120,68 @@ func GetEpisodeName(animeName string, videoType *downloaders.VideoType, epInfo *
 	return sb.String()
 }
 
+// SpecialsFolder is the folder of season 0, the movies and specials. Jellyfin, Plex and Kodi all look for them there.
+const SpecialsFolder = "Season 00"
+
+// SpecialsTemplate is the folder template of --include-specials without --folder-template, it only moves the
+// specials into SpecialsFolder.
+const SpecialsTemplate = "{specials}"
+
+// GetEpisodeDirectory expands a folder template like "{series}/Season {season}" into a relative directory for the episode.
+// Every path segment gets sanitized on its own, so titles can't escape the save directory. An empty template keeps the output flat.
+// {specials} is SpecialsFolder for season 0 and empty otherwise, empty segments are dropped.
+func GetEpisodeDirectory(template, seriesTitle string, epInfo *downloaders.EpisodeInfo) string {
+	if template == "" {
+		return ""
+	}
+
+	specials := ""
+	if epInfo.Season == 0 {
+		specials = SpecialsFolder
+	}
+	replacer := strings.NewReplacer(
+		"{series}", seriesTitle,
+		"{season}", fmt.Sprintf("%02d", epInfo.Season),
+		"{specials}", specials,
+	)
+
+	var segments []string
+	for _, segment := range strings.FieldsFunc(template, func(r rune) bool { return r == '/' || r == '\\' }) {
+		segment = utils.CleanFolderName(replacer.Replace(segment))
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return filepath.Join(segments...)
+}
+
+// DefaultOutputTemplate names single downloads after the video, the timestamp keeps repeated titles apart.
+const DefaultOutputTemplate = "{title} {timestamp}"
+
+// GetSingleFileName expands an output template with {title} and {timestamp} for single downloads.
+// Without a title only the timestamp is used, as the rest of the template is usually meaningless then.
+func GetSingleFileName(template, title string, now time.Time) string {
+	timestamp := now.Format("2006-01-02_15-04-05.000")
+
+	title = strings.TrimSpace(title)
+	if title == "" || template == "" {
+		return timestamp
+	}
+
+	name := strings.NewReplacer(
+		"{title}", title,
+		"{timestamp}", timestamp,
+	).Replace(template)
+
+	// no subfolders for single downloads
+	name = utils.CleanFolderName(name)
+	if name == "" {
+		return timestamp
+	}
+	return name
+}
+
 func formatEpisodeNumber(num uint32, alignment int) string {
 	if alignment <= 0 {
 		return fmt.Sprintf("%d", num)
@@ -131,3 +196,17 @@ func ilog10(n uint32) int {
 	}
 	return int(math.Log10(float64(n)))
 }
+
+// FormatSize prints a byte count with binary units, e.g. 1.5 GiB.
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
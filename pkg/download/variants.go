@@ -0,0 +1,66 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/grafov/m3u8"
+)
+
+// Variant is one quality of a HLS master playlist.
+type Variant struct {
+	Url        string `json:"url"`
+	Resolution string `json:"resolution,omitempty"`
+	Bandwidth  uint32 `json:"bandwidth"`
+	Codecs     string `json:"codecs,omitempty"`
+	// Selected marks the variant a download would pick with the current --quality
+	Selected bool `json:"selected"`
+}
+
+// ListVariants returns the variants of a HLS master playlist, sorted by bandwidth like a download sees them.
+// Anything else, including media playlists, has no variants and returns nil.
+func (d *Downloader) ListVariants(ctx context.Context, url, referer string) ([]Variant, error) {
+	resp, err := d.get(ctx, url, referer)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !isHLS(resp.Request.URL, resp.Header.Get("Content-Type")) {
+		return nil, nil
+	}
+
+	p, listType, err := m3u8.DecodeFrom(resp.Body, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode m3u8: %w", err)
+	}
+	if listType != m3u8.MASTER {
+		return nil, nil
+	}
+	master := p.(*m3u8.MasterPlaylist)
+	if len(master.Variants) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(master.Variants, func(i, j int) bool {
+		return master.Variants[i].Bandwidth > master.Variants[j].Bandwidth
+	})
+	selected := selectVariant(master.Variants, d.quality)
+
+	variants := make([]Variant, len(master.Variants))
+	for i, v := range master.Variants {
+		u, err := resp.Request.URL.Parse(v.URI)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse variant URL: %w", err)
+		}
+		variants[i] = Variant{
+			Url:        u.String(),
+			Resolution: v.Resolution,
+			Bandwidth:  v.Bandwidth,
+			Codecs:     v.Codecs,
+			Selected:   v == selected,
+		}
+	}
+	return variants, nil
+}
@@ -0,0 +1,90 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bugmaschine/gad/internal/extractors"
+	"github.com/grafov/m3u8"
+)
+
+func TestListVariants(t *testing.T) {
+	master := `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"
+360/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,CODECS="avc1.640028,mp4a.40.2"
+1080/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2500000,RESOLUTION=1280x720
+https://other.example.com/720.m3u8
+`
+	media := "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXT-X-ENDLIST\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/master.m3u8":
+			w.Write([]byte(master))
+		case "/media.m3u8":
+			w.Write([]byte(media))
+		default:
+			w.Write([]byte("video"))
+		}
+	}))
+	defer server.Close()
+
+	d := NewDownloader("", false, 0)
+	d.SetQuality(extractors.QualityCap{MaxHeight: 720})
+	variants, err := d.ListVariants(context.Background(), server.URL+"/master.m3u8", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Variant{
+		{Url: server.URL + "/1080/index.m3u8", Resolution: "1920x1080", Bandwidth: 5000000, Codecs: "avc1.640028,mp4a.40.2"},
+		{Url: "https://other.example.com/720.m3u8", Resolution: "1280x720", Bandwidth: 2500000, Selected: true},
+		{Url: server.URL + "/360/index.m3u8", Resolution: "640x360", Bandwidth: 800000, Codecs: "avc1.4d401e,mp4a.40.2"},
+	}
+	if len(variants) != len(expected) {
+		t.Fatalf("\nExpected: %+v\nGot:      %+v", expected, variants)
+	}
+	for i := range expected {
+		if variants[i] != expected[i] {
+			t.Errorf("\nExpected: %+v\nGot:      %+v", expected[i], variants[i])
+		}
+	}
+
+	// media playlists and files have no variants
+	for _, path := range []string{"/media.m3u8", "/video.mp4"} {
+		variants, err := d.ListVariants(context.Background(), server.URL+path, "")
+		if err != nil || variants != nil {
+			t.Errorf("%s\nExpected: no variants\nGot:      %+v (%v)", path, variants, err)
+		}
+	}
+}
+
+func TestSelectVariantCap(t *testing.T) {
+	// sorted by bandwidth like ListVariants and the HLS download do
+	variants := []*m3u8.Variant{
+		{URI: "1080", VariantParams: m3u8.VariantParams{Resolution: "1920x1080", Bandwidth: 6000000}},
+		{URI: "720-high", VariantParams: m3u8.VariantParams{Resolution: "1280x720", Bandwidth: 4000000}},
+		{URI: "720-low", VariantParams: m3u8.VariantParams{Resolution: "1280x720", Bandwidth: 2500000}},
+		{URI: "480", VariantParams: m3u8.VariantParams{Resolution: "854x480", Bandwidth: 1200000}},
+	}
+
+	tests := []struct {
+		quality  extractors.QualityCap
+		expected string
+	}{
+		{extractors.QualityCap{}, "1080"},
+		{extractors.QualityCap{MaxHeight: 720}, "720-high"},
+		{extractors.QualityCap{MaxBitrate: 3000000}, "720-low"},
+		{extractors.QualityCap{MaxHeight: 1080, MaxBitrate: 5000000}, "720-high"},
+		{extractors.QualityCap{MaxBitrate: 500000}, "480"},
+		{extractors.QualityCap{MaxHeight: 360}, "480"},
+	}
+
+	for _, tt := range tests {
+		if got := selectVariant(variants, tt.quality).URI; got != tt.expected {
+			t.Errorf("\nCap:      %v\nExpected: %s\nGot:      %s", tt.quality, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bugmaschine/gad/pkg/utils"
+)
+
+// muxingSuffix marks the output of FFmpeg until it is verified and gets the name of the episode, e.g.
+// "<name>.muxing.mp4". A mux that breaks off never leaves a file behind that looks finished.
+const muxingSuffix = ".muxing"
+
+// ErrVerifyFailed is returned if ffprobe can't read a mux, see SetVerify.
+var ErrVerifyFailed = errors.New("the muxed file is broken")
+
+// SetVerify checks every mux with the ffprobe at ffprobePath before it gets its final name, an empty path disables it.
+func (d *Downloader) SetVerify(ffprobePath string) {
+	d.ffprobePath = ffprobePath
+}
+
+// muxingPath keeps the extension of outputPath, so FFmpeg picks the right muxer.
+func muxingPath(outputPath string) string {
+	ext := filepath.Ext(outputPath)
+	return strings.TrimSuffix(outputPath, ext) + muxingSuffix + ext
+}
+
+// muxAtomically runs FFmpeg like runFfmpeg, but the output is written under a temporary name, verified and only then
+// renamed to the last argument. Nothing is left behind if FFmpeg or the verification fails, not even the empty
+// placeholder DownloadToFile created under the final name.
+func (d *Downloader) muxAtomically(ctx context.Context, args []string) error {
+	outputPath := args[len(args)-1]
+	tmpPath := muxingPath(outputPath)
+	err := d.runFfmpeg(ctx, append(slices.Clone(args[:len(args)-1]), tmpPath))
+	if err == nil {
+		err = d.verifyOutput(ctx, tmpPath)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, outputPath)
+	}
+	if err != nil {
+		utils.RemoveFileIgnoreNotExists(tmpPath)
+		if info, statErr := os.Stat(outputPath); statErr == nil && info.Size() == 0 {
+			utils.RemoveFileIgnoreNotExists(outputPath)
+		}
+	}
+	return err
+}
+
+// verifyOutput checks that ffprobe can read the file at path and finds a video or audio stream in it.
+func (d *Downloader) verifyOutput(ctx context.Context, path string) error {
+	if d.ffprobePath == "" {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, d.ffprobePath, "-v", "error", "-show_entries", "stream=codec_type", "-of", "csv=p=0", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: %v: %s", ErrVerifyFailed, err, strings.TrimSpace(stderr.String()))
+	}
+	if !slices.ContainsFunc(strings.Fields(string(out)), func(codecType string) bool {
+		return codecType == "video" || codecType == "audio"
+	}) {
+		return fmt.Errorf("%w: no video or audio stream", ErrVerifyFailed)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMuxAtomically(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake FFmpeg and ffprobe are shell scripts")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".m3u8") {
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXTINF:4,\nseg1.ts\n#EXT-X-ENDLIST\n"))
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	// both write the last argument, the output, the failing one breaks off half way
+	const muxes = "#!/bin/sh\nfor last; do :; done\necho muxed > \"$last\"\n"
+	const breaks = "#!/bin/sh\nfor last; do :; done\necho half > \"$last\"\nexit 1\n"
+	const readable = "#!/bin/sh\necho video\necho audio\n"
+	const broken = "#!/bin/sh\necho 'moov atom not found' >&2\nexit 1\n"
+
+	tests := []struct {
+		name    string
+		ffmpeg  string
+		ffprobe string
+		// muxed is whether the episode got its final name, the raw stream is kept otherwise
+		muxed bool
+	}{
+		{"muxed", muxes, "", true},
+		{"verified", muxes, readable, true},
+		{"mux failed", breaks, "", false},
+		{"verification failed", muxes, broken, false},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		ffmpegPath := filepath.Join(dir, "ffmpeg")
+		os.WriteFile(ffmpegPath, []byte(tt.ffmpeg), 0755)
+
+		d := NewDownloader("", false, 0)
+		d.SetFfmpegPath(ffmpegPath)
+		if tt.ffprobe != "" {
+			ffprobePath := filepath.Join(dir, "ffprobe")
+			os.WriteFile(ffprobePath, []byte(tt.ffprobe), 0755)
+			d.SetVerify(ffprobePath)
+		}
+		task := NewDownloadTask(filepath.Join(dir, "episode"), server.URL+"/index.m3u8")
+		if err := d.DownloadToFile(context.Background(), task); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		outputPath := task.FinalOutputPath()
+		got, err := os.ReadFile(outputPath)
+		if tt.muxed && string(got) != "muxed\n" {
+			t.Errorf("%s\nExpected: the muxed episode\nGot:      %q (%v)", tt.name, got, err)
+		}
+		if !tt.muxed {
+			if !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s\nExpected: no file with the name of the episode\nGot:      %q (%v)", tt.name, got, err)
+			}
+			if raw, _ := os.ReadFile(hlsFallbackPath(outputPath)); string(raw) != "/seg0.ts/seg1.ts" {
+				t.Errorf("%s\nExpected: the raw stream\nGot:      %q", tt.name, raw)
+			}
+		}
+		if _, err := os.Stat(muxingPath(outputPath)); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s\nExpected: the temporary mux to be removed\nGot:      %v", tt.name, err)
+		}
+	}
+
+	// DASH has no raw stream to fall back to, the error is returned and the empty placeholder of DownloadToFile
+	// must not stay under the final name
+	for _, tt := range tests {
+		if tt.muxed {
+			continue
+		}
+		dir := t.TempDir()
+		ffmpegPath := filepath.Join(dir, "ffmpeg")
+		os.WriteFile(ffmpegPath, []byte(tt.ffmpeg), 0755)
+
+		d := NewDownloader("", false, 0)
+		d.SetFfmpegPath(ffmpegPath)
+		if tt.ffprobe != "" {
+			ffprobePath := filepath.Join(dir, "ffprobe")
+			os.WriteFile(ffprobePath, []byte(tt.ffprobe), 0755)
+			d.SetVerify(ffprobePath)
+		}
+		outputPath := filepath.Join(dir, "episode.mp4")
+		os.WriteFile(outputPath, nil, 0644)
+		if err := d.muxAtomically(context.Background(), []string{"-y", "-i", "video.mp4", "-i", "audio.mp4", outputPath}); err == nil {
+			t.Errorf("%s\nExpected: an error\nGot:      nil", tt.name)
+		}
+		for _, path := range []string{outputPath, muxingPath(outputPath)} {
+			if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s\nExpected: %s to be removed\nGot:      %v", tt.name, path, err)
+			}
+		}
+	}
+}
+
+func TestMuxingPath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Episode 1.mp4", "Episode 1.muxing.mp4"},
+		{filepath.Join("Season 1", "Episode 1.mkv"), filepath.Join("Season 1", "Episode 1.muxing.mkv")},
+		{"Episode", "Episode.muxing"},
+	}
+
+	for _, tt := range tests {
+		if got := muxingPath(tt.input); got != tt.expected {
+			t.Errorf("%s\nExpected: %s\nGot:      %s", tt.input, tt.expected, got)
+		}
+	}
+}
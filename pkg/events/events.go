@@ -0,0 +1,54 @@
+// Package events streams the progress of downloads as JSON lines over a Unix socket, see --event-socket.
+package events
+
+import "time"
+
+type Type string
+
+const (
+	TypeTaskStarted   Type = "task_started"
+	TypeProgress      Type = "progress"
+	TypeTaskCompleted Type = "task_completed"
+	TypeTaskFailed    Type = "task_failed"
+	// TypeSummary is sent once all downloads of a series are done
+	TypeSummary Type = "summary"
+)
+
+// Event is written as one JSON object per line. Only the fields of its type are set.
+type Event struct {
+	Type Type      `json:"type"`
+	Time time.Time `json:"time"`
+	Task *Task     `json:"task,omitempty"`
+	// Downloaded and Total are bytes, Total is an estimate for HLS and 0 if unknown
+	Downloaded int64    `json:"downloaded,omitempty"`
+	Total      int64    `json:"total,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	Summary    *Summary `json:"summary,omitempty"`
+}
+
+// Task identifies the episode an event belongs to.
+type Task struct {
+	Series  string `json:"series"`
+	Season  uint32 `json:"season"`
+	Episode uint32 `json:"episode"`
+	File    string `json:"file"`
+}
+
+type Summary struct {
+	Series    string `json:"series"`
+	Completed int    `json:"completed"`
+	Failed    int    `json:"failed"`
+	// Skipped counts existing episodes and those left out by --max-total-size
+	Skipped int `json:"skipped"`
+	// Canceled counts the downloads that were stopped or never started because of Ctrl+C or --max-failures
+	Canceled int `json:"canceled"`
+	// DataUsed is every byte the downloads received, DataWasted the part of it that was thrown away by retries and
+	// failed downloads
+	DataUsed   int64 `json:"data_used"`
+	DataWasted int64 `json:"data_wasted"`
+}
+
+// Publisher receives the events of a download manager.
+type Publisher interface {
+	Publish(e Event)
+}
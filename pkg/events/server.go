@@ -0,0 +1,158 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it misses some.
+const subscriberBuffer = 256
+
+// closeTimeout is how long subscribers get to read the remaining events when the server closes.
+const closeTimeout = time.Second
+
+// Server sends every published event to all connected subscribers. Subscribers only read, anything they write is ignored.
+// A subscriber that doesn't keep up misses events instead of slowing down the downloads.
+type Server struct {
+	listener net.Listener
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	closed      bool
+	wg          sync.WaitGroup
+}
+
+type subscriber struct {
+	conn   net.Conn
+	events chan []byte
+}
+
+// Listen creates the socket at path. A socket left behind by a crashed run is replaced, one that is still in use is an error.
+func Listen(path string) (*Server, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener:    listener,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+	go s.accept()
+	return s, nil
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		sub := &subscriber{conn: conn, events: make(chan []byte, subscriberBuffer)}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.subscribers[sub] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		slog.Debug("Event subscriber connected")
+		go s.serve(sub)
+	}
+}
+
+// serve writes the events of one subscriber until the server closes or the subscriber goes away.
+func (s *Server) serve(sub *subscriber) {
+	defer s.wg.Done()
+	defer sub.conn.Close()
+
+	for line := range sub.events {
+		if _, err := sub.conn.Write(line); err != nil {
+			slog.Debug("Event subscriber disconnected", "error", err)
+			s.mu.Lock()
+			if _, ok := s.subscribers[sub]; ok {
+				delete(s.subscribers, sub)
+				close(sub.events)
+			}
+			s.mu.Unlock()
+			// drain, so Publish never blocks on a removed subscriber
+			for range sub.events {
+			}
+			return
+		}
+	}
+}
+
+// Publish sends e to every subscriber, it never blocks.
+func (s *Server) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		slog.Debug("Failed to encode event", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscribers {
+		select {
+		case sub.events <- line:
+		default:
+		}
+	}
+}
+
+// Close stops accepting subscribers, gives the connected ones a moment to read the remaining events and removes the socket.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	// the listener unlinks the socket file
+	err := s.listener.Close()
+	for sub := range s.subscribers {
+		sub.conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+		close(sub.events)
+	}
+	s.subscribers = nil
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
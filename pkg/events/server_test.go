@@ -0,0 +1,96 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// socketPath stays below the length limit of Unix socket paths, which the test temp dirs can exceed.
+func socketPath(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "gad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "gad.sock")
+}
+
+func TestServer(t *testing.T) {
+	path := socketPath(t)
+	s, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var readers []*bufio.Reader
+	for range 2 {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		readers = append(readers, bufio.NewReader(conn))
+	}
+	// the subscribers are registered by the accept loop
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		n := len(s.subscribers)
+		s.mu.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sent := Event{Type: TypeProgress, Task: &Task{Series: "Series", Season: 1, Episode: 2, File: "Series - S01E02.mp4"}, Downloaded: 10, Total: 20}
+	s.Publish(sent)
+
+	for i, r := range readers {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("subscriber %d: %v", i, err)
+		}
+		var got Event
+		if err := json.Unmarshal(line, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Type != sent.Type || *got.Task != *sent.Task || got.Downloaded != sent.Downloaded || got.Time.IsZero() {
+			t.Errorf("subscriber %d\nExpected: %+v\nGot:      %+v", i, sent, got)
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket wasn't removed: %v", err)
+	}
+}
+
+func TestListenStaleSocket(t *testing.T) {
+	path := socketPath(t)
+	// a listener that doesn't unlink leaves the socket behind like a crashed run
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+
+	if _, err := Listen(path); err == nil {
+		t.Fatal("listening on a socket in use should fail")
+	}
+	stale.Close()
+
+	s, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+}
@@ -0,0 +1,84 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// reservedArgs are set by gad itself, overriding them would break the input, the muxer or the overwrite handling.
+var reservedArgs = []string{"-i", "-f", "-y", "-n"}
+
+// ParseArgs splits user supplied FFmpeg arguments like a shell would, respecting single and double quotes and
+// backslash escapes. The arguments get added in front of the output file, so they may only contain output options:
+// every value has to follow an option, a second value in a row would be taken as an additional output file.
+func ParseArgs(s string) ([]string, error) {
+	args, err := splitArgs(s)
+	if err != nil {
+		return nil, err
+	}
+
+	valueAllowed := false
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			if slices.Contains(reservedArgs, arg) {
+				return nil, fmt.Errorf("%s is set by gad and can't be overridden", arg)
+			}
+			valueAllowed = true
+			continue
+		}
+		if !valueAllowed {
+			return nil, fmt.Errorf("%q would be an additional output file, only options and their values are allowed", arg)
+		}
+		valueAllowed = false
+	}
+	return args, nil
+}
+
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,36 @@
+package ffmpeg
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		valid    bool
+	}{
+		{"", nil, true},
+		{"-bsf:a aac_adtstoasc -movflags +faststart", []string{"-bsf:a", "aac_adtstoasc", "-movflags", "+faststart"}, true},
+		{`-metadata "title=Episode 1" -metadata 'comment=it''s'`, []string{"-metadata", "title=Episode 1", "-metadata", "comment=its"}, true},
+		{`-metadata title=A\ B -sn`, []string{"-metadata", "title=A B", "-sn"}, true},
+		{"-itsoffset -1", []string{"-itsoffset", "-1"}, true},
+		{"-i other.mp4", nil, false},
+		{"-y", nil, false},
+		{"-c copy out.mkv", nil, false},
+		{"out.mkv", nil, false},
+		{`-metadata "title=open`, nil, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseArgs(tt.input)
+		if (err == nil) != tt.valid {
+			t.Errorf("%q\nExpected: valid=%v\nGot:      %v", tt.input, tt.valid, err)
+			continue
+		}
+		if tt.valid && !slices.Equal(got, tt.expected) {
+			t.Errorf("%q\nExpected: %q\nGot:      %q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -5,12 +5,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/bugmaschine/gad/pkg/download"
+	"github.com/bugmaschine/gad/pkg/utils"
 )
 
 // Downloader is an interface that matches the required functionality for ffmpeg auto-download.
@@ -26,59 +29,133 @@ func New(dataDir string) *Ffmpeg {
 	return &Ffmpeg{dataDir: dataDir}
 }
 
+// downloadAttempts is how often a download that fails verification is tried, corrupt downloads are usually one-offs.
+const downloadAttempts = 2
+
+// The binaries managed by Ffmpeg, they are released together.
+const (
+	toolFfmpeg  = "ffmpeg"
+	toolFfprobe = "ffprobe"
+)
+
 func (f *Ffmpeg) AutoDownload(ctx context.Context, downloader Downloader) (string, error) {
-	if path, err := f.GetFfmpegPath(); err == nil && path != "" {
+	return f.autoDownload(ctx, downloader, toolFfmpeg)
+}
+
+// AutoDownloadFfprobe works like AutoDownload for ffprobe, which "gad probe" and --verify need.
+func (f *Ffmpeg) AutoDownloadFfprobe(ctx context.Context, downloader Downloader) (string, error) {
+	return f.autoDownload(ctx, downloader, toolFfprobe)
+}
+
+func (f *Ffmpeg) autoDownload(ctx context.Context, downloader Downloader, tool string) (string, error) {
+	if path, err := f.lookPath(tool); err == nil {
 		return path, nil
 	}
 
-	url, err := ffmpegDownloadUrl()
+	url, err := downloadUrl(tool)
 	if err != nil {
 		return "", err
 	}
 
-	gzipPath := f.getFfmpegDataPath(true)
+	return f.download(ctx, downloader, tool, url)
+}
+
+// download installs the tool from url, retrying once if the download can't be verified.
+func (f *Ffmpeg) download(ctx context.Context, downloader Downloader, tool, url string) (string, error) {
+	var err error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		if err = f.install(ctx, downloader, tool, url); err == nil {
+			return f.dataPath(tool, false), nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		slog.Warn("Download failed", "tool", tool, "attempt", attempt, "attempts", downloadAttempts, "error", err)
+	}
+	return "", err
+}
+
+// install unpacks the download next to the binary and only replaces it once the new one runs, so the path
+// handed to the downloader always points to a working binary. The gzip trailer holds the CRC-32 and size of
+// the binary, unpacking fails on truncated or corrupt downloads.
+func (f *Ffmpeg) install(ctx context.Context, downloader Downloader, tool, url string) error {
+	gzipPath := f.dataPath(tool, true)
+	defer utils.RemoveFileIgnoreNotExists(gzipPath)
+
 	task := download.NewDownloadTask(gzipPath, url).
 		SetOverwriteFile(true).
-		SetCustomMessage("Downloading FFmpeg")
-
+		SetCustomMessage("Downloading " + tool)
 	task.OutputPathHasExtension = true
 
-	err = downloader.DownloadToFile(ctx, task)
-	if err != nil {
-		return "", fmt.Errorf("failed to download ffmpeg: %w", err)
+	if err := downloader.DownloadToFile(ctx, task); err != nil {
+		return fmt.Errorf("failed to download %s: %w", tool, err)
 	}
 
-	ffmpegPath := f.getFfmpegDataPath(false)
+	binPath := f.dataPath(tool, false)
+	newPath := binPath + ".new"
+	defer utils.RemoveFileIgnoreNotExists(newPath)
 
-	err = f.decompressGzip(gzipPath, ffmpegPath)
-	if err != nil {
-		return "", err
+	if err := f.decompressGzip(gzipPath, newPath); err != nil {
+		return err
 	}
-
-	_ = os.Remove(gzipPath)
-
-	return ffmpegPath, nil
+	if _, err := Version(newPath); err != nil {
+		return fmt.Errorf("downloaded %s doesn't run: %w", tool, err)
+	}
+	return os.Rename(newPath, binPath)
 }
 
 func (f *Ffmpeg) GetFfmpegPath() (string, error) {
-	exeName := ffmpegExecutableName()
-	path, err := exec.LookPath(exeName)
+	return f.lookPath(toolFfmpeg)
+}
+
+// lookPath prefers the tool from PATH over the downloaded one.
+func (f *Ffmpeg) lookPath(tool string) (string, error) {
+	path, err := exec.LookPath(executableName(tool))
 	if err == nil {
 		return path, nil
 	}
 
-	dataPath := f.getFfmpegDataPath(false)
+	dataPath := f.dataPath(tool, false)
 	if _, err := os.Stat(dataPath); err == nil {
 		return dataPath, nil
 	}
 
-	return "", fmt.Errorf("ffmpeg not found")
+	return "", fmt.Errorf("%s not found", tool)
+}
+
+// Version returns the first line of `ffmpeg -version` for the binary at path.
+func Version(path string) (string, error) {
+	out, err := exec.Command(path, "-version").Output()
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(line), nil
 }
 
-func (f *Ffmpeg) getFfmpegDataPath(gzip bool) string {
-	name := ffmpegExecutableName()
+// DownloadSource describes where AutoDownload gets ffmpeg from, as the static builds are always the latest release.
+func DownloadSource() string {
+	url, err := downloadUrl(toolFfmpeg)
+	if err != nil {
+		return err.Error()
+	}
+	return url
+}
+
+// Cache returns the FFmpeg and ffprobe binaries AutoDownload put into the data directory, the ones of the system
+// are never part of it.
+func (f *Ffmpeg) Cache() []string {
+	var paths []string
+	for _, tool := range []string{toolFfmpeg, toolFfprobe} {
+		paths = append(paths, f.dataPath(tool, false), f.dataPath(tool, true))
+	}
+	return paths
+}
+
+func (f *Ffmpeg) dataPath(tool string, gzip bool) string {
+	name := executableName(tool)
 	if gzip {
-		name = "ffmpeg.gz"
+		name = tool + ".gz"
 	}
 	return filepath.Join(f.dataDir, name)
 }
@@ -100,9 +177,11 @@ func (f *Ffmpeg) decompressGzip(src, dst string) error {
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer dstFile.Close()
 
 	_, err = io.Copy(dstFile, gzReader)
+	if closeErr := dstFile.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		return fmt.Errorf("failed to decompress gzip content: %w", err)
 	}
@@ -110,14 +189,14 @@ func (f *Ffmpeg) decompressGzip(src, dst string) error {
 	return nil
 }
 
-func ffmpegExecutableName() string {
+func executableName(tool string) string {
 	if runtime.GOOS == "windows" {
-		return "ffmpeg.exe"
+		return tool + ".exe"
 	}
-	return "ffmpeg"
+	return tool
 }
 
-func ffmpegDownloadUrl() (string, error) {
+func downloadUrl(tool string) (string, error) {
 	var platform string
 	switch runtime.GOOS {
 	case "linux":
@@ -162,5 +241,5 @@ func ffmpegDownloadUrl() (string, error) {
 		return "", fmt.Errorf("unsupported platform architecture combination: %s %s", runtime.GOOS, runtime.GOARCH)
 	}
 
-	return fmt.Sprintf("https://github.com/eugeneware/ffmpeg-static/releases/latest/download/ffmpeg-%s-%s.gz", platform, arch), nil
+	return fmt.Sprintf("https://github.com/eugeneware/ffmpeg-static/releases/latest/download/%s-%s-%s.gz", tool, platform, arch), nil
 }
@@ -0,0 +1,96 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/bugmaschine/gad/pkg/download"
+)
+
+// fakeDownloader serves the given bodies one after another.
+type fakeDownloader struct {
+	bodies [][]byte
+	calls  int
+}
+
+func (d *fakeDownloader) DownloadToFile(_ context.Context, task *download.DownloadTask) error {
+	body := d.bodies[min(d.calls, len(d.bodies)-1)]
+	d.calls++
+	return os.WriteFile(task.FinalOutputPath(), body, 0644)
+}
+
+func TestDownloadRetriesTruncated(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake binary is a shell script")
+	}
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	gz.Write([]byte("#!/bin/sh\necho 'ffmpeg version test'\n"))
+	gz.Close()
+	full := archive.Bytes()
+	truncated := full[:len(full)-6]
+
+	tests := []struct {
+		name   string
+		bodies [][]byte
+		valid  bool
+		calls  int
+	}{
+		{"intact", [][]byte{full}, true, 1},
+		{"truncated once", [][]byte{truncated, full}, true, 2},
+		{"always truncated", [][]byte{truncated}, false, downloadAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := New(t.TempDir())
+			downloader := &fakeDownloader{bodies: tt.bodies}
+
+			path, err := f.download(context.Background(), downloader, toolFfmpeg, "https://example.com/ffmpeg.gz")
+			if (err == nil) != tt.valid {
+				t.Fatalf("\nExpected: valid=%v\nGot:      %v", tt.valid, err)
+			}
+			if downloader.calls != tt.calls {
+				t.Errorf("\nExpected: %d downloads\nGot:      %d", tt.calls, downloader.calls)
+			}
+			if !tt.valid {
+				if _, err := os.Stat(f.dataPath(toolFfmpeg, false)); !os.IsNotExist(err) {
+					t.Errorf("a broken download must not be installed: %v", err)
+				}
+				return
+			}
+			if v, err := Version(path); err != nil || v != "ffmpeg version test" {
+				t.Errorf("\nExpected: ffmpeg version test\nGot:      %q %v", v, err)
+			}
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	dataDir := t.TempDir()
+	f := New(dataDir)
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	gz.Write([]byte("#!/bin/sh\n"))
+	gz.Close()
+
+	path, err := f.download(context.Background(), &fakeDownloader{bodies: [][]byte{archive.Bytes()}}, toolFfmpeg, "https://example.com/ffmpeg.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(f.Cache(), path) {
+		t.Errorf("\nExpected: %s in %v\nGot:      missing", path, f.Cache())
+	}
+	for _, p := range f.Cache() {
+		if filepath.Dir(p) != dataDir {
+			t.Errorf("\nExpected: %s in the data directory\nGot:      outside", p)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bugmaschine/gad/pkg/download"
+)
+
+// ProbeResult describes a stream, see Probe.
+type ProbeResult struct {
+	Url    string `json:"url"`
+	Format string `json:"format"`
+	// Duration is in seconds, 0 if unknown
+	Duration float64 `json:"duration"`
+	// Bitrate is in bits per second, 0 if unknown
+	Bitrate int64         `json:"bitrate"`
+	Streams []ProbeStream `json:"streams"`
+	// Variants are the qualities of a HLS master playlist, the streams belong to the selected one
+	Variants []download.Variant `json:"variants,omitempty"`
+}
+
+type ProbeStream struct {
+	Index int `json:"index"`
+	// Type is video, audio or subtitle
+	Type     string `json:"type"`
+	Codec    string `json:"codec"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Channels int    `json:"channels,omitempty"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+// ffprobeOutput is the part of `ffprobe -print_format json` that ends up in a ProbeResult.
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []struct {
+		Index     int    `json:"index"`
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		Channels  int    `json:"channels"`
+		Tags      struct {
+			Language string `json:"language"`
+			Title    string `json:"title"`
+		} `json:"tags"`
+	} `json:"streams"`
+}
+
+// Probe runs ffprobe on url with the headers a download would send. Only metadata is read, nothing is written.
+func Probe(ctx context.Context, ffprobePath, url, referer, userAgent string) (*ProbeResult, error) {
+	args := []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams"}
+	if userAgent != "" {
+		args = append(args, "-user_agent", userAgent)
+	}
+	if referer != "" {
+		args = append(args, "-headers", "Referer: "+referer+"\r\n")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffprobePath, append(args, url)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w: %s", err, lastLine(stderr.String()))
+	}
+	return parseProbe(out, url)
+}
+
+func parseProbe(data []byte, url string) (*ProbeResult, error) {
+	var out ffprobeOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to decode ffprobe output: %w", err)
+	}
+
+	r := &ProbeResult{Url: url, Format: out.Format.FormatName, Streams: []ProbeStream{}}
+	// both are "N/A" if unknown
+	r.Duration, _ = strconv.ParseFloat(out.Format.Duration, 64)
+	r.Bitrate, _ = strconv.ParseInt(out.Format.BitRate, 10, 64)
+
+	for _, s := range out.Streams {
+		if s.CodecType != "video" && s.CodecType != "audio" && s.CodecType != "subtitle" {
+			continue
+		}
+		r.Streams = append(r.Streams, ProbeStream{
+			Index:    s.Index,
+			Type:     s.CodecType,
+			Codec:    s.CodecName,
+			Width:    s.Width,
+			Height:   s.Height,
+			Channels: s.Channels,
+			Language: s.Tags.Language,
+			Title:    s.Tags.Title,
+		})
+	}
+	return r, nil
+}
+
+// Print writes the result for humans.
+func (r *ProbeResult) Print(w io.Writer) {
+	fmt.Fprintf(w, "URL:      %s\n", r.Url)
+	fmt.Fprintf(w, "Format:   %s\n", r.Format)
+	if r.Duration > 0 {
+		fmt.Fprintf(w, "Duration: %s\n", time.Duration(r.Duration*float64(time.Second)).Round(time.Second))
+	}
+	if r.Bitrate > 0 {
+		fmt.Fprintf(w, "Bitrate:  %s\n", formatBitrate(r.Bitrate))
+	}
+
+	if len(r.Variants) > 0 {
+		fmt.Fprintln(w, "\nVariants (* is downloaded):")
+		for _, v := range r.Variants {
+			marker := " "
+			if v.Selected {
+				marker = "*"
+			}
+			resolution := v.Resolution
+			if resolution == "" {
+				resolution = "unknown"
+			}
+			fmt.Fprintf(w, "  %s %-10s %-12s %s\n", marker, resolution, formatBitrate(int64(v.Bandwidth)), v.Codecs)
+		}
+	}
+
+	fmt.Fprintln(w, "\nStreams:")
+	for _, s := range r.Streams {
+		details := []string{s.Codec}
+		if s.Width > 0 && s.Height > 0 {
+			details = append(details, fmt.Sprintf("%dx%d", s.Width, s.Height))
+		}
+		if s.Channels > 0 {
+			details = append(details, fmt.Sprintf("%d channels", s.Channels))
+		}
+		if s.Language != "" {
+			details = append(details, s.Language)
+		}
+		if s.Title != "" {
+			details = append(details, strconv.Quote(s.Title))
+		}
+		fmt.Fprintf(w, "  #%-2d %-8s %s\n", s.Index, s.Type, strings.Join(details, ", "))
+	}
+}
+
+func formatBitrate(bitsPerSecond int64) string {
+	if bitsPerSecond >= 1_000_000 {
+		return fmt.Sprintf("%.1f Mbit/s", float64(bitsPerSecond)/1_000_000)
+	}
+	return fmt.Sprintf("%d kbit/s", bitsPerSecond/1000)
+}
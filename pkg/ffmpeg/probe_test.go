@@ -0,0 +1,56 @@
+package ffmpeg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProbe(t *testing.T) {
+	output := `{
+  "streams": [
+    {"index": 0, "codec_name": "h264", "codec_type": "video", "width": 1920, "height": 1080},
+    {"index": 1, "codec_name": "aac", "codec_type": "audio", "channels": 2, "tags": {"language": "jpn"}},
+    {"index": 2, "codec_name": "webvtt", "codec_type": "subtitle", "tags": {"language": "ger", "title": "Forced"}},
+    {"index": 3, "codec_name": "timed_id3", "codec_type": "data"}
+  ],
+  "format": {"format_name": "hls", "duration": "1440.500000", "bit_rate": "N/A"}
+}`
+
+	got, err := parseProbe([]byte(output), "https://example.com/master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ProbeResult{
+		Url:      "https://example.com/master.m3u8",
+		Format:   "hls",
+		Duration: 1440.5,
+		Streams: []ProbeStream{
+			{Index: 0, Type: "video", Codec: "h264", Width: 1920, Height: 1080},
+			{Index: 1, Type: "audio", Codec: "aac", Channels: 2, Language: "jpn"},
+			{Index: 2, Type: "subtitle", Codec: "webvtt", Language: "ger", Title: "Forced"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("\nExpected: %+v\nGot:      %+v", expected, got)
+	}
+
+	if _, err := parseProbe([]byte("not json"), ""); err == nil {
+		t.Error("invalid output should fail")
+	}
+}
+
+func TestFormatBitrate(t *testing.T) {
+	tests := []struct {
+		input    int64
+		expected string
+	}{
+		{128000, "128 kbit/s"},
+		{5500000, "5.5 Mbit/s"},
+	}
+
+	for _, tt := range tests {
+		if got := formatBitrate(tt.input); got != tt.expected {
+			t.Errorf("%d\nExpected: %s\nGot:      %s", tt.input, tt.expected, got)
+		}
+	}
+}
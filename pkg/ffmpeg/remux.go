@@ -0,0 +1,132 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bugmaschine/gad/pkg/download"
+	"github.com/bugmaschine/gad/pkg/utils"
+)
+
+// RemuxFormats are the containers Remux can write, the transport streams of HLS downloads fit into both.
+var RemuxFormats = []string{"mp4", "mkv"}
+
+// ErrTargetExists is returned by Remux if the remuxed file is already there.
+var ErrTargetExists = errors.New("target already exists")
+
+// FindRemuxSources returns path if it is a .ts file, or every .ts file below it if it is a directory.
+func FindRemuxSources(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if !isTransportStream(path) {
+			return nil, fmt.Errorf("%s is not a .ts file", path)
+		}
+		return []string{path}, nil
+	}
+
+	var sources []string
+	err = filepath.WalkDir(path, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// the segments of unfinished HLS downloads are no episodes
+		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".parts") {
+			return filepath.SkipDir
+		}
+		if !entry.IsDir() && isTransportStream(p) {
+			sources = append(sources, p)
+		}
+		return nil
+	})
+	return sources, err
+}
+
+// RemuxTarget is the path Remux writes src to.
+func RemuxTarget(src, format string) string {
+	return strings.TrimSuffix(src, filepath.Ext(src)) + "." + format
+}
+
+// RemuxOptions configure Remux.
+type RemuxOptions struct {
+	// Format is one of RemuxFormats
+	Format string
+	// DeleteSource removes src once the remuxed file is in place
+	DeleteSource bool
+	// Faststart moves the index of mp4 files to the front, so players can start before reading the whole file
+	Faststart bool
+	// ExtraArgs are user supplied output options, see ParseArgs
+	ExtraArgs []string
+	// NoSeek writes mp4 files fragmented, for directories that can't seek. Without it this is only tried after the
+	// plain mp4 failed to seek.
+	NoSeek bool
+}
+
+// Remux copies the streams of src into a new container next to it, without re-encoding.
+// The result is written to a temporary file first and moved into place once FFmpeg succeeded.
+func Remux(ctx context.Context, ffmpegPath, src string, opts RemuxOptions) (string, error) {
+	dst := RemuxTarget(src, opts.Format)
+	if _, err := os.Stat(dst); err == nil {
+		return dst, ErrTargetExists
+	}
+
+	tmp := dst + ".part"
+	args := remuxArgs(src, tmp, opts)
+	seeks := opts.Format == "mp4"
+	if seeks && opts.NoSeek {
+		args = download.StreamableArgs(args)
+	}
+	out, err := exec.CommandContext(ctx, ffmpegPath, args...).CombinedOutput()
+	if err != nil && seeks && !opts.NoSeek && ctx.Err() == nil && download.IsSeekError(string(out)) {
+		slog.Warn("The directory can't seek, writing a fragmented mp4 instead", "file", src)
+		out, err = exec.CommandContext(ctx, ffmpegPath, download.StreamableArgs(args)...).CombinedOutput()
+	}
+	if err != nil {
+		utils.RemoveFileIgnoreNotExists(tmp)
+		return "", fmt.Errorf("ffmpeg failed: %w: %s", err, lastLine(string(out)))
+	}
+	if err := utils.MoveFile(tmp, dst); err != nil {
+		utils.RemoveFileIgnoreNotExists(tmp)
+		return "", err
+	}
+
+	if opts.DeleteSource {
+		if err := os.Remove(src); err != nil {
+			return dst, fmt.Errorf("remuxed, but failed to delete the source: %w", err)
+		}
+	}
+	return dst, nil
+}
+
+func remuxArgs(src, dst string, opts RemuxOptions) []string {
+	// the temporary name hides the extension, so the muxer has to be named
+	muxer := opts.Format
+	if opts.Format == "mkv" {
+		muxer = "matroska"
+	}
+	// data streams like ID3 tags of HLS can't go into mp4, only video and audio are kept
+	args := []string{"-y", "-i", src, "-map", "0:v?", "-map", "0:a?", "-c", "copy", "-f", muxer}
+	if opts.Faststart && opts.Format == "mp4" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	args = append(args, opts.ExtraArgs...)
+	return append(args, dst)
+}
+
+func isTransportStream(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".ts")
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
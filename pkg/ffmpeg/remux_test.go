@@ -0,0 +1,113 @@
+package ffmpeg
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFindRemuxSources(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.ts", "b.mp4", "Season 01/c.TS", "d.mp4.parts/0.ts"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, nil, 0644)
+	}
+
+	sources, err := FindRemuxSources(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(dir, "Season 01", "c.TS"), filepath.Join(dir, "a.ts")}
+	if !slices.Equal(sources, expected) {
+		t.Errorf("\nExpected: %v\nGot:      %v", expected, sources)
+	}
+
+	if _, err := FindRemuxSources(filepath.Join(dir, "b.mp4")); err == nil {
+		t.Error("expected an error for a file that isn't a .ts")
+	}
+}
+
+func TestRemuxArgs(t *testing.T) {
+	tests := []struct {
+		opts     RemuxOptions
+		expected []string
+	}{
+		{RemuxOptions{Format: "mp4", Faststart: true}, []string{"-y", "-i", "a.ts", "-map", "0:v?", "-map", "0:a?", "-c", "copy", "-f", "mp4", "-movflags", "+faststart", "a.mp4.part"}},
+		{RemuxOptions{Format: "mp4"}, []string{"-y", "-i", "a.ts", "-map", "0:v?", "-map", "0:a?", "-c", "copy", "-f", "mp4", "a.mp4.part"}},
+		{RemuxOptions{Format: "mkv", Faststart: true, ExtraArgs: []string{"-sn"}}, []string{"-y", "-i", "a.ts", "-map", "0:v?", "-map", "0:a?", "-c", "copy", "-f", "matroska", "-sn", "a.mkv.part"}},
+	}
+
+	for _, tt := range tests {
+		got := remuxArgs("a.ts", RemuxTarget("a.ts", tt.opts.Format)+".part", tt.opts)
+		if !slices.Equal(got, tt.expected) {
+			t.Errorf("\nExpected: %v\nGot:      %v", tt.expected, got)
+		}
+	}
+}
+
+// TestRemuxFaststart checks with a real FFmpeg that the index ends up in front of the media data.
+func TestRemuxFaststart(t *testing.T) {
+	ffmpegPath, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+
+	for _, faststart := range []bool{true, false} {
+		src := filepath.Join(t.TempDir(), "a.ts")
+		cmd := exec.Command(ffmpegPath, "-f", "lavfi", "-i", "testsrc=duration=1:size=64x64:rate=10", "-c:v", "mpeg4", "-f", "mpegts", src)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("failed to create the source: %v\n%s", err, out)
+		}
+
+		dst, err := Remux(context.Background(), ffmpegPath, src, RemuxOptions{Format: "mp4", Faststart: faststart})
+		if err != nil {
+			t.Fatal(err)
+		}
+		boxes := topLevelBoxes(t, dst)
+		if moovFirst := slices.Index(boxes, "moov") < slices.Index(boxes, "mdat"); moovFirst != faststart {
+			t.Errorf("faststart=%v\nExpected: moov before mdat=%v\nGot:      %v", faststart, faststart, boxes)
+		}
+	}
+}
+
+// topLevelBoxes lists the types of the top level mp4 boxes in file order.
+func topLevelBoxes(t *testing.T, path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var boxes []string
+	for offset := 0; offset+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[offset:]))
+		boxes = append(boxes, string(data[offset+4:offset+8]))
+		if size == 1 && offset+16 <= len(data) {
+			size = int(binary.BigEndian.Uint64(data[offset+8:]))
+		}
+		if size < 8 {
+			break
+		}
+		offset += size
+	}
+	return boxes
+}
+
+func TestRemuxTargetExists(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.ts")
+	os.WriteFile(src, nil, 0644)
+	os.WriteFile(filepath.Join(dir, "a.mp4"), nil, 0644)
+
+	// ffmpeg isn't needed, the existing target is found before it runs
+	if _, err := Remux(context.Background(), "ffmpeg-not-there", src, RemuxOptions{Format: "mp4", DeleteSource: true}); !errors.Is(err, ErrTargetExists) {
+		t.Errorf("\nExpected: %v\nGot:      %v", ErrTargetExists, err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("the source must be kept: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultUserAgent is sent by the browser and the downloads alike, some hosters reject requests if the two don't match.
+const DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36"
+
+// ErrStalled is returned by a response body that didn't deliver any data for Config.StallTimeout.
+var ErrStalled = errors.New("connection stalled")
+
+// Config holds the tuning knobs of the shared client.
+type Config struct {
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration
+	// StallTimeout aborts a response body if a single read takes longer, 0 disables it.
+	StallTimeout        time.Duration
+	MaxIdleConnsPerHost int
+	// DisableHTTP2 forces HTTP/1.1, some CDNs misbehave with HTTP/2.
+	DisableHTTP2 bool
+	// Proxy routes every request through a proxy, see ParseProxy. nil uses HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+	Proxy *url.URL
+	// AcceptLanguage is sent with every request that doesn't set it, so the downloads match the locale of the
+	// browser. Empty sends none.
+	AcceptLanguage string
+	// Simulation injects latency, a bandwidth cap and failures for debugging, nil uses the network as it is.
+	Simulation *Simulation
+}
+
+func DefaultConfig() Config {
+	return Config{
+		DialTimeout:           15 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		StallTimeout:          60 * time.Second,
+		// HLS downloads fetch lots of small segments from the same host.
+		MaxIdleConnsPerHost: 16,
+	}
+}
+
+var (
+	mu            sync.RWMutex
+	defaultClient = New(DefaultConfig())
+)
+
+// Default returns the client shared by the downloader, the extractors and the asset downloads.
+func Default() *http.Client {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultClient
+}
+
+// SetDefault replaces the shared client, e.g. with one built from the command line flags or a stub in tests.
+func SetDefault(c *http.Client) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultClient = c
+}
+
+// New builds a client with a tuned transport. There is no overall timeout, as downloads can take hours,
+// stalled connections are caught by the StallTimeout instead.
+func New(cfg Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   cfg.DialTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     !cfg.DisableHTTP2,
+	}
+	if cfg.Proxy != nil {
+		transport.Proxy = http.ProxyURL(cfg.Proxy)
+	}
+	if cfg.DisableHTTP2 {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		transport.Protocols = protocols
+	}
+
+	var rt http.RoundTripper = transport
+	if cfg.AcceptLanguage != "" {
+		rt = &languageTransport{base: rt, acceptLanguage: cfg.AcceptLanguage}
+	}
+	if cfg.Simulation != nil {
+		rt = newSimulateTransport(rt, *cfg.Simulation)
+	}
+	// outside of the simulation, so simulated slow bodies run into it like real ones
+	if cfg.StallTimeout > 0 {
+		rt = &stallTransport{base: rt, timeout: cfg.StallTimeout}
+	}
+
+	return &http.Client{Transport: rt}
+}
+
+// stallTransport cancels a request if reading its body hangs, the transport itself only has timeouts until the headers arrive.
+type stallTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *stallTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+
+	resp.Body = &stallBody{
+		body:    resp.Body,
+		ctx:     ctx,
+		cancel:  cancel,
+		timeout: t.timeout,
+	}
+	return resp, nil
+}
+
+type stallBody struct {
+	body    io.ReadCloser
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timeout time.Duration
+}
+
+func (b *stallBody) Read(p []byte) (int, error) {
+	// only the time spent inside Read counts, so slow consumers like the rate limiter don't trigger it.
+	timer := time.AfterFunc(b.timeout, func() { b.cancel(ErrStalled) })
+	n, err := b.body.Read(p)
+	timer.Stop()
+
+	if err != nil && errors.Is(context.Cause(b.ctx), ErrStalled) {
+		return n, ErrStalled
+	}
+	return n, err
+}
+
+func (b *stallBody) Close() error {
+	b.cancel(nil)
+	return b.body.Close()
+}
@@ -0,0 +1,52 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStallTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		pause    time.Duration
+		expected error
+	}{
+		{"stalled", time.Second, ErrStalled},
+		{"slow but alive", 20 * time.Millisecond, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("first"))
+				w.(http.Flusher).Flush()
+				select {
+				case <-time.After(tt.pause):
+				case <-done:
+					return
+				}
+				w.Write([]byte("second"))
+			}))
+			defer server.Close()
+			defer close(done)
+
+			cfg := DefaultConfig()
+			cfg.StallTimeout = 200 * time.Millisecond
+			resp, err := New(cfg).Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			_, err = io.ReadAll(resp.Body)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("\nExpected: %v\nGot:      %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// ParseLocale checks a BCP 47 language tag like "de-DE" and returns it in its usual case.
+func ParseLocale(s string) (string, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "_", "-")
+	if !localePattern.MatchString(s) {
+		return "", fmt.Errorf("invalid locale %q, expected a language tag like de-DE", s)
+	}
+	parts := strings.Split(s, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			parts[i] = strings.ToUpper(parts[i])
+		case 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		}
+	}
+	return strings.Join(parts, "-"), nil
+}
+
+// ParseTimezone checks an IANA time zone like "Europe/Berlin".
+func ParseTimezone(s string) (string, error) {
+	if s == "" || strings.EqualFold(s, "local") {
+		return "", fmt.Errorf("invalid timezone %q, expected an IANA name like Europe/Berlin", s)
+	}
+	if _, err := time.LoadLocation(s); err != nil {
+		return "", fmt.Errorf("invalid timezone %q: %w", s, err)
+	}
+	return s, nil
+}
+
+// AcceptLanguage returns the Accept-Language header Chromium sends for locale, falling back to the language
+// without the region, e.g. "de-DE,de;q=0.9".
+func AcceptLanguage(locale string) string {
+	language, _, hasRegion := strings.Cut(locale, "-")
+	if !hasRegion {
+		return locale
+	}
+	return locale + "," + language + ";q=0.9"
+}
+
+// languageTransport adds an Accept-Language header to the requests that don't have one.
+type languageTransport struct {
+	base           http.RoundTripper
+	acceptLanguage string
+}
+
+func (t *languageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Language") != "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Language", t.acceptLanguage)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,89 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseLocale(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		valid    bool
+	}{
+		{"de-DE", "de-DE", true},
+		{"de_de", "de-DE", true},
+		{"ja", "ja", true},
+		{"zh-hant-tw", "zh-Hant-TW", true},
+		{"es-419", "es-419", true},
+		{"", "", false},
+		{"german", "", false},
+		{"de-", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLocale(tt.input)
+		if (err == nil) != tt.valid || got != tt.expected {
+			t.Errorf("%q\nExpected: %q (valid=%v)\nGot:      %q (%v)", tt.input, tt.expected, tt.valid, got, err)
+		}
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	for _, tz := range []string{"Europe/Berlin", "Asia/Tokyo", "UTC"} {
+		if _, err := ParseTimezone(tz); err != nil {
+			t.Errorf("%q\nExpected: valid\nGot:      %v", tz, err)
+		}
+	}
+	for _, tz := range []string{"", "Local", "Europe/Atlantis", "+02:00"} {
+		if _, err := ParseTimezone(tz); err == nil {
+			t.Errorf("%q\nExpected: an error\nGot:      valid", tz)
+		}
+	}
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		locale   string
+		expected string
+	}{
+		{"de-DE", "de-DE,de;q=0.9"},
+		{"ja", "ja"},
+	}
+	for _, tt := range tests {
+		if got := AcceptLanguage(tt.locale); got != tt.expected {
+			t.Errorf("%q\nExpected: %q\nGot:      %q", tt.locale, tt.expected, got)
+		}
+	}
+}
+
+func TestConfigAcceptLanguage(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Accept-Language"))
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.AcceptLanguage = "de-DE,de;q=0.9"
+	client := New(cfg)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	// a header set by the request is kept
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Accept-Language", "en")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if len(got) != 2 || got[0] != "de-DE,de;q=0.9" || got[1] != "en" {
+		t.Errorf("\nExpected: [de-DE,de;q=0.9 en]\nGot:      %q", got)
+	}
+}
@@ -0,0 +1,126 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how Do retries requests that failed for a transient reason.
+type RetryPolicy struct {
+	// Attempts is the number of requests including the first one, values below 1 send it once
+	Attempts int
+	// BaseDelay is the wait before the second attempt, it doubles with every further attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the wait. A Retry-After asking for more is not waited for, the response is returned instead.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used for metadata requests like the GitHub API and hoster pages. It gives up after a few
+// seconds, the callers have fallbacks for failed requests.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+
+// Do sends req with the shared client and DefaultRetryPolicy, see DoWithPolicy.
+func Do(req *http.Request) (*http.Response, error) {
+	return DoWithPolicy(Default(), req, DefaultRetryPolicy)
+}
+
+// DoWithPolicy sends req and retries connection errors, 429 and 5xx responses until policy.Attempts are used up.
+// The waits grow exponentially with up to half of them added as jitter, so clients don't retry in lockstep.
+// A Retry-After header is honored instead. The last response is returned as it is, so callers keep handling
+// the status themselves. Requests with a body are only retried if it can be recreated through req.GetBody.
+func DoWithPolicy(c *http.Client, req *http.Request, policy RetryPolicy) (*http.Response, error) {
+	ctx := req.Context()
+	attempts := max(policy.Attempts, 1)
+	if req.Body != nil && req.GetBody == nil {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.Do(req)
+		if attempt == attempts || ctx.Err() != nil || !retryable(resp, err) {
+			return resp, err
+		}
+
+		delay := backoff(policy, attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp, time.Now()); ok {
+				if policy.MaxDelay > 0 && after > policy.MaxDelay {
+					return resp, nil
+				}
+				delay = after
+			}
+			resp.Body.Close()
+		}
+		slog.Debug("Request failed, retrying", "url", req.URL.Redacted(), "attempt", attempt, "attempts", attempts, "delay", delay, "status", status(resp), "error", err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryable reports whether the request may succeed if it is sent again.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// backoff returns the wait after the given failed attempt, between BaseDelay*2^(attempt-1) and 1.5 times that.
+func backoff(policy RetryPolicy, attempt int) time.Duration {
+	delay := policy.BaseDelay << (attempt - 1)
+	if delay > 0 {
+		delay += rand.N(delay/2 + 1)
+	}
+	if policy.MaxDelay > 0 {
+		delay = min(delay, policy.MaxDelay)
+	}
+	return delay
+}
+
+// retryAfter parses the Retry-After header of resp, it is either a number of seconds or an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// rewind returns a copy of req with a fresh body for the next attempt.
+func rewind(req *http.Request) (*http.Request, error) {
+	next := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+	return next, nil
+}
+
+func status(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
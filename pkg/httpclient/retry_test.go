@@ -0,0 +1,78 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoWithPolicy(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		name     string
+		statuses []int
+		header   string
+		expected int
+		requests int32
+	}{
+		{"429 then 200", []int{http.StatusTooManyRequests, http.StatusOK}, "0", http.StatusOK, 2},
+		{"server errors", []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, "", http.StatusOK, 3},
+		{"attempts used up", []int{http.StatusServiceUnavailable}, "", http.StatusServiceUnavailable, 3},
+		{"not found", []int{http.StatusNotFound}, "", http.StatusNotFound, 1},
+		{"retry after too long", []int{http.StatusTooManyRequests, http.StatusOK}, "3600", http.StatusTooManyRequests, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(requests.Add(1))
+				if body, _ := io.ReadAll(r.Body); string(body) != "hash=1" {
+					t.Errorf("\nExpected: %q\nGot:      %q", "hash=1", body)
+				}
+				if tt.header != "" {
+					w.Header().Set("Retry-After", tt.header)
+				}
+				w.WriteHeader(tt.statuses[min(n, len(tt.statuses))-1])
+			}))
+			defer server.Close()
+
+			req, _ := http.NewRequest("POST", server.URL, strings.NewReader("hash=1"))
+			resp, err := DoWithPolicy(server.Client(), req, policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.expected || requests.Load() != tt.requests {
+				t.Errorf("\nExpected: %d after %d requests\nGot:      %d after %d", tt.expected, tt.requests, resp.StatusCode, requests.Load())
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header   string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("Retry-After", tt.header)
+		if got, ok := retryAfter(resp, now); got != tt.expected || ok != tt.ok {
+			t.Errorf("%q\nExpected: %v %v\nGot:      %v %v", tt.header, tt.expected, tt.ok, got, ok)
+		}
+	}
+}
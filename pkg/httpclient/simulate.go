@@ -0,0 +1,133 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrSimulated is the connection error of a request failed by a Simulation.
+var ErrSimulated = errors.New("simulated connection failure")
+
+// simulatedChunk is the most a simulated body returns per read, so the rate cap is smooth for small rates as well.
+const simulatedChunk = 16 * 1024
+
+// Simulation makes the client behave like a bad network, to reproduce timing and retry bugs. It is meant for
+// debugging only. Decisions are drawn from a random source seeded with Seed, so with one download at a time the
+// same requests fail on every run.
+type Simulation struct {
+	// Latency is added before every response
+	Latency time.Duration
+	// Rate caps every response body to this many bytes per second, 0 doesn't limit it
+	Rate float64
+	// Fail is the chance of a request failing with a connection error before it is sent
+	Fail float64
+	// Drop is the chance of a response body ending early with io.ErrUnexpectedEOF, like a connection reset while downloading
+	Drop float64
+	Seed uint64
+}
+
+// simulateTransport injects the faults of a Simulation into the requests of base.
+type simulateTransport struct {
+	base http.RoundTripper
+	sim  Simulation
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newSimulateTransport(base http.RoundTripper, sim Simulation) *simulateTransport {
+	return &simulateTransport{base: base, sim: sim, rng: rand.New(rand.NewPCG(sim.Seed, sim.Seed))}
+}
+
+// roll returns whether an event with the given chance happens and a random fraction for where it happens.
+func (t *simulateTransport) roll(chance float64) (bool, float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rng.Float64() < chance, t.rng.Float64()
+}
+
+func (t *simulateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	// both rolls are taken for every request, so one decision doesn't shift the ones of later requests
+	fail, _ := t.roll(t.sim.Fail)
+	drop, at := t.roll(t.sim.Drop)
+
+	if err := sleepContext(ctx, t.sim.Latency); err != nil {
+		return nil, err
+	}
+	if fail {
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Redacted(), ErrSimulated)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body := &simulatedBody{body: resp.Body, ctx: ctx, rate: t.sim.Rate, dropAt: -1, start: time.Now()}
+	if drop {
+		size := resp.ContentLength
+		if size <= 0 {
+			size = 1 << 20
+		}
+		body.dropAt = int64(at * float64(size))
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+type simulatedBody struct {
+	body   io.ReadCloser
+	ctx    context.Context
+	rate   float64
+	dropAt int64
+	start  time.Time
+	read   int64
+}
+
+func (b *simulatedBody) Read(p []byte) (int, error) {
+	if b.dropAt >= 0 && b.read >= b.dropAt {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if b.rate > 0 && len(p) > simulatedChunk {
+		p = p[:simulatedChunk]
+	}
+	if b.dropAt >= 0 && int64(len(p)) > b.dropAt-b.read {
+		p = p[:b.dropAt-b.read]
+	}
+
+	n, err := b.body.Read(p)
+	b.read += int64(n)
+	if b.rate > 0 && n > 0 {
+		// wait until the bytes read so far fit the rate
+		due := b.start.Add(time.Duration(float64(b.read) / b.rate * float64(time.Second)))
+		if sleepErr := sleepContext(b.ctx, time.Until(due)); sleepErr != nil {
+			return n, sleepErr
+		}
+	}
+	return n, err
+}
+
+func (b *simulatedBody) Close() error {
+	return b.body.Close()
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,82 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimulationSeed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 1000)))
+	}))
+	defer server.Close()
+
+	// which of the requests fail or get cut short
+	run := func(seed uint64) string {
+		cfg := DefaultConfig()
+		cfg.Simulation = &Simulation{Fail: 0.3, Drop: 0.3, Seed: seed}
+		client := New(cfg)
+
+		var outcome strings.Builder
+		for range 20 {
+			resp, err := client.Get(server.URL)
+			if errors.Is(err, ErrSimulated) {
+				outcome.WriteByte('F')
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				outcome.WriteByte('D')
+			} else {
+				outcome.WriteByte('.')
+			}
+		}
+		return outcome.String()
+	}
+
+	first, second := run(42), run(42)
+	if first != second {
+		t.Errorf("\nExpected: %s\nGot:      %s", first, second)
+	}
+	if !strings.Contains(first, "F") || !strings.Contains(first, "D") || !strings.Contains(first, ".") {
+		t.Errorf("\nExpected: failed, dropped and complete requests\nGot:      %s", first)
+	}
+	if other := run(7); other == first {
+		t.Errorf("\nExpected: another seed to fail other requests\nGot:      %s", other)
+	}
+}
+
+func TestSimulationRate(t *testing.T) {
+	body := strings.Repeat("x", 50_000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.Simulation = &Simulation{Latency: 50 * time.Millisecond, Rate: 250_000}
+	start := time.Now()
+	resp, err := New(cfg).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil || string(data) != body {
+		t.Fatalf("\nExpected: the whole body\nGot:      %d bytes (%v)", len(data), err)
+	}
+
+	// 50ms latency and 200ms for 50 kB at 250 kB/s
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("\nExpected: at least 250ms\nGot:      %s", elapsed)
+	}
+}
@@ -13,11 +13,15 @@ import (
 // LevelTrace is a custom log level for trace logs.
 const LevelTrace = slog.LevelDebug - 4
 
+// LevelSummary is for the summary at the end of a run. It looks like info, but is still shown with --quiet.
+const LevelSummary = slog.LevelInfo + 2
+
 // Level names and colors
 var levelNames = map[slog.Level]string{
 	LevelTrace:      "TRACE",
 	slog.LevelDebug: "DEBUG",
 	slog.LevelInfo:  "INFO ",
+	LevelSummary:    "INFO ",
 	slog.LevelWarn:  "WARN ",
 	slog.LevelError: "ERROR",
 }
@@ -26,18 +30,42 @@ var levelColors = map[slog.Level]*color.Color{
 	LevelTrace:      color.New(color.FgMagenta),
 	slog.LevelDebug: color.New(color.FgBlue),
 	slog.LevelInfo:  color.New(color.FgGreen),
+	LevelSummary:    color.New(color.FgGreen),
 	slog.LevelWarn:  color.New(color.FgYellow),
 	slog.LevelError: color.New(color.FgRed),
 }
 
+// DefaultTimeFormat is short for interactive use, the date is left out.
+const DefaultTimeFormat = "15:04:05.000"
+
+// UTCTimeFormat is used with UTC timestamps, as those are usually compared with logs of other systems.
+const UTCTimeFormat = "2006-01-02T15:04:05.000Z"
+
 // CustomHandler is a custom slog handler for pretty printing.
 type CustomHandler struct {
-	w    io.Writer
-	opts slog.HandlerOptions
+	w          io.Writer
+	opts       slog.HandlerOptions
+	timeFormat string
+	utc        bool
 }
 
 func NewCustomHandler(w io.Writer, opts slog.HandlerOptions) *CustomHandler {
-	return &CustomHandler{w: w, opts: opts}
+	return &CustomHandler{w: w, opts: opts, timeFormat: DefaultTimeFormat}
+}
+
+// SetTimeFormat changes the layout of the timestamps, see time.Layout. An empty layout keeps the default,
+// which is UTCTimeFormat if utc is set.
+func (h *CustomHandler) SetTimeFormat(layout string, utc bool) *CustomHandler {
+	h.utc = utc
+	switch {
+	case layout != "":
+		h.timeFormat = layout
+	case utc:
+		h.timeFormat = UTCTimeFormat
+	default:
+		h.timeFormat = DefaultTimeFormat
+	}
+	return h
 }
 
 func (h *CustomHandler) Enabled(_ context.Context, level slog.Level) bool {
@@ -58,7 +86,11 @@ func (h *CustomHandler) Handle(_ context.Context, r slog.Record) error {
 		levelStr = levelName
 	}
 
-	timeStr := r.Time.Format("15:04:05.000")
+	t := r.Time
+	if h.utc {
+		t = t.UTC()
+	}
+	timeStr := t.Format(h.timeFormat)
 
 	fmt.Fprintf(h.w, "%s %s > %s", timeStr, levelStr, r.Message)
 	r.Attrs(func(a slog.Attr) bool {
@@ -77,13 +109,9 @@ func (h *CustomHandler) WithGroup(name string) slog.Handler {
 	return h // Simplified for now
 }
 
-// InitDefaultLogger initializes the global logger with the specified debug level.
-func InitDefaultLogger(debug bool, logFilePath string) {
-	level := slog.LevelInfo
-	if debug {
-		level = slog.LevelDebug
-	}
-
+// InitDefaultLogger initializes the global logger with the minimum level and timestamp format,
+// see CustomHandler.SetTimeFormat.
+func InitDefaultLogger(level slog.Level, logFilePath string, timeFormat string, utc bool) {
 	var writer io.Writer = os.Stderr
 
 	// only write to file if user set logfile path
@@ -101,7 +129,7 @@ func InitDefaultLogger(debug bool, logFilePath string) {
 
 	handler := NewCustomHandler(writer, slog.HandlerOptions{
 		Level: level,
-	})
+	}).SetTimeFormat(timeFormat, utc)
 
 	slog.SetDefault(slog.New(handler))
 }
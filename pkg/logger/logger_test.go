@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeFormat(t *testing.T) {
+	// 12:30 in UTC, 14:30 in the +2 zone
+	zone := time.FixedZone("test", 2*60*60)
+	at := time.Date(2026, 3, 1, 14, 30, 15, 250*int(time.Millisecond), zone)
+
+	tests := []struct {
+		layout   string
+		utc      bool
+		expected string
+	}{
+		{"", false, "14:30:15.250"},
+		{"", true, "2026-03-01T12:30:15.250Z"},
+		{"2006-01-02 15:04", false, "2026-03-01 14:30"},
+		{"15:04", true, "12:30"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		h := NewCustomHandler(&buf, slog.HandlerOptions{}).SetTimeFormat(tt.layout, tt.utc)
+		h.Handle(context.Background(), slog.NewRecord(at, slog.LevelInfo, "message", 0))
+
+		if !strings.HasPrefix(buf.String(), tt.expected+" ") {
+			t.Errorf("\nExpected: %s ...\nGot:      %s", tt.expected, buf.String())
+		}
+	}
+}
+
+func TestLevelSummary(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewCustomHandler(&buf, slog.HandlerOptions{Level: LevelSummary})
+	if h.Enabled(context.Background(), slog.LevelInfo) || !h.Enabled(context.Background(), LevelSummary) {
+		t.Error("expected only the summary to pass the --quiet level")
+	}
+
+	// it looks like any other info line
+	h.Handle(context.Background(), slog.NewRecord(time.Now(), LevelSummary, "Done!", 0))
+	if !strings.Contains(buf.String(), "INFO  > Done!") {
+		t.Errorf("\nExpected: INFO  > Done!\nGot:      %s", buf.String())
+	}
+}
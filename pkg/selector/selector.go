@@ -0,0 +1,211 @@
+package selector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrAborted is returned if the user quit the selection.
+var ErrAborted = errors.New("selection aborted")
+
+// maxVisibleRows limits how many entries are drawn at once, long lists scroll with the cursor.
+const maxVisibleRows = 15
+
+type key int
+
+const (
+	keyUnknown key = iota
+	keyUp
+	keyDown
+	keyToggle
+	keyToggleAll
+	keyConfirm
+	keyAbort
+)
+
+// IsInteractive reports whether stdin and stdout are both terminals, which is required for the selectors.
+func IsInteractive() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// MultiSelect shows a checklist and returns the indices of the selected items in order.
+// Arrow keys (or j/k) move, space toggles, a toggles everything and enter confirms.
+func MultiSelect(title string, items []string, preselected bool) ([]int, error) {
+	selected := make([]bool, len(items))
+	for i := range selected {
+		selected[i] = preselected
+	}
+
+	hint := "↑/↓ move, space select, a all, enter confirm, q quit"
+	err := run(title, hint, len(items), func(cursor int, k key) bool {
+		switch k {
+		case keyToggle:
+			selected[cursor] = !selected[cursor]
+		case keyToggleAll:
+			all := true
+			for _, s := range selected {
+				all = all && s
+			}
+			for i := range selected {
+				selected[i] = !all
+			}
+		case keyConfirm:
+			return true
+		}
+		return false
+	}, func(i int) string {
+		box := "[ ]"
+		if selected[i] {
+			box = "[x]"
+		}
+		return fmt.Sprintf("%s %s", box, items[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []int
+	for i, s := range selected {
+		if s {
+			result = append(result, i)
+		}
+	}
+	return result, nil
+}
+
+// SingleSelect shows a list of options and returns the index of the chosen one.
+func SingleSelect(title string, options []string, initial int) (int, error) {
+	chosen := initial
+	hint := "↑/↓ move, enter confirm, q quit"
+	err := run(title, hint, len(options), func(cursor int, k key) bool {
+		if k == keyConfirm || k == keyToggle {
+			chosen = cursor
+			return true
+		}
+		return false
+	}, func(i int) string {
+		return options[i]
+	})
+	return chosen, err
+}
+
+// run draws the list and feeds key presses to onKey until it returns true.
+func run(title, hint string, count int, onKey func(cursor int, k key) bool, label func(i int) string) error {
+	if count == 0 {
+		return nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to switch terminal to raw mode: %w", err)
+	}
+	defer term.Restore(fd, oldState)
+
+	out := os.Stdout
+	in := bufio.NewReader(os.Stdin)
+
+	// hide the cursor while drawing
+	fmt.Fprint(out, "\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h")
+
+	cursor := 0
+	drawnLines := 0
+	for {
+		drawnLines = draw(out, title, hint, count, cursor, drawnLines, label)
+
+		k, err := readKey(in)
+		if err != nil {
+			return err
+		}
+
+		switch k {
+		case keyUp:
+			cursor = (cursor - 1 + count) % count
+		case keyDown:
+			cursor = (cursor + 1) % count
+		case keyAbort:
+			return ErrAborted
+		default:
+			if onKey(cursor, k) {
+				return nil
+			}
+		}
+	}
+}
+
+func draw(out io.Writer, title, hint string, count, cursor, previousLines int, label func(i int) string) int {
+	// move back to the start of the previous frame and clear it
+	if previousLines > 0 {
+		fmt.Fprintf(out, "\x1b[%dA", previousLines)
+	}
+	fmt.Fprint(out, "\r\x1b[J")
+
+	start := 0
+	if count > maxVisibleRows {
+		start = cursor - maxVisibleRows/2
+		start = max(0, min(start, count-maxVisibleRows))
+	}
+	end := min(count, start+maxVisibleRows)
+
+	var sb strings.Builder
+	sb.WriteString(title + "\r\n")
+	lines := 1
+	for i := start; i < end; i++ {
+		pointer := "  "
+		if i == cursor {
+			pointer = "> "
+		}
+		sb.WriteString(pointer + label(i) + "\r\n")
+		lines++
+	}
+	sb.WriteString(fmt.Sprintf("(%d/%d) %s\r\n", cursor+1, count, hint))
+	lines++
+
+	fmt.Fprint(out, sb.String())
+	return lines
+}
+
+func readKey(in *bufio.Reader) (key, error) {
+	b, err := in.ReadByte()
+	if err != nil {
+		return keyUnknown, err
+	}
+
+	switch b {
+	case 3, 'q': // ctrl+c is not delivered as a signal in raw mode
+		return keyAbort, nil
+	case '\r', '\n':
+		return keyConfirm, nil
+	case ' ':
+		return keyToggle, nil
+	case 'a':
+		return keyToggleAll, nil
+	case 'k':
+		return keyUp, nil
+	case 'j':
+		return keyDown, nil
+	case 0x1b:
+		// arrow keys are sent as ESC [ A / ESC [ B
+		if next, err := in.ReadByte(); err != nil || next != '[' {
+			return keyUnknown, err
+		}
+		code, err := in.ReadByte()
+		if err != nil {
+			return keyUnknown, err
+		}
+		switch code {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		}
+	}
+	return keyUnknown, nil
+}
@@ -0,0 +1,345 @@
+package selfupdate
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/bugmaschine/gad/pkg/download"
+	"github.com/bugmaschine/gad/pkg/httpclient"
+	"github.com/bugmaschine/gad/pkg/utils"
+)
+
+// GithubAPIURL is the latest release of gad, its assets are built by the release workflow.
+const GithubAPIURL = "https://api.github.com/repos/bugmaschine/gad/releases/latest"
+
+// checksumSuffix is appended to the asset name for the file holding its SHA-256 in the format of sha256sum.
+const checksumSuffix = ".sha256"
+
+// Downloader is an interface that matches the required functionality for downloading a release.
+type Downloader interface {
+	DownloadToFile(ctx context.Context, task *download.DownloadTask) error
+}
+
+// Release is the asset of the latest release for this platform.
+type Release struct {
+	Version     string
+	AssetName   string
+	AssetURL    string
+	ChecksumURL string
+}
+
+// Latest asks GitHub for the latest release and picks the asset of the running platform.
+func Latest(ctx context.Context, apiURL string) (*Release, error) {
+	suffix, err := assetSuffix(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status from github: %s", resp.Status)
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, err
+	}
+	return release.pick(suffix)
+}
+
+type githubRelease struct {
+	TagName string        `json:"tag_name"`
+	Assets  []githubAsset `json:"assets"`
+}
+
+type githubAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// pick returns the asset ending in suffix together with its checksum file. Releases without a checksum aren't
+// installed, there would be no way to tell a broken download apart.
+func (r *githubRelease) pick(suffix string) (*Release, error) {
+	if r.TagName == "" {
+		return nil, fmt.Errorf("missing tag in github response")
+	}
+	release := &Release{Version: strings.TrimPrefix(r.TagName, "v")}
+
+	urls := make(map[string]string, len(r.Assets))
+	for _, asset := range r.Assets {
+		urls[asset.Name] = asset.BrowserDownloadURL
+		if strings.HasSuffix(asset.Name, suffix) {
+			release.AssetName = asset.Name
+			release.AssetURL = asset.BrowserDownloadURL
+		}
+	}
+	if release.AssetURL == "" {
+		return nil, fmt.Errorf("release %s has no build for %s/%s", r.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	release.ChecksumURL = urls[release.AssetName+checksumSuffix]
+	if release.ChecksumURL == "" {
+		return nil, fmt.Errorf("release %s has no checksum for %s", r.TagName, release.AssetName)
+	}
+	return release, nil
+}
+
+// assetSuffix returns the end of the asset name the release workflow uses for the platform.
+func assetSuffix(goos, goarch string) (string, error) {
+	switch goos + "/" + goarch {
+	case "linux/amd64":
+		return "-linux-amd64.gz", nil
+	case "darwin/arm64":
+		return "-darwin-arm64.gz", nil
+	case "windows/amd64":
+		return "-windows-x64.zip", nil
+	}
+	return "", fmt.Errorf("there are no release builds for %s/%s", goos, goarch)
+}
+
+// IsNewer reports whether latest is a higher version than current, both dot separated numbers like "0.2.7".
+// Versions that can't be compared, e.g. "dev", are never newer.
+func IsNewer(latest, current string) bool {
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	c, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	for i := range max(len(l), len(c)) {
+		var a, b int
+		if i < len(l) {
+			a = l[i]
+		}
+		if i < len(c) {
+			b = c[i]
+		}
+		if a != b {
+			return a > b
+		}
+	}
+	return false
+}
+
+// parseVersion splits a version into its numbers, a pre-release or build suffix like "-rc1" is ignored.
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "-")
+	v, _, _ = strings.Cut(v, "+")
+
+	var parts []int
+	for part := range strings.SplitSeq(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
+
+// Install downloads the release next to the executable at exePath, verifies its checksum, checks that the new
+// binary runs and replaces the executable with it.
+func Install(ctx context.Context, downloader Downloader, release *Release, exePath string) error {
+	dir := filepath.Dir(exePath)
+	archivePath := filepath.Join(dir, release.AssetName)
+	checksumPath := archivePath + checksumSuffix
+	defer utils.RemoveFileIgnoreNotExists(archivePath)
+	defer utils.RemoveFileIgnoreNotExists(checksumPath)
+
+	for _, file := range []struct{ path, url, message string }{
+		{checksumPath, release.ChecksumURL, "Downloading checksum"},
+		{archivePath, release.AssetURL, "Downloading gad " + release.Version},
+	} {
+		task := download.NewDownloadTask(file.path, file.url).
+			SetOverwriteFile(true).
+			SetCustomMessage(file.message)
+		task.OutputPathHasExtension = true
+		if err := downloader.DownloadToFile(ctx, task); err != nil {
+			return fmt.Errorf("failed to download %s: %w", filepath.Base(file.path), err)
+		}
+	}
+
+	checksum, err := os.ReadFile(checksumPath)
+	if err != nil {
+		return err
+	}
+	expected, err := parseChecksum(checksum, release.AssetName)
+	if err != nil {
+		return err
+	}
+	if err := verifyChecksum(archivePath, expected); err != nil {
+		return err
+	}
+
+	newPath := exePath + ".new"
+	defer utils.RemoveFileIgnoreNotExists(newPath)
+	if err := unpack(archivePath, newPath); err != nil {
+		return err
+	}
+	if err := exec.CommandContext(ctx, newPath, "version").Run(); err != nil {
+		return fmt.Errorf("downloaded gad doesn't run: %w", err)
+	}
+	return replace(exePath, newPath)
+}
+
+// parseChecksum returns the hash for name from a file in the format of sha256sum. A single hash without a name
+// is accepted as well.
+func parseChecksum(data []byte, name string) (string, error) {
+	for line := range strings.Lines(string(data)) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+			continue
+		}
+		if len(fields) == 1 || strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum for %s", name)
+}
+
+func verifyChecksum(path, expected string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != expected {
+		return fmt.Errorf("checksum mismatch for %s, expected %s, got %s", filepath.Base(path), expected, got)
+	}
+	return nil
+}
+
+// unpack writes the executable of the gzip or zip archive at src to dst.
+func unpack(src, dst string) error {
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	if strings.HasSuffix(src, ".zip") {
+		err = unzipExecutable(src, out)
+	} else {
+		err = gunzip(src, out)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unpack %s: %w", filepath.Base(src), err)
+	}
+	return nil
+}
+
+func gunzip(src string, dst io.Writer) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(dst, reader)
+	return err
+}
+
+// unzipExecutable copies the first .exe of the zip at src, the Windows release only holds gad itself.
+func unzipExecutable(src string, dst io.Writer) error {
+	archive, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if !strings.EqualFold(filepath.Ext(file.Name), ".exe") {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		_, err = io.Copy(dst, reader)
+		return err
+	}
+	return fmt.Errorf("no executable in archive")
+}
+
+// replace moves newPath over exePath. A rename within the directory is atomic, so exePath is always either the
+// old or the new binary. Windows doesn't allow replacing a running executable but renaming it, so the old one is
+// moved aside first and removed by RemoveOld on the next run.
+func replace(exePath, newPath string) error {
+	if runtime.GOOS != "windows" {
+		return os.Rename(newPath, exePath)
+	}
+
+	oldPath := oldExecutable(exePath)
+	utils.RemoveFileIgnoreNotExists(oldPath)
+	if err := os.Rename(exePath, oldPath); err != nil {
+		return fmt.Errorf("failed to move the running executable aside: %w", err)
+	}
+	if err := os.Rename(newPath, exePath); err != nil {
+		// put the old one back, otherwise there is no gad at all
+		if restoreErr := os.Rename(oldPath, exePath); restoreErr != nil {
+			return fmt.Errorf("failed to replace the executable: %w, the old one is at %s", err, oldPath)
+		}
+		return fmt.Errorf("failed to replace the executable: %w", err)
+	}
+	return nil
+}
+
+// RemoveOld deletes the executable an update on Windows left behind, it can only be removed once it isn't running.
+func RemoveOld(exePath string) {
+	utils.RemoveFileIgnoreNotExists(oldExecutable(exePath))
+}
+
+func oldExecutable(exePath string) string {
+	return exePath + ".old"
+}
+
+// Executable returns the path of the running gad with symlinks resolved, so the target gets replaced and not the link.
+func Executable() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(path)
+}
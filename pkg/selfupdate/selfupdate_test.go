@@ -0,0 +1,147 @@
+package selfupdate
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsNewer(t *testing.T) {
+	tests := []struct {
+		latest   string
+		current  string
+		expected bool
+	}{
+		{"0.2.8", "0.2.7", true},
+		{"v0.3.0", "0.2.10", true},
+		{"0.2.10", "0.2.9", true},
+		{"0.2.7", "0.2.7", false},
+		{"0.2.7", "0.2.8", false},
+		{"0.3", "0.2.9", true},
+		{"0.2.7.1", "0.2.7", true},
+		{"0.2.8-rc1", "0.2.7", true},
+		{"0.2.8", "dev", false},
+		{"latest", "0.2.7", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsNewer(tt.latest, tt.current); got != tt.expected {
+			t.Errorf("%s > %s\nExpected: %v\nGot:      %v", tt.latest, tt.current, tt.expected, got)
+		}
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{sum + "  gad-0.2.8-linux-amd64.gz\n", sum},
+		{sum + " *gad-0.2.8-linux-amd64.gz\n", sum},
+		{strings.ToUpper(sum) + "\n", sum},
+		{strings.Repeat("cd", 32) + "  gad-0.2.8-darwin-arm64.gz\n" + sum + "  gad-0.2.8-linux-amd64.gz\n", sum},
+		{strings.Repeat("cd", 32) + "  gad-0.2.8-darwin-arm64.gz\n", ""},
+		{"not a checksum\n", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := parseChecksum([]byte(tt.data), "gad-0.2.8-linux-amd64.gz")
+		if tt.expected == "" {
+			if err == nil {
+				t.Errorf("%q\nExpected: an error\nGot:      %s", tt.data, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.expected {
+			t.Errorf("%q\nExpected: %s\nGot:      %s (%v)", tt.data, tt.expected, got, err)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	release := &githubRelease{TagName: "v0.2.8"}
+	for _, name := range []string{"gad-0.2.8-linux-amd64.gz", "gad-0.2.8-windows-x64.zip"} {
+		release.Assets = append(release.Assets, githubAsset{name, "https://example.com/" + name})
+	}
+
+	if _, err := release.pick("-linux-amd64.gz"); err == nil {
+		t.Errorf("\nExpected: an error without a checksum\nGot:      %v", err)
+	}
+
+	release.Assets = append(release.Assets, githubAsset{"gad-0.2.8-linux-amd64.gz.sha256", "https://example.com/sum"})
+
+	got, err := release.pick("-linux-amd64.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Release{
+		Version:     "0.2.8",
+		AssetName:   "gad-0.2.8-linux-amd64.gz",
+		AssetURL:    "https://example.com/gad-0.2.8-linux-amd64.gz",
+		ChecksumURL: "https://example.com/sum",
+	}
+	if *got != expected {
+		t.Errorf("\nExpected: %+v\nGot:      %+v", expected, *got)
+	}
+
+	if _, err := release.pick("-darwin-arm64.gz"); err == nil {
+		t.Errorf("\nExpected: an error for a missing platform\nGot:      %v", err)
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("binary")
+
+	gzPath := filepath.Join(dir, "gad-linux-amd64.gz")
+	gzFile, _ := os.Create(gzPath)
+	gz := gzip.NewWriter(gzFile)
+	gz.Write(content)
+	gz.Close()
+	gzFile.Close()
+
+	zipPath := filepath.Join(dir, "gad-windows-x64.zip")
+	zipFile, _ := os.Create(zipPath)
+	zw := zip.NewWriter(zipFile)
+	w, _ := zw.Create("gad-windows-x64.exe")
+	w.Write(content)
+	zw.Close()
+	zipFile.Close()
+
+	for _, src := range []string{gzPath, zipPath} {
+		dst := filepath.Join(dir, "gad.new")
+		if err := unpack(src, dst); err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		got, _ := os.ReadFile(dst)
+		if string(got) != string(content) {
+			t.Errorf("%s\nExpected: %q\nGot:      %q", src, content, got)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	dir := t.TempDir()
+	exePath := filepath.Join(dir, "gad")
+	newPath := exePath + ".new"
+	os.WriteFile(exePath, []byte("old"), 0755)
+	os.WriteFile(newPath, []byte("new"), 0755)
+
+	if err := replace(exePath, newPath); err != nil {
+		t.Fatal(err)
+	}
+	RemoveOld(exePath)
+
+	got, _ := os.ReadFile(exePath)
+	if string(got) != "new" {
+		t.Errorf("\nExpected: %q\nGot:      %q", "new", got)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("\nExpected: only the executable left\nGot:      %d files", len(entries))
+	}
+}
@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -25,6 +28,69 @@ func RemoveDirAllIgnoreNotExists(path string) error {
 	return nil
 }
 
+// PathSize returns the size of a file, or of all files below a directory.
+func PathSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// MoveFile renames src to dst. If that fails, e.g. because they are on different filesystems, the file is copied
+// to a temporary file next to dst and renamed from there, so dst never shows up half written. src is removed afterwards.
+func MoveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, in)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		RemoveFileIgnoreNotExists(tmp.Name())
+		return err
+	}
+
+	in.Close()
+	return RemoveFileIgnoreNotExists(src)
+}
+
 func CleanFolderName(rawName string) string {
 	// i had a script that used sdl to download stuff (basically the queue feature, but more manual), and to make it backwards compatible to that script, i made it clean the titles in a similar way.
 	name := strings.TrimSpace(rawName)
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -73,3 +75,24 @@ func TestCleanFolderName(t *testing.T) {
 		})
 	}
 }
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.mp4")
+	dst := filepath.Join(dir, "b.mp4")
+	os.WriteFile(src, []byte("video"), 0600)
+
+	if err := MoveFile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "video" {
+		t.Errorf("\nExpected: video\nGot:      %s", data)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("the source must be gone: %v", err)
+	}
+
+	if err := MoveFile(src, dst); err == nil {
+		t.Error("expected an error for a missing source")
+	}
+}
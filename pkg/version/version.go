@@ -0,0 +1,82 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// These get overwritten at build time, e.g.
+// go build -ldflags "-X github.com/bugmaschine/gad/pkg/version.Version=0.2.7" ./cmd/gad/main.go
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+type Info struct {
+	Version   string
+	Commit    string
+	Date      string
+	Modified  bool
+	GoVersion string
+	Platform  string
+}
+
+// Get returns the build information. Values that weren't set via ldflags are taken from the vcs info go embeds into the binary.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	// installed with go install, so the module version is the real one
+	if info.Version == "dev" && buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+		info.Version = strings.TrimPrefix(buildInfo.Main.Version, "v")
+	}
+
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.Date == "" {
+				info.Date = setting.Value
+			}
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+
+	return info
+}
+
+func (i Info) String() string {
+	commit := i.Commit
+	if commit == "" {
+		commit = "unknown"
+	} else if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if i.Modified {
+		commit += "-dirty"
+	}
+
+	date := i.Date
+	if date == "" {
+		date = "unknown"
+	}
+
+	return fmt.Sprintf("gad %s (commit %s, built %s, %s %s)", i.Version, commit, date, i.GoVersion, i.Platform)
+}